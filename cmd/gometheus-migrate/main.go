@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/m1khal3v/gometheus/internal/common/logger"
+	"github.com/m1khal3v/gometheus/internal/migrate/app"
+	"github.com/m1khal3v/gometheus/internal/migrate/config"
+	"go.uber.org/zap"
+)
+
+var (
+	buildVersion = "N/A"
+	buildDate    = "N/A"
+	buildCommit  = "N/A"
+)
+
+func main() {
+	config := config.ParseConfig()
+	logger.Init("migrate", config.LogLevel)
+	defer logger.Logger.Sync()
+	defer logger.RecoverAndPanic()
+	logger.Logger.Info(
+		"Starting",
+		// build info is not printed by buildlog, because stdout is used by export
+		zap.String("build_version", buildVersion),
+		zap.String("build_date", buildDate),
+		zap.String("build_commit", buildCommit),
+		zap.String("from_file", config.FromFile),
+		zap.String("from_driver", config.FromDriver),
+		zap.String("to_file", config.ToFile),
+		zap.String("to_driver", config.ToDriver),
+		zap.String("import", config.Import),
+		zap.Bool("export", config.Export),
+		zap.Bool("dry_run", config.DryRun),
+	)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer cancel()
+
+	if err := app.Run(ctx, config, os.Stdin, os.Stdout); err != nil {
+		logger.Logger.Fatal(err.Error())
+	}
+}
@@ -107,3 +107,45 @@ func TransformToGRPCSaveResponse(metric metric.Metric) (*proto.SaveMetricRespons
 	}
 	return nil, newErrUnknownType(metric.Type())
 }
+
+func TransformToGRPCSaveRequest(metric metric.Metric) (*proto.SaveMetricRequest, error) {
+	switch metric.Type() {
+	case gauge.MetricType:
+		value := metric.(*gauge.Metric).GetValue()
+		return &proto.SaveMetricRequest{
+			MetricType: metric.Type(),
+			MetricName: metric.Name(),
+			Value:      wrapperspb.Double(value),
+		}, nil
+	case counter.MetricType:
+		value := metric.(*counter.Metric).GetValue()
+		return &proto.SaveMetricRequest{
+			MetricType: metric.Type(),
+			MetricName: metric.Name(),
+			Delta:      wrapperspb.Int64(value),
+		}, nil
+	}
+	return nil, newErrUnknownType(metric.Type())
+}
+
+func TransformToGRPCMetric(metric metric.Metric, revision uint64) (*proto.Metric, error) {
+	switch metric.Type() {
+	case gauge.MetricType:
+		value := metric.(*gauge.Metric).GetValue()
+		return &proto.Metric{
+			MetricType: metric.Type(),
+			MetricName: metric.Name(),
+			Value:      wrapperspb.Double(value),
+			Revision:   revision,
+		}, nil
+	case counter.MetricType:
+		value := metric.(*counter.Metric).GetValue()
+		return &proto.Metric{
+			MetricType: metric.Type(),
+			MetricName: metric.Name(),
+			Delta:      wrapperspb.Int64(value),
+			Revision:   revision,
+		}, nil
+	}
+	return nil, newErrUnknownType(metric.Type())
+}
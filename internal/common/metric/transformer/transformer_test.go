@@ -6,10 +6,13 @@ import (
 	"github.com/m1khal3v/gometheus/internal/common/metric"
 	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
 	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/pkg/proto"
 	"github.com/m1khal3v/gometheus/pkg/request"
 	"github.com/m1khal3v/gometheus/pkg/response"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	gproto "google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
 	"k8s.io/utils/ptr"
 )
 
@@ -151,6 +154,52 @@ func TestTransformToSaveResponse(t *testing.T) {
 	}
 }
 
+func TestTransformToGRPCSaveRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  metric.Metric
+		want    *proto.SaveMetricRequest
+		wantErr error
+	}{
+		{
+			name:   "counter",
+			metric: counter.New("test", 123),
+			want: &proto.SaveMetricRequest{
+				MetricType: counter.MetricType,
+				MetricName: "test",
+				Delta:      wrapperspb.Int64(123),
+			},
+		},
+		{
+			name:   "gauge",
+			metric: gauge.New("test", 123.321),
+			want: &proto.SaveMetricRequest{
+				MetricType: gauge.MetricType,
+				MetricName: "test",
+				Value:      wrapperspb.Double(123.321),
+			},
+		},
+		{
+			name:    "invalid",
+			metric:  &invalidMetric{},
+			wantErr: newErrUnknownType("invalid"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TransformToGRPCSaveRequest(tt.metric)
+			if tt.wantErr != nil {
+				assert.Nil(t, got)
+				assert.Equal(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				require.NotNil(t, got)
+				assert.True(t, gproto.Equal(tt.want, got))
+			}
+		})
+	}
+}
+
 type invalidMetric struct {
 }
 
@@ -169,3 +218,51 @@ func (metric *invalidMetric) StringValue() string {
 func (metric *invalidMetric) Clone() metric.Metric {
 	return &invalidMetric{}
 }
+
+func TestTransformToGRPCMetric(t *testing.T) {
+	tests := []struct {
+		name    string
+		metric  metric.Metric
+		want    *proto.Metric
+		wantErr error
+	}{
+		{
+			name:   "counter",
+			metric: counter.New("test", 123),
+			want: &proto.Metric{
+				MetricType: counter.MetricType,
+				MetricName: "test",
+				Delta:      wrapperspb.Int64(123),
+				Revision:   7,
+			},
+		},
+		{
+			name:   "gauge",
+			metric: gauge.New("test", 123.321),
+			want: &proto.Metric{
+				MetricType: gauge.MetricType,
+				MetricName: "test",
+				Value:      wrapperspb.Double(123.321),
+				Revision:   7,
+			},
+		},
+		{
+			name:    "invalid",
+			metric:  &invalidMetric{},
+			wantErr: newErrUnknownType("invalid"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := TransformToGRPCMetric(tt.metric, 7)
+			if tt.wantErr != nil {
+				assert.Nil(t, got)
+				assert.Equal(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+				require.NotNil(t, got)
+				assert.True(t, gproto.Equal(tt.want, got))
+			}
+		})
+	}
+}
@@ -0,0 +1,171 @@
+// Package app
+// contains metrics migration between storages, export and import
+package app
+
+import (
+	"context"
+	"errors"
+	"io"
+	"iter"
+	"os"
+
+	"github.com/m1khal3v/gometheus/internal/common/logger"
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/migrate/config"
+	"github.com/m1khal3v/gometheus/internal/migrate/format"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/factory"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrNoSource           = errors.New("source is not defined, set --from-file, --from-dsn or --import")
+	ErrNoDestination      = errors.New("destination is not defined, set --to-file or --to-dsn")
+	ErrAmbiguousStorage   = errors.New("dump file and database dsn cannot be used together")
+	ErrSourceFileNotFound = errors.New("source dump file not found")
+)
+
+// Run copies metrics from source to destination, or exports them to stdout.
+// Source is storage or file to import (stdin if it is "-")
+func Run(ctx context.Context, config *config.Config, stdin io.Reader, stdout io.Writer) error {
+	metricFormat, err := format.ParseFormat(config.Format)
+	if err != nil {
+		return err
+	}
+
+	metrics, closeSource, err := openSource(ctx, config, metricFormat, stdin)
+	if err != nil {
+		return err
+	}
+	defer closeSource()
+
+	if config.Export {
+		count, err := format.Encode(metricFormat, stdout, metrics)
+		logger.Logger.Info("Metrics exported", zap.Int("count", count), zap.String("format", config.Format))
+
+		return err
+	}
+
+	if config.DryRun {
+		count := 0
+		for _, err := range metrics {
+			if err != nil {
+				return err
+			}
+			count++
+		}
+		logger.Logger.Info("Dry run completed, nothing is written", zap.Int("count", count))
+
+		return nil
+	}
+
+	if config.ToFile == "" && config.ToDSN == "" {
+		return ErrNoDestination
+	}
+
+	destination, err := newStorage(ctx, config.ToFile, config.ToDriver, config.ToDSN)
+	if err != nil {
+		return err
+	}
+	defer closeStorage(ctx, destination)
+
+	count, batches, err := copyMetrics(ctx, destination, metrics, config.BatchSize)
+	logger.Logger.Info("Metrics migrated", zap.Int("count", count), zap.Int("batches", batches))
+
+	return err
+}
+
+func openSource(ctx context.Context, config *config.Config, metricFormat format.Format, stdin io.Reader) (iter.Seq2[metric.Metric, error], func(), error) {
+	if config.Import == "-" {
+		return format.Decode(metricFormat, stdin), func() {}, nil
+	}
+
+	if config.Import != "" {
+		file, err := os.Open(config.Import)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		return format.Decode(metricFormat, file), func() { file.Close() }, nil
+	}
+
+	if config.FromFile == "" && config.FromDSN == "" {
+		return nil, nil, ErrNoSource
+	}
+
+	// missing dump is restored as empty storage, so it is checked explicitly
+	if config.FromFile != "" {
+		if _, err := os.Stat(config.FromFile); errors.Is(err, os.ErrNotExist) {
+			return nil, nil, ErrSourceFileNotFound
+		}
+	}
+
+	source, err := newStorage(ctx, config.FromFile, config.FromDriver, config.FromDSN)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	metrics, err := source.GetAll(ctx)
+	if err != nil {
+		closeStorage(ctx, source)
+		return nil, nil, err
+	}
+
+	return metrics, func() { closeStorage(ctx, source) }, nil
+}
+
+// newStorage creates dump file storage restored from file or database storage.
+// Dump restore resets decorated storage, so dump file and database are not combined
+func newStorage(ctx context.Context, file, driver, dsn string) (storage.Storage, error) {
+	if file != "" && dsn != "" {
+		return nil, ErrAmbiguousStorage
+	}
+
+	if file != "" {
+		return factory.New(ctx, file, "", "", 0, true)
+	}
+
+	return factory.New(ctx, "", driver, dsn, 0, false)
+}
+
+func closeStorage(ctx context.Context, storage storage.Storage) {
+	if err := storage.Close(ctx); err != nil {
+		logger.Logger.Error("Failed to close storage", zap.Error(err))
+	}
+}
+
+// copyMetrics saves metrics by batches, returns count of saved metrics and batches
+func copyMetrics(ctx context.Context, destination storage.Storage, metrics iter.Seq2[metric.Metric, error], batchSize int) (int, int, error) {
+	count, batches := 0, 0
+	batch := make([]metric.Metric, 0, batchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		if err := destination.SaveBatch(ctx, batch); err != nil {
+			return err
+		}
+
+		count += len(batch)
+		batches++
+		batch = batch[:0]
+
+		return nil
+	}
+
+	for metric, err := range metrics {
+		if err != nil {
+			return count, batches, err
+		}
+
+		batch = append(batch, metric)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return count, batches, err
+			}
+		}
+	}
+
+	return count, batches, flush()
+}
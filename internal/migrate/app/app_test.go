@@ -0,0 +1,174 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/migrate/config"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/sqlite"
+	"github.com/m1khal3v/gometheus/pkg/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var metrics = []metric.Metric{
+	counter.New("m1", 1),
+	gauge.New("m2", 2.5),
+	counter.New("m3", 3),
+}
+
+func newConfig(modify func(config *config.Config)) *config.Config {
+	config := &config.Config{
+		FromDriver: "sqlite",
+		ToDriver:   "sqlite",
+		Format:     "ndjson",
+		BatchSize:  2,
+	}
+	modify(config)
+
+	return config
+}
+
+func readSqlite(t *testing.T, dsn string) []metric.Metric {
+	t.Helper()
+	ctx := context.Background()
+	storage := sqlite.New(dsn)
+	defer storage.Close(ctx)
+
+	seq, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+
+	return all
+}
+
+func TestRun_migrate(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.db")
+	dump := filepath.Join(dir, "dump.json")
+	destination := filepath.Join(dir, "destination.db")
+
+	// sqlite -> dump file -> sqlite
+	require.NoError(t, Run(ctx, newConfig(func(config *config.Config) {
+		config.Import = "-"
+		config.ToDSN = source
+	}), strings.NewReader(`{"id":"m1","type":"counter","delta":1}
+{"id":"m2","type":"gauge","value":2.5}
+{"id":"m3","type":"counter","delta":3}
+`), &bytes.Buffer{}))
+	require.NoError(t, Run(ctx, newConfig(func(config *config.Config) {
+		config.FromDSN = source
+		config.ToFile = dump
+	}), nil, &bytes.Buffer{}))
+	require.NoError(t, Run(ctx, newConfig(func(config *config.Config) {
+		config.FromFile = dump
+		config.ToDSN = destination
+	}), nil, &bytes.Buffer{}))
+
+	assert.ElementsMatch(t, metrics, readSqlite(t, destination))
+}
+
+func TestRun_export(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	source := filepath.Join(dir, "source.db")
+	imported := filepath.Join(dir, "metrics.csv")
+	require.NoError(t, os.WriteFile(imported, []byte("counter,m1,1\ngauge,m2,2.5\ncounter,m3,3\n"), 0644))
+
+	require.NoError(t, Run(ctx, newConfig(func(config *config.Config) {
+		config.Import = imported
+		config.Format = "csv"
+		config.ToDSN = source
+	}), nil, &bytes.Buffer{}))
+
+	stdout := &bytes.Buffer{}
+	require.NoError(t, Run(ctx, newConfig(func(config *config.Config) {
+		config.FromDSN = source
+		config.Export = true
+		config.Format = "csv"
+	}), nil, stdout))
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	assert.Equal(t, "type,name,value", lines[0])
+	assert.ElementsMatch(t, []string{"counter,m1,1", "gauge,m2,2.5", "counter,m3,3"}, lines[1:])
+}
+
+func TestRun_dryRun(t *testing.T) {
+	ctx := context.Background()
+	destination := filepath.Join(t.TempDir(), "destination.db")
+
+	require.NoError(t, Run(ctx, newConfig(func(config *config.Config) {
+		config.Import = "-"
+		config.ToDSN = destination
+		config.DryRun = true
+	}), strings.NewReader(`{"id":"m1","type":"counter","delta":1}`), &bytes.Buffer{}))
+
+	_, err := os.Stat(destination)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestRun_errors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		modify  func(config *config.Config)
+		wantErr error
+	}{
+		{
+			name:    "no source",
+			modify:  func(config *config.Config) {},
+			wantErr: ErrNoSource,
+		},
+		{
+			name: "no destination",
+			modify: func(config *config.Config) {
+				config.Import = "-"
+			},
+			wantErr: ErrNoDestination,
+		},
+		{
+			name: "missing source file",
+			modify: func(config *config.Config) {
+				config.FromFile = filepath.Join(dir, "missing.json")
+			},
+			wantErr: ErrSourceFileNotFound,
+		},
+		{
+			name: "file and dsn",
+			modify: func(config *config.Config) {
+				config.Import = "-"
+				config.ToFile = filepath.Join(dir, "dump.json")
+				config.ToDSN = filepath.Join(dir, "metrics.db")
+			},
+			wantErr: ErrAmbiguousStorage,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Run(context.Background(), newConfig(tt.modify), strings.NewReader(""), &bytes.Buffer{})
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestRun_invalidImport(t *testing.T) {
+	destination := filepath.Join(t.TempDir(), "destination.db")
+
+	err := Run(context.Background(), newConfig(func(config *config.Config) {
+		config.Import = "-"
+		config.ToDSN = destination
+	}), strings.NewReader("{\"id\":\"m1\",\"type\":\"counter\",\"delta\":1}\n{\"id\":\"m2\",\"type\":\"counter\",\"delta\":2}\n{"), &bytes.Buffer{})
+	require.Error(t, err)
+
+	// full batches before invalid record are written
+	assert.ElementsMatch(t, []metric.Metric{counter.New("m1", 1), counter.New("m2", 2)}, readSqlite(t, destination))
+}
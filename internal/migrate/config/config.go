@@ -0,0 +1,46 @@
+// Package config
+// gometheus-migrate configuration
+package config
+
+import (
+	flag "github.com/spf13/pflag"
+)
+
+type Config struct {
+	LogLevel   string
+	FromFile   string
+	FromDriver string
+	FromDSN    string
+	ToFile     string
+	ToDriver   string
+	ToDSN      string
+	Export     bool
+	Import     string
+	Format     string
+	BatchSize  int
+	DryRun     bool
+}
+
+func ParseConfig() *Config {
+	config := &Config{}
+
+	flag.StringVarP(&config.LogLevel, "log-level", "l", "info", "log level")
+	flag.StringVar(&config.FromFile, "from-file", "", "source dump file")
+	flag.StringVar(&config.FromDriver, "from-driver", "pgx", "source database driver: pgx/sqlite/bolt")
+	flag.StringVar(&config.FromDSN, "from-dsn", "", "source database dsn")
+	flag.StringVar(&config.ToFile, "to-file", "", "destination dump file")
+	flag.StringVar(&config.ToDriver, "to-driver", "pgx", "destination database driver: pgx/sqlite/bolt")
+	flag.StringVar(&config.ToDSN, "to-dsn", "", "destination database dsn")
+	flag.BoolVar(&config.Export, "export", false, "export source metrics to stdout instead of writing them to destination")
+	flag.StringVar(&config.Import, "import", "", "import metrics from file instead of source storage, - reads stdin")
+	flag.StringVar(&config.Format, "format", "ndjson", "export/import format: ndjson/csv")
+	flag.IntVar(&config.BatchSize, "batch-size", 1000, "count of metrics written to destination at once")
+	flag.BoolVar(&config.DryRun, "dry-run", false, "read metrics and report their count without writing to destination")
+	flag.Parse()
+
+	if config.BatchSize <= 0 {
+		panic("batch size must be positive")
+	}
+
+	return config
+}
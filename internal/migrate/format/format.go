@@ -0,0 +1,214 @@
+// Package format
+// contains NDJSON and CSV encoding of metrics used by export and import
+package format
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"iter"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/factory"
+	"github.com/m1khal3v/gometheus/internal/common/metric/transformer"
+	requests "github.com/m1khal3v/gometheus/pkg/request"
+)
+
+type Format string
+
+const (
+	// NDJSON is one save metric request per line, e.g. {"id":"m1","type":"counter","delta":1}
+	NDJSON Format = "ndjson"
+	// CSV has header type,name,value
+	CSV Format = "csv"
+)
+
+var csvHeader = []string{"type", "name", "value"}
+
+var errEmptyName = errors.New("metric name is empty")
+
+type UnknownFormatError struct {
+	Format string
+}
+
+func (err UnknownFormatError) Error() string {
+	return fmt.Sprintf("unknown format '%s', expected ndjson/csv", err.Format)
+}
+
+func newErrUnknownFormat(format string) error {
+	return &UnknownFormatError{
+		Format: format,
+	}
+}
+
+type InvalidRecordError struct {
+	Line int
+}
+
+func (err InvalidRecordError) Error() string {
+	return fmt.Sprintf("invalid record at line %d", err.Line)
+}
+
+func newErrInvalidRecord(line int) error {
+	return &InvalidRecordError{
+		Line: line,
+	}
+}
+
+func ParseFormat(format string) (Format, error) {
+	switch Format(format) {
+	case NDJSON, CSV:
+		return Format(format), nil
+	default:
+		return "", newErrUnknownFormat(format)
+	}
+}
+
+// Encode writes metrics to writer and returns count of written metrics
+func Encode(format Format, writer io.Writer, metrics iter.Seq2[metric.Metric, error]) (int, error) {
+	switch format {
+	case NDJSON:
+		return encodeNDJSON(writer, metrics)
+	case CSV:
+		return encodeCSV(writer, metrics)
+	default:
+		return 0, newErrUnknownFormat(string(format))
+	}
+}
+
+// Decode reads metrics from reader, decoding is stopped by the first invalid record
+func Decode(format Format, reader io.Reader) iter.Seq2[metric.Metric, error] {
+	switch format {
+	case NDJSON:
+		return decodeNDJSON(reader)
+	case CSV:
+		return decodeCSV(reader)
+	default:
+		return func(yield func(metric.Metric, error) bool) {
+			yield(nil, newErrUnknownFormat(string(format)))
+		}
+	}
+}
+
+func encodeNDJSON(writer io.Writer, metrics iter.Seq2[metric.Metric, error]) (int, error) {
+	buffered := bufio.NewWriter(writer)
+	encoder := json.NewEncoder(buffered)
+
+	count := 0
+	for metric, err := range metrics {
+		if err != nil {
+			return count, err
+		}
+
+		request, err := transformer.TransformToSaveRequest(metric)
+		if err != nil {
+			return count, err
+		}
+
+		if err := encoder.Encode(request); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	return count, buffered.Flush()
+}
+
+func decodeNDJSON(reader io.Reader) iter.Seq2[metric.Metric, error] {
+	return func(yield func(metric.Metric, error) bool) {
+		scanner := bufio.NewScanner(reader)
+		for line := 1; scanner.Scan(); line++ {
+			if len(scanner.Bytes()) == 0 {
+				continue
+			}
+
+			request := &requests.SaveMetricRequest{}
+			if err := json.Unmarshal(scanner.Bytes(), request); err != nil {
+				yield(nil, fmt.Errorf("%w: %w", newErrInvalidRecord(line), err))
+				return
+			}
+
+			metric, err := factory.NewFromRequest(request)
+			if err == nil && metric.Name() == "" {
+				err = errEmptyName
+			}
+			if err != nil {
+				yield(nil, fmt.Errorf("%w: %w", newErrInvalidRecord(line), err))
+				return
+			}
+
+			if !yield(metric, nil) {
+				return
+			}
+		}
+
+		if err := scanner.Err(); err != nil {
+			yield(nil, err)
+		}
+	}
+}
+
+func encodeCSV(writer io.Writer, metrics iter.Seq2[metric.Metric, error]) (int, error) {
+	encoder := csv.NewWriter(writer)
+	if err := encoder.Write(csvHeader); err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for metric, err := range metrics {
+		if err != nil {
+			return count, err
+		}
+
+		if err := encoder.Write([]string{metric.Type(), metric.Name(), metric.StringValue()}); err != nil {
+			return count, err
+		}
+		count++
+	}
+
+	encoder.Flush()
+
+	return count, encoder.Error()
+}
+
+func decodeCSV(reader io.Reader) iter.Seq2[metric.Metric, error] {
+	return func(yield func(metric.Metric, error) bool) {
+		decoder := csv.NewReader(reader)
+		decoder.FieldsPerRecord = len(csvHeader)
+		decoder.ReuseRecord = true
+
+		for line := 1; ; line++ {
+			record, err := decoder.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				yield(nil, fmt.Errorf("%w: %w", newErrInvalidRecord(line), err))
+				return
+			}
+
+			// header is optional
+			if line == 1 && record[0] == csvHeader[0] && record[1] == csvHeader[1] && record[2] == csvHeader[2] {
+				continue
+			}
+
+			if record[1] == "" {
+				yield(nil, fmt.Errorf("%w: %w", newErrInvalidRecord(line), errEmptyName))
+				return
+			}
+
+			metric, err := factory.New(record[0], record[1], record[2])
+			if err != nil {
+				yield(nil, fmt.Errorf("%w: %w", newErrInvalidRecord(line), err))
+				return
+			}
+
+			if !yield(metric, nil) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package format
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/pkg/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func seq(metrics ...metric.Metric) func(yield func(metric.Metric, error) bool) {
+	return func(yield func(metric.Metric, error) bool) {
+		for _, metric := range metrics {
+			if !yield(metric, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	format, err := ParseFormat("csv")
+	require.NoError(t, err)
+	assert.Equal(t, CSV, format)
+
+	_, err = ParseFormat("xml")
+	assert.ErrorAs(t, err, new(*UnknownFormatError))
+}
+
+func TestEncode(t *testing.T) {
+	tests := []struct {
+		name   string
+		format Format
+		want   string
+	}{
+		{
+			name:   "ndjson",
+			format: NDJSON,
+			want:   "{\"id\":\"m1\",\"type\":\"counter\",\"delta\":5,\"value\":null}\n{\"id\":\"m2\",\"type\":\"gauge\",\"delta\":null,\"value\":1.5}\n",
+		},
+		{
+			name:   "csv",
+			format: CSV,
+			want:   "type,name,value\ncounter,m1,5\ngauge,m2,1.5\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			count, err := Encode(tt.format, buffer, seq(counter.New("m1", 5), gauge.New("m2", 1.5)))
+			require.NoError(t, err)
+			assert.Equal(t, 2, count)
+			assert.Equal(t, tt.want, buffer.String())
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		format   Format
+		input    string
+		want     []metric.Metric
+		wantLine int
+	}{
+		{
+			name:   "ndjson",
+			format: NDJSON,
+			input:  "{\"id\":\"m1\",\"type\":\"counter\",\"delta\":5}\n\n{\"id\":\"m2\",\"type\":\"gauge\",\"value\":1.5}\n",
+			want:   []metric.Metric{counter.New("m1", 5), gauge.New("m2", 1.5)},
+		},
+		{
+			name:   "csv with header",
+			format: CSV,
+			input:  "type,name,value\ncounter,m1,5\ngauge,m2,1.5\n",
+			want:   []metric.Metric{counter.New("m1", 5), gauge.New("m2", 1.5)},
+		},
+		{
+			name:   "csv without header",
+			format: CSV,
+			input:  "counter,m1,5\n",
+			want:   []metric.Metric{counter.New("m1", 5)},
+		},
+		{
+			name:     "ndjson invalid json",
+			format:   NDJSON,
+			input:    "{\"id\":\"m1\",\"type\":\"counter\",\"delta\":5}\n{",
+			wantLine: 2,
+		},
+		{
+			name:     "ndjson empty name",
+			format:   NDJSON,
+			input:    "{\"id\":\"\",\"type\":\"counter\",\"delta\":5}\n",
+			wantLine: 1,
+		},
+		{
+			name:     "csv invalid value",
+			format:   CSV,
+			input:    "type,name,value\ncounter,m1,1.5\n",
+			wantLine: 2,
+		},
+		{
+			name:     "csv invalid field count",
+			format:   CSV,
+			input:    "counter,m1\n",
+			wantLine: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := slice.FromSeq2(Decode(tt.format, strings.NewReader(tt.input)))
+			if tt.wantLine > 0 {
+				invalidRecordErr := &InvalidRecordError{}
+				require.ErrorAs(t, err, &invalidRecordErr)
+				assert.Equal(t, tt.wantLine, invalidRecordErr.Line)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	metrics := []metric.Metric{counter.New("m1", 1<<60), gauge.New("m2", 0.1+0.2), gauge.New("with,comma", -1)}
+	for _, format := range []Format{NDJSON, CSV} {
+		t.Run(string(format), func(t *testing.T) {
+			buffer := &bytes.Buffer{}
+			_, err := Encode(format, buffer, seq(metrics...))
+			require.NoError(t, err)
+
+			got, err := slice.FromSeq2(Decode(format, buffer))
+			require.NoError(t, err)
+			assert.Equal(t, metrics, got)
+		})
+	}
+}
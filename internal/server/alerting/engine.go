@@ -0,0 +1,187 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/logger"
+	"github.com/m1khal3v/gometheus/internal/server/query"
+	"go.uber.org/zap"
+)
+
+// State of alert
+type State string
+
+const (
+	// Pending alert meets condition for less than For of rule
+	Pending State = "pending"
+	// Firing alert meets condition for For of rule
+	Firing State = "firing"
+	// Resolved alert was firing and does not meet condition anymore
+	Resolved State = "resolved"
+)
+
+// Alert is state of rule for one metric. Notifications are sent when alert starts firing and when it is resolved
+type Alert struct {
+	Rule        string     `json:"rule"`
+	Metric      string     `json:"metric,omitempty"`
+	Severity    string     `json:"severity"`
+	State       State      `json:"state"`
+	Condition   string     `json:"condition"`
+	Value       float64    `json:"value"`
+	ActiveSince time.Time  `json:"active_since"`
+	ResolvedAt  *time.Time `json:"resolved_at,omitempty"`
+}
+
+// Notifier delivers alerts, Notify must not block evaluation
+type Notifier interface {
+	Notify(alert Alert)
+}
+
+type Engine struct {
+	source   query.Source
+	rules    []Rule
+	notifier Notifier
+	interval time.Duration
+	now      func() time.Time
+	// active contains pending and firing alerts of rule with the same index by metric name
+	active []map[string]*Alert
+}
+
+// NewEngine creates engine evaluating rules against source, e.g. manager.Manager shared with servers.
+// State changes are logged, nil notifier disables notifications
+func NewEngine(source query.Source, rules []Rule, notifier Notifier, interval time.Duration) *Engine {
+	if source == nil {
+		panic("Source cannot be nil")
+	}
+	if interval <= 0 {
+		panic("Evaluation interval must be positive")
+	}
+
+	active := make([]map[string]*Alert, len(rules))
+	for index := range active {
+		active[index] = map[string]*Alert{}
+	}
+
+	return &Engine{
+		source:   source,
+		rules:    rules,
+		notifier: notifier,
+		interval: interval,
+		now:      time.Now,
+		active:   active,
+	}
+}
+
+// Start evaluates rules every interval until ctx is done
+func (engine *Engine) Start(ctx context.Context) {
+	ticker := time.NewTicker(engine.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		if err := engine.Evaluate(ctx); err != nil {
+			logger.Logger.Error("Failed to evaluate alerting rules", zap.Error(err))
+		}
+	}
+}
+
+// Evaluate evaluates every rule once, state of rule which cannot be evaluated is kept.
+// Evaluate must not be called concurrently
+func (engine *Engine) Evaluate(ctx context.Context) error {
+	errs := make([]error, 0)
+	for index, rule := range engine.rules {
+		if err := engine.evaluate(ctx, rule, engine.active[index]); err != nil {
+			errs = append(errs, fmt.Errorf("rule '%s': %w", rule.Name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (engine *Engine) evaluate(ctx context.Context, rule Rule, active map[string]*Alert) error {
+	result, err := rule.query.Evaluate(ctx, engine.source)
+	// aggregation of missing metrics is treated as missing metric, so its alerts are resolved
+	if errors.Is(err, query.ErrEmptyAggregation) {
+		result, err = &query.Result{Vector: true}, nil
+	}
+	if err != nil {
+		return err
+	}
+
+	samples := result.Samples
+	if !result.Vector {
+		samples = []query.Sample{{Value: result.Scalar}}
+	}
+
+	now := engine.now()
+	values := make(map[string]float64, len(samples))
+	for _, sample := range samples {
+		values[sample.Name] = sample.Value
+		if !rule.Condition.Matches(sample.Value) {
+			continue
+		}
+
+		alert, ok := active[sample.Name]
+		if !ok {
+			alert = &Alert{
+				Rule:        rule.Name,
+				Metric:      sample.Name,
+				Severity:    rule.Severity,
+				State:       Pending,
+				Condition:   rule.Condition.String(),
+				ActiveSince: now,
+			}
+			active[sample.Name] = alert
+		}
+		alert.Value = sample.Value
+
+		if alert.State == Pending && now.Sub(alert.ActiveSince) >= rule.For {
+			alert.State = Firing
+			engine.notify(*alert)
+		}
+	}
+
+	for name, alert := range active {
+		value, ok := values[name]
+		if ok && rule.Condition.Matches(value) {
+			continue
+		}
+
+		delete(active, name)
+		// pending alert was not notified, so it is dropped silently
+		if alert.State != Firing {
+			continue
+		}
+
+		// value of missing metric is the last seen one
+		if ok {
+			alert.Value = value
+		}
+		alert.State = Resolved
+		alert.ResolvedAt = &now
+		engine.notify(*alert)
+	}
+
+	return nil
+}
+
+func (engine *Engine) notify(alert Alert) {
+	logger.Logger.Info("Alert state is changed",
+		zap.String("rule", alert.Rule),
+		zap.String("metric", alert.Metric),
+		zap.String("state", string(alert.State)),
+		zap.Float64("value", alert.Value),
+	)
+
+	if engine.notifier != nil {
+		engine.notifier.Notify(alert)
+	}
+}
@@ -0,0 +1,158 @@
+package alerting
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/manager"
+	"github.com/m1khal3v/gometheus/internal/server/query"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	alerts []Alert
+}
+
+func (recorder *recorder) Notify(alert Alert) {
+	recorder.alerts = append(recorder.alerts, alert)
+}
+
+// states returns notified states of metrics and forgets notifications
+func (recorder *recorder) states() map[string]State {
+	states := map[string]State{}
+	for _, alert := range recorder.alerts {
+		states[alert.Metric] = alert.State
+	}
+	recorder.alerts = nil
+
+	return states
+}
+
+func newRule(t *testing.T, selector, condition string, duration time.Duration) Rule {
+	parsed, err := query.Parse(selector)
+	require.NoError(t, err)
+	parsedCondition, err := ParseCondition(condition)
+	require.NoError(t, err)
+
+	return Rule{
+		Name:      "rule",
+		Selector:  selector,
+		Condition: parsedCondition,
+		For:       duration,
+		Severity:  "critical",
+		query:     parsed,
+	}
+}
+
+func TestEngine_Evaluate(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	notifier := &recorder{}
+	engine := NewEngine(manager.New(storage), []Rule{newRule(t, "*.FreeMemory", "< 100", time.Minute)}, notifier, time.Second)
+	started := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	now := started
+	engine.now = func() time.Time { return now }
+
+	step := func(elapsed time.Duration, metrics ...metric.Metric) map[string]State {
+		t.Helper()
+		if len(metrics) > 0 {
+			require.NoError(t, storage.SaveBatch(ctx, metrics))
+		}
+		now = started.Add(elapsed)
+		require.NoError(t, engine.Evaluate(ctx))
+
+		return notifier.states()
+	}
+
+	// pending alerts are not notified
+	assert.Empty(t, step(0, gauge.New("h1.FreeMemory", 50), gauge.New("h2.FreeMemory", 500)))
+	assert.Equal(t, Pending, engine.active[0]["h1.FreeMemory"].State)
+	assert.Empty(t, step(30*time.Second, gauge.New("h2.FreeMemory", 10)))
+
+	assert.Equal(t, map[string]State{"h1.FreeMemory": Firing}, step(time.Minute))
+	require.Len(t, engine.active[0], 2)
+	assert.Equal(t, Pending, engine.active[0]["h2.FreeMemory"].State)
+
+	// pending alert is dropped without notification when it stops meeting condition
+	assert.Empty(t, step(70*time.Second, gauge.New("h2.FreeMemory", 200)))
+	assert.NotContains(t, engine.active[0], "h2.FreeMemory")
+
+	// firing alert is notified once
+	assert.Empty(t, step(80*time.Second, gauge.New("h1.FreeMemory", 40)))
+
+	assert.Equal(t, map[string]State{"h1.FreeMemory": Resolved}, step(90*time.Second, gauge.New("h1.FreeMemory", 150)))
+	assert.Empty(t, engine.active[0])
+
+	// alert of deleted metric is resolved
+	assert.Empty(t, step(5*time.Minute, gauge.New("h2.FreeMemory", 1)))
+	assert.Equal(t, map[string]State{"h2.FreeMemory": Firing}, step(6*time.Minute))
+	require.NoError(t, storage.Delete(ctx, "h2.FreeMemory"))
+	assert.Equal(t, map[string]State{"h2.FreeMemory": Resolved}, step(7*time.Minute))
+}
+
+func TestEngine_EvaluateAlert(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	require.NoError(t, storage.Save(ctx, gauge.New("FreeMemory", 50)))
+	notifier := &recorder{}
+	engine := NewEngine(manager.New(storage), []Rule{newRule(t, "FreeMemory", "< 100", 0)}, notifier, time.Second)
+	fired := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	engine.now = func() time.Time { return fired }
+
+	// rule without for fires on the first evaluation
+	require.NoError(t, engine.Evaluate(ctx))
+	require.Len(t, notifier.alerts, 1)
+	assert.Equal(t, Alert{
+		Rule:        "rule",
+		Metric:      "FreeMemory",
+		Severity:    "critical",
+		State:       Firing,
+		Condition:   "< 100",
+		Value:       50,
+		ActiveSince: fired,
+	}, notifier.alerts[0])
+
+	resolved := fired.Add(time.Minute)
+	engine.now = func() time.Time { return resolved }
+	require.NoError(t, storage.Save(ctx, gauge.New("FreeMemory", 120)))
+	require.NoError(t, engine.Evaluate(ctx))
+	require.Len(t, notifier.alerts, 2)
+	assert.Equal(t, Alert{
+		Rule:        "rule",
+		Metric:      "FreeMemory",
+		Severity:    "critical",
+		State:       Resolved,
+		Condition:   "< 100",
+		Value:       120,
+		ActiveSince: fired,
+		ResolvedAt:  &resolved,
+	}, notifier.alerts[1])
+}
+
+func TestEngine_EvaluateScalar(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	require.NoError(t, storage.SaveBatch(ctx, []metric.Metric{gauge.New("h1.Load", 2), gauge.New("h2.Load", 4)}))
+	notifier := &recorder{}
+	engine := NewEngine(manager.New(storage), []Rule{
+		newRule(t, "avg(*.Load)", "> 1", 0),
+		newRule(t, "*.Load / 0", "> 1", 0),
+	}, notifier, time.Second)
+
+	// rule which cannot be evaluated does not prevent evaluation of other rules
+	assert.ErrorIs(t, engine.Evaluate(ctx), query.ErrNotFinite)
+	require.Len(t, notifier.alerts, 1)
+	assert.Equal(t, "", notifier.alerts[0].Metric)
+	assert.Equal(t, float64(3), notifier.alerts[0].Value)
+
+	// aggregation of missing metrics resolves alert
+	require.NoError(t, storage.Reset(ctx))
+	assert.NoError(t, engine.Evaluate(ctx))
+	require.Len(t, notifier.alerts, 2)
+	assert.Equal(t, Resolved, notifier.alerts[1].State)
+}
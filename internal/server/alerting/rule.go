@@ -0,0 +1,193 @@
+// Package alerting
+// contains threshold alerting rules, their periodic evaluation and webhook notifications
+package alerting
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/server/query"
+)
+
+// defaultSeverity is used by rules without severity
+const defaultSeverity = "warning"
+
+type InvalidRuleError struct {
+	Rule string
+}
+
+func (err InvalidRuleError) Error() string {
+	return fmt.Sprintf("invalid alerting rule '%s'", err.Rule)
+}
+
+func newErrInvalidRule(rule string) error {
+	return &InvalidRuleError{
+		Rule: rule,
+	}
+}
+
+// Operator compares metric value with threshold
+type Operator string
+
+const (
+	Below        Operator = "<"
+	BelowOrEqual Operator = "<="
+	Above        Operator = ">"
+	AboveOrEqual Operator = ">="
+	Equal        Operator = "=="
+	NotEqual     Operator = "!="
+)
+
+// operators are ordered so two character operators are matched before their prefixes
+var operators = []Operator{BelowOrEqual, AboveOrEqual, Equal, NotEqual, Below, Above}
+
+// Condition is met by values which are in Operator relation with Threshold, e.g. "< 1048576"
+type Condition struct {
+	Operator  Operator
+	Threshold float64
+}
+
+// ParseCondition parses operator followed by threshold
+func ParseCondition(condition string) (Condition, error) {
+	condition = strings.TrimSpace(condition)
+	for _, operator := range operators {
+		threshold, ok := strings.CutPrefix(condition, string(operator))
+		if !ok {
+			continue
+		}
+
+		value, err := strconv.ParseFloat(strings.TrimSpace(threshold), 64)
+		if err != nil {
+			return Condition{}, fmt.Errorf("invalid threshold '%s'", strings.TrimSpace(threshold))
+		}
+
+		return Condition{Operator: operator, Threshold: value}, nil
+	}
+
+	return Condition{}, fmt.Errorf("condition '%s' must start with one of < <= > >= == !=", condition)
+}
+
+// Matches reports whether value meets condition
+func (condition Condition) Matches(value float64) bool {
+	switch condition.Operator {
+	case Below:
+		return value < condition.Threshold
+	case BelowOrEqual:
+		return value <= condition.Threshold
+	case Above:
+		return value > condition.Threshold
+	case AboveOrEqual:
+		return value >= condition.Threshold
+	case Equal:
+		return value == condition.Threshold
+	case NotEqual:
+		return value != condition.Threshold
+	default:
+		return false
+	}
+}
+
+func (condition Condition) String() string {
+	return string(condition.Operator) + " " + strconv.FormatFloat(condition.Threshold, 'g', -1, 64)
+}
+
+// Rule fires alert for every metric selected by Selector which meets Condition during For
+type Rule struct {
+	Name string
+	// Selector is query expression (see package query), e.g. "FreeMemory" or "sum(*.FreeMemory)".
+	// Alert of scalar expression has empty metric name
+	Selector  string
+	Condition Condition
+	For       time.Duration
+	Severity  string
+	query     *query.Query
+}
+
+// ruleFile is rule as written in rules file
+type ruleFile struct {
+	Name      string `json:"name"`
+	Selector  string `json:"selector"`
+	Condition string `json:"condition"`
+	For       string `json:"for"`
+	Severity  string `json:"severity"`
+}
+
+// LoadRules reads JSON array of rules from file, e.g.
+// [{"name": "LowFreeMemory", "selector": "FreeMemory", "condition": "< 104857600", "for": "1m", "severity": "critical"}]
+func LoadRules(path string) ([]Rule, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	decoder := json.NewDecoder(file)
+	// misspelled field must not silently disable part of rule
+	decoder.DisallowUnknownFields()
+	files := make([]ruleFile, 0)
+	if err := decoder.Decode(&files); err != nil {
+		return nil, fmt.Errorf("invalid alerting rules file: %w", err)
+	}
+
+	rules := make([]Rule, 0, len(files))
+	names := make(map[string]struct{}, len(files))
+	for _, file := range files {
+		rule, err := parseRule(file)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", newErrInvalidRule(file.Name), err)
+		}
+		if _, ok := names[rule.Name]; ok {
+			return nil, fmt.Errorf("%w: %w", newErrInvalidRule(file.Name), errors.New("name is not unique"))
+		}
+		names[rule.Name] = struct{}{}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func parseRule(file ruleFile) (Rule, error) {
+	if file.Name == "" {
+		return Rule{}, errors.New("name is required")
+	}
+
+	parsed, err := query.Parse(file.Selector)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	condition, err := ParseCondition(file.Condition)
+	if err != nil {
+		return Rule{}, err
+	}
+
+	var duration time.Duration
+	if file.For != "" {
+		if duration, err = time.ParseDuration(file.For); err != nil {
+			return Rule{}, err
+		}
+		if duration < 0 {
+			return Rule{}, errors.New("for must not be negative")
+		}
+	}
+
+	severity := file.Severity
+	if severity == "" {
+		severity = defaultSeverity
+	}
+
+	return Rule{
+		Name:      file.Name,
+		Selector:  file.Selector,
+		Condition: condition,
+		For:       duration,
+		Severity:  severity,
+		query:     parsed,
+	}, nil
+}
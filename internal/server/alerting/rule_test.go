@@ -0,0 +1,131 @@
+package alerting
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCondition(t *testing.T) {
+	tests := []struct {
+		condition string
+		want      Condition
+		wantErr   bool
+	}{
+		{condition: "< 100", want: Condition{Operator: Below, Threshold: 100}},
+		{condition: "<=1.5", want: Condition{Operator: BelowOrEqual, Threshold: 1.5}},
+		{condition: " > -3 ", want: Condition{Operator: Above, Threshold: -3}},
+		{condition: ">= 1e9", want: Condition{Operator: AboveOrEqual, Threshold: 1e9}},
+		{condition: "== 0", want: Condition{Operator: Equal, Threshold: 0}},
+		{condition: "!= 7", want: Condition{Operator: NotEqual, Threshold: 7}},
+		{condition: "100", wantErr: true},
+		{condition: "< ten", wantErr: true},
+		{condition: "=< 1", wantErr: true},
+		{condition: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			got, err := ParseCondition(tt.condition)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCondition_Matches(t *testing.T) {
+	tests := []struct {
+		operator Operator
+		want     []bool // matches of values below, equal to and above threshold
+	}{
+		{operator: Below, want: []bool{true, false, false}},
+		{operator: BelowOrEqual, want: []bool{true, true, false}},
+		{operator: Above, want: []bool{false, false, true}},
+		{operator: AboveOrEqual, want: []bool{false, true, true}},
+		{operator: Equal, want: []bool{false, true, false}},
+		{operator: NotEqual, want: []bool{true, false, true}},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.operator), func(t *testing.T) {
+			condition := Condition{Operator: tt.operator, Threshold: 10}
+			got := []bool{condition.Matches(9), condition.Matches(10), condition.Matches(11)}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestLoadRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Rule
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			content: `[
+				{"name": "LowFreeMemory", "selector": "FreeMemory", "condition": "< 1048576", "for": "1m", "severity": "critical"},
+				{"name": "HighCPU", "selector": "avg(CPUutilization*)", "condition": ">= 90"}
+			]`,
+			want: []Rule{
+				{
+					Name:      "LowFreeMemory",
+					Selector:  "FreeMemory",
+					Condition: Condition{Operator: Below, Threshold: 1048576},
+					For:       time.Minute,
+					Severity:  "critical",
+				},
+				{
+					Name:      "HighCPU",
+					Selector:  "avg(CPUutilization*)",
+					Condition: Condition{Operator: AboveOrEqual, Threshold: 90},
+					Severity:  defaultSeverity,
+				},
+			},
+		},
+		{name: "empty", content: `[]`, want: []Rule{}},
+		{name: "not array", content: `{"name": "r"}`, wantErr: true},
+		{name: "unknown field", content: `[{"name": "r", "selector": "m", "condition": "< 1", "fro": "1m"}]`, wantErr: true},
+		{name: "missing name", content: `[{"selector": "m", "condition": "< 1"}]`, wantErr: true},
+		{name: "invalid selector", content: `[{"name": "r", "selector": "sum(", "condition": "< 1"}]`, wantErr: true},
+		{name: "invalid condition", content: `[{"name": "r", "selector": "m", "condition": "1"}]`, wantErr: true},
+		{name: "invalid for", content: `[{"name": "r", "selector": "m", "condition": "< 1", "for": "soon"}]`, wantErr: true},
+		{name: "negative for", content: `[{"name": "r", "selector": "m", "condition": "< 1", "for": "-1m"}]`, wantErr: true},
+		{
+			name:    "duplicate name",
+			content: `[{"name": "r", "selector": "m", "condition": "< 1"}, {"name": "r", "selector": "n", "condition": "> 1"}]`,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "rules.json")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			got, err := LoadRules(path)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, got, len(tt.want))
+			for index := range got {
+				assert.NotNil(t, got[index].query)
+				got[index].query = nil
+			}
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("missing file", func(t *testing.T) {
+		_, err := LoadRules(filepath.Join(t.TempDir(), "missing.json"))
+		assert.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
@@ -0,0 +1,152 @@
+package alerting
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-resty/resty/v2"
+	"github.com/m1khal3v/gometheus/internal/common/logger"
+	"github.com/m1khal3v/gometheus/pkg/retry"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultQueueSize = 1024
+	webhookTimeout   = 5 * time.Second
+)
+
+type UnexpectedStatusError struct {
+	Status int
+}
+
+func (err UnexpectedStatusError) Error() string {
+	return fmt.Sprintf("unexpected status code: %d", err.Status)
+}
+
+func newErrUnexpectedStatus(status int) error {
+	return &UnexpectedStatusError{
+		Status: status,
+	}
+}
+
+// Webhook posts alerts as JSON to every URL. Alerts are delivered one by one in order of notification
+type Webhook struct {
+	urls   []string
+	client *resty.Client
+	queue  chan Alert
+	retry  retry.RetryOptions
+}
+
+type WebhookOption func(webhook *Webhook)
+
+// WithRetry sets retry options of delivery to one URL
+func WithRetry(options retry.RetryOptions) WebhookOption {
+	return func(webhook *Webhook) {
+		webhook.retry = options
+	}
+}
+
+// WithQueueSize sets count of alerts waiting for delivery, alerts exceeding it are dropped
+func WithQueueSize(size int) WebhookOption {
+	if size <= 0 {
+		panic("Queue size must be positive")
+	}
+
+	return func(webhook *Webhook) {
+		webhook.queue = make(chan Alert, size)
+	}
+}
+
+func NewWebhook(urls []string, options ...WebhookOption) *Webhook {
+	if len(urls) == 0 {
+		panic("Webhook URLs cannot be empty")
+	}
+
+	webhook := &Webhook{
+		urls: urls,
+		client: resty.
+			New().
+			SetTimeout(webhookTimeout).
+			SetHeader("Content-Type", "application/json"),
+		queue: make(chan Alert, defaultQueueSize),
+		retry: retry.RetryOptions{
+			BaseDelay:  time.Second,
+			MaxDelay:   5 * time.Second,
+			Attempts:   4,
+			Multiplier: 2,
+		},
+	}
+	for _, option := range options {
+		option(webhook)
+	}
+
+	return webhook
+}
+
+// Notify queues alert. Alert is dropped if queue is full, so unavailable webhook does not block evaluation
+func (webhook *Webhook) Notify(alert Alert) {
+	select {
+	case webhook.queue <- alert:
+	default:
+		logger.Logger.Error("Alert is dropped, webhook queue is full",
+			zap.String("rule", alert.Rule),
+			zap.String("metric", alert.Metric),
+			zap.String("state", string(alert.State)),
+		)
+	}
+}
+
+// Start delivers queued alerts until ctx is done
+func (webhook *Webhook) Start(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case alert := <-webhook.queue:
+			for _, url := range webhook.urls {
+				if err := webhook.send(ctx, url, alert); err != nil {
+					logger.Logger.Error("Failed to deliver alert",
+						zap.String("url", url),
+						zap.String("rule", alert.Rule),
+						zap.String("metric", alert.Metric),
+						zap.Error(err),
+					)
+				}
+			}
+		}
+	}
+}
+
+func (webhook *Webhook) send(ctx context.Context, url string, alert Alert) error {
+	return retry.Retry(webhook.retry, func() error {
+		response, err := webhook.client.R().SetContext(ctx).SetBody(alert).Post(url)
+		if err != nil {
+			return err
+		}
+		if response.IsError() {
+			return newErrUnexpectedStatus(response.StatusCode())
+		}
+
+		return nil
+	}, isRetryableError)
+}
+
+// isRetryableError reports whether delivery could succeed later.
+// Client errors are permanent except timeout and rate limit
+func isRetryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var statusErr *UnexpectedStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.Status >= http.StatusInternalServerError ||
+			statusErr.Status == http.StatusRequestTimeout ||
+			statusErr.Status == http.StatusTooManyRequests
+	}
+
+	return true
+}
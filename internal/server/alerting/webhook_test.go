@@ -0,0 +1,145 @@
+package alerting
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/pkg/retry"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var fastRetry = WithRetry(retry.RetryOptions{
+	BaseDelay:  time.Millisecond,
+	MaxDelay:   time.Millisecond,
+	Attempts:   3,
+	Multiplier: 1,
+})
+
+// receiver responds with statuses in order and records delivered alerts
+type receiver struct {
+	mutex    *sync.Mutex
+	statuses []int
+	calls    *atomic.Int32
+	alerts   []Alert
+}
+
+func newReceiver(statuses ...int) *receiver {
+	return &receiver{mutex: &sync.Mutex{}, statuses: statuses, calls: &atomic.Int32{}}
+}
+
+func (receiver *receiver) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+
+	receiver.calls.Add(1)
+	status := http.StatusOK
+	if len(receiver.statuses) > 0 {
+		status, receiver.statuses = receiver.statuses[0], receiver.statuses[1:]
+	}
+	if status == http.StatusOK {
+		alert := Alert{}
+		if err := json.NewDecoder(request.Body).Decode(&alert); err != nil {
+			status = http.StatusBadRequest
+		} else {
+			receiver.alerts = append(receiver.alerts, alert)
+		}
+	}
+
+	writer.WriteHeader(status)
+}
+
+func (receiver *receiver) delivered() []Alert {
+	receiver.mutex.Lock()
+	defer receiver.mutex.Unlock()
+
+	return append([]Alert{}, receiver.alerts...)
+}
+
+func TestWebhook_send(t *testing.T) {
+	alert := Alert{
+		Rule:        "LowFreeMemory",
+		Metric:      "FreeMemory",
+		Severity:    "critical",
+		State:       Firing,
+		Condition:   "< 100",
+		Value:       50,
+		ActiveSince: time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		name      string
+		statuses  []int
+		wantErr   bool
+		wantCalls int32
+	}{
+		{name: "delivered", wantCalls: 1},
+		{name: "server error is retried", statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}, wantCalls: 3},
+		{name: "client error is not retried", statuses: []int{http.StatusNotFound}, wantErr: true, wantCalls: 1},
+		{
+			name:      "attempts are exhausted",
+			statuses:  []int{http.StatusBadGateway, http.StatusBadGateway, http.StatusBadGateway},
+			wantErr:   true,
+			wantCalls: 3,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			receiver := newReceiver(tt.statuses...)
+			server := httptest.NewServer(receiver)
+			defer server.Close()
+			webhook := NewWebhook([]string{server.URL}, fastRetry)
+
+			err := webhook.send(context.Background(), server.URL, alert)
+			if tt.wantErr {
+				assert.Error(t, err)
+				assert.Empty(t, receiver.delivered())
+			} else {
+				require.NoError(t, err)
+				assert.Equal(t, []Alert{alert}, receiver.delivered())
+			}
+			assert.Equal(t, tt.wantCalls, receiver.calls.Load())
+		})
+	}
+}
+
+func TestWebhook_Start(t *testing.T) {
+	first, second := newReceiver(http.StatusInternalServerError), newReceiver()
+	firstServer, secondServer := httptest.NewServer(first), httptest.NewServer(second)
+	defer firstServer.Close()
+	defer secondServer.Close()
+
+	webhook := NewWebhook([]string{firstServer.URL, secondServer.URL}, fastRetry)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go webhook.Start(ctx)
+
+	webhook.Notify(Alert{Rule: "r", Metric: "m1", State: Firing})
+	webhook.Notify(Alert{Rule: "r", Metric: "m1", State: Resolved})
+
+	// every URL receives alerts in order of notification
+	for _, receiver := range []*receiver{first, second} {
+		require.Eventually(t, func() bool {
+			return len(receiver.delivered()) == 2
+		}, time.Second, time.Millisecond)
+		delivered := receiver.delivered()
+		assert.Equal(t, Firing, delivered[0].State)
+		assert.Equal(t, Resolved, delivered[1].State)
+	}
+}
+
+func TestWebhook_NotifyQueueFull(t *testing.T) {
+	webhook := NewWebhook([]string{"http://localhost"}, WithQueueSize(1))
+
+	// webhook is not started, so the second alert does not fit queue and notify does not block
+	webhook.Notify(Alert{Rule: "r", Metric: "m1", State: Firing})
+	webhook.Notify(Alert{Rule: "r", Metric: "m2", State: Firing})
+
+	require.Len(t, webhook.queue, 1)
+	assert.Equal(t, "m1", (<-webhook.queue).Metric)
+}
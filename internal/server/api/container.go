@@ -3,19 +3,23 @@
 package api
 
 import (
+	"github.com/m1khal3v/gometheus/internal/server/hub"
 	"github.com/m1khal3v/gometheus/internal/server/manager"
-	"github.com/m1khal3v/gometheus/internal/server/storage"
 	"github.com/m1khal3v/gometheus/internal/server/templates"
 )
 
 type Container struct {
 	manager   *manager.Manager
 	templates *templates.Storage
+	hub       *hub.Hub
 }
 
-func New(storage storage.Storage) *Container {
+// New creates controllers, live update streams are served from hub if it is not nil.
+// Manager is shared with other servers and background jobs, so its waiters and publisher see all changes
+func New(manager *manager.Manager, hub *hub.Hub) *Container {
 	return &Container{
-		manager:   manager.New(storage),
+		manager:   manager,
 		templates: templates.New(),
+		hub:       hub,
 	}
 }
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric/transformer"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/pkg/response"
+)
+
+// ListChanges returns metrics saved or deleted after revision passed in since query parameter (0 by default) and head revision.
+// Client continues feed by passing returned revision as since of the next request
+func (container Container) ListChanges(writer http.ResponseWriter, request *http.Request) {
+	var since uint64
+	if value := request.URL.Query().Get("since"); value != "" {
+		var err error
+		if since, err = strconv.ParseUint(value, 10, 64); err != nil {
+			WriteJSONErrorResponse(http.StatusBadRequest, writer, "Invalid since revision received", err)
+			return
+		}
+	}
+
+	seq, head, err := container.manager.GetChanges(request.Context(), since)
+	if err != nil {
+		if errors.Is(err, storage.ErrChangesNotSupported) {
+			WriteJSONErrorResponse(http.StatusNotImplemented, writer, "Storage does not support changes", err)
+			return
+		}
+		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t get changes", err)
+		return
+	}
+
+	changes := &response.ChangesResponse{Revision: head, Metrics: make([]*response.GetMetricResponse, 0)}
+	for record, err := range seq {
+		if err != nil {
+			WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t get changes", err)
+			return
+		}
+
+		item, err := transformer.TransformToGetResponse(record.Metric)
+		if err != nil {
+			WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t create response", err)
+			return
+		}
+		if !record.UpdatedAt.IsZero() {
+			item.UpdatedAt = &record.UpdatedAt
+		}
+		item.Revision = record.Revision
+		item.Deleted = record.Deleted
+		changes.Metrics = append(changes.Metrics, item)
+	}
+
+	WriteJSONResponse(changes, writer)
+}
@@ -0,0 +1,27 @@
+package api
+
+import (
+	"net/http"
+)
+
+func (container Container) DeleteMetric(writer http.ResponseWriter, request *http.Request) {
+	metricType := request.PathValue("type")
+	metricName := request.PathValue("name")
+
+	metric, err := container.manager.Delete(request.Context(), metricType, metricName)
+	if err != nil {
+		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t delete metric", err)
+		return
+	}
+	if metric == nil {
+		WriteJSONErrorResponse(http.StatusNotFound, writer, "Metric not found", nil)
+		return
+	}
+
+	// deleted value is returned, so client could restore metric if it was deleted by mistake
+	writer.Header().Set("Content-Type", "text/plain")
+	if _, err := writer.Write([]byte(metric.StringValue())); err != nil {
+		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t write response", err)
+		return
+	}
+}
@@ -2,18 +2,27 @@ package api
 
 import (
 	"net/http"
+
+	"github.com/m1khal3v/gometheus/pkg/slice"
 )
 
 func (container Container) GetAllMetrics(writer http.ResponseWriter, request *http.Request) {
 	writer.Header().Set("Content-Type", "text/html")
 
-	metrics, err := container.manager.GetAll(request.Context())
+	all, err := container.manager.GetAllRecords(request.Context())
+	if err != nil {
+		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t get metrics", err)
+		return
+	}
+
+	// metrics are collected before rendering, so read error is not hidden by partially rendered page
+	records, err := slice.FromSeq2(all)
 	if err != nil {
 		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t get metrics", err)
 		return
 	}
 
-	if err := container.templates.ExecuteAllMetricsTemplate(writer, metrics); err != nil {
+	if err := container.templates.ExecuteAllMetricsTemplate(writer, records); err != nil {
 		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t use page template", err)
 		return
 	}
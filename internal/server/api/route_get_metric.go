@@ -4,22 +4,30 @@ import (
 	"net/http"
 )
 
+// GetMetric returns metric value. If wait query parameter is set, response is delayed until value differs
+// from revision or value query parameter (current value by default) or wait timeout elapses
 func (container Container) GetMetric(writer http.ResponseWriter, request *http.Request) {
 	metricType := request.PathValue("type")
 	metricName := request.PathValue("name")
 
-	metric, err := container.manager.Get(request.Context(), metricType, metricName)
+	wait, condition, err := parseWait(request.URL.Query(), metricType, metricName)
+	if err != nil {
+		WriteJSONErrorResponse(http.StatusBadRequest, writer, "Invalid request received", err)
+		return
+	}
+
+	record, err := container.getRecord(request, metricType, metricName, wait, condition)
 	if err != nil {
 		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t get metric", err)
 		return
 	}
-	if metric == nil {
+	if record == nil {
 		WriteJSONErrorResponse(http.StatusNotFound, writer, "Metric not found", nil)
 		return
 	}
 
 	writer.Header().Set("Content-Type", "text/plain")
-	if _, err := writer.Write([]byte(metric.StringValue())); err != nil {
+	if _, err := writer.Write([]byte(record.Metric.StringValue())); err != nil {
 		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t write response", err)
 		return
 	}
@@ -7,27 +7,40 @@ import (
 	requests "github.com/m1khal3v/gometheus/pkg/request"
 )
 
+// JSONGetMetric returns metric with time and revision of its last save. Long polling parameters
+// are passed in query string as for GetMetric
 func (container Container) JSONGetMetric(writer http.ResponseWriter, request *http.Request) {
 	getMetricRequest, ok := DecodeAndValidateJSONRequest[requests.GetMetricRequest](request, writer)
 	if !ok {
 		return
 	}
 
-	metric, err := container.manager.Get(request.Context(), getMetricRequest.MetricType, getMetricRequest.MetricName)
+	wait, condition, err := parseWait(request.URL.Query(), getMetricRequest.MetricType, getMetricRequest.MetricName)
+	if err != nil {
+		WriteJSONErrorResponse(http.StatusBadRequest, writer, "Invalid request received", err)
+		return
+	}
+
+	record, err := container.getRecord(request, getMetricRequest.MetricType, getMetricRequest.MetricName, wait, condition)
 	switch {
 	case err != nil:
 		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t get metric", err)
 		return
-	case metric == nil:
+	case record == nil:
 		WriteJSONErrorResponse(http.StatusNotFound, writer, "Metric not found", nil)
 		return
 	}
 
-	response, err := transformer.TransformToGetResponse(metric)
+	response, err := transformer.TransformToGetResponse(record.Metric)
 	if err != nil {
 		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t create response", err)
 		return
 	}
+	// metrics written by older versions have no update time
+	if !record.UpdatedAt.IsZero() {
+		response.UpdatedAt = &record.UpdatedAt
+	}
+	response.Revision = record.Revision
 
 	WriteJSONResponse(response, writer)
 }
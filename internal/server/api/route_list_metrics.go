@@ -0,0 +1,118 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric/transformer"
+	"github.com/m1khal3v/gometheus/internal/server/manager"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/pkg/response"
+)
+
+const (
+	defaultListLimit = 100
+	maxListLimit     = 1000
+)
+
+// ListMetrics returns page of metrics selected by query parameters:
+// type, prefix, match (glob pattern), sort (name or -name), limit and cursor of previous page
+func (container Container) ListMetrics(writer http.ResponseWriter, request *http.Request) {
+	filter, err := parseListFilter(request.URL.Query())
+	if err != nil {
+		WriteJSONErrorResponse(http.StatusBadRequest, writer, "Invalid request received", err)
+		return
+	}
+	limit := filter.Limit
+	// one more metric is requested to find out whether next page exists
+	filter.Limit++
+
+	seq, err := container.manager.GetFiltered(request.Context(), filter)
+	if err != nil {
+		if errors.Is(err, path.ErrBadPattern) || errors.As(err, new(*manager.UnknownMetricTypeError)) {
+			WriteJSONErrorResponse(http.StatusBadRequest, writer, "Invalid request received", err)
+			return
+		}
+		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t get metrics", err)
+		return
+	}
+
+	list := &response.ListMetricsResponse{Metrics: make([]*response.GetMetricResponse, 0)}
+	for record, err := range seq {
+		if err != nil {
+			WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t get metrics", err)
+			return
+		}
+		if len(list.Metrics) == limit {
+			list.NextCursor = encodeCursor(list.Metrics[limit-1].MetricName)
+			break
+		}
+
+		item, err := transformer.TransformToGetResponse(record.Metric)
+		if err != nil {
+			WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t create response", err)
+			return
+		}
+		// metrics written by older versions have no update time
+		if !record.UpdatedAt.IsZero() {
+			item.UpdatedAt = &record.UpdatedAt
+		}
+		list.Metrics = append(list.Metrics, item)
+	}
+
+	WriteJSONResponse(list, writer)
+}
+
+func parseListFilter(query url.Values) (storage.Filter, error) {
+	filter := storage.Filter{
+		Type:   query.Get("type"),
+		Prefix: query.Get("prefix"),
+		Match:  query.Get("match"),
+		Limit:  defaultListLimit,
+	}
+
+	switch sort := query.Get("sort"); sort {
+	case "", "name":
+	case "-name":
+		filter.Descending = true
+	default:
+		return filter, fmt.Errorf("unsupported sort: %s", sort)
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > maxListLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxListLimit)
+		}
+		filter.Limit = value
+	}
+
+	if cursor := query.Get("cursor"); cursor != "" {
+		after, err := decodeCursor(cursor)
+		if err != nil {
+			return filter, err
+		}
+		filter.After = after
+	}
+
+	return filter, nil
+}
+
+// encodeCursor hides name of the last metric of page, so clients do not rely on cursor format
+func encodeCursor(name string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(name))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	name, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(name) == 0 {
+		return "", errors.New("invalid cursor")
+	}
+
+	return string(name), nil
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/m1khal3v/gometheus/internal/server/query"
+	"github.com/m1khal3v/gometheus/pkg/response"
+)
+
+func (container Container) Query(writer http.ResponseWriter, request *http.Request) {
+	parsed, err := query.Parse(request.URL.Query().Get("q"))
+	if err != nil {
+		WriteJSONErrorResponse(http.StatusBadRequest, writer, "Invalid query received", err)
+		return
+	}
+
+	result, err := parsed.Evaluate(request.Context(), container.manager)
+	if err != nil {
+		if errors.Is(err, query.ErrNotFinite) || errors.Is(err, query.ErrEmptyAggregation) {
+			WriteJSONErrorResponse(http.StatusUnprocessableEntity, writer, "Can`t evaluate query", err)
+			return
+		}
+		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t evaluate query", err)
+		return
+	}
+
+	if !result.Vector {
+		WriteJSONResponse(&response.QueryResponse{ResultType: "scalar", Value: &result.Scalar}, writer)
+		return
+	}
+
+	queryResponse := &response.QueryResponse{
+		ResultType: "vector",
+		Metrics:    make([]*response.QueryMetricResponse, 0, len(result.Samples)),
+	}
+	for _, sample := range result.Samples {
+		queryResponse.Metrics = append(queryResponse.Metrics, &response.QueryMetricResponse{
+			MetricName: sample.Name,
+			Value:      sample.Value,
+		})
+	}
+
+	WriteJSONResponse(queryResponse, writer)
+}
@@ -0,0 +1,248 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
+	"github.com/m1khal3v/gometheus/internal/common/logger"
+	"github.com/m1khal3v/gometheus/internal/common/metric/transformer"
+	"github.com/m1khal3v/gometheus/internal/server/hub"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/pkg/response"
+	"go.uber.org/zap"
+)
+
+const (
+	// streamLimit is max count of distinct metrics queued for one client, slower clients are disconnected
+	streamLimit = 1024
+	// heartbeatInterval keeps idle streams open behind proxies
+	heartbeatInterval = 15 * time.Second
+	// streamWriteTimeout limits write of one message to WebSocket
+	streamWriteTimeout = 10 * time.Second
+)
+
+// Stream sends metrics matched by "match" glob pattern and then their updates as Server-Sent Events
+func (container Container) Stream(writer http.ResponseWriter, request *http.Request) {
+	subscription, snapshot, ok := container.subscribe(writer, request)
+	if !ok {
+		return
+	}
+	defer subscription.Close()
+
+	controller := http.NewResponseController(writer)
+	writer.Header().Set("Content-Type", "text/event-stream")
+	writer.Header().Set("Cache-Control", "no-cache")
+	writer.Header().Set("X-Accel-Buffering", "no")
+	writer.WriteHeader(http.StatusOK)
+
+	send := func(items []*response.GetMetricResponse) error {
+		for _, item := range items {
+			if err := writeEvent(writer, "metric", item); err != nil {
+				return err
+			}
+		}
+
+		return controller.Flush()
+	}
+	heartbeat := func() error {
+		if _, err := fmt.Fprint(writer, ": heartbeat\n\n"); err != nil {
+			return err
+		}
+
+		return controller.Flush()
+	}
+
+	err := send(snapshot)
+	if err == nil {
+		err = forward(request.Context(), subscription, send, heartbeat)
+	}
+
+	switch {
+	case errors.Is(err, hub.ErrSlowSubscriber):
+		err = writeEvent(writer, "error", response.APIError{Code: http.StatusServiceUnavailable, Message: "Client does not keep up with updates"})
+	case errors.Is(err, hub.ErrHubClosed):
+		err = writeEvent(writer, "error", response.APIError{Code: http.StatusServiceUnavailable, Message: "Server is shutting down"})
+	default:
+		return
+	}
+	if err == nil {
+		err = controller.Flush()
+	}
+	if err != nil {
+		logger.Logger.Debug("Failed to finish stream", zap.Error(err))
+	}
+}
+
+// StreamWebSocket sends metrics matched by "match" glob pattern and then their updates as WebSocket JSON messages
+func (container Container) StreamWebSocket(writer http.ResponseWriter, request *http.Request) {
+	subscription, snapshot, ok := container.subscribe(writer, request)
+	if !ok {
+		return
+	}
+	defer subscription.Close()
+
+	connection, err := websocket.Accept(writer, request, nil)
+	if err != nil {
+		// Accept responds with error itself
+		logger.Logger.Debug("Failed to accept WebSocket", zap.Error(err))
+		return
+	}
+	defer connection.CloseNow()
+
+	// client messages are not expected, context is canceled when client closes connection
+	ctx := connection.CloseRead(request.Context())
+	send := func(items []*response.GetMetricResponse) error {
+		for _, item := range items {
+			writeCtx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+			err := wsjson.Write(writeCtx, connection, item)
+			cancel()
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+	heartbeat := func() error {
+		pingCtx, cancel := context.WithTimeout(ctx, streamWriteTimeout)
+		defer cancel()
+
+		return connection.Ping(pingCtx)
+	}
+
+	err = send(snapshot)
+	if err == nil {
+		err = forward(ctx, subscription, send, heartbeat)
+	}
+
+	switch {
+	case errors.Is(err, hub.ErrSlowSubscriber):
+		err = connection.Close(websocket.StatusTryAgainLater, "client does not keep up with updates")
+	case errors.Is(err, hub.ErrHubClosed):
+		err = connection.Close(websocket.StatusGoingAway, "server is shutting down")
+	default:
+		return
+	}
+	if err != nil {
+		logger.Logger.Debug("Failed to close WebSocket", zap.Error(err))
+	}
+}
+
+// subscribe to updates before snapshot is read, so updates made while reading are not lost
+func (container Container) subscribe(writer http.ResponseWriter, request *http.Request) (*hub.Subscription, []*response.GetMetricResponse, bool) {
+	pattern := request.URL.Query().Get("match")
+	selector, err := hub.MatchPattern(pattern)
+	if err != nil {
+		WriteJSONErrorResponse(http.StatusBadRequest, writer, "Invalid request received", err)
+		return nil, nil, false
+	}
+
+	subscription, err := container.hub.Subscribe(selector, streamLimit)
+	switch {
+	case errors.Is(err, hub.ErrHubClosed):
+		WriteJSONErrorResponse(http.StatusServiceUnavailable, writer, "Server is shutting down", err)
+		return nil, nil, false
+	case err != nil:
+		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t subscribe to updates", err)
+		return nil, nil, false
+	}
+
+	snapshot, err := container.snapshot(request.Context(), pattern)
+	if err != nil {
+		subscription.Close()
+		WriteJSONErrorResponse(http.StatusInternalServerError, writer, "Can`t get metrics", err)
+		return nil, nil, false
+	}
+
+	return subscription, snapshot, true
+}
+
+func (container Container) snapshot(ctx context.Context, pattern string) ([]*response.GetMetricResponse, error) {
+	records, err := container.manager.GetFiltered(ctx, storage.Filter{Match: pattern})
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]*response.GetMetricResponse, 0)
+	for record, err := range records {
+		if err != nil {
+			return nil, err
+		}
+
+		item, err := transformer.TransformToGetResponse(record.Metric)
+		if err != nil {
+			return nil, err
+		}
+		// metrics written by older versions have no update time
+		if !record.UpdatedAt.IsZero() {
+			item.UpdatedAt = &record.UpdatedAt
+		}
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+// forward sends updates until subscription fails, client disconnects or send fails.
+// Heartbeat is sent if there are no updates for heartbeatInterval
+func forward(
+	ctx context.Context,
+	subscription *hub.Subscription,
+	send func(items []*response.GetMetricResponse) error,
+	heartbeat func() error,
+) error {
+	for {
+		waitCtx, cancel := context.WithTimeout(ctx, heartbeatInterval)
+		updates, err := subscription.Next(waitCtx)
+		cancel()
+
+		switch {
+		case errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil:
+			if err := heartbeat(); err != nil {
+				return err
+			}
+			continue
+		case err != nil:
+			return err
+		}
+
+		items, err := toGetResponses(updates)
+		if err != nil {
+			return err
+		}
+		if err := send(items); err != nil {
+			return err
+		}
+	}
+}
+
+// toGetResponses marks deleted metrics, including expired ones, so clients could drop them
+func toGetResponses(updates []hub.Update) ([]*response.GetMetricResponse, error) {
+	items := make([]*response.GetMetricResponse, 0, len(updates))
+	for _, update := range updates {
+		item, err := transformer.TransformToGetResponse(update.Metric)
+		if err != nil {
+			return nil, err
+		}
+		item.Deleted = update.Deleted
+		items = append(items, item)
+	}
+
+	return items, nil
+}
+
+func writeEvent(writer http.ResponseWriter, event string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(writer, "event: %s\ndata: %s\n\n", event, encoded)
+
+	return err
+}
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/factory"
+	"github.com/m1khal3v/gometheus/internal/server/manager"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+)
+
+// maxWait limits long polling, so connections are not held by clients forever
+const maxWait = time.Minute
+
+// parseWait parses long polling parameters: wait timeout and revision or value which metric must differ from.
+// Zero wait means metric is returned immediately, nil condition means metric must differ from its current value
+func parseWait(query url.Values, metricType, metricName string) (time.Duration, manager.Condition, error) {
+	if query.Get("wait") == "" {
+		return 0, nil, nil
+	}
+
+	wait, err := time.ParseDuration(query.Get("wait"))
+	if err != nil || wait <= 0 || wait > maxWait {
+		return 0, nil, fmt.Errorf("wait must be duration between 0 and %s", maxWait)
+	}
+
+	revision, value := query.Get("revision"), query.Get("value")
+	switch {
+	case revision != "" && value != "":
+		return 0, nil, errors.New("only one of revision and value could be set")
+	case revision != "":
+		after, err := strconv.ParseUint(revision, 10, 64)
+		if err != nil {
+			return 0, nil, fmt.Errorf("invalid revision: %w", err)
+		}
+
+		return wait, manager.RevisionAfter(after), nil
+	case value != "":
+		metric, err := factory.New(metricType, metricName, value)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		return wait, manager.ValueDiffers(metric), nil
+	default:
+		return wait, nil, nil
+	}
+}
+
+// getRecord returns metric immediately or waits until condition is met. Metric is returned as is after wait timeout
+func (container Container) getRecord(
+	request *http.Request,
+	metricType, metricName string,
+	wait time.Duration,
+	condition manager.Condition,
+) (*storage.Record, error) {
+	if wait == 0 {
+		return container.manager.GetRecord(request.Context(), metricType, metricName)
+	}
+
+	if condition == nil {
+		current, err := container.manager.GetRecord(request.Context(), metricType, metricName)
+		if err != nil {
+			return nil, err
+		}
+		var metric metric.Metric
+		if current != nil {
+			metric = current.Metric
+		}
+		condition = manager.ValueDiffers(metric)
+	}
+
+	ctx, cancel := context.WithTimeout(request.Context(), wait)
+	defer cancel()
+
+	record, err := container.manager.Wait(ctx, metricType, metricName, condition)
+	// metric is not changed until timeout, client receives its current state
+	if errors.Is(err, context.DeadlineExceeded) && request.Context().Err() == nil {
+		return record, nil
+	}
+
+	return record, err
+}
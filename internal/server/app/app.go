@@ -14,15 +14,26 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/m1khal3v/gometheus/internal/common/logger"
 	"github.com/m1khal3v/gometheus/internal/common/pprof"
+	"github.com/m1khal3v/gometheus/internal/server/alerting"
 	"github.com/m1khal3v/gometheus/internal/server/config"
+	"github.com/m1khal3v/gometheus/internal/server/expiry"
+	"github.com/m1khal3v/gometheus/internal/server/hub"
+	"github.com/m1khal3v/gometheus/internal/server/manager"
 	"github.com/m1khal3v/gometheus/internal/server/router"
 	"github.com/m1khal3v/gometheus/internal/server/rpc"
 	"github.com/m1khal3v/gometheus/internal/server/storage/factory"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/buffer"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/cache"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/dump"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/fault"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/instrument"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/pgsql"
 	"go.uber.org/zap"
 )
 
@@ -34,6 +45,108 @@ func Start(config *config.Config) error {
 	suspendCtx, suspendCancel := signal.NotifyContext(ctx, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
 	defer suspendCancel()
 
+	dumpEncoding, err := dump.ParseEncoding(config.DumpEncoding)
+	if err != nil {
+		return err
+	}
+
+	dumpCompression, err := dump.ParseCompression(config.DumpCompression)
+	if err != nil {
+		return err
+	}
+
+	restoreMode, err := dump.ParseRestoreMode(config.RestoreMode)
+	if err != nil {
+		return err
+	}
+
+	ttlRules, err := expiry.ParseRules(config.MetricTTLRules)
+	if err != nil {
+		return err
+	}
+
+	ttlPolicy := expiry.NewPolicy(config.MetricTTL, ttlRules...)
+	if ttlPolicy.Enabled() && config.MetricTTLInterval <= 0 {
+		return fmt.Errorf("metric TTL interval must be positive, got %s", config.MetricTTLInterval)
+	}
+
+	var alertRules []alerting.Rule
+	var alertWebhooks []string
+	if config.AlertRulesFile != "" {
+		alertRules, err = alerting.LoadRules(config.AlertRulesFile)
+		if err != nil {
+			return err
+		}
+		if config.AlertInterval <= 0 {
+			return fmt.Errorf("alert interval must be positive, got %s", config.AlertInterval)
+		}
+
+		for _, url := range strings.Split(config.AlertWebhooks, ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				alertWebhooks = append(alertWebhooks, url)
+			}
+		}
+	}
+
+	dumpOptions := []dump.Option{
+		dump.WithEncoding(dumpEncoding),
+		dump.WithCompression(dumpCompression),
+		dump.WithHistory(config.DumpHistorySize, config.DumpHistoryMaxAge),
+		dump.WithRestoreMode(restoreMode),
+	}
+	if config.RestoreAt != "" {
+		restoreAt, err := time.Parse(time.RFC3339, config.RestoreAt)
+		if err != nil {
+			return err
+		}
+
+		dumpOptions = append(dumpOptions, dump.WithRestoreAt(restoreAt))
+	}
+
+	factoryOptions := []factory.Option{factory.WithDumpOptions(dumpOptions...)}
+	if config.BufferSize > 0 {
+		factoryOptions = append(factoryOptions, factory.WithBuffer(
+			buffer.WithSize(config.BufferSize),
+			buffer.WithFlushInterval(config.BufferFlushInterval),
+		))
+	}
+
+	if config.CacheSize > 0 {
+		factoryOptions = append(factoryOptions, factory.WithCache(
+			cache.WithSize(config.CacheSize),
+			cache.WithTTL(config.CacheTTL),
+		))
+	}
+
+	if config.DatabaseMaxConns > 0 {
+		factoryOptions = append(factoryOptions, factory.WithPgsqlOptions(pgsql.WithMaxConns(int32(config.DatabaseMaxConns))))
+	}
+
+	if config.DatabaseMinConns > 0 {
+		factoryOptions = append(factoryOptions, factory.WithPgsqlOptions(pgsql.WithMinConns(int32(config.DatabaseMinConns))))
+	}
+
+	if config.DatabaseStmtCache > 0 {
+		factoryOptions = append(factoryOptions, factory.WithPgsqlOptions(pgsql.WithStatementCacheCapacity(config.DatabaseStmtCache)))
+	}
+
+	if config.DatabaseNotify {
+		factoryOptions = append(factoryOptions, factory.WithPgsqlOptions(pgsql.WithChangeNotifications()))
+	}
+
+	faultRules, err := fault.ParseRules(config.FaultInjection)
+	if err != nil {
+		return err
+	}
+
+	if len(faultRules) > 0 {
+		logger.Logger.Warn("Storage fault injection is enabled", zap.String("rules", config.FaultInjection))
+		factoryOptions = append(factoryOptions, factory.WithFaults(faultRules...))
+	}
+
+	collector := instrument.NewCollector()
+	factoryOptions = append(factoryOptions, factory.WithInstrumentation(collector))
+
 	storage, err := factory.New(
 		suspendCtx,
 		config.FileStoragePath,
@@ -41,11 +154,32 @@ func Start(config *config.Config) error {
 		config.DatabaseDSN,
 		config.StoreInterval,
 		config.Restore,
+		factoryOptions...,
 	)
 	if err != nil {
 		return err
 	}
 
+	// saved and deleted metrics are published to live update streams
+	updates := hub.New()
+	// servers and background jobs share manager, so its waiters and streams see all changes
+	storageManager := manager.New(storage, manager.WithPublisher(updates))
+
+	if ttlPolicy.Enabled() {
+		go expiry.NewSweeper(storageManager, ttlPolicy, config.MetricTTLInterval).Start(suspendCtx)
+	}
+
+	if config.AlertRulesFile != "" {
+		var notifier alerting.Notifier
+		if len(alertWebhooks) > 0 {
+			webhook := alerting.NewWebhook(alertWebhooks)
+			go webhook.Start(suspendCtx)
+			notifier = webhook
+		}
+
+		go alerting.NewEngine(storageManager, alertRules, notifier, config.AlertInterval).Start(suspendCtx)
+	}
+
 	errCtx, errCancel := context.WithCancelCause(ctx)
 	defer errCancel(nil)
 
@@ -71,7 +205,7 @@ func Start(config *config.Config) error {
 		// Настройка HTTP-сервера
 		server := &http.Server{
 			Addr:    config.Address,
-			Handler: router.New(storage, config.Key, privKey, subnet),
+			Handler: router.New(storageManager, config.Key, privKey, subnet, config.AdminToken, collector, updates),
 		}
 		shutdown = func(ctx context.Context) error {
 			return server.Shutdown(ctx)
@@ -84,7 +218,7 @@ func Start(config *config.Config) error {
 		}()
 
 	} else {
-		opts := []rpc.ServerOption{}
+		opts := []rpc.ServerOption{rpc.WithHub(updates)}
 		if config.Key != "" {
 			opts = append(opts, rpc.WithHMAC(config.Key, "X-Signature", sha256.New))
 		}
@@ -97,7 +231,11 @@ func Start(config *config.Config) error {
 			opts = append(opts, rpc.WithSubnet("X-Real-IP", subnet))
 		}
 
-		server, err := rpc.NewGRPCServer(storage, opts...)
+		if config.AdminToken != "" {
+			opts = append(opts, rpc.WithAdminToken(config.AdminToken))
+		}
+
+		server, err := rpc.NewGRPCServer(storageManager, opts...)
 		if err != nil {
 			errCancel(err)
 		}
@@ -126,6 +264,9 @@ func Start(config *config.Config) error {
 
 		logger.Logger.Info("Received suspend signal. Trying to shutdown gracefully...")
 
+		// streams are finished first, otherwise server shutdown waits for them
+		updates.Close()
+
 		if err := storage.Close(timeoutCtx); err != nil {
 			logger.Logger.Error("Failed to close storage", zap.Error(err))
 		} else {
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"encoding/json"
@@ -8,15 +9,24 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"regexp"
+	"strings"
 	"testing"
+	"time"
 
+	"github.com/coder/websocket"
+	"github.com/coder/websocket/wsjson"
 	"github.com/m1khal3v/gometheus/internal/common/metric"
 	"github.com/m1khal3v/gometheus/internal/common/metric/factory"
 	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
 	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
 	"github.com/m1khal3v/gometheus/internal/common/metric/transformer"
+	"github.com/m1khal3v/gometheus/internal/server/hub"
+	"github.com/m1khal3v/gometheus/internal/server/manager"
 	"github.com/m1khal3v/gometheus/internal/server/router"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/instrument"
 	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
 	responses "github.com/m1khal3v/gometheus/pkg/response"
 	"github.com/stretchr/testify/assert"
@@ -38,7 +48,7 @@ func testRequest(t *testing.T, server *httptest.Server, method string, path stri
 
 func TestSaveMetric(t *testing.T) {
 	storage := memory.New()
-	server := httptest.NewServer(router.New(storage, "", nil, nil))
+	server := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, "", nil, nil))
 	defer server.Close()
 	tests := []struct {
 		method             string
@@ -188,7 +198,7 @@ type saveMetricRequest struct {
 
 func TestSaveMetricJSON(t *testing.T) {
 	storage := memory.New()
-	server := httptest.NewServer(router.New(storage, "", nil, nil))
+	server := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, "", nil, nil))
 	defer server.Close()
 	tests := []struct {
 		method             string
@@ -365,7 +375,7 @@ func TestSaveMetricJSON(t *testing.T) {
 
 func TestSaveMetricsJSON(t *testing.T) {
 	storage := memory.New()
-	server := httptest.NewServer(router.New(storage, "", nil, nil))
+	server := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, "", nil, nil))
 	defer server.Close()
 	tests := []struct {
 		method             string
@@ -736,7 +746,7 @@ func TestGetMetric(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
 			storage := memory.New()
-			server := httptest.NewServer(router.New(storage, "", nil, nil))
+			server := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, "", nil, nil))
 			defer server.Close()
 
 			for _, metric := range tt.preset {
@@ -875,7 +885,7 @@ func TestGetMetricJSON(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
 			storage := memory.New()
-			server := httptest.NewServer(router.New(storage, "", nil, nil))
+			server := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, "", nil, nil))
 			defer server.Close()
 
 			for _, metric := range tt.preset {
@@ -901,14 +911,86 @@ func TestGetMetricJSON(t *testing.T) {
 			if tt.expectedStatusCode == http.StatusOK {
 				expectedResponse, err := transformer.TransformToGetResponse(tt.expected)
 				require.NoError(t, err)
-				expectedResponseBody, err := json.Marshal(expectedResponse)
-				require.NoError(t, err)
-				assert.Equal(t, string(expectedResponseBody), body)
+				got := &responses.GetMetricResponse{}
+				require.NoError(t, json.Unmarshal([]byte(body), got))
+				require.NotNil(t, got.UpdatedAt)
+				assert.WithinDuration(t, time.Now(), *got.UpdatedAt, time.Minute)
+				got.UpdatedAt = nil
+				assert.NotZero(t, got.Revision)
+				got.Revision = 0
+				assert.Equal(t, expectedResponse, got)
 			}
 		})
 	}
 }
 
+func TestGetMetric_wait(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	require.NoError(t, storage.Save(ctx, counter.New("requests", 1)))
+	server := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, "", nil, nil))
+	defer server.Close()
+
+	// update is sent while request is waiting or before it, result is the same
+	update := func() {
+		go func() {
+			time.Sleep(20 * time.Millisecond)
+			response, _ := testRequest(t, server, http.MethodPost, "/update/counter/requests/2", nil)
+			assert.NoError(t, response.Body.Close())
+		}()
+	}
+
+	t.Run("value", func(t *testing.T) {
+		update()
+		response, body := testRequest(t, server, http.MethodGet, "/value/counter/requests?wait=5s&value=1", nil)
+		require.NoError(t, response.Body.Close())
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "3", body)
+	})
+
+	t.Run("json revision", func(t *testing.T) {
+		request := []byte(`{"id":"requests","type":"counter"}`)
+		response, body := testRequest(t, server, http.MethodPost, "/value/", request)
+		require.NoError(t, response.Body.Close())
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		current := &responses.GetMetricResponse{}
+		require.NoError(t, json.Unmarshal([]byte(body), current))
+
+		update()
+		response, body = testRequest(t, server, http.MethodPost, fmt.Sprintf("/value/?wait=5s&revision=%d", current.Revision), request)
+		require.NoError(t, response.Body.Close())
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		got := &responses.GetMetricResponse{}
+		require.NoError(t, json.Unmarshal([]byte(body), got))
+		require.NotNil(t, got.Delta)
+		assert.Equal(t, int64(5), *got.Delta)
+		assert.Greater(t, got.Revision, current.Revision)
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		started := time.Now()
+		response, body := testRequest(t, server, http.MethodGet, "/value/counter/requests?wait=50ms", nil)
+		require.NoError(t, response.Body.Close())
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "5", body)
+		assert.GreaterOrEqual(t, time.Since(started), 50*time.Millisecond)
+
+		response, _ = testRequest(t, server, http.MethodGet, "/value/gauge/missing?wait=50ms", nil)
+		require.NoError(t, response.Body.Close())
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		for _, query := range []string{"wait=soon", "wait=0s", "wait=2m", "wait=1s&revision=-1", "wait=1s&value=1.5", "wait=1s&value=1&revision=1"} {
+			t.Run(query, func(t *testing.T) {
+				response, _ := testRequest(t, server, http.MethodGet, "/value/counter/requests?"+query, nil)
+				require.NoError(t, response.Body.Close())
+				assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+			})
+		}
+	})
+}
+
 func TestGetAllMetrics(t *testing.T) {
 	tests := []struct {
 		method             string
@@ -952,7 +1034,7 @@ func TestGetAllMetrics(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
 			storage := memory.New()
-			server := httptest.NewServer(router.New(storage, "", nil, nil))
+			server := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, "", nil, nil))
 			defer server.Close()
 
 			for _, metric := range tt.preset {
@@ -974,7 +1056,7 @@ func TestGetAllMetrics(t *testing.T) {
 			if tt.expectedStatusCode == http.StatusOK {
 				for _, metric := range tt.preset {
 					assert.Regexp(t, regexp.MustCompile(fmt.Sprintf(
-						"<tr>\\n +<td>%s<\\/td>\\n +<td>%s<\\/td>\\n +<td>%s<\\/td>\\n +<\\/tr>",
+						"<tr>\\n +<td>%s<\\/td>\\n +<td>%s<\\/td>\\n +<td>%s<\\/td>\\n +<td>\\d{4}-\\d{2}-\\d{2} \\d{2}:\\d{2}:\\d{2} UTC<\\/td>\\n +<\\/tr>",
 						regexp.QuoteMeta(metric.Name()),
 						regexp.QuoteMeta(metric.Type()),
 						regexp.QuoteMeta(metric.StringValue()),
@@ -984,3 +1066,434 @@ func TestGetAllMetrics(t *testing.T) {
 		})
 	}
 }
+
+func TestDeleteMetric(t *testing.T) {
+	tests := []struct {
+		name               string
+		adminToken         string
+		authorization      string
+		metricType         string
+		metricName         string
+		expectedStatusCode int
+		expectedBody       string
+		expectedLeft       metric.Metric
+	}{
+		{
+			name:               "valid counter",
+			adminToken:         "secret",
+			authorization:      "Bearer secret",
+			metricType:         "counter",
+			metricName:         "c1",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       "123",
+		},
+		{
+			name:               "type mismatch",
+			adminToken:         "secret",
+			authorization:      "Bearer secret",
+			metricType:         "gauge",
+			metricName:         "c1",
+			expectedStatusCode: http.StatusNotFound,
+			expectedBody:       "{\"code\":404,\"message\":\"Metric not found\",\"details\":[]}",
+			expectedLeft:       counter.New("c1", 123),
+		},
+		{
+			name:               "invalid token",
+			adminToken:         "secret",
+			authorization:      "Bearer public",
+			metricType:         "counter",
+			metricName:         "c1",
+			expectedStatusCode: http.StatusUnauthorized,
+			expectedBody:       "{\"code\":401,\"message\":\"Invalid admin token\",\"details\":[]}",
+			expectedLeft:       counter.New("c1", 123),
+		},
+		{
+			name:               "admin API disabled",
+			metricType:         "counter",
+			metricName:         "c1",
+			expectedStatusCode: http.StatusForbidden,
+			expectedBody:       "{\"code\":403,\"message\":\"Admin API is disabled\",\"details\":[]}",
+			expectedLeft:       counter.New("c1", 123),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := memory.New()
+			require.NoError(t, storage.Save(ctx, counter.New("c1", 123)))
+			server := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, tt.adminToken, nil, nil))
+			defer server.Close()
+
+			request, err := http.NewRequest(http.MethodDelete, fmt.Sprintf("%s/value/%s/%s", server.URL, tt.metricType, tt.metricName), nil)
+			require.NoError(t, err)
+			request.Header.Set("Authorization", tt.authorization)
+			response, err := server.Client().Do(request)
+			require.NoError(t, err)
+			defer response.Body.Close()
+			body, err := io.ReadAll(response.Body)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.expectedStatusCode, response.StatusCode)
+			assert.Equal(t, tt.expectedBody, string(body))
+			left, err := storage.Get(ctx, "c1")
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedLeft, left)
+		})
+	}
+}
+
+func TestListMetrics(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	require.NoError(t, storage.SaveBatch(ctx, []metric.Metric{
+		gauge.New("cpu.user", 1.5),
+		counter.New("cpu.count", 2),
+		gauge.New("mem.free", 3.5),
+		counter.New("mem.swaps", 4),
+		gauge.New("disk.free", 5.5),
+	}))
+	server := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, "", nil, nil))
+	defer server.Close()
+
+	list := func(t *testing.T, query string) responses.ListMetricsResponse {
+		response, body := testRequest(t, server, http.MethodGet, "/values?"+query, nil)
+		require.NoError(t, response.Body.Close())
+		require.Equal(t, http.StatusOK, response.StatusCode, body)
+		assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+
+		page := responses.ListMetricsResponse{}
+		require.NoError(t, json.Unmarshal([]byte(body), &page))
+
+		return page
+	}
+	names := func(page responses.ListMetricsResponse) []string {
+		names := make([]string, 0, len(page.Metrics))
+		for _, item := range page.Metrics {
+			names = append(names, item.MetricName)
+		}
+
+		return names
+	}
+
+	t.Run("filters", func(t *testing.T) {
+		tests := []struct {
+			query string
+			want  []string
+		}{
+			{query: "", want: []string{"cpu.count", "cpu.user", "disk.free", "mem.free", "mem.swaps"}},
+			{query: "type=counter", want: []string{"cpu.count", "mem.swaps"}},
+			{query: "prefix=mem", want: []string{"mem.free", "mem.swaps"}},
+			{query: "match=*.free&sort=-name", want: []string{"mem.free", "disk.free"}},
+			{query: "type=gauge&prefix=zzz", want: []string{}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.query, func(t *testing.T) {
+				page := list(t, tt.query)
+				assert.Equal(t, tt.want, names(page))
+				assert.Empty(t, page.NextCursor)
+			})
+		}
+	})
+
+	t.Run("item", func(t *testing.T) {
+		page := list(t, "prefix=cpu.user")
+		require.Len(t, page.Metrics, 1)
+		require.NotNil(t, page.Metrics[0].Value)
+		assert.Equal(t, gauge.MetricType, page.Metrics[0].MetricType)
+		assert.Equal(t, 1.5, *page.Metrics[0].Value)
+		assert.NotNil(t, page.Metrics[0].UpdatedAt)
+	})
+
+	t.Run("pagination", func(t *testing.T) {
+		pages := [][]string{}
+		cursor := ""
+		for {
+			page := list(t, "sort=-name&limit=2&cursor="+cursor)
+			pages = append(pages, names(page))
+			if page.NextCursor == "" {
+				break
+			}
+			cursor = page.NextCursor
+		}
+		assert.Equal(t, [][]string{{"mem.swaps", "mem.free"}, {"disk.free", "cpu.user"}, {"cpu.count"}}, pages)
+
+		// last page is not followed by empty one
+		assert.Empty(t, list(t, "limit=5").NextCursor)
+	})
+
+	t.Run("invalid request", func(t *testing.T) {
+		for _, query := range []string{"type=histogram", "match=[a-", "sort=value", "limit=0", "limit=1001", "limit=ten", "cursor=***"} {
+			t.Run(query, func(t *testing.T) {
+				response, _ := testRequest(t, server, http.MethodGet, "/values?"+query, nil)
+				require.NoError(t, response.Body.Close())
+				assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+			})
+		}
+	})
+}
+
+func TestListChanges(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	server := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, "", nil, nil))
+	defer server.Close()
+
+	changes := func(t *testing.T, since uint64) responses.ChangesResponse {
+		response, body := testRequest(t, server, http.MethodGet, fmt.Sprintf("/changes?since=%d", since), nil)
+		require.NoError(t, response.Body.Close())
+		require.Equal(t, http.StatusOK, response.StatusCode, body)
+		assert.Equal(t, "application/json", response.Header.Get("Content-Type"))
+
+		changes := responses.ChangesResponse{}
+		require.NoError(t, json.Unmarshal([]byte(body), &changes))
+
+		return changes
+	}
+	names := func(changes responses.ChangesResponse) []string {
+		names := make([]string, 0, len(changes.Metrics))
+		for _, item := range changes.Metrics {
+			names = append(names, item.MetricName)
+		}
+
+		return names
+	}
+
+	start := changes(t, 0)
+	assert.Empty(t, start.Metrics)
+
+	require.NoError(t, storage.Save(ctx, gauge.New("cpu", 1.5)))
+	require.NoError(t, storage.SaveBatch(ctx, []metric.Metric{counter.New("requests", 2), gauge.New("mem", 3.5)}))
+	first := changes(t, start.Revision)
+	assert.Equal(t, []string{"cpu", "requests", "mem"}, names(first))
+	require.NotNil(t, first.Metrics[0].Value)
+	assert.Equal(t, 1.5, *first.Metrics[0].Value)
+	assert.NotNil(t, first.Metrics[0].UpdatedAt)
+	assert.Greater(t, first.Metrics[0].Revision, start.Revision)
+	assert.LessOrEqual(t, first.Metrics[2].Revision, first.Revision)
+
+	require.NoError(t, storage.Save(ctx, gauge.New("mem", 4.5)))
+	second := changes(t, first.Revision)
+	assert.Equal(t, []string{"mem"}, names(second))
+	assert.Equal(t, second.Metrics[0].Revision, second.Revision)
+	assert.Empty(t, changes(t, second.Revision).Metrics)
+
+	t.Run("invalid since", func(t *testing.T) {
+		for _, since := range []string{"-1", "head", "1.5"} {
+			response, _ := testRequest(t, server, http.MethodGet, "/changes?since="+since, nil)
+			require.NoError(t, response.Body.Close())
+			assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+		}
+	})
+
+	t.Run("not supported", func(t *testing.T) {
+		// embedded interface hides change feed methods of memory storage
+		server := httptest.NewServer(router.New(manager.New(struct{ store.Storage }{memory.New()}), "", nil, nil, "", nil, nil))
+		defer server.Close()
+
+		response, _ := testRequest(t, server, http.MethodGet, "/changes", nil)
+		require.NoError(t, response.Body.Close())
+		assert.Equal(t, http.StatusNotImplemented, response.StatusCode)
+	})
+}
+
+func TestQuery(t *testing.T) {
+	storage := memory.New()
+	require.NoError(t, storage.SaveBatch(context.Background(), []metric.Metric{
+		gauge.New("CPUutilization1", 10),
+		gauge.New("CPUutilization2", 30),
+		counter.New("PollCount", 5),
+	}))
+	server := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, "", nil, nil))
+	defer server.Close()
+
+	tests := []struct {
+		query              string
+		expectedStatusCode int
+		expectedBody       string
+	}{
+		{
+			query:              "sum(CPUutilization*) + 1",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"type":"scalar","value":41}`,
+		},
+		{
+			query:              "count(missing*)",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"type":"scalar","value":0}`,
+		},
+		{
+			query:              "CPUutilization* / 10",
+			expectedStatusCode: http.StatusOK,
+			expectedBody:       `{"type":"vector","metrics":[{"id":"CPUutilization1","value":1},{"id":"CPUutilization2","value":3}]}`,
+		},
+		{
+			query:              "",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			query:              "sum(CPUutilization*",
+			expectedStatusCode: http.StatusBadRequest,
+		},
+		{
+			query:              "PollCount / 0",
+			expectedStatusCode: http.StatusUnprocessableEntity,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			response, body := testRequest(t, server, http.MethodGet, "/query?q="+url.QueryEscape(tt.query), nil)
+			require.NoError(t, response.Body.Close())
+			assert.Equal(t, tt.expectedStatusCode, response.StatusCode)
+			if tt.expectedBody != "" {
+				assert.JSONEq(t, tt.expectedBody, body)
+			}
+		})
+	}
+}
+
+// readEvent reads one Server-Sent Event, comments are skipped
+func readEvent(t *testing.T, reader *bufio.Reader) (string, string) {
+	t.Helper()
+	var event, data string
+	for {
+		line, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		line = strings.TrimSuffix(line, "\n")
+
+		switch {
+		case line == "" && event != "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestStream(t *testing.T) {
+	storage := memory.New()
+	require.NoError(t, storage.Save(context.Background(), gauge.New("cpu1", 1.5)))
+	updates := hub.New()
+	server := httptest.NewServer(router.New(manager.New(storage, manager.WithPublisher(updates)), "", nil, nil, "", nil, updates))
+	defer server.Close()
+
+	response, err := server.Client().Get(server.URL + "/stream?match=cpu*")
+	require.NoError(t, err)
+	defer response.Body.Close()
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Equal(t, "text/event-stream", response.Header.Get("Content-Type"))
+	reader := bufio.NewReader(response.Body)
+
+	// snapshot
+	event, data := readEvent(t, reader)
+	assert.Equal(t, "metric", event)
+	assert.Contains(t, data, `"id":"cpu1","type":"gauge","value":1.5`)
+
+	// updates of other metrics are filtered out
+	for _, path := range []string{"/update/gauge/memory/1", "/update/counter/cpu2/2", "/update/counter/cpu2/3"} {
+		updateResponse, _ := testRequest(t, server, http.MethodPost, path, nil)
+		require.NoError(t, updateResponse.Body.Close())
+	}
+	received := map[string]string{}
+	for len(received) == 0 || !strings.Contains(received["cpu2"], `"delta":5`) {
+		event, data = readEvent(t, reader)
+		assert.Equal(t, "metric", event)
+		update := responses.GetMetricResponse{}
+		require.NoError(t, json.Unmarshal([]byte(data), &update))
+		received[update.MetricName] = data
+	}
+	assert.NotContains(t, received, "memory")
+
+	updates.Close()
+	event, data = readEvent(t, reader)
+	assert.Equal(t, "error", event)
+	assert.Contains(t, data, "Server is shutting down")
+	_, err = reader.ReadString('\n')
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	require.NoError(t, storage.Save(ctx, gauge.New("cpu1", 1.5)))
+	updates := hub.New()
+	storageManager := manager.New(storage, manager.WithPublisher(updates))
+	server := httptest.NewServer(router.New(storageManager, "", nil, nil, "", nil, updates))
+	defer server.Close()
+
+	connection, _, err := websocket.Dial(ctx, "ws"+strings.TrimPrefix(server.URL, "http")+"/stream/ws?match=cpu*", nil)
+	require.NoError(t, err)
+	defer connection.CloseNow()
+
+	item := responses.GetMetricResponse{}
+	require.NoError(t, wsjson.Read(ctx, connection, &item))
+	assert.Equal(t, "cpu1", item.MetricName)
+	require.NotNil(t, item.UpdatedAt)
+
+	updateResponse, _ := testRequest(t, server, http.MethodPost, "/update/counter/cpu2/2", nil)
+	require.NoError(t, updateResponse.Body.Close())
+	item = responses.GetMetricResponse{}
+	require.NoError(t, wsjson.Read(ctx, connection, &item))
+	assert.Equal(t, "cpu2", item.MetricName)
+	require.NotNil(t, item.Delta)
+	assert.Equal(t, int64(2), *item.Delta)
+
+	// metrics deleted through shared manager, e.g. by expiry, are sent with deleted flag
+	_, err = storageManager.Delete(ctx, "gauge", "cpu1")
+	require.NoError(t, err)
+	item = responses.GetMetricResponse{}
+	require.NoError(t, wsjson.Read(ctx, connection, &item))
+	assert.Equal(t, "cpu1", item.MetricName)
+	assert.True(t, item.Deleted)
+
+	updates.Close()
+	err = wsjson.Read(ctx, connection, &item)
+	assert.Equal(t, websocket.StatusGoingAway, websocket.CloseStatus(err))
+}
+
+func TestStream_errors(t *testing.T) {
+	updates := hub.New()
+	server := httptest.NewServer(router.New(manager.New(memory.New(), manager.WithPublisher(updates)), "", nil, nil, "", nil, updates))
+	defer server.Close()
+
+	response, _ := testRequest(t, server, http.MethodGet, "/stream?match=[a-", nil)
+	require.NoError(t, response.Body.Close())
+	assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+	updates.Close()
+	response, _ = testRequest(t, server, http.MethodGet, "/stream/ws", nil)
+	require.NoError(t, response.Body.Close())
+	assert.Equal(t, http.StatusServiceUnavailable, response.StatusCode)
+
+	// streams are not served without hub
+	withoutHub := httptest.NewServer(router.New(manager.New(memory.New()), "", nil, nil, "", nil, nil))
+	defer withoutHub.Close()
+	response, _ = testRequest(t, withoutHub, http.MethodGet, "/stream", nil)
+	require.NoError(t, response.Body.Close())
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
+
+func TestStorageMetrics(t *testing.T) {
+	collector := instrument.NewCollector()
+	storage := instrument.New(memory.New(), collector, "memory")
+	server := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, "", collector, nil))
+	defer server.Close()
+
+	response, _ := testRequest(t, server, http.MethodPost, "/update/gauge/m1/1.5", nil)
+	require.NoError(t, response.Body.Close())
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+
+	response, body := testRequest(t, server, http.MethodGet, "/metrics", nil)
+	require.NoError(t, response.Body.Close())
+	assert.Equal(t, http.StatusOK, response.StatusCode)
+	assert.Contains(t, body, `gometheus_storage_operations_total{driver="memory",operation="save"} 1`)
+	assert.Contains(t, body, `gometheus_storage_operation_duration_seconds_count{driver="memory",operation="save"} 1`)
+
+	// handler is optional
+	withoutMetrics := httptest.NewServer(router.New(manager.New(storage), "", nil, nil, "", nil, nil))
+	defer withoutMetrics.Close()
+	response, _ = testRequest(t, withoutMetrics, http.MethodGet, "/metrics", nil)
+	require.NoError(t, response.Body.Close())
+	assert.Equal(t, http.StatusNotFound, response.StatusCode)
+}
@@ -24,20 +24,42 @@ type jsonConfig struct {
 }
 
 type Config struct {
-	Address            string        `env:"ADDRESS"`
-	LogLevel           string        `env:"LOG_LEVEL"`
-	StoreInterval      uint32        `env:"STORE_INTERVAL"`
-	FileStoragePath    string        `env:"FILE_STORAGE_PATH"`
-	Restore            bool          `env:"RESTORE"`
-	DatabaseDriver     string        `env:"DATABASE_DRIVER"`
-	DatabaseDSN        string        `env:"DATABASE_DSN"`
-	Key                string        `env:"KEY"`
-	CPUProfileFile     string        `env:"CPU_PROFILE_FILE"`
-	CPUProfileDuration time.Duration `env:"CPU_PROFILE_DURATION"`
-	MemProfileFile     string        `env:"MEM_PROFILE_FILE"`
-	CryptoKey          string        `env:"CRYPTO_KEY"`
-	TrustedSubnet      string        `env:"TRUSTED_SUBNET"`
-	Protocol           string        `env:"PROTOCOL"`
+	Address             string        `env:"ADDRESS"`
+	LogLevel            string        `env:"LOG_LEVEL"`
+	StoreInterval       uint32        `env:"STORE_INTERVAL"`
+	FileStoragePath     string        `env:"FILE_STORAGE_PATH"`
+	Restore             bool          `env:"RESTORE"`
+	DatabaseDriver      string        `env:"DATABASE_DRIVER"`
+	DatabaseDSN         string        `env:"DATABASE_DSN"`
+	Key                 string        `env:"KEY"`
+	CPUProfileFile      string        `env:"CPU_PROFILE_FILE"`
+	CPUProfileDuration  time.Duration `env:"CPU_PROFILE_DURATION"`
+	MemProfileFile      string        `env:"MEM_PROFILE_FILE"`
+	CryptoKey           string        `env:"CRYPTO_KEY"`
+	TrustedSubnet       string        `env:"TRUSTED_SUBNET"`
+	Protocol            string        `env:"PROTOCOL"`
+	DumpEncoding        string        `env:"DUMP_ENCODING"`
+	DumpCompression     string        `env:"DUMP_COMPRESSION"`
+	DumpHistorySize     uint          `env:"DUMP_HISTORY_SIZE"`
+	DumpHistoryMaxAge   time.Duration `env:"DUMP_HISTORY_MAX_AGE"`
+	RestoreAt           string        `env:"RESTORE_AT"`
+	RestoreMode         string        `env:"RESTORE_MODE"`
+	DatabaseMaxConns    int           `env:"DATABASE_MAX_CONNS"`
+	DatabaseMinConns    int           `env:"DATABASE_MIN_CONNS"`
+	DatabaseStmtCache   int           `env:"DATABASE_STMT_CACHE"`
+	DatabaseNotify      bool          `env:"DATABASE_NOTIFY"`
+	BufferSize          int           `env:"BUFFER_SIZE"`
+	BufferFlushInterval time.Duration `env:"BUFFER_FLUSH_INTERVAL"`
+	CacheSize           int           `env:"CACHE_SIZE"`
+	CacheTTL            time.Duration `env:"CACHE_TTL"`
+	AdminToken          string        `env:"ADMIN_TOKEN"`
+	MetricTTL           time.Duration `env:"METRIC_TTL"`
+	MetricTTLRules      string        `env:"METRIC_TTL_RULES"`
+	MetricTTLInterval   time.Duration `env:"METRIC_TTL_INTERVAL"`
+	FaultInjection      string        `env:"FAULT_INJECTION"`
+	AlertRulesFile      string        `env:"ALERT_RULES_FILE"`
+	AlertInterval       time.Duration `env:"ALERT_INTERVAL"`
+	AlertWebhooks       string        `env:"ALERT_WEBHOOKS"`
 }
 
 func ParseConfig() *Config {
@@ -101,6 +123,28 @@ func ParseConfig() *Config {
 	flag.DurationVar(&config.CPUProfileDuration, "cpu-profile-duration", time.Second*30, "duration to save CPU profile")
 	flag.StringVar(&config.MemProfileFile, "mem-profile-file", "mem.pprof", "path to save memory profile")
 	flag.StringVar(&config.Protocol, "protocol", "http", "http/grpc")
+	flag.StringVar(&config.AdminToken, "admin-token", "", "bearer token for admin API (metric deletion), admin API is disabled if empty")
+	flag.IntVar(&config.DatabaseMaxConns, "database-max-conns", 0, "max size of postgres connection pool, 0 uses driver default")
+	flag.IntVar(&config.DatabaseMinConns, "database-min-conns", 0, "count of postgres connections kept open while pool is idle")
+	flag.IntVar(&config.DatabaseStmtCache, "database-stmt-cache", 0, "count of prepared statements cached per postgres connection, 0 uses driver default")
+	flag.BoolVar(&config.DatabaseNotify, "database-notify", false, "publish postgres changes with NOTIFY, so server replicas invalidate their caches")
+	flag.IntVar(&config.BufferSize, "buffer-size", 0, "write-behind buffer size in front of database, 0 disables buffer")
+	flag.DurationVar(&config.BufferFlushInterval, "buffer-flush-interval", time.Second, "write-behind buffer flush interval")
+	flag.IntVar(&config.CacheSize, "cache-size", 0, "count of metrics cached in front of database, 0 disables cache")
+	flag.DurationVar(&config.CacheTTL, "cache-ttl", time.Minute, "max time metric is served from cache, 0 keeps metric until eviction")
+	flag.DurationVar(&config.MetricTTL, "metric-ttl", 0, "metrics not updated for this time are deleted, 0 keeps metrics forever")
+	flag.StringVar(&config.MetricTTLRules, "metric-ttl-rules", "", "per name TTL rules: pattern=ttl,... (e.g. host_*=10m), first matched rule wins")
+	flag.DurationVar(&config.MetricTTLInterval, "metric-ttl-interval", time.Minute, "interval of stale metrics check")
+	flag.StringVar(&config.AlertRulesFile, "alert-rules-file", "", "path to JSON file with alerting rules, alerting is disabled if empty")
+	flag.DurationVar(&config.AlertInterval, "alert-interval", 30*time.Second, "interval of alerting rules evaluation")
+	flag.StringVar(&config.AlertWebhooks, "alert-webhooks", "", "comma separated URLs receiving firing and resolved alerts")
+	flag.StringVar(&config.FaultInjection, "fault-injection", "", "debug only: inject storage faults by rules operation:fault[=value][:every=N|:p=probability],...")
+	flag.StringVar(&config.DumpEncoding, "dump-encoding", "json", "dump snapshot encoding: json/protobuf")
+	flag.StringVar(&config.DumpCompression, "dump-compression", "none", "dump snapshot compression: none/gzip/zstd")
+	flag.UintVar(&config.DumpHistorySize, "dump-history-size", 0, "count of kept historical dump snapshots")
+	flag.DurationVar(&config.DumpHistoryMaxAge, "dump-history-max-age", 0, "max age of historical dump snapshots")
+	flag.StringVar(&config.RestoreMode, "restore-mode", "replace", "restore mode: replace/merge-keep-newer/merge-add-counters/skip")
+	flag.StringVar(&config.RestoreAt, "restore-at", "", "restore once from the latest historical snapshot taken at or before time (RFC3339)")
 	flag.Parse()
 
 	if err := env.Parse(config); err != nil {
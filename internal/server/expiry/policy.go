@@ -0,0 +1,117 @@
+// Package expiry
+// contains TTL policy of metrics and sweeper which deletes stale metrics
+package expiry
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+)
+
+type InvalidRuleError struct {
+	Rule string
+}
+
+func (err InvalidRuleError) Error() string {
+	return fmt.Sprintf("invalid TTL rule '%s', expected 'pattern=ttl'", err.Rule)
+}
+
+func newErrInvalidRule(rule string) error {
+	return &InvalidRuleError{
+		Rule: rule,
+	}
+}
+
+// Rule sets TTL of metrics which names match Pattern (path.Match syntax, e.g. "host_*").
+// Zero TTL disables expiry of matched metrics
+type Rule struct {
+	Pattern string
+	TTL     time.Duration
+}
+
+// ParseRules parses comma separated rules, e.g. "host_*=10m,cpu?_*=1h"
+func ParseRules(rules string) ([]Rule, error) {
+	if strings.TrimSpace(rules) == "" {
+		return nil, nil
+	}
+
+	parsed := make([]Rule, 0, strings.Count(rules, ",")+1)
+	for _, rule := range strings.Split(rules, ",") {
+		pattern, ttl, ok := strings.Cut(strings.TrimSpace(rule), "=")
+		if !ok || pattern == "" {
+			return nil, newErrInvalidRule(rule)
+		}
+
+		// pattern is validated once, so Policy.TTL could ignore match errors
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("%w: %w", newErrInvalidRule(rule), err)
+		}
+
+		duration, err := time.ParseDuration(ttl)
+		if err != nil || duration < 0 {
+			return nil, newErrInvalidRule(rule)
+		}
+
+		parsed = append(parsed, Rule{Pattern: pattern, TTL: duration})
+	}
+
+	return parsed, nil
+}
+
+type Policy struct {
+	defaultTTL time.Duration
+	rules      []Rule
+}
+
+// NewPolicy creates policy with TTL applied to metrics not matched by any rule.
+// Zero defaultTTL keeps such metrics forever
+func NewPolicy(defaultTTL time.Duration, rules ...Rule) *Policy {
+	return &Policy{
+		defaultTTL: defaultTTL,
+		rules:      rules,
+	}
+}
+
+// Enabled reports whether any metric could expire
+func (policy *Policy) Enabled() bool {
+	if policy.defaultTTL > 0 {
+		return true
+	}
+
+	for _, rule := range policy.rules {
+		if rule.TTL > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TTL of metric, first matched rule wins
+func (policy *Policy) TTL(name string) time.Duration {
+	for _, rule := range policy.rules {
+		if matched, _ := path.Match(rule.Pattern, name); matched {
+			return rule.TTL
+		}
+	}
+
+	return policy.defaultTTL
+}
+
+// IsStale reports whether metric was not updated during its TTL.
+// Records without update time (written by older versions) are never stale
+func (policy *Policy) IsStale(record *storage.Record, now time.Time) bool {
+	if record.UpdatedAt.IsZero() {
+		return false
+	}
+
+	ttl := policy.TTL(record.Metric.Name())
+	if ttl <= 0 {
+		return false
+	}
+
+	return now.Sub(record.UpdatedAt) > ttl
+}
@@ -0,0 +1,133 @@
+package expiry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		want    []Rule
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			rules: "",
+			want:  nil,
+		},
+		{
+			name:  "rules",
+			rules: "host_*=10m, cpu?_*=1h,keep=0s",
+			want: []Rule{
+				{Pattern: "host_*", TTL: 10 * time.Minute},
+				{Pattern: "cpu?_*", TTL: time.Hour},
+				{Pattern: "keep", TTL: 0},
+			},
+		},
+		{
+			name:    "missing ttl",
+			rules:   "host_*",
+			wantErr: true,
+		},
+		{
+			name:    "missing pattern",
+			rules:   "=10m",
+			wantErr: true,
+		},
+		{
+			name:    "invalid ttl",
+			rules:   "host_*=often",
+			wantErr: true,
+		},
+		{
+			name:    "negative ttl",
+			rules:   "host_*=-1m",
+			wantErr: true,
+		},
+		{
+			name:    "invalid pattern",
+			rules:   "host_[=10m",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules, err := ParseRules(tt.rules)
+			if tt.wantErr {
+				var target *InvalidRuleError
+				assert.ErrorAs(t, err, &target)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, rules)
+		})
+	}
+}
+
+func TestPolicy_IsStale(t *testing.T) {
+	now := time.Now()
+	policy := NewPolicy(time.Hour,
+		Rule{Pattern: "host_*", TTL: 10 * time.Minute},
+		Rule{Pattern: "host_keep", TTL: time.Minute}, // shadowed by previous rule
+		Rule{Pattern: "keep_*", TTL: 0},
+	)
+
+	tests := []struct {
+		name      string
+		record    *storage.Record
+		wantTTL   time.Duration
+		wantStale bool
+	}{
+		{
+			name:      "default fresh",
+			record:    &storage.Record{Metric: gauge.New("m1", 1), UpdatedAt: now.Add(-30 * time.Minute)},
+			wantTTL:   time.Hour,
+			wantStale: false,
+		},
+		{
+			name:      "default stale",
+			record:    &storage.Record{Metric: gauge.New("m1", 1), UpdatedAt: now.Add(-2 * time.Hour)},
+			wantTTL:   time.Hour,
+			wantStale: true,
+		},
+		{
+			name:      "rule stale",
+			record:    &storage.Record{Metric: gauge.New("host_keep", 1), UpdatedAt: now.Add(-30 * time.Minute)},
+			wantTTL:   10 * time.Minute,
+			wantStale: true,
+		},
+		{
+			name:      "rule disables expiry",
+			record:    &storage.Record{Metric: gauge.New("keep_me", 1), UpdatedAt: now.Add(-24 * time.Hour)},
+			wantTTL:   0,
+			wantStale: false,
+		},
+		{
+			name:      "unknown update time",
+			record:    &storage.Record{Metric: gauge.New("m1", 1)},
+			wantTTL:   time.Hour,
+			wantStale: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.wantTTL, policy.TTL(tt.record.Metric.Name()))
+			assert.Equal(t, tt.wantStale, policy.IsStale(tt.record, now))
+		})
+	}
+}
+
+func TestPolicy_Enabled(t *testing.T) {
+	assert.False(t, NewPolicy(0).Enabled())
+	assert.False(t, NewPolicy(0, Rule{Pattern: "*", TTL: 0}).Enabled())
+	assert.True(t, NewPolicy(time.Minute).Enabled())
+	assert.True(t, NewPolicy(0, Rule{Pattern: "host_*", TTL: time.Minute}).Enabled())
+}
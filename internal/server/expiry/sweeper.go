@@ -0,0 +1,90 @@
+package expiry
+
+import (
+	"context"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/logger"
+	"github.com/m1khal3v/gometheus/internal/server/manager"
+	"go.uber.org/zap"
+)
+
+type Sweeper struct {
+	manager  *manager.Manager
+	policy   *Policy
+	interval time.Duration
+	now      func() time.Time
+}
+
+// NewSweeper deletes metrics through manager, so waiters and streams of manager see expired metrics disappear
+func NewSweeper(manager *manager.Manager, policy *Policy, interval time.Duration) *Sweeper {
+	if manager == nil {
+		panic("Manager cannot be nil")
+	}
+	if interval <= 0 {
+		panic("Sweep interval must be positive")
+	}
+
+	return &Sweeper{
+		manager:  manager,
+		policy:   policy,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// Start sweeps storage every interval until ctx is done
+func (sweeper *Sweeper) Start(ctx context.Context) {
+	ticker := time.NewTicker(sweeper.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		deleted, err := sweeper.Sweep(ctx)
+		if err != nil {
+			logger.Logger.Error("Failed to sweep stale metrics", zap.Error(err))
+		}
+		if deleted > 0 {
+			logger.Logger.Info("Stale metrics were deleted", zap.Int("count", deleted))
+		}
+	}
+}
+
+// Sweep deletes stale metrics and returns their count.
+// Metric could be updated after it was read, so it is deleted only if it was not updated since its cutoff
+func (sweeper *Sweeper) Sweep(ctx context.Context) (int, error) {
+	records, err := sweeper.manager.GetAllRecords(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	now := sweeper.now()
+	stale := []string{}
+	for record, err := range records {
+		if err != nil {
+			return 0, err
+		}
+
+		if sweeper.policy.IsStale(record, now) {
+			stale = append(stale, record.Metric.Name())
+		}
+	}
+
+	deleted := 0
+	for _, name := range stale {
+		ok, err := sweeper.manager.DeleteStale(ctx, name, now.Add(-sweeper.policy.TTL(name)))
+		if err != nil {
+			return deleted, err
+		}
+		if ok {
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
@@ -0,0 +1,154 @@
+package expiry
+
+import (
+	"context"
+	"iter"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/hub"
+	"github.com/m1khal3v/gometheus/internal/server/manager"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/m1khal3v/gometheus/pkg/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSweeper_Sweep(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      *Policy
+		after       time.Duration
+		wantDeleted int
+		want        []metric.Metric
+	}{
+		{
+			name:        "nothing is stale yet",
+			policy:      NewPolicy(time.Hour),
+			after:       30 * time.Minute,
+			wantDeleted: 0,
+			want: []metric.Metric{
+				gauge.New("host_a_load", 1.5),
+				counter.New("requests", 10),
+				gauge.New("keep_uptime", 100),
+			},
+		},
+		{
+			name:        "rule expires before default",
+			policy:      NewPolicy(time.Hour, Rule{Pattern: "host_*", TTL: 10 * time.Minute}),
+			after:       30 * time.Minute,
+			wantDeleted: 1,
+			want: []metric.Metric{
+				counter.New("requests", 10),
+				gauge.New("keep_uptime", 100),
+			},
+		},
+		{
+			name:        "rule keeps metric forever",
+			policy:      NewPolicy(time.Hour, Rule{Pattern: "keep_*", TTL: 0}),
+			after:       2 * time.Hour,
+			wantDeleted: 2,
+			want: []metric.Metric{
+				gauge.New("keep_uptime", 100),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := memory.New()
+			require.NoError(t, storage.SaveBatch(ctx, []metric.Metric{
+				gauge.New("host_a_load", 1.5),
+				counter.New("requests", 10),
+				gauge.New("keep_uptime", 100),
+			}))
+
+			sweeper := NewSweeper(manager.New(storage), tt.policy, time.Minute)
+			sweeper.now = func() time.Time {
+				return time.Now().Add(tt.after)
+			}
+
+			deleted, err := sweeper.Sweep(ctx)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantDeleted, deleted)
+
+			seq, err := storage.GetAll(ctx)
+			require.NoError(t, err)
+			all, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, all)
+		})
+	}
+}
+
+// updatingStorage saves metric after records are read, like concurrent save between listing and delete
+type updatingStorage struct {
+	*memory.Storage
+	updated metric.Metric
+}
+
+func (storage *updatingStorage) GetAllRecords(ctx context.Context) (iter.Seq2[*store.Record, error], error) {
+	seq, err := storage.Storage.GetAllRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+	records, err := slice.FromSeq2(seq)
+	if err != nil {
+		return nil, err
+	}
+	if err := storage.Save(ctx, storage.updated); err != nil {
+		return nil, err
+	}
+
+	return func(yield func(*store.Record, error) bool) {
+		for _, record := range records {
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}, nil
+}
+
+func TestSweeper_SweepUpdatedMetric(t *testing.T) {
+	ctx := context.Background()
+	storage := &updatingStorage{Storage: memory.New(), updated: gauge.New("m1", 2)}
+	require.NoError(t, storage.SaveRecords(ctx, []*store.Record{
+		{Metric: gauge.New("m1", 1), UpdatedAt: time.Now().Add(-2 * time.Hour)},
+		{Metric: gauge.New("m2", 1), UpdatedAt: time.Now().Add(-2 * time.Hour)},
+	}))
+
+	deleted, err := NewSweeper(manager.New(storage), NewPolicy(time.Hour), time.Minute).Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	seq, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.Equal(t, []metric.Metric{gauge.New("m1", 2)}, all)
+}
+
+func TestSweeper_SweepPublishesDeleted(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	require.NoError(t, storage.SaveRecords(ctx, []*store.Record{
+		{Metric: gauge.New("m1", 1), UpdatedAt: time.Now().Add(-2 * time.Hour)},
+		{Metric: gauge.New("m2", 1), UpdatedAt: time.Now()},
+	}))
+	updates := hub.New()
+	subscription, err := updates.Subscribe(nil, 10)
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	deleted, err := NewSweeper(manager.New(storage, manager.WithPublisher(updates)), NewPolicy(time.Hour), time.Minute).Sweep(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, deleted)
+
+	got, err := subscription.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []hub.Update{{Metric: gauge.New("m1", 1), Deleted: true}}, got)
+}
@@ -0,0 +1,247 @@
+// Package hub
+// contains in-process pub/sub of saved and deleted metrics used by live update streams
+package hub
+
+import (
+	"context"
+	"errors"
+	"path"
+	"sync"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+)
+
+var ErrHubClosed = errors.New("hub closed")
+var ErrSubscriptionClosed = errors.New("subscription closed")
+
+// ErrSlowSubscriber is returned to subscriber which does not keep up with updates
+var ErrSlowSubscriber = errors.New("subscriber is too slow")
+
+// Selector reports whether metric with name is delivered to subscription
+type Selector func(name string) bool
+
+// MatchAll selects all metrics
+func MatchAll(string) bool {
+	return true
+}
+
+// MatchPattern selects metrics which names match pattern (path.Match syntax), empty pattern matches all metrics
+func MatchPattern(pattern string) (Selector, error) {
+	if pattern == "" {
+		return MatchAll, nil
+	}
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+
+	return func(name string) bool {
+		matched, _ := path.Match(pattern, name)
+
+		return matched
+	}, nil
+}
+
+// Update is saved metric or deleted one with its last value
+type Update struct {
+	Metric  metric.Metric
+	Deleted bool
+}
+
+type Hub struct {
+	mutex         *sync.RWMutex
+	subscriptions map[*Subscription]struct{}
+	closed        bool
+}
+
+func New() *Hub {
+	return &Hub{
+		mutex:         &sync.RWMutex{},
+		subscriptions: map[*Subscription]struct{}{},
+	}
+}
+
+// Publish never blocks, so slow subscribers cannot slow down metric saving.
+// Published metrics are shared by subscriptions, so they are cloned once
+func (hub *Hub) Publish(metrics ...metric.Metric) {
+	hub.publish(metrics, false)
+}
+
+// PublishDeleted publishes deleted metrics with their last values
+func (hub *Hub) PublishDeleted(metrics ...metric.Metric) {
+	hub.publish(metrics, true)
+}
+
+func (hub *Hub) publish(metrics []metric.Metric, deleted bool) {
+	hub.mutex.RLock()
+	defer hub.mutex.RUnlock()
+
+	if hub.closed {
+		return
+	}
+
+	updates := make([]Update, 0, len(metrics))
+	for _, metric := range metrics {
+		updates = append(updates, Update{Metric: metric.Clone(), Deleted: deleted})
+	}
+
+	for subscription := range hub.subscriptions {
+		subscription.push(updates)
+	}
+}
+
+// Subscribe to metrics chosen by selector, nil selector chooses all metrics.
+// Limit is max count of distinct metrics waiting for subscriber, subscriber exceeding it fails with ErrSlowSubscriber
+func (hub *Hub) Subscribe(selector Selector, limit int) (*Subscription, error) {
+	if limit <= 0 {
+		panic("Subscription limit must be positive")
+	}
+
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	if hub.closed {
+		return nil, ErrHubClosed
+	}
+
+	if selector == nil {
+		selector = MatchAll
+	}
+
+	subscription := &Subscription{
+		hub:      hub,
+		selector: selector,
+		limit:    limit,
+		mutex:    &sync.Mutex{},
+		pending:  map[string]int{},
+		notify:   make(chan struct{}, 1),
+	}
+	hub.subscriptions[subscription] = struct{}{}
+
+	return subscription, nil
+}
+
+// Close fails all subscriptions with ErrHubClosed, so streams could be finished before server shutdown
+func (hub *Hub) Close() {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	hub.closed = true
+	for subscription := range hub.subscriptions {
+		subscription.fail(ErrHubClosed)
+	}
+	clear(hub.subscriptions)
+}
+
+func (hub *Hub) unsubscribe(subscription *Subscription) {
+	hub.mutex.Lock()
+	defer hub.mutex.Unlock()
+
+	delete(hub.subscriptions, subscription)
+}
+
+// Subscription queues updates until they are received by Next.
+// Update of metric which is already queued replaces queued one, so memory is bounded by limit.
+// Queued metrics are shared by subscriptions, so they must not be modified
+type Subscription struct {
+	hub      *Hub
+	selector Selector
+	limit    int
+	mutex    *sync.Mutex
+	// pending contains index of queued update by name
+	pending map[string]int
+	queue   []Update
+	notify  chan struct{}
+	err     error
+}
+
+func (subscription *Subscription) push(updates []Update) {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+
+	if subscription.err != nil {
+		return
+	}
+
+	pushed := false
+	for _, update := range updates {
+		name := update.Metric.Name()
+		if !subscription.selector(name) {
+			continue
+		}
+
+		if index, ok := subscription.pending[name]; ok {
+			subscription.queue[index] = update
+		} else {
+			if len(subscription.queue) == subscription.limit {
+				subscription.failLocked(ErrSlowSubscriber)
+				return
+			}
+			subscription.pending[name] = len(subscription.queue)
+			subscription.queue = append(subscription.queue, update)
+		}
+		pushed = true
+	}
+
+	if pushed {
+		subscription.wake()
+	}
+}
+
+// Next waits for queued updates and returns them in order of first update of every metric.
+// Error is returned if subscription is failed or closed, queued updates are dropped then
+func (subscription *Subscription) Next(ctx context.Context) ([]Update, error) {
+	for {
+		subscription.mutex.Lock()
+		if subscription.err != nil {
+			subscription.mutex.Unlock()
+			return nil, subscription.err
+		}
+		if len(subscription.queue) > 0 {
+			batch := subscription.queue
+			subscription.queue = nil
+			clear(subscription.pending)
+			subscription.mutex.Unlock()
+
+			return batch, nil
+		}
+		subscription.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-subscription.notify:
+		}
+	}
+}
+
+// Close unsubscribes, pending and following Next calls return ErrSubscriptionClosed
+func (subscription *Subscription) Close() {
+	subscription.hub.unsubscribe(subscription)
+	subscription.fail(ErrSubscriptionClosed)
+}
+
+func (subscription *Subscription) fail(err error) {
+	subscription.mutex.Lock()
+	defer subscription.mutex.Unlock()
+
+	subscription.failLocked(err)
+}
+
+// failLocked keeps the first error, so failed subscription is not reported as closed
+func (subscription *Subscription) failLocked(err error) {
+	if subscription.err != nil {
+		return
+	}
+
+	subscription.err = err
+	subscription.queue = nil
+	clear(subscription.pending)
+	subscription.wake()
+}
+
+func (subscription *Subscription) wake() {
+	select {
+	case subscription.notify <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,183 @@
+package hub
+
+import (
+	"context"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHub_Publish(t *testing.T) {
+	ctx := context.Background()
+	hub := New()
+	all, err := hub.Subscribe(nil, 10)
+	require.NoError(t, err)
+	defer all.Close()
+	cpuSelector, err := MatchPattern("cpu*")
+	require.NoError(t, err)
+	cpu, err := hub.Subscribe(cpuSelector, 10)
+	require.NoError(t, err)
+	defer cpu.Close()
+
+	hub.Publish(gauge.New("cpu1", 1), counter.New("poll", 1))
+	hub.Publish(gauge.New("cpu2", 2))
+
+	got, err := all.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []Update{{Metric: gauge.New("cpu1", 1)}, {Metric: counter.New("poll", 1)}, {Metric: gauge.New("cpu2", 2)}}, got)
+
+	got, err = cpu.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []Update{{Metric: gauge.New("cpu1", 1)}, {Metric: gauge.New("cpu2", 2)}}, got)
+}
+
+func TestHub_PublishCoalesce(t *testing.T) {
+	hub := New()
+	subscription, err := hub.Subscribe(nil, 2)
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	published := counter.New("m2", 2)
+	hub.Publish(gauge.New("m1", 1), published)
+	hub.Publish(gauge.New("m1", 3))
+	// queued metric is a copy
+	published.Add(100)
+
+	got, err := subscription.Next(context.Background())
+	require.NoError(t, err)
+	// queued metric is replaced by the latest update, but keeps position of the first one
+	assert.Equal(t, []Update{{Metric: gauge.New("m1", 3)}, {Metric: counter.New("m2", 2)}}, got)
+
+	// delete replaces queued save and save replaces queued delete
+	hub.Publish(gauge.New("m1", 4))
+	hub.PublishDeleted(gauge.New("m1", 4), counter.New("m2", 2))
+	hub.Publish(counter.New("m2", 5))
+	got, err = subscription.Next(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []Update{{Metric: gauge.New("m1", 4), Deleted: true}, {Metric: counter.New("m2", 5)}}, got)
+}
+
+func TestHub_SlowSubscriber(t *testing.T) {
+	ctx := context.Background()
+	hub := New()
+	slow, err := hub.Subscribe(nil, 2)
+	require.NoError(t, err)
+	defer slow.Close()
+	fast, err := hub.Subscribe(nil, 10)
+	require.NoError(t, err)
+	defer fast.Close()
+
+	hub.Publish(gauge.New("m1", 1), gauge.New("m2", 2), gauge.New("m3", 3))
+
+	_, err = slow.Next(ctx)
+	assert.ErrorIs(t, err, ErrSlowSubscriber)
+	// failure is kept after close
+	slow.Close()
+	_, err = slow.Next(ctx)
+	assert.ErrorIs(t, err, ErrSlowSubscriber)
+
+	got, err := fast.Next(ctx)
+	require.NoError(t, err)
+	assert.Len(t, got, 3)
+}
+
+func TestHub_Close(t *testing.T) {
+	hub := New()
+	subscription, err := hub.Subscribe(nil, 10)
+	require.NoError(t, err)
+
+	result := make(chan error)
+	go func() {
+		_, err := subscription.Next(context.Background())
+		result <- err
+	}()
+	hub.Close()
+
+	select {
+	case err := <-result:
+		assert.ErrorIs(t, err, ErrHubClosed)
+	case <-time.After(time.Second):
+		t.Fatal("Next was not woken up by Close")
+	}
+
+	_, err = hub.Subscribe(nil, 10)
+	assert.ErrorIs(t, err, ErrHubClosed)
+	hub.Publish(gauge.New("m1", 1))
+}
+
+func TestSubscription_Close(t *testing.T) {
+	hub := New()
+	subscription, err := hub.Subscribe(nil, 10)
+	require.NoError(t, err)
+	hub.Publish(gauge.New("m1", 1))
+	subscription.Close()
+
+	_, err = subscription.Next(context.Background())
+	assert.ErrorIs(t, err, ErrSubscriptionClosed)
+	assert.Empty(t, hub.subscriptions)
+}
+
+func TestSubscription_NextContext(t *testing.T) {
+	hub := New()
+	subscription, err := hub.Subscribe(nil, 10)
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = subscription.Next(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestHub_Subscribe(t *testing.T) {
+	assert.PanicsWithValue(t, "Subscription limit must be positive", func() {
+		New().Subscribe(nil, 0)
+	})
+}
+
+func TestMatchPattern(t *testing.T) {
+	_, err := MatchPattern("[a-")
+	assert.ErrorIs(t, err, path.ErrBadPattern)
+
+	all, err := MatchPattern("")
+	require.NoError(t, err)
+	assert.True(t, all("any/name"))
+
+	cpu, err := MatchPattern("cpu?")
+	require.NoError(t, err)
+	assert.True(t, cpu("cpu1"))
+	assert.False(t, cpu("cpu10"))
+}
+
+func TestHub_Concurrent(t *testing.T) {
+	ctx := context.Background()
+	hub := New()
+	subscription, err := hub.Subscribe(nil, 100)
+	require.NoError(t, err)
+	defer subscription.Close()
+
+	group := &sync.WaitGroup{}
+	for i := range 10 {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for j := range 100 {
+				hub.Publish(counter.New("m"+string(rune('0'+i)), int64(j)))
+			}
+		}()
+	}
+	group.Wait()
+
+	got, err := subscription.Next(ctx)
+	require.NoError(t, err)
+	assert.Len(t, got, 10)
+	for _, update := range got {
+		assert.Equal(t, int64(99), update.Metric.(*counter.Metric).GetValue())
+	}
+}
@@ -5,7 +5,10 @@ package manager
 import (
 	"context"
 	"fmt"
+	"iter"
 	"sort"
+	"sync"
+	"time"
 
 	"github.com/m1khal3v/gometheus/internal/common/metric"
 	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
@@ -29,18 +32,45 @@ func newErrUnknownMetricType(metricType string) error {
 	}
 }
 
+// Publisher receives saved and deleted metrics, e.g. to stream them to clients. Methods must not block
+type Publisher interface {
+	Publish(metrics ...metric.Metric)
+	// PublishDeleted receives deleted metrics with their last values
+	PublishDeleted(metrics ...metric.Metric)
+}
+
 type Manager struct {
-	mutex   *mutex.NamedMutex
-	storage storage.Storage
+	mutex     *mutex.NamedMutex
+	storage   storage.Storage
+	publisher Publisher
+	waiters   *waiters
+	// subscribe subscribes waiters to changes made by other servers on the first Wait
+	subscribe *sync.Once
 }
 
-func New(storage storage.Storage) *Manager {
-	return &Manager{
-		mutex:   mutex.NewNamedMutex(),
-		storage: storage,
+type Option func(manager *Manager)
+
+// WithPublisher publishes metrics after they are saved or deleted, counters are published with accumulated value
+func WithPublisher(publisher Publisher) Option {
+	return func(manager *Manager) {
+		manager.publisher = publisher
 	}
 }
 
+func New(storage storage.Storage, options ...Option) *Manager {
+	manager := &Manager{
+		mutex:     mutex.NewNamedMutex(),
+		storage:   storage,
+		waiters:   newWaiters(),
+		subscribe: &sync.Once{},
+	}
+	for _, option := range options {
+		option(manager)
+	}
+
+	return manager
+}
+
 func (manager *Manager) Get(ctx context.Context, metricType, metricName string) (metric.Metric, error) {
 	metric, err := manager.storage.Get(ctx, metricName)
 	if err != nil {
@@ -53,14 +83,90 @@ func (manager *Manager) Get(ctx context.Context, metricType, metricName string)
 	return metric, nil
 }
 
-func (manager *Manager) GetAll(ctx context.Context) (<-chan metric.Metric, error) {
+// GetRecord returns metric with time of its last update, nil is returned if metric is not found
+func (manager *Manager) GetRecord(ctx context.Context, metricType, metricName string) (*storage.Record, error) {
+	record, err := manager.storage.GetRecord(ctx, metricName)
+	if err != nil {
+		return nil, err
+	}
+	if record == nil || record.Metric.Type() != metricType {
+		return nil, nil
+	}
+
+	return record, nil
+}
+
+func (manager *Manager) GetAll(ctx context.Context) (iter.Seq2[metric.Metric, error], error) {
 	return manager.storage.GetAll(ctx)
 }
 
+func (manager *Manager) GetAllRecords(ctx context.Context) (iter.Seq2[*storage.Record, error], error) {
+	return manager.storage.GetAllRecords(ctx)
+}
+
+// GetFiltered returns records selected by filter sorted by name, type of filter must be known if it is set
+func (manager *Manager) GetFiltered(ctx context.Context, filter storage.Filter) (iter.Seq2[*storage.Record, error], error) {
+	switch filter.Type {
+	case "", gauge.MetricType, counter.MetricType:
+	default:
+		return nil, newErrUnknownMetricType(filter.Type)
+	}
+
+	return storage.GetFiltered(ctx, manager.storage, filter)
+}
+
+// GetChanges returns records saved after revision since and head revision, storage.ErrChangesNotSupported
+// is returned if storage does not assign revisions
+func (manager *Manager) GetChanges(ctx context.Context, since uint64) (iter.Seq2[*storage.Record, error], uint64, error) {
+	return storage.GetChanges(ctx, manager.storage, since)
+}
+
+// Revision returns head revision of storage, storage.ErrChangesNotSupported is returned if storage does not assign revisions
+func (manager *Manager) Revision(ctx context.Context) (uint64, error) {
+	return storage.Revision(ctx, manager.storage)
+}
+
+// HasChangeFeed reports whether storage assigns revisions
+func (manager *Manager) HasChangeFeed() bool {
+	return storage.HasChangeFeed(manager.storage)
+}
+
+// Subscribe registers handler of changes made by other servers sharing storage.
+// Handler is never called if storage is not shared
+func (manager *Manager) Subscribe(handler func(change storage.Change)) (unsubscribe func()) {
+	subscriber, ok := storage.FindChangeSubscriber(manager.storage)
+	if !ok {
+		return func() {}
+	}
+
+	return subscriber.Subscribe(handler)
+}
+
 func (manager *Manager) Save(ctx context.Context, metric metric.Metric) (metric.Metric, error) {
+	// write could be done even if error is returned, so waiters read metric anyway
+	defer manager.waiters.notify(metric.Name())
+
+	saved, err := manager.save(ctx, metric)
+	if err == nil && manager.publisher != nil {
+		manager.publisher.Publish(saved)
+	}
+
+	return saved, err
+}
+
+func (manager *Manager) save(ctx context.Context, metric metric.Metric) (metric.Metric, error) {
 	switch metric.Type() {
 	case gauge.MetricType:
 	case counter.MetricType:
+		if incrementer, ok := manager.storage.(storage.CounterIncrementer); ok {
+			value, err := incrementer.IncrementCounter(ctx, metric.Name(), metric.(*counter.Metric).GetValue())
+			if err != nil {
+				return nil, err
+			}
+
+			return counter.New(metric.Name(), value), nil
+		}
+
 		manager.mutex.Lock(metric.Name())
 		defer manager.mutex.Unlock(metric.Name())
 
@@ -79,6 +185,25 @@ func (manager *Manager) Save(ctx context.Context, metric metric.Metric) (metric.
 }
 
 func (manager *Manager) SaveBatch(ctx context.Context, metrics []metric.Metric) ([]metric.Metric, error) {
+	names := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		names = append(names, metric.Name())
+	}
+	defer manager.waiters.notify(names...)
+
+	saved, err := manager.saveBatch(ctx, metrics)
+	if err == nil && manager.publisher != nil {
+		manager.publisher.Publish(saved...)
+	}
+
+	return saved, err
+}
+
+func (manager *Manager) saveBatch(ctx context.Context, metrics []metric.Metric) ([]metric.Metric, error) {
+	if incrementer, ok := manager.storage.(storage.CounterIncrementer); ok {
+		return manager.saveBatchIncrementing(ctx, incrementer, metrics)
+	}
+
 	processed := map[string]metric.Metric{}
 	// Sorting metrics to avoid deadlock, use Stable to save original order
 	sort.SliceStable(metrics, func(i, j int) bool {
@@ -122,6 +247,42 @@ func (manager *Manager) SaveBatch(ctx context.Context, metrics []metric.Metric)
 	return metrics, nil
 }
 
+// saveBatchIncrementing coalesces counters of batch and saves batch with one atomic storage call
+// without named mutex, so failed batch is not applied partially and could be retried
+func (manager *Manager) saveBatchIncrementing(
+	ctx context.Context,
+	incrementer storage.CounterIncrementer,
+	metrics []metric.Metric,
+) ([]metric.Metric, error) {
+	// coalesced metrics keep order of the first occurrence of name in batch
+	indexes := make(map[string]int, len(metrics))
+	coalesced := make([]metric.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		index, processed := indexes[metric.Name()]
+		switch metric.Type() {
+		case gauge.MetricType:
+		case counter.MetricType:
+			if !processed {
+				break
+			}
+			if previous, ok := coalesced[index].(*counter.Metric); ok {
+				metric.(*counter.Metric).Add(previous.GetValue())
+			}
+		default:
+			return nil, newErrUnknownMetricType(metric.Type())
+		}
+
+		if processed {
+			coalesced[index] = metric
+			continue
+		}
+		indexes[metric.Name()] = len(coalesced)
+		coalesced = append(coalesced, metric)
+	}
+
+	return incrementer.SaveBatchIncrementing(ctx, coalesced)
+}
+
 func (manager *Manager) prepareCounter(ctx context.Context, metric *counter.Metric, previous metric.Metric) error {
 	if previous == nil {
 		var err error
@@ -137,6 +298,79 @@ func (manager *Manager) prepareCounter(ctx context.Context, metric *counter.Metr
 	return nil
 }
 
+// Delete removes metric if it has requested type. Deleted metric is returned, nil is returned if metric is not found
+func (manager *Manager) Delete(ctx context.Context, metricType, metricName string) (metric.Metric, error) {
+	// counter must not be restored by concurrent save which has already read it
+	manager.mutex.Lock(metricName)
+	defer manager.mutex.Unlock(metricName)
+
+	metric, err := manager.Get(ctx, metricType, metricName)
+	if err != nil || metric == nil {
+		return nil, err
+	}
+
+	defer manager.waiters.notify(metricName)
+	if err := manager.storage.Delete(ctx, metricName); err != nil {
+		return nil, err
+	}
+	if manager.publisher != nil {
+		manager.publisher.PublishDeleted(metric)
+	}
+
+	return metric, nil
+}
+
+// DeleteStale deletes metric only if it was not updated after cutoff and reports whether it was deleted.
+// Waiters and publisher are notified as on Delete, so expired metrics disappear from streams
+func (manager *Manager) DeleteStale(ctx context.Context, metricName string, cutoff time.Time) (bool, error) {
+	manager.mutex.Lock(metricName)
+	defer manager.mutex.Unlock(metricName)
+
+	record, err := manager.storage.GetRecord(ctx, metricName)
+	if err != nil || record == nil {
+		return false, err
+	}
+
+	defer manager.waiters.notify(metricName)
+	deleted, err := storage.DeleteStale(ctx, manager.storage, metricName, cutoff)
+	if err != nil || !deleted {
+		return false, err
+	}
+	if manager.publisher != nil {
+		manager.publisher.PublishDeleted(record.Metric)
+	}
+
+	return true, nil
+}
+
+// DeleteByPrefix publishes metrics read before delete, metric saved while they are deleted could be deleted unpublished
+func (manager *Manager) DeleteByPrefix(ctx context.Context, prefix string) error {
+	defer manager.waiters.notifyPrefix(prefix)
+
+	var deleted []metric.Metric
+	if manager.publisher != nil {
+		records, err := storage.GetFiltered(ctx, manager.storage, storage.Filter{Prefix: prefix})
+		if err != nil {
+			return err
+		}
+		for record, err := range records {
+			if err != nil {
+				return err
+			}
+			deleted = append(deleted, record.Metric)
+		}
+	}
+
+	if err := manager.storage.DeleteByPrefix(ctx, prefix); err != nil {
+		return err
+	}
+	if manager.publisher != nil {
+		manager.publisher.PublishDeleted(deleted...)
+	}
+
+	return nil
+}
+
 func (manager *Manager) PingStorage(ctx context.Context) error {
 	return manager.storage.Ping(ctx)
 }
@@ -2,17 +2,31 @@ package manager
 
 import (
 	"context"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/m1khal3v/gometheus/internal/common/metric"
 	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
 	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/fault"
 	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
 	"github.com/m1khal3v/gometheus/pkg/slice"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+// plainStorage hides optional interfaces of storage, so manager uses named mutex
+type plainStorage struct {
+	storage.Storage
+}
+
+var storages = map[string]func() storage.Storage{
+	"atomic": func() storage.Storage { return memory.New() },
+	"locked": func() storage.Storage { return plainStorage{memory.New()} },
+}
+
 func TestManager_Save(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -44,20 +58,22 @@ func TestManager_Save(t *testing.T) {
 		},
 	}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			ctx := context.Background()
-			storage := memory.New()
-			if tt.preset != nil {
-				require.NoError(t, storage.Save(ctx, tt.preset))
-			}
-			manager := New(storage)
-			saved, err := manager.Save(ctx, tt.metric)
-			require.NoError(t, err)
-			assert.Equal(t, tt.want, saved)
-			got, err := manager.Get(ctx, tt.metric.Type(), tt.metric.Name())
-			require.NoError(t, err)
-			assert.Equal(t, tt.want, got)
-		})
+		for name, newStorage := range storages {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				ctx := context.Background()
+				storage := newStorage()
+				if tt.preset != nil {
+					require.NoError(t, storage.Save(ctx, tt.preset))
+				}
+				manager := New(storage)
+				saved, err := manager.Save(ctx, tt.metric.Clone())
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, saved)
+				got, err := manager.Get(ctx, tt.metric.Type(), tt.metric.Name())
+				require.NoError(t, err)
+				assert.Equal(t, tt.want, got)
+			})
+		}
 	}
 }
 
@@ -122,23 +138,166 @@ func TestManager_SaveBatch(t *testing.T) {
 		},
 	}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
+		for name, newStorage := range storages {
+			t.Run(tt.name+"/"+name, func(t *testing.T) {
+				ctx := context.Background()
+				storage := newStorage()
+				if tt.preset != nil {
+					require.NoError(t, storage.SaveBatch(ctx, tt.preset))
+				}
+				manager := New(storage)
+				metrics := make([]metric.Metric, 0, len(tt.metric))
+				for _, metric := range tt.metric {
+					metrics = append(metrics, metric.Clone())
+				}
+				saved, err := manager.SaveBatch(ctx, metrics)
+				require.NoError(t, err)
+				assert.ElementsMatch(t, tt.want, saved)
+				seq, err := manager.GetAll(ctx)
+				require.NoError(t, err)
+				all, err := slice.FromSeq2(seq)
+				require.NoError(t, err)
+				assert.ElementsMatch(t, tt.want, all)
+			})
+		}
+	}
+}
+
+func TestManager_SaveConcurrent(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
 			ctx := context.Background()
-			storage := memory.New()
-			if tt.preset != nil {
-				require.NoError(t, storage.SaveBatch(ctx, tt.preset))
+			manager := New(newStorage())
+			wg := &sync.WaitGroup{}
+			for i := 0; i < 20; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for j := 0; j < 50; j++ {
+						_, err := manager.Save(ctx, counter.New("m1", 1))
+						assert.NoError(t, err)
+						_, err = manager.SaveBatch(ctx, []metric.Metric{counter.New("m1", 1), counter.New("m1", 1)})
+						assert.NoError(t, err)
+					}
+				}()
 			}
-			manager := New(storage)
-			saved, err := manager.SaveBatch(ctx, tt.metric)
+			wg.Wait()
+
+			got, err := manager.Get(ctx, counter.MetricType, "m1")
+			require.NoError(t, err)
+			assert.Equal(t, counter.New("m1", 3000), got)
+		})
+	}
+}
+
+func TestManager_SaveBatchTransientFault(t *testing.T) {
+	faulty := map[string]func() storage.Storage{
+		"atomic": func() storage.Storage {
+			return fault.New(memory.New(), fault.Rule{Operation: fault.SaveBatchIncrementingOperation, Fault: fault.Transient, Every: 2})
+		},
+		"locked": func() storage.Storage {
+			return plainStorage{fault.New(memory.New(), fault.Rule{Operation: fault.SaveBatchOperation, Fault: fault.Transient, Every: 2})}
+		},
+	}
+	for kind, newStorage := range faulty {
+		t.Run(kind, func(t *testing.T) {
+			ctx := context.Background()
+			manager := New(newStorage())
+
+			_, err := manager.SaveBatch(ctx, []metric.Metric{counter.New("m1", 1), counter.New("m2", 1)})
 			require.NoError(t, err)
-			assert.ElementsMatch(t, tt.want, saved)
-			all, err := manager.GetAll(ctx)
+
+			// failed batch is not applied partially, so client could retry it
+			_, err = manager.SaveBatch(ctx, []metric.Metric{counter.New("m1", 2), counter.New("m2", 2), gauge.New("m3", 1.5)})
+			require.ErrorIs(t, err, storage.ErrTransient)
+			for _, want := range []metric.Metric{counter.New("m1", 1), counter.New("m2", 1)} {
+				got, err := manager.Get(ctx, counter.MetricType, want.Name())
+				require.NoError(t, err)
+				assert.Equal(t, want, got)
+			}
+			got, err := manager.Get(ctx, gauge.MetricType, "m3")
+			require.NoError(t, err)
+			assert.Nil(t, got)
+
+			saved, err := manager.SaveBatch(ctx, []metric.Metric{counter.New("m1", 2), counter.New("m2", 2), gauge.New("m3", 1.5)})
 			require.NoError(t, err)
-			assert.ElementsMatch(t, tt.want, slice.FromChannel(all))
+			assert.ElementsMatch(t, []metric.Metric{counter.New("m1", 3), counter.New("m2", 3), gauge.New("m3", 1.5)}, saved)
 		})
 	}
 }
 
+type recordingPublisher struct {
+	published []metric.Metric
+	deleted   []metric.Metric
+}
+
+func (publisher *recordingPublisher) Publish(metrics ...metric.Metric) {
+	publisher.published = append(publisher.published, metrics...)
+}
+
+func (publisher *recordingPublisher) PublishDeleted(metrics ...metric.Metric) {
+	publisher.deleted = append(publisher.deleted, metrics...)
+}
+
+func TestManager_Publish(t *testing.T) {
+	for name, newStorage := range storages {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			publisher := &recordingPublisher{}
+			manager := New(newStorage(), WithPublisher(publisher))
+
+			_, err := manager.Save(ctx, counter.New("c1", 1))
+			require.NoError(t, err)
+			_, err = manager.SaveBatch(ctx, []metric.Metric{counter.New("c1", 2), gauge.New("g1", 1.5)})
+			require.NoError(t, err)
+			_, err = manager.Save(ctx, counter.New("c1", 1))
+			require.NoError(t, err)
+
+			// counters are published with accumulated value
+			assert.Equal(t, counter.New("c1", 1), publisher.published[0])
+			assert.ElementsMatch(t, []metric.Metric{counter.New("c1", 3), gauge.New("g1", 1.5)}, publisher.published[1:3])
+			assert.Equal(t, counter.New("c1", 4), publisher.published[3])
+
+			// failed save is not published
+			_, err = New(fault.New(newStorage(), fault.Rule{Operation: fault.AnyOperation, Fault: fault.Permanent}), WithPublisher(publisher)).
+				Save(ctx, gauge.New("g2", 1))
+			require.Error(t, err)
+			assert.Len(t, publisher.published, 4)
+			assert.Empty(t, publisher.deleted)
+		})
+	}
+}
+
+func TestManager_PublishDeleted(t *testing.T) {
+	ctx := context.Background()
+	publisher := &recordingPublisher{}
+	manager := New(memory.New(), WithPublisher(publisher))
+	_, err := manager.SaveBatch(ctx, []metric.Metric{counter.New("c1", 1), gauge.New("g1", 1), gauge.New("g2", 2), gauge.New("h1", 3)})
+	require.NoError(t, err)
+
+	_, err = manager.Delete(ctx, counter.MetricType, "c1")
+	require.NoError(t, err)
+	// missing metric is not published
+	_, err = manager.Delete(ctx, counter.MetricType, "c1")
+	require.NoError(t, err)
+	require.NoError(t, manager.DeleteByPrefix(ctx, "g"))
+	assert.Equal(t, []metric.Metric{counter.New("c1", 1), gauge.New("g1", 1), gauge.New("g2", 2)}, publisher.deleted)
+
+	// metric updated after cutoff is kept
+	cutoff := time.Now()
+	deleted, err := manager.DeleteStale(ctx, "h1", cutoff.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.False(t, deleted)
+	deleted, err = manager.DeleteStale(ctx, "h1", cutoff)
+	require.NoError(t, err)
+	assert.True(t, deleted)
+	deleted, err = manager.DeleteStale(ctx, "h1", cutoff)
+	require.NoError(t, err)
+	assert.False(t, deleted)
+	assert.Equal(t, gauge.New("h1", 3), publisher.deleted[3])
+	assert.Len(t, publisher.deleted, 4)
+}
+
 func TestManager_Get(t *testing.T) {
 	ctx := context.Background()
 	storage := memory.New()
@@ -198,6 +357,73 @@ func TestManager_Get(t *testing.T) {
 	}
 }
 
+func TestManager_GetFiltered(t *testing.T) {
+	ctx := context.Background()
+	base := memory.New()
+	base.Save(ctx, gauge.New("m1", 123.321))
+	base.Save(ctx, counter.New("m2", 123))
+	manager := New(base)
+
+	seq, err := manager.GetFiltered(ctx, storage.Filter{Type: counter.MetricType})
+	require.NoError(t, err)
+	records, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	assert.Equal(t, counter.New("m2", 123), records[0].Metric)
+
+	_, err = manager.GetFiltered(ctx, storage.Filter{Type: "histogram"})
+	assert.ErrorAs(t, err, new(*UnknownMetricTypeError))
+}
+
+func TestManager_Delete(t *testing.T) {
+	tests := []struct {
+		name       string
+		metricName string
+		metricType string
+		want       metric.Metric
+		wantLeft   metric.Metric
+	}{
+		{
+			name:       "existing counter",
+			metricName: "m2",
+			metricType: counter.MetricType,
+			want:       counter.New("m2", 123),
+		},
+		{
+			name:       "type mismatch",
+			metricName: "m1",
+			metricType: counter.MetricType,
+			want:       nil,
+			wantLeft:   gauge.New("m1", 123.321),
+		},
+		{
+			name:       "nonexistent metric",
+			metricName: "m3",
+			metricType: gauge.MetricType,
+			want:       nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := memory.New()
+			require.NoError(t, storage.SaveBatch(ctx, []metric.Metric{
+				gauge.New("m1", 123.321),
+				counter.New("m2", 123),
+			}))
+			manager := New(storage)
+
+			got, err := manager.Delete(ctx, tt.metricType, tt.metricName)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			left, err := storage.Get(ctx, tt.metricName)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantLeft, left)
+		})
+	}
+}
+
 func TestManager_PingStorage(t *testing.T) {
 	ctx := context.Background()
 	storage := memory.New() // актуальный storage всегда должен отвечать на ping
@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"context"
+	"strings"
+	"sync"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+)
+
+// Condition reports whether awaited state of metric is reached, record is nil if metric is not found
+type Condition func(record *storage.Record) bool
+
+// RevisionAfter is met when metric is saved after revision. Records without revision (storage without change feed
+// or metric not flushed by buffer yet) do not meet it
+func RevisionAfter(revision uint64) Condition {
+	return func(record *storage.Record) bool {
+		return record != nil && record.Revision > revision
+	}
+}
+
+// ValueDiffers is met when metric value differs from value of metric, nil metric means missing metric
+func ValueDiffers(metric metric.Metric) Condition {
+	return func(record *storage.Record) bool {
+		if record == nil || metric == nil {
+			return (record == nil) != (metric == nil)
+		}
+
+		return record.Metric.StringValue() != metric.StringValue()
+	}
+}
+
+// Wait reads metric until condition is met. Metric is read again after it is changed by manager
+// or by another server sharing storage. If ctx is done first, the last read record is returned with ctx error
+func (manager *Manager) Wait(ctx context.Context, metricType, metricName string, condition Condition) (*storage.Record, error) {
+	manager.subscribe.Do(func() {
+		if subscriber, ok := storage.FindChangeSubscriber(manager.storage); ok {
+			subscriber.Subscribe(manager.applyChange)
+		}
+	})
+
+	for {
+		// waiter is registered before read, so change made after read is not missed
+		changed, release := manager.waiters.watch(metricName)
+		record, err := manager.GetRecord(ctx, metricType, metricName)
+		if err != nil || condition(record) {
+			release()
+			return record, err
+		}
+
+		select {
+		case <-ctx.Done():
+			release()
+			return record, ctx.Err()
+		case <-changed:
+			release()
+		}
+	}
+}
+
+// applyChange wakes waiters of metrics changed by other servers
+func (manager *Manager) applyChange(change storage.Change) {
+	if change.Kind == storage.ChangeAll {
+		manager.waiters.notifyIf(func(string) bool { return true })
+		return
+	}
+
+	manager.waiters.notify(change.Name)
+}
+
+// waiters wakes goroutines waiting for change of metrics
+type waiters struct {
+	mutex   *sync.Mutex
+	changed map[string]*waiter
+}
+
+// waiter is channel closed on the next change of metric and count of goroutines waiting on it
+type waiter struct {
+	changed chan struct{}
+	count   int
+}
+
+func newWaiters() *waiters {
+	return &waiters{
+		mutex:   &sync.Mutex{},
+		changed: map[string]*waiter{},
+	}
+}
+
+// watch returns channel closed on the next change of metric. Release must be called when waiting is finished,
+// so metrics which are not awaited anymore do not hold memory
+func (waiters *waiters) watch(name string) (<-chan struct{}, func()) {
+	waiters.mutex.Lock()
+	defer waiters.mutex.Unlock()
+
+	current, ok := waiters.changed[name]
+	if !ok {
+		current = &waiter{changed: make(chan struct{})}
+		waiters.changed[name] = current
+	}
+	current.count++
+
+	return current.changed, func() {
+		waiters.mutex.Lock()
+		defer waiters.mutex.Unlock()
+
+		current.count--
+		if current.count == 0 && waiters.changed[name] == current {
+			delete(waiters.changed, name)
+		}
+	}
+}
+
+func (waiters *waiters) notify(names ...string) {
+	waiters.mutex.Lock()
+	defer waiters.mutex.Unlock()
+
+	for _, name := range names {
+		if current, ok := waiters.changed[name]; ok {
+			close(current.changed)
+			delete(waiters.changed, name)
+		}
+	}
+}
+
+func (waiters *waiters) notifyIf(match func(name string) bool) {
+	waiters.mutex.Lock()
+	defer waiters.mutex.Unlock()
+
+	for name, current := range waiters.changed {
+		if match(name) {
+			close(current.changed)
+			delete(waiters.changed, name)
+		}
+	}
+}
+
+// notifyPrefix wakes waiters of metrics which names start with prefix
+func (waiters *waiters) notifyPrefix(prefix string) {
+	waiters.notifyIf(func(name string) bool {
+		return strings.HasPrefix(name, prefix)
+	})
+}
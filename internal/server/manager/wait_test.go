@@ -0,0 +1,185 @@
+package manager
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// subscribedStorage delivers changes made by test as changes of another server
+type subscribedStorage struct {
+	storage.Storage
+	mutex   *sync.Mutex
+	handler func(change storage.Change)
+}
+
+func (storage *subscribedStorage) Subscribe(handler func(change storage.Change)) func() {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	storage.handler = handler
+
+	return func() {}
+}
+
+func (storage *subscribedStorage) publish(change storage.Change) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if storage.handler != nil {
+		storage.handler(change)
+	}
+}
+
+func TestConditions(t *testing.T) {
+	record := &storage.Record{Metric: gauge.New("m1", 1.5), Revision: 10}
+	tests := []struct {
+		name      string
+		condition Condition
+		record    *storage.Record
+		want      bool
+	}{
+		{name: "revision after", condition: RevisionAfter(9), record: record, want: true},
+		{name: "revision equal", condition: RevisionAfter(10), record: record, want: false},
+		{name: "revision of missing metric", condition: RevisionAfter(0), record: nil, want: false},
+		{name: "value differs", condition: ValueDiffers(gauge.New("m1", 1)), record: record, want: true},
+		{name: "value equals", condition: ValueDiffers(gauge.New("m1", 1.5)), record: record, want: false},
+		{name: "metric appeared", condition: ValueDiffers(nil), record: record, want: true},
+		{name: "metric deleted", condition: ValueDiffers(gauge.New("m1", 1.5)), record: nil, want: true},
+		{name: "metric still missing", condition: ValueDiffers(nil), record: nil, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, tt.condition(tt.record))
+		})
+	}
+}
+
+func TestManager_Wait(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition Condition
+		change    func(ctx context.Context, manager *Manager, shared *subscribedStorage) error
+		want      metric.Metric
+	}{
+		{
+			name:      "condition is already met",
+			condition: ValueDiffers(counter.New("c1", 1)),
+			want:      counter.New("c1", 2),
+		},
+		{
+			name:      "save",
+			condition: ValueDiffers(counter.New("c1", 2)),
+			change: func(ctx context.Context, manager *Manager, _ *subscribedStorage) error {
+				_, err := manager.Save(ctx, counter.New("c1", 3))
+				return err
+			},
+			want: counter.New("c1", 5),
+		},
+		{
+			name:      "save batch",
+			condition: ValueDiffers(counter.New("c1", 2)),
+			change: func(ctx context.Context, manager *Manager, _ *subscribedStorage) error {
+				_, err := manager.SaveBatch(ctx, []metric.Metric{gauge.New("g1", 1), counter.New("c1", 1)})
+				return err
+			},
+			want: counter.New("c1", 3),
+		},
+		{
+			name:      "delete",
+			condition: ValueDiffers(counter.New("c1", 2)),
+			change: func(ctx context.Context, manager *Manager, _ *subscribedStorage) error {
+				return manager.DeleteByPrefix(ctx, "c")
+			},
+			want: nil,
+		},
+		{
+			name:      "expiry",
+			condition: ValueDiffers(counter.New("c1", 2)),
+			change: func(ctx context.Context, manager *Manager, _ *subscribedStorage) error {
+				_, err := manager.DeleteStale(ctx, "c1", time.Now())
+				return err
+			},
+			want: nil,
+		},
+		{
+			name:      "change of another server",
+			condition: ValueDiffers(counter.New("c1", 2)),
+			change: func(ctx context.Context, _ *Manager, shared *subscribedStorage) error {
+				if err := shared.Save(ctx, counter.New("c1", 10)); err != nil {
+					return err
+				}
+				shared.publish(storage.Change{Kind: storage.ChangeSave, Name: "c1"})
+
+				return nil
+			},
+			want: counter.New("c1", 10),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := &subscribedStorage{Storage: memory.New(), mutex: &sync.Mutex{}}
+			require.NoError(t, storage.Save(ctx, counter.New("c1", 2)))
+			manager := New(storage)
+
+			waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancel()
+			done := make(chan struct{})
+			var got metric.Metric
+			go func() {
+				defer close(done)
+				record, err := manager.Wait(waitCtx, counter.MetricType, "c1", tt.condition)
+				assert.NoError(t, err)
+				if record != nil {
+					got = record.Metric
+				}
+			}()
+
+			if tt.change != nil {
+				// change is made after waiter is registered
+				require.Eventually(t, func() bool {
+					manager.waiters.mutex.Lock()
+					defer manager.waiters.mutex.Unlock()
+
+					return len(manager.waiters.changed) == 1
+				}, time.Second, time.Millisecond)
+				require.NoError(t, tt.change(ctx, manager, storage))
+			}
+
+			<-done
+			assert.Equal(t, tt.want, got)
+			// finished waiters do not hold memory
+			assert.Empty(t, manager.waiters.changed)
+		})
+	}
+}
+
+func TestManager_WaitTimeout(t *testing.T) {
+	ctx := context.Background()
+	storage := memory.New()
+	require.NoError(t, storage.Save(ctx, gauge.New("g1", 1)))
+	manager := New(storage)
+
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+
+	// changes of other metrics do not meet condition
+	go func() {
+		_, _ = manager.Save(ctx, gauge.New("g2", 2))
+	}()
+	record, err := manager.Wait(waitCtx, gauge.MetricType, "g1", ValueDiffers(gauge.New("g1", 1)))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	require.NotNil(t, record)
+	assert.Equal(t, gauge.New("g1", 1), record.Metric)
+	assert.Empty(t, manager.waiters.changed)
+}
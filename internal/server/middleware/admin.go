@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/m1khal3v/gometheus/internal/server/api"
+)
+
+// AdminTokenValidate allows request only with "Authorization: Bearer <token>" header.
+// All requests are forbidden if token is empty
+func AdminTokenValidate(token string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+			if token == "" {
+				api.WriteJSONErrorResponse(http.StatusForbidden, writer, "Admin API is disabled", nil)
+				return
+			}
+
+			requestToken, ok := strings.CutPrefix(request.Header.Get("Authorization"), "Bearer ")
+			if !ok || requestToken == "" {
+				api.WriteJSONErrorResponse(http.StatusUnauthorized, writer, "Admin token is missing", nil)
+				return
+			}
+
+			if subtle.ConstantTimeCompare([]byte(requestToken), []byte(token)) != 1 {
+				api.WriteJSONErrorResponse(http.StatusUnauthorized, writer, "Invalid admin token", nil)
+				return
+			}
+
+			next.ServeHTTP(writer, request)
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAdminTokenValidate(t *testing.T) {
+	mockHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte("success"))
+	})
+
+	tests := []struct {
+		name            string
+		token           string
+		authorization   string
+		expectedStatus  int
+		expectedMessage string
+	}{
+		{
+			name:            "valid token",
+			token:           "secret",
+			authorization:   "Bearer secret",
+			expectedStatus:  http.StatusOK,
+			expectedMessage: "success",
+		},
+		{
+			name:            "admin API disabled",
+			token:           "",
+			authorization:   "Bearer ",
+			expectedStatus:  http.StatusForbidden,
+			expectedMessage: "Admin API is disabled",
+		},
+		{
+			name:            "missing token",
+			token:           "secret",
+			expectedStatus:  http.StatusUnauthorized,
+			expectedMessage: "Admin token is missing",
+		},
+		{
+			name:            "another scheme",
+			token:           "secret",
+			authorization:   "Basic secret",
+			expectedStatus:  http.StatusUnauthorized,
+			expectedMessage: "Admin token is missing",
+		},
+		{
+			name:            "invalid token",
+			token:           "secret",
+			authorization:   "Bearer secret2",
+			expectedStatus:  http.StatusUnauthorized,
+			expectedMessage: "Invalid admin token",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			recorder := httptest.NewRecorder()
+
+			AdminTokenValidate(tt.token)(mockHandler).ServeHTTP(recorder, req)
+
+			assert.Equal(t, tt.expectedStatus, recorder.Code)
+			if recorder.Code != http.StatusOK {
+				assert.Contains(t, recorder.Body.String(), tt.expectedMessage)
+			} else {
+				assert.Equal(t, tt.expectedMessage, recorder.Body.String())
+			}
+		})
+	}
+}
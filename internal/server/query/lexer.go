@@ -0,0 +1,162 @@
+package query
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+type tokenKind byte
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenName
+	tokenString
+	tokenTilde
+	tokenOperator
+	tokenLeftParen
+	tokenRightParen
+)
+
+type token struct {
+	kind     tokenKind
+	text     string
+	position int
+}
+
+// lexer splits query into tokens, position of token is byte offset in query
+type lexer struct {
+	query    string
+	position int
+	// operand is set after token which ends operand, star following operand is multiplication
+	operand bool
+}
+
+func (lexer *lexer) next() (token, error) {
+	token, err := lexer.scan()
+	if err != nil {
+		return token, err
+	}
+	lexer.operand = token.kind == tokenNumber || token.kind == tokenName || token.kind == tokenString || token.kind == tokenRightParen
+
+	return token, nil
+}
+
+func (lexer *lexer) scan() (token, error) {
+	for lexer.position < len(lexer.query) {
+		char, size := utf8.DecodeRuneInString(lexer.query[lexer.position:])
+		if !unicode.IsSpace(char) {
+			break
+		}
+		lexer.position += size
+	}
+
+	start := lexer.position
+	if start == len(lexer.query) {
+		return token{kind: tokenEOF, position: start}, nil
+	}
+
+	char, size := utf8.DecodeRuneInString(lexer.query[start:])
+	switch {
+	case char == '(':
+		lexer.position += size
+		return token{kind: tokenLeftParen, text: "(", position: start}, nil
+	case char == ')':
+		lexer.position += size
+		return token{kind: tokenRightParen, text: ")", position: start}, nil
+	case char == '~':
+		lexer.position += size
+		return token{kind: tokenTilde, text: "~", position: start}, nil
+	case strings.ContainsRune("+-/", char) || char == '*' && lexer.operand:
+		lexer.position += size
+		return token{kind: tokenOperator, text: string(char), position: start}, nil
+	case char == '"':
+		return lexer.quoted()
+	case char >= '0' && char <= '9' || char == '.':
+		return lexer.number(), nil
+	case isNameStart(char):
+		return lexer.name()
+	}
+
+	return token{}, newErrSyntax(start, "unexpected character '"+string(char)+"'")
+}
+
+// number scans decimal number with optional exponent, validity is checked by parser
+func (lexer *lexer) number() token {
+	start := lexer.position
+	for lexer.position < len(lexer.query) {
+		char := lexer.query[lexer.position]
+		switch {
+		case char >= '0' && char <= '9' || char == '.':
+		case char == 'e' || char == 'E':
+			if lexer.position+1 < len(lexer.query) && strings.ContainsRune("+-", rune(lexer.query[lexer.position+1])) {
+				lexer.position++
+			}
+		default:
+			return token{kind: tokenNumber, text: lexer.query[start:lexer.position], position: start}
+		}
+		lexer.position++
+	}
+
+	return token{kind: tokenNumber, text: lexer.query[start:], position: start}
+}
+
+// name scans bare glob pattern. Any character except closing bracket is allowed inside character class
+func (lexer *lexer) name() (token, error) {
+	start := lexer.position
+	class := false
+	for lexer.position < len(lexer.query) {
+		char, size := utf8.DecodeRuneInString(lexer.query[lexer.position:])
+		switch {
+		case char == '\\':
+			if lexer.position+size == len(lexer.query) {
+				return token{}, newErrSyntax(start, "unterminated pattern")
+			}
+			_, escaped := utf8.DecodeRuneInString(lexer.query[lexer.position+size:])
+			size += escaped
+		case class:
+			class = char != ']'
+		case char == '[':
+			class = true
+		case !isNameChar(char):
+			return token{kind: tokenName, text: lexer.query[start:lexer.position], position: start}, nil
+		}
+		lexer.position += size
+	}
+	if class {
+		return token{}, newErrSyntax(start, "unterminated pattern")
+	}
+
+	return token{kind: tokenName, text: lexer.query[start:], position: start}, nil
+}
+
+// quoted scans string in double quotes. Only \" is unescaped, other escapes are kept for glob or regexp
+func (lexer *lexer) quoted() (token, error) {
+	start := lexer.position
+	builder := &strings.Builder{}
+	for i := start + 1; i < len(lexer.query); i++ {
+		switch {
+		case lexer.query[i] == '"':
+			lexer.position = i + 1
+			return token{kind: tokenString, text: builder.String(), position: start}, nil
+		case lexer.query[i] == '\\' && i+1 < len(lexer.query):
+			i++
+			if lexer.query[i] != '"' {
+				builder.WriteByte('\\')
+			}
+		}
+		builder.WriteByte(lexer.query[i])
+	}
+
+	return token{}, newErrSyntax(start, "unterminated string")
+}
+
+// isNameStart reports whether char starts name, star starts name only if it does not follow operand
+func isNameStart(char rune) bool {
+	return unicode.IsLetter(char) || strings.ContainsRune("_*?[\\", char)
+}
+
+func isNameChar(char rune) bool {
+	return isNameStart(char) || unicode.IsDigit(char) || char == '.'
+}
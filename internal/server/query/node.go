@@ -0,0 +1,240 @@
+package query
+
+import (
+	"context"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+)
+
+type node interface {
+	evaluate(ctx context.Context, source Source) (*Result, error)
+}
+
+type number float64
+
+func (number number) evaluate(context.Context, Source) (*Result, error) {
+	return &Result{Scalar: float64(number)}, nil
+}
+
+// selector reads metrics matched by glob filter or by regular expression
+type selector struct {
+	filter     storage.Filter
+	expression *regexp.Regexp
+}
+
+// evaluate pushes glob into storage filter, regular expression is matched after reading all metrics
+func (selector *selector) evaluate(ctx context.Context, source Source) (*Result, error) {
+	records, err := source.GetFiltered(ctx, selector.filter)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{Vector: true, Samples: make([]Sample, 0)}
+	for record, err := range records {
+		if err != nil {
+			return nil, err
+		}
+		if selector.expression != nil && !selector.expression.MatchString(record.Metric.Name()) {
+			continue
+		}
+
+		value, err := valueOf(record.Metric)
+		if err != nil {
+			return nil, err
+		}
+		result.Samples = append(result.Samples, Sample{Name: record.Metric.Name(), Value: value})
+	}
+
+	return result, nil
+}
+
+func valueOf(metric metric.Metric) (float64, error) {
+	switch metric := metric.(type) {
+	case *gauge.Metric:
+		return metric.GetValue(), nil
+	case *counter.Metric:
+		return float64(metric.GetValue()), nil
+	default:
+		return strconv.ParseFloat(metric.StringValue(), 64)
+	}
+}
+
+type aggregate func(values []float64) (float64, error)
+
+func sum(values []float64) (float64, error) {
+	total := 0.0
+	for _, value := range values {
+		total += value
+	}
+
+	return total, nil
+}
+
+func avg(values []float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, ErrEmptyAggregation
+	}
+	total, _ := sum(values)
+
+	return total / float64(len(values)), nil
+}
+
+func minimum(values []float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, ErrEmptyAggregation
+	}
+
+	return slices.Min(values), nil
+}
+
+func maximum(values []float64) (float64, error) {
+	if len(values) == 0 {
+		return 0, ErrEmptyAggregation
+	}
+
+	return slices.Max(values), nil
+}
+
+func count(values []float64) (float64, error) {
+	return float64(len(values)), nil
+}
+
+// aggregation reduces vector to scalar, scalar argument is aggregated as vector of one value
+type aggregation struct {
+	function aggregate
+	argument node
+}
+
+func (aggregation *aggregation) evaluate(ctx context.Context, source Source) (*Result, error) {
+	argument, err := aggregation.argument.evaluate(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	values := []float64{argument.Scalar}
+	if argument.Vector {
+		values = make([]float64, 0, len(argument.Samples))
+		for _, sample := range argument.Samples {
+			values = append(values, sample.Value)
+		}
+	}
+
+	value, err := aggregation.function(values)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{Scalar: value}, finite(value)
+}
+
+type negation struct {
+	operand node
+}
+
+func (negation *negation) evaluate(ctx context.Context, source Source) (*Result, error) {
+	negated := &binary{operator: '*', left: number(-1), right: negation.operand}
+
+	return negated.evaluate(ctx, source)
+}
+
+// binary applies operator to scalars, to every sample of vector and scalar,
+// or to samples with the same name of two vectors
+type binary struct {
+	operator byte
+	left     node
+	right    node
+}
+
+func (binary *binary) evaluate(ctx context.Context, source Source) (*Result, error) {
+	left, err := binary.left.evaluate(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+	right, err := binary.right.evaluate(ctx, source)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case !left.Vector && !right.Vector:
+		value, err := calculate(binary.operator, left.Scalar, right.Scalar)
+		if err != nil {
+			return nil, err
+		}
+
+		return &Result{Scalar: value}, nil
+	case !right.Vector:
+		return mapSamples(left.Samples, func(value float64) (float64, error) {
+			return calculate(binary.operator, value, right.Scalar)
+		})
+	case !left.Vector:
+		return mapSamples(right.Samples, func(value float64) (float64, error) {
+			return calculate(binary.operator, left.Scalar, value)
+		})
+	}
+
+	// samples of both vectors are sorted by name
+	result := &Result{Vector: true, Samples: make([]Sample, 0)}
+	for i, j := 0, 0; i < len(left.Samples) && j < len(right.Samples); {
+		switch {
+		case left.Samples[i].Name < right.Samples[j].Name:
+			i++
+		case left.Samples[i].Name > right.Samples[j].Name:
+			j++
+		default:
+			value, err := calculate(binary.operator, left.Samples[i].Value, right.Samples[j].Value)
+			if err != nil {
+				return nil, err
+			}
+			result.Samples = append(result.Samples, Sample{Name: left.Samples[i].Name, Value: value})
+			i++
+			j++
+		}
+	}
+
+	return result, nil
+}
+
+func mapSamples(samples []Sample, function func(value float64) (float64, error)) (*Result, error) {
+	result := &Result{Vector: true, Samples: make([]Sample, 0, len(samples))}
+	for _, sample := range samples {
+		value, err := function(sample.Value)
+		if err != nil {
+			return nil, err
+		}
+		result.Samples = append(result.Samples, Sample{Name: sample.Name, Value: value})
+	}
+
+	return result, nil
+}
+
+func calculate(operator byte, left, right float64) (float64, error) {
+	var value float64
+	switch operator {
+	case '+':
+		value = left + right
+	case '-':
+		value = left - right
+	case '*':
+		value = left * right
+	case '/':
+		value = left / right
+	}
+
+	return value, finite(value)
+}
+
+func finite(value float64) error {
+	if math.IsInf(value, 0) || math.IsNaN(value) {
+		return ErrNotFinite
+	}
+
+	return nil
+}
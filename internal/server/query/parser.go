@@ -0,0 +1,202 @@
+package query
+
+import (
+	"math"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+)
+
+// maxDepth limits nesting of expressions, so query cannot exhaust stack
+const maxDepth = 64
+
+var functions = map[string]aggregate{
+	"sum":   sum,
+	"avg":   avg,
+	"min":   minimum,
+	"max":   maximum,
+	"count": count,
+}
+
+// parser is recursive descent parser with one token lookahead
+type parser struct {
+	lexer   *lexer
+	current token
+	depth   int
+}
+
+func newParser(query string) *parser {
+	return &parser{lexer: &lexer{query: query}}
+}
+
+func (parser *parser) parse() (node, error) {
+	if err := parser.advance(); err != nil {
+		return nil, err
+	}
+	if parser.current.kind == tokenEOF {
+		return nil, newErrSyntax(parser.current.position, "empty query")
+	}
+
+	root, err := parser.expression()
+	if err != nil {
+		return nil, err
+	}
+	if parser.current.kind != tokenEOF {
+		return nil, parser.unexpected()
+	}
+
+	return root, nil
+}
+
+func (parser *parser) advance() error {
+	current, err := parser.lexer.next()
+	if err != nil {
+		return err
+	}
+	parser.current = current
+
+	return nil
+}
+
+func (parser *parser) unexpected() error {
+	if parser.current.kind == tokenEOF {
+		return newErrSyntax(parser.current.position, "unexpected end of query")
+	}
+
+	return newErrSyntax(parser.current.position, "unexpected '"+parser.current.text+"'")
+}
+
+func (parser *parser) expression() (node, error) {
+	return parser.binary(parser.term, "+", "-")
+}
+
+func (parser *parser) term() (node, error) {
+	return parser.binary(parser.factor, "*", "/")
+}
+
+// binary parses left associative chain of operands separated by operators
+func (parser *parser) binary(operand func() (node, error), operators ...string) (node, error) {
+	left, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	for parser.current.kind == tokenOperator && slices.Contains(operators, parser.current.text) {
+		operator := parser.current.text[0]
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+
+		right, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		left = &binary{operator: operator, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (parser *parser) factor() (node, error) {
+	parser.depth++
+	defer func() { parser.depth-- }()
+	if parser.depth > maxDepth {
+		return nil, newErrSyntax(parser.current.position, "expression is nested too deep")
+	}
+
+	current := parser.current
+	switch current.kind {
+	case tokenOperator:
+		if current.text != "-" {
+			return nil, parser.unexpected()
+		}
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+		operand, err := parser.factor()
+		if err != nil {
+			return nil, err
+		}
+
+		return &negation{operand: operand}, nil
+	case tokenNumber:
+		value, err := strconv.ParseFloat(current.text, 64)
+		if err != nil || math.IsInf(value, 0) {
+			return nil, newErrSyntax(current.position, "invalid number '"+current.text+"'")
+		}
+
+		return number(value), parser.advance()
+	case tokenLeftParen:
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+
+		return parser.parenthesized()
+	case tokenName:
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+		if function, ok := functions[current.text]; ok && parser.current.kind == tokenLeftParen {
+			if err := parser.advance(); err != nil {
+				return nil, err
+			}
+			argument, err := parser.parenthesized()
+			if err != nil {
+				return nil, err
+			}
+
+			return &aggregation{function: function, argument: argument}, nil
+		}
+
+		return newGlobSelector(current)
+	case tokenString:
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+
+		return newGlobSelector(current)
+	case tokenTilde:
+		if err := parser.advance(); err != nil {
+			return nil, err
+		}
+		pattern := parser.current
+		if pattern.kind != tokenString {
+			return nil, newErrSyntax(pattern.position, "regexp must be quoted")
+		}
+		expression, err := regexp.Compile(pattern.text)
+		if err != nil {
+			return nil, newErrSyntax(pattern.position, err.Error())
+		}
+
+		return &selector{expression: expression}, parser.advance()
+	}
+
+	return nil, parser.unexpected()
+}
+
+// parenthesized parses expression followed by closing parenthesis
+func (parser *parser) parenthesized() (node, error) {
+	inner, err := parser.expression()
+	if err != nil {
+		return nil, err
+	}
+	if parser.current.kind != tokenRightParen {
+		return nil, parser.unexpected()
+	}
+
+	return inner, parser.advance()
+}
+
+func newGlobSelector(pattern token) (node, error) {
+	if pattern.text == "" {
+		return nil, newErrSyntax(pattern.position, "empty pattern")
+	}
+	if _, err := path.Match(pattern.text, ""); err != nil {
+		return nil, newErrSyntax(pattern.position, "invalid pattern '"+pattern.text+"'")
+	}
+
+	return &selector{filter: storage.Filter{Match: pattern.text}}, nil
+}
@@ -0,0 +1,86 @@
+// Package query
+// contains small query language which aggregates metrics and combines them with arithmetic.
+//
+// Grammar:
+//
+//	expression = term { ("+" | "-") term }
+//	term       = factor { ("*" | "/") factor }
+//	factor     = "-" factor | number | selector | function "(" expression ")" | "(" expression ")"
+//	selector   = glob | '"' glob '"' | "~" '"' regexp '"'
+//	function   = "sum" | "avg" | "min" | "max" | "count"
+//
+// Selector is vector of metrics which names match glob (path.Match syntax) or regexp (RE2 syntax).
+// Bare glob takes stars following it, so multiplication of selector is written with spaces: "HeapAlloc * 2".
+// Names with other characters are written in double quotes, \" escapes quote.
+// Arithmetic between vectors is applied to metrics with the same name only,
+// so different metrics are combined after aggregation, e.g. "sum(*.TotalMemory) - sum(*.FreeMemory)"
+package query
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+)
+
+// ErrNotFinite is returned if result of arithmetic is infinite or NaN, e.g. on division by zero
+var ErrNotFinite = errors.New("result is not a finite number")
+
+// ErrEmptyAggregation is returned by avg, min and max of empty vector
+var ErrEmptyAggregation = errors.New("aggregation of empty vector")
+
+type SyntaxError struct {
+	Position int
+	Message  string
+}
+
+func (err SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", err.Position, err.Message)
+}
+
+func newErrSyntax(position int, message string) error {
+	return &SyntaxError{
+		Position: position,
+		Message:  message,
+	}
+}
+
+// Source of metrics selected by query, manager.Manager is used by server
+type Source interface {
+	GetFiltered(ctx context.Context, filter storage.Filter) (iter.Seq2[*storage.Record, error], error)
+}
+
+// Sample is value of one metric
+type Sample struct {
+	Name  string
+	Value float64
+}
+
+// Result is scalar or vector of samples sorted by name
+type Result struct {
+	Vector  bool
+	Scalar  float64
+	Samples []Sample
+}
+
+// Query is parsed expression, it could be evaluated multiple times
+type Query struct {
+	root node
+}
+
+// Parse returns SyntaxError if query is malformed
+func Parse(query string) (*Query, error) {
+	root, err := newParser(query).parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return &Query{root: root}, nil
+}
+
+// Evaluate reads metrics of selectors from source and computes result
+func (query *Query) Evaluate(ctx context.Context, source Source) (*Result, error) {
+	return query.root.evaluate(ctx, source)
+}
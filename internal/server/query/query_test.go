@@ -0,0 +1,170 @@
+package query
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/manager"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSource(t *testing.T) Source {
+	storage := memory.New()
+	require.NoError(t, storage.SaveBatch(context.Background(), []metric.Metric{
+		gauge.New("CPUutilization1", 10),
+		gauge.New("CPUutilization2", 30),
+		gauge.New("host1.HeapAlloc", 100),
+		gauge.New("host2.HeapAlloc", 300),
+		gauge.New("host1.TotalMemory", 1000),
+		gauge.New("host2.TotalMemory", 2000),
+		gauge.New("host1.FreeMemory", 400),
+		gauge.New("weird name-1", 7),
+		counter.New("PollCount", 5),
+		counter.New("sum", 2),
+	}))
+
+	return manager.New(storage)
+}
+
+func scalar(value float64) *Result {
+	return &Result{Scalar: value}
+}
+
+func vector(samples ...Sample) *Result {
+	if samples == nil {
+		samples = []Sample{}
+	}
+
+	return &Result{Vector: true, Samples: samples}
+}
+
+func TestQuery_Evaluate(t *testing.T) {
+	tests := []struct {
+		query string
+		want  *Result
+	}{
+		{query: "1 + 2 * 3", want: scalar(7)},
+		{query: "(1 + 2) * 3", want: scalar(9)},
+		{query: "10 - 4 - 3", want: scalar(3)},
+		{query: "2*-3", want: scalar(-6)},
+		{query: "1.5e2 / 3", want: scalar(50)},
+		{query: "PollCount", want: vector(Sample{Name: "PollCount", Value: 5})},
+		{query: "sum(CPUutilization*)", want: scalar(40)},
+		{query: "avg(CPUutilization*)", want: scalar(20)},
+		{query: "min(CPUutilization[0-9])", want: scalar(10)},
+		{query: "max(*.HeapAlloc)", want: scalar(300)},
+		{query: "count(*)", want: scalar(10)},
+		{query: "count(missing*)", want: scalar(0)},
+		{query: "sum(5)", want: scalar(5)},
+		{query: "sum + 1", want: vector(Sample{Name: "sum", Value: 3})},
+		{query: "sum(CPUutilization*) / count(CPUutilization*)", want: scalar(20)},
+		{query: "max(*.HeapAlloc)*2", want: scalar(600)},
+		{query: "*.HeapAlloc * 2", want: vector(Sample{Name: "host1.HeapAlloc", Value: 200}, Sample{Name: "host2.HeapAlloc", Value: 600})},
+		{query: "-host1.HeapAlloc", want: vector(Sample{Name: "host1.HeapAlloc", Value: -100})},
+		{query: "sum(*.TotalMemory) - sum(*.FreeMemory)", want: scalar(2600)},
+		{query: "*.TotalMemory - *.FreeMemory", want: vector()},
+		{
+			query: "~\"^host[0-9]\\.(HeapAlloc)$\" / 100",
+			want:  vector(Sample{Name: "host1.HeapAlloc", Value: 1}, Sample{Name: "host2.HeapAlloc", Value: 3}),
+		},
+		{query: `"weird name-?" + 1`, want: vector(Sample{Name: "weird name-1", Value: 8})},
+	}
+	source := newSource(t)
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := Parse(tt.query)
+			require.NoError(t, err)
+			got, err := query.Evaluate(context.Background(), source)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestQuery_EvaluateVectors(t *testing.T) {
+	storage := memory.New()
+	require.NoError(t, storage.SaveBatch(context.Background(), []metric.Metric{
+		gauge.New("a", 10),
+		gauge.New("b", 20),
+		gauge.New("c", 30),
+	}))
+
+	query, err := Parse("[ab] - [bc]")
+	require.NoError(t, err)
+	got, err := query.Evaluate(context.Background(), manager.New(storage))
+	require.NoError(t, err)
+	// only metrics present in both vectors are combined
+	assert.Equal(t, vector(Sample{Name: "b", Value: 0}), got)
+}
+
+func TestQuery_EvaluateErrors(t *testing.T) {
+	tests := []struct {
+		query   string
+		wantErr error
+	}{
+		{query: "1 / 0", wantErr: ErrNotFinite},
+		{query: "CPUutilization* / 0", wantErr: ErrNotFinite},
+		{query: "1e308 * 10", wantErr: ErrNotFinite},
+		{query: "avg(missing*)", wantErr: ErrEmptyAggregation},
+		{query: "max(missing*)", wantErr: ErrEmptyAggregation},
+	}
+	source := newSource(t)
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := Parse(tt.query)
+			require.NoError(t, err)
+			_, err = query.Evaluate(context.Background(), source)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
+
+func TestParse_errors(t *testing.T) {
+	tests := []struct {
+		query        string
+		wantPosition int
+	}{
+		{query: "", wantPosition: 0},
+		{query: "   ", wantPosition: 3},
+		{query: "1 +", wantPosition: 3},
+		{query: "(1 + 2", wantPosition: 6},
+		{query: "1 2", wantPosition: 2},
+		{query: "sum(a) )", wantPosition: 7},
+		{query: "a & b", wantPosition: 2},
+		{query: "CPU[0-9", wantPosition: 0},
+		{query: `"unterminated`, wantPosition: 0},
+		{query: `""`, wantPosition: 0},
+		{query: "~abc", wantPosition: 1},
+		{query: `~"(abc"`, wantPosition: 1},
+		{query: "1..2", wantPosition: 0},
+		{query: "1e999", wantPosition: 0},
+		{query: "+1", wantPosition: 0},
+		{query: "sum()", wantPosition: 4},
+		{query: "a\\", wantPosition: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			syntaxErr := &SyntaxError{}
+			require.ErrorAs(t, err, &syntaxErr)
+			assert.Equal(t, tt.wantPosition, syntaxErr.Position)
+		})
+	}
+}
+
+func TestParse_depth(t *testing.T) {
+	nested := func(depth int) string {
+		return strings.Repeat("(", depth) + "1" + strings.Repeat(")", depth)
+	}
+
+	_, err := Parse(nested(maxDepth - 1))
+	require.NoError(t, err)
+	_, err = Parse(nested(maxDepth))
+	assert.ErrorAs(t, err, new(*SyntaxError))
+}
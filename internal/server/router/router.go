@@ -6,50 +6,91 @@ import (
 	"crypto/rsa"
 	"crypto/sha256"
 	"net"
+	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/m1khal3v/gometheus/internal/common/logger"
 	"github.com/m1khal3v/gometheus/internal/server/api"
+	"github.com/m1khal3v/gometheus/internal/server/hub"
+	"github.com/m1khal3v/gometheus/internal/server/manager"
 	internalMiddleware "github.com/m1khal3v/gometheus/internal/server/middleware"
-	"github.com/m1khal3v/gometheus/internal/server/storage"
 	pkgMiddleware "github.com/m1khal3v/gometheus/pkg/middleware"
 )
 
-func New(storage storage.Storage, key string, privKey *rsa.PrivateKey, subnet *net.IPNet) chi.Router {
-	routes := api.New(storage)
-	router := chi.NewRouter()
-	if key != "" {
-		router.Use(internalMiddleware.HMACSignatureRespond("HashSHA256", sha256.New, key))
-		router.Use(internalMiddleware.HMACSignatureValidate("HashSHA256", sha256.New, key))
-	}
-	router.Use(pkgMiddleware.ZapLogRequest(logger.Logger, "http-request"))
-	router.Use(internalMiddleware.Recover())
-	router.Use(pkgMiddleware.ZapLogPanic(logger.Logger, "http-panic"))
-	router.Use(middleware.RealIP)
-	if privKey != nil {
-		router.Use(internalMiddleware.Decrypt(privKey))
-	}
-	router.Use(pkgMiddleware.Decompress())
-	router.Use(pkgMiddleware.Compress(5, "text/html", "application/json"))
-	if subnet != nil {
-		router.Use(internalMiddleware.SubnetValidate("X-Real-IP", subnet))
-	}
-	router.Get("/", routes.GetAllMetrics)
-	router.Route("/ping", func(router chi.Router) {
-		router.Get("/", routes.PingStorage)
-	})
-	router.Route("/update", func(router chi.Router) {
-		router.Post("/{type}/{name}/{value}", routes.SaveMetric)
-		router.Post("/", routes.JSONSaveMetric)
+// New creates router, metrics handler exposes server's own metrics on /metrics if it is not nil.
+// Live update streams are served if hub is not nil, manager should publish metrics to it
+func New(manager *manager.Manager, key string, privKey *rsa.PrivateKey, subnet *net.IPNet, adminToken string, metrics http.Handler, hub *hub.Hub) chi.Router {
+	routes := api.New(manager, hub)
+	root := chi.NewRouter()
+	root.Group(func(router chi.Router) {
+		if key != "" {
+			router.Use(internalMiddleware.HMACSignatureRespond("HashSHA256", sha256.New, key))
+			router.Use(internalMiddleware.HMACSignatureValidate("HashSHA256", sha256.New, key))
+		}
+		router.Use(pkgMiddleware.ZapLogRequest(logger.Logger, "http-request"))
+		router.Use(internalMiddleware.Recover())
+		router.Use(pkgMiddleware.ZapLogPanic(logger.Logger, "http-panic"))
+		router.Use(middleware.RealIP)
+		if privKey != nil {
+			router.Use(internalMiddleware.Decrypt(privKey))
+		}
+		router.Use(pkgMiddleware.Decompress())
+		router.Use(pkgMiddleware.Compress(5, "text/html", "application/json"))
+		if subnet != nil {
+			router.Use(internalMiddleware.SubnetValidate("X-Real-IP", subnet))
+		}
+		router.Get("/", routes.GetAllMetrics)
+		router.Route("/ping", func(router chi.Router) {
+			router.Get("/", routes.PingStorage)
+		})
+		router.Route("/update", func(router chi.Router) {
+			router.Post("/{type}/{name}/{value}", routes.SaveMetric)
+			router.Post("/", routes.JSONSaveMetric)
+		})
+		router.Route("/updates", func(router chi.Router) {
+			router.Post("/", routes.JSONSaveMetrics)
+		})
+		router.Route("/value", func(router chi.Router) {
+			router.Get("/{type}/{name}", routes.GetMetric)
+			router.With(internalMiddleware.AdminTokenValidate(adminToken)).Delete("/{type}/{name}", routes.DeleteMetric)
+			router.Post("/", routes.JSONGetMetric)
+		})
+		router.Route("/values", func(router chi.Router) {
+			router.Get("/", routes.ListMetrics)
+		})
+		router.Route("/query", func(router chi.Router) {
+			router.Get("/", routes.Query)
+		})
+		router.Route("/changes", func(router chi.Router) {
+			router.Get("/", routes.ListChanges)
+		})
+		if metrics != nil {
+			router.Method(http.MethodGet, "/metrics", metrics)
+		}
 	})
-	router.Route("/updates", func(router chi.Router) {
-		router.Post("/", routes.JSONSaveMetrics)
-	})
-	router.Route("/value", func(router chi.Router) {
-		router.Get("/{type}/{name}", routes.GetMetric)
-		router.Post("/", routes.JSONGetMetric)
+
+	if hub == nil {
+		return root
+	}
+
+	// streams are not signed and compressed, because both require whole response
+	root.Group(func(router chi.Router) {
+		if key != "" {
+			router.Use(internalMiddleware.HMACSignatureValidate("HashSHA256", sha256.New, key))
+		}
+		router.Use(pkgMiddleware.ZapLogRequest(logger.Logger, "http-request"))
+		router.Use(internalMiddleware.Recover())
+		router.Use(pkgMiddleware.ZapLogPanic(logger.Logger, "http-panic"))
+		router.Use(middleware.RealIP)
+		if subnet != nil {
+			router.Use(internalMiddleware.SubnetValidate("X-Real-IP", subnet))
+		}
+		router.Route("/stream", func(router chi.Router) {
+			router.Get("/", routes.Stream)
+			router.Get("/ws", routes.StreamWebSocket)
+		})
 	})
 
-	return router
+	return root
 }
@@ -0,0 +1,313 @@
+package rpc
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/server/hub"
+	"github.com/m1khal3v/gometheus/internal/server/manager"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+)
+
+// feedInterval is min interval between reads of storage changes, wakes received in between are coalesced into one read
+const feedInterval = 100 * time.Millisecond
+
+// feed reads storage changes once for all Watch streams and queues them to watchers.
+// Reader is started by the first watcher and stopped after the last one leaves, so idle server does not read changes
+type feed struct {
+	manager *manager.Manager
+	hub     *hub.Hub
+	mutex   sync.Mutex
+	reader  *feedReader
+}
+
+type feedReader struct {
+	watchers map[*watcher]struct{}
+	cancel   context.CancelFunc
+}
+
+func newFeed(manager *manager.Manager, hub *hub.Hub) *feed {
+	return &feed{
+		manager: manager,
+		hub:     hub,
+	}
+}
+
+// join registers watcher of metrics chosen by selector.
+// Watcher receives changes made after head revision read at the moment of join or earlier ones,
+// so stream reading its own changes after join could skip received records not exceeding its head
+func (feed *feed) join(ctx context.Context, selector hub.Selector) (*watcher, error) {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	if feed.reader == nil {
+		reader, err := feed.start(ctx)
+		if err != nil {
+			return nil, err
+		}
+		feed.reader = reader
+	}
+
+	watcher := newWatcher(feed.reader, selector)
+	feed.reader.watchers[watcher] = struct{}{}
+
+	return watcher, nil
+}
+
+func (feed *feed) leave(watcher *watcher) {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	delete(watcher.reader.watchers, watcher)
+	if len(watcher.reader.watchers) == 0 && feed.reader == watcher.reader {
+		feed.reader.cancel()
+		feed.reader = nil
+	}
+}
+
+// start subscribes before head revision is read, so changes made after it wake reader
+func (feed *feed) start(ctx context.Context) (*feedReader, error) {
+	subscription, err := feed.hub.Subscribe(hub.MatchAll, watchLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	wake := make(chan struct{}, 1)
+	unsubscribe := feed.manager.Subscribe(func(storage.Change) {
+		notify(wake)
+	})
+
+	head, err := feed.manager.Revision(ctx)
+	if err != nil {
+		unsubscribe()
+		subscription.Close()
+
+		return nil, err
+	}
+
+	readerCtx, cancel := context.WithCancel(context.Background())
+	reader := &feedReader{
+		watchers: map[*watcher]struct{}{},
+		cancel:   cancel,
+	}
+	go feed.read(readerCtx, reader, head, subscription, unsubscribe, wake)
+
+	return reader, nil
+}
+
+func (feed *feed) read(
+	ctx context.Context,
+	reader *feedReader,
+	head uint64,
+	subscription *hub.Subscription,
+	unsubscribe func(),
+	wake chan struct{},
+) {
+	defer unsubscribe()
+
+	failed := make(chan error, 1)
+	go func() {
+		defer func() {
+			subscription.Close()
+		}()
+
+		for {
+			// published metrics are dropped, changes are read from storage with their revisions
+			_, err := subscription.Next(ctx)
+			switch {
+			case errors.Is(err, hub.ErrSlowSubscriber):
+				// dropped metrics are read from storage anyway, so reader resubscribes
+				subscription.Close()
+				if subscription, err = feed.hub.Subscribe(hub.MatchAll, watchLimit); err != nil {
+					failed <- err
+					return
+				}
+			case err != nil:
+				failed <- err
+				return
+			}
+			notify(wake)
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-failed:
+			feed.fail(reader, err)
+			return
+		case <-wake:
+		}
+
+		records, next, err := feed.changes(ctx, head)
+		if err != nil {
+			if ctx.Err() == nil {
+				feed.fail(reader, err)
+			}
+			return
+		}
+		feed.push(reader, records)
+		head = next
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(feedInterval):
+		}
+	}
+}
+
+func (feed *feed) changes(ctx context.Context, since uint64) ([]*storage.Record, uint64, error) {
+	seq, head, err := feed.manager.GetChanges(ctx, since)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	records := make([]*storage.Record, 0)
+	for record, err := range seq {
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, record)
+	}
+
+	return records, head, nil
+}
+
+func (feed *feed) push(reader *feedReader, records []*storage.Record) {
+	if len(records) == 0 {
+		return
+	}
+
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	for watcher := range reader.watchers {
+		watcher.push(records)
+	}
+}
+
+// fail finishes watchers of reader, following watchers start new reader
+func (feed *feed) fail(reader *feedReader, err error) {
+	feed.mutex.Lock()
+	defer feed.mutex.Unlock()
+
+	for watcher := range reader.watchers {
+		watcher.fail(err)
+	}
+	reader.cancel()
+	if feed.reader == reader {
+		feed.reader = nil
+	}
+}
+
+// watcher queues changes of selected metrics until they are received by next.
+// Change of metric which is already queued replaces queued one, so memory is bounded by watchLimit
+type watcher struct {
+	reader   *feedReader
+	selector hub.Selector
+	mutex    sync.Mutex
+	pending  map[string]*storage.Record
+	notify   chan struct{}
+	err      error
+}
+
+func newWatcher(reader *feedReader, selector hub.Selector) *watcher {
+	return &watcher{
+		reader:   reader,
+		selector: selector,
+		pending:  map[string]*storage.Record{},
+		notify:   make(chan struct{}, 1),
+	}
+}
+
+func (watcher *watcher) push(records []*storage.Record) {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	if watcher.err != nil {
+		return
+	}
+
+	pushed := false
+	for _, record := range records {
+		name := record.Metric.Name()
+		if !watcher.selector(name) {
+			continue
+		}
+
+		if _, ok := watcher.pending[name]; !ok && len(watcher.pending) == watchLimit {
+			watcher.failLocked(hub.ErrSlowSubscriber)
+			return
+		}
+		watcher.pending[name] = record
+		pushed = true
+	}
+
+	if pushed {
+		notify(watcher.notify)
+	}
+}
+
+// next waits for queued changes and returns them in order of revisions, so stream could be resumed from any of them.
+// Error is returned if watcher is failed, queued changes are dropped then
+func (watcher *watcher) next(ctx context.Context) ([]*storage.Record, error) {
+	for {
+		watcher.mutex.Lock()
+		if watcher.err != nil {
+			watcher.mutex.Unlock()
+			return nil, watcher.err
+		}
+		if len(watcher.pending) > 0 {
+			batch := make([]*storage.Record, 0, len(watcher.pending))
+			for _, record := range watcher.pending {
+				batch = append(batch, record)
+			}
+			clear(watcher.pending)
+			watcher.mutex.Unlock()
+
+			slices.SortFunc(batch, func(a, b *storage.Record) int {
+				return cmp.Compare(a.Revision, b.Revision)
+			})
+
+			return batch, nil
+		}
+		watcher.mutex.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-watcher.notify:
+		}
+	}
+}
+
+func (watcher *watcher) fail(err error) {
+	watcher.mutex.Lock()
+	defer watcher.mutex.Unlock()
+
+	watcher.failLocked(err)
+}
+
+// failLocked keeps the first error
+func (watcher *watcher) failLocked(err error) {
+	if watcher.err != nil {
+		return
+	}
+
+	watcher.err = err
+	clear(watcher.pending)
+	notify(watcher.notify)
+}
+
+func notify(channel chan struct{}) {
+	select {
+	case channel <- struct{}{}:
+	default:
+	}
+}
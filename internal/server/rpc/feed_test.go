@@ -0,0 +1,47 @@
+package rpc
+
+import (
+	"context"
+	"strconv"
+	"testing"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/hub"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher_next(t *testing.T) {
+	ctx := context.Background()
+	watcher := newWatcher(nil, func(name string) bool {
+		return name != "other"
+	})
+
+	watcher.push([]*storage.Record{
+		{Metric: gauge.New("m1", 1), Revision: 1},
+		{Metric: gauge.New("m2", 2), Revision: 2},
+		{Metric: gauge.New("other", 3), Revision: 3},
+	})
+	// queued change is replaced and sent in order of its new revision
+	watcher.push([]*storage.Record{{Metric: gauge.New("m1", 4), Revision: 4}})
+
+	records, err := watcher.next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []*storage.Record{
+		{Metric: gauge.New("m2", 2), Revision: 2},
+		{Metric: gauge.New("m1", 4), Revision: 4},
+	}, records)
+}
+
+func TestWatcher_slow(t *testing.T) {
+	watcher := newWatcher(nil, hub.MatchAll)
+	records := make([]*storage.Record, 0, watchLimit+1)
+	for i := range watchLimit + 1 {
+		records = append(records, &storage.Record{Metric: gauge.New("m"+strconv.Itoa(i), 1), Revision: uint64(i + 1)})
+	}
+
+	watcher.push(records)
+	_, err := watcher.next(context.Background())
+	assert.ErrorIs(t, err, hub.ErrSlowSubscriber)
+}
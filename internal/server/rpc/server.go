@@ -5,16 +5,19 @@ import (
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/rsa"
+	"crypto/subtle"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/hex"
 	"hash"
 	"math/big"
 	"net"
+	"strings"
 	"sync"
 	"time"
 
-	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/hub"
+	"github.com/m1khal3v/gometheus/internal/server/manager"
 	"github.com/m1khal3v/gometheus/pkg/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
@@ -32,6 +35,8 @@ type serverConfig struct {
 	hasher          func() hash.Hash
 	privateKey      *rsa.PrivateKey
 	allowedSubnet   *net.IPNet
+	adminToken      string
+	hub             *hub.Hub
 }
 
 type ServerOption func(*serverConfig)
@@ -56,13 +61,32 @@ func WithSubnet(header string, subnet *net.IPNet) ServerOption {
 	}
 }
 
+// WithAdminToken allows admin methods (metric deletion) for requests with "authorization: Bearer <token>" metadata
+func WithAdminToken(token string) ServerOption {
+	return func(c *serverConfig) {
+		c.adminToken = token
+	}
+}
+
+// WithHub enables Watch, manager of server should publish metrics to hub
+func WithHub(hub *hub.Hub) ServerOption {
+	return func(c *serverConfig) {
+		c.hub = hub
+	}
+}
+
+// adminMethods are denied if admin token is not configured
+var adminMethods = map[string]struct{}{
+	proto.MetricsService_DeleteMetric_FullMethodName: {},
+}
+
 type GRPCServer struct {
 	server   *grpc.Server
 	config   *serverConfig
 	hmacPool *sync.Pool
 }
 
-func NewGRPCServer(storage storage.Storage, options ...ServerOption) (*GRPCServer, error) {
+func NewGRPCServer(manager *manager.Manager, options ...ServerOption) (*GRPCServer, error) {
 	cfg := &serverConfig{}
 	for _, opt := range options {
 		opt(cfg)
@@ -80,16 +104,21 @@ func NewGRPCServer(storage storage.Storage, options ...ServerOption) (*GRPCServe
 		serverOpts = append(serverOpts, grpc.Creds(creds))
 	}
 
+	// only one grpc.UnaryInterceptor could be set, so interceptors are chained
 	if cfg.hmacSecret != "" {
-		serverOpts = append(serverOpts, grpc.UnaryInterceptor(hmacInterceptor(cfg)))
+		serverOpts = append(serverOpts, grpc.ChainUnaryInterceptor(hmacInterceptor(cfg)))
+		serverOpts = append(serverOpts, grpc.ChainStreamInterceptor(hmacStreamInterceptor(cfg)))
 	}
 
 	if cfg.allowedSubnet != nil {
-		serverOpts = append(serverOpts, grpc.UnaryInterceptor(subnetInterceptor("X-Real-IP", cfg.allowedSubnet)))
+		serverOpts = append(serverOpts, grpc.ChainUnaryInterceptor(subnetInterceptor("X-Real-IP", cfg.allowedSubnet)))
+		serverOpts = append(serverOpts, grpc.ChainStreamInterceptor(subnetStreamInterceptor("X-Real-IP", cfg.allowedSubnet)))
 	}
 
+	serverOpts = append(serverOpts, grpc.ChainUnaryInterceptor(adminInterceptor(cfg.adminToken)))
+
 	server := grpc.NewServer(serverOpts...)
-	proto.RegisterMetricsServiceServer(server, NewMetricsService(storage))
+	proto.RegisterMetricsServiceServer(server, NewMetricsService(manager, cfg.hub))
 
 	return &GRPCServer{
 		server: server,
@@ -98,11 +127,7 @@ func NewGRPCServer(storage storage.Storage, options ...ServerOption) (*GRPCServe
 }
 
 func hmacInterceptor(cfg *serverConfig) grpc.UnaryServerInterceptor {
-	pool := &sync.Pool{
-		New: func() interface{} {
-			return hmac.New(cfg.hasher, []byte(cfg.hmacSecret))
-		},
-	}
+	verify := signatureVerifier(cfg)
 
 	return func(
 		ctx context.Context,
@@ -110,19 +135,62 @@ func hmacInterceptor(cfg *serverConfig) grpc.UnaryServerInterceptor {
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
+		if err := verify(ctx, req); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// hmacStreamInterceptor verifies signature of request message of server-streaming methods
+func hmacStreamInterceptor(cfg *serverConfig) grpc.StreamServerInterceptor {
+	verify := signatureVerifier(cfg)
+
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		return handler(srv, &verifiedStream{ServerStream: stream, verify: verify})
+	}
+}
+
+type verifiedStream struct {
+	grpc.ServerStream
+	verify func(ctx context.Context, req interface{}) error
+}
+
+func (stream *verifiedStream) RecvMsg(m interface{}) error {
+	if err := stream.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	return stream.verify(stream.Context(), m)
+}
+
+func signatureVerifier(cfg *serverConfig) func(ctx context.Context, req interface{}) error {
+	pool := &sync.Pool{
+		New: func() interface{} {
+			return hmac.New(cfg.hasher, []byte(cfg.hmacSecret))
+		},
+	}
+
+	return func(ctx context.Context, req interface{}) error {
 		md, ok := metadata.FromIncomingContext(ctx)
 		if !ok {
-			return nil, status.Error(codes.Unauthenticated, "missing metadata")
+			return status.Error(codes.Unauthenticated, "missing metadata")
 		}
 
 		signatures := md.Get(cfg.signatureHeader)
 		if len(signatures) == 0 {
-			return nil, status.Error(codes.Unauthenticated, "missing signature")
+			return status.Error(codes.Unauthenticated, "missing signature")
 		}
 
 		raw, err := gproto.Marshal(req.(gproto.Message))
 		if err != nil {
-			return nil, status.Error(codes.Internal, "failed to marshal request")
+			return status.Error(codes.Internal, "failed to marshal request")
 		}
 
 		h := pool.Get().(hash.Hash)
@@ -130,15 +198,15 @@ func hmacInterceptor(cfg *serverConfig) grpc.UnaryServerInterceptor {
 		h.Reset()
 
 		if _, err := h.Write(raw); err != nil {
-			return nil, status.Error(codes.Internal, "failed to compute signature")
+			return status.Error(codes.Internal, "failed to compute signature")
 		}
 
 		expected := hex.EncodeToString(h.Sum(nil))
 		if !hmac.Equal([]byte(signatures[0]), []byte(expected)) {
-			return nil, status.Error(codes.Unauthenticated, "invalid signature")
+			return status.Error(codes.Unauthenticated, "invalid signature")
 		}
 
-		return handler(ctx, req)
+		return nil
 	}
 }
 
@@ -176,34 +244,92 @@ func subnetInterceptor(header string, subnet *net.IPNet) grpc.UnaryServerInterce
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler,
 	) (interface{}, error) {
-		var ipStr string
+		if err := checkSubnet(ctx, header, subnet); err != nil {
+			return nil, err
+		}
 
-		// Пытаемся получить IP из метаданных
-		if md, ok := metadata.FromIncomingContext(ctx); ok {
-			values := md.Get(header)
-			if len(values) > 0 {
-				ipStr = values[0]
-			}
+		return handler(ctx, req)
+	}
+}
+
+func subnetStreamInterceptor(header string, subnet *net.IPNet) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := checkSubnet(stream.Context(), header, subnet); err != nil {
+			return err
 		}
 
-		// Если не нашли в метаданных, пробуем получить из peer
-		if ipStr == "" {
-			if p, ok := peer.FromContext(ctx); ok {
-				ipStr = p.Addr.String()
-			}
+		return handler(srv, stream)
+	}
+}
+
+func checkSubnet(ctx context.Context, header string, subnet *net.IPNet) error {
+	var ipStr string
+
+	// Пытаемся получить IP из метаданных
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		values := md.Get(header)
+		if len(values) > 0 {
+			ipStr = values[0]
 		}
+	}
 
-		if ipStr == "" {
-			return nil, status.Error(codes.PermissionDenied, "IP address not found")
+	// Если не нашли в метаданных, пробуем получить из peer
+	if ipStr == "" {
+		if p, ok := peer.FromContext(ctx); ok {
+			ipStr = p.Addr.String()
+		}
+	}
+
+	if ipStr == "" {
+		return status.Error(codes.PermissionDenied, "IP address not found")
+	}
+
+	ip := net.ParseIP(ipStr)
+	if ip == nil {
+		return status.Error(codes.PermissionDenied, "Invalid IP format")
+	}
+
+	if !subnet.Contains(ip) {
+		return status.Error(codes.PermissionDenied, "IP not in allowed subnet")
+	}
+
+	return nil
+}
+
+func adminInterceptor(token string) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if _, ok := adminMethods[info.FullMethod]; !ok {
+			return handler(ctx, req)
+		}
+
+		if token == "" {
+			return nil, status.Error(codes.PermissionDenied, "admin API is disabled")
+		}
+
+		var requestToken string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			values := md.Get("authorization")
+			if len(values) > 0 {
+				requestToken, _ = strings.CutPrefix(values[0], "Bearer ")
+			}
 		}
 
-		ip := net.ParseIP(ipStr)
-		if ip == nil {
-			return nil, status.Error(codes.PermissionDenied, "Invalid IP format")
+		if requestToken == "" {
+			return nil, status.Error(codes.Unauthenticated, "missing admin token")
 		}
 
-		if !subnet.Contains(ip) {
-			return nil, status.Error(codes.PermissionDenied, "IP not in allowed subnet")
+		if subtle.ConstantTimeCompare([]byte(requestToken), []byte(token)) != 1 {
+			return nil, status.Error(codes.Unauthenticated, "invalid admin token")
 		}
 
 		return handler(ctx, req)
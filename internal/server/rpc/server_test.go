@@ -7,6 +7,7 @@ import (
 	"net"
 	"testing"
 
+	"github.com/m1khal3v/gometheus/pkg/proto"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
@@ -87,3 +88,100 @@ func TestSubnetInterceptor_DeniedIP(t *testing.T) {
 		t.Fatalf("unexpected error code: %v", st.Code())
 	}
 }
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (stream contextStream) Context() context.Context {
+	return stream.ctx
+}
+
+func TestSubnetStreamInterceptor(t *testing.T) {
+	_, subnet, err := net.ParseCIDR("192.168.1.0/24")
+	if err != nil {
+		t.Fatalf("failed to parse subnet: %v", err)
+	}
+
+	interceptor := subnetStreamInterceptor("X-Real-IP", subnet)
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		return nil
+	}
+
+	tests := []struct {
+		ip       string
+		wantCode codes.Code
+	}{
+		{ip: "192.168.1.42", wantCode: codes.OK},
+		{ip: "10.0.0.5", wantCode: codes.PermissionDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ip, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("X-Real-IP", tt.ip))
+
+			err := interceptor(nil, contextStream{ctx: ctx}, &grpc.StreamServerInfo{}, handler)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("unexpected error code: %v", status.Code(err))
+			}
+		})
+	}
+}
+
+func TestAdminInterceptor(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		method        string
+		authorization string
+		wantCode      codes.Code
+	}{
+		{
+			name:          "valid token",
+			token:         "secret",
+			method:        proto.MetricsService_DeleteMetric_FullMethodName,
+			authorization: "Bearer secret",
+			wantCode:      codes.OK,
+		},
+		{
+			name:     "not admin method",
+			method:   proto.MetricsService_SaveMetric_FullMethodName,
+			wantCode: codes.OK,
+		},
+		{
+			name:          "admin API disabled",
+			method:        proto.MetricsService_DeleteMetric_FullMethodName,
+			authorization: "Bearer secret",
+			wantCode:      codes.PermissionDenied,
+		},
+		{
+			name:     "missing token",
+			token:    "secret",
+			method:   proto.MetricsService_DeleteMetric_FullMethodName,
+			wantCode: codes.Unauthenticated,
+		},
+		{
+			name:          "invalid token",
+			token:         "secret",
+			method:        proto.MetricsService_DeleteMetric_FullMethodName,
+			authorization: "Bearer public",
+			wantCode:      codes.Unauthenticated,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.authorization != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", tt.authorization))
+			}
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				return "success", nil
+			}
+
+			_, err := adminInterceptor(tt.token)(ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if status.Code(err) != tt.wantCode {
+				t.Fatalf("unexpected error code: %v", status.Code(err))
+			}
+		})
+	}
+}
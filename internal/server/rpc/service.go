@@ -2,24 +2,39 @@ package rpc
 
 import (
 	"context"
+	"errors"
+	"strings"
 
 	"github.com/m1khal3v/gometheus/internal/common/metric"
 	"github.com/m1khal3v/gometheus/internal/common/metric/factory"
 	"github.com/m1khal3v/gometheus/internal/common/metric/transformer"
+	"github.com/m1khal3v/gometheus/internal/server/hub"
 	"github.com/m1khal3v/gometheus/internal/server/manager"
 	"github.com/m1khal3v/gometheus/internal/server/storage"
 	"github.com/m1khal3v/gometheus/pkg/proto"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+// watchLimit is max count of distinct metrics queued for one Watch stream, slower clients are disconnected
+const watchLimit = 1024
+
 type MetricsService struct {
 	proto.UnimplementedMetricsServiceServer
 	manager *manager.Manager
+	hub     *hub.Hub
+	feed    *feed
 }
 
-func NewMetricsService(storage storage.Storage) *MetricsService {
-	return &MetricsService{manager: manager.New(storage)}
+// NewMetricsService wakes Watch streams by metrics published to hub, manager should publish to it.
+// Watch is unavailable without hub
+func NewMetricsService(manager *manager.Manager, hub *hub.Hub) *MetricsService {
+	return &MetricsService{
+		manager: manager,
+		hub:     hub,
+		feed:    newFeed(manager, hub),
+	}
 }
 
 func (s *MetricsService) SaveMetric(
@@ -84,6 +99,242 @@ func (s *MetricsService) SaveMetrics(
 	return &proto.SaveMetricsBatchResponse{Metrics: responses}, nil
 }
 
+func (s *MetricsService) DeleteMetric(
+	ctx context.Context,
+	req *proto.DeleteMetricRequest,
+) (*proto.DeleteMetricResponse, error) {
+	deletedMetric, err := s.manager.Delete(ctx, req.GetMetricType(), req.GetMetricName())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if deletedMetric == nil {
+		return nil, status.Error(codes.NotFound, "metric not found")
+	}
+
+	return &proto.DeleteMetricResponse{
+		MetricName: deletedMetric.Name(),
+		MetricType: deletedMetric.Type(),
+	}, nil
+}
+
+// Watch sends snapshot of selected metrics and then their changes read from storage change feed.
+// Changes are read once for all streams after metrics are published to hub by this server
+// or changes are made by other servers sharing storage.
+// Snapshot is skipped if stream is resumed from revision not exceeding head revision of storage.
+// Storages without change feed have no revisions, so their streams send snapshot and then metrics published to hub
+func (s *MetricsService) Watch(req *proto.WatchRequest, stream grpc.ServerStreamingServer[proto.Metric]) error {
+	if s.hub == nil {
+		return status.Error(codes.Unimplemented, "watch is not available")
+	}
+
+	selector := watchSelector(req.GetNames(), req.GetPrefixes())
+	if !s.manager.HasChangeFeed() {
+		return s.watchUpdates(req, selector, stream)
+	}
+
+	ctx := stream.Context()
+	// watcher joins before head revision is read, so changes made after it are queued
+	watcher, err := s.feed.join(ctx, selector)
+	if err != nil {
+		return watchError(err)
+	}
+	defer s.feed.leave(watcher)
+
+	since := req.GetRevision()
+	head, err := s.manager.Revision(ctx)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	// revision greater than head was received from storage which is replaced, e.g. in-memory storage of restarted server
+	if since == 0 || since > head {
+		if err := s.sendSnapshot(req, stream, true); err != nil {
+			return err
+		}
+		since = head
+	}
+
+	if since, err = s.sendChanges(selector, since, stream); err != nil {
+		return err
+	}
+
+	for {
+		records, err := watcher.next(ctx)
+		if err != nil {
+			return watchError(err)
+		}
+
+		for _, record := range records {
+			// queued before stream read its own changes
+			if record.Revision <= since {
+				continue
+			}
+			if err := sendRecord(record, stream); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// watchUpdates sends snapshot and then metrics published to hub, revisions are not sent, so stream is not resumed
+func (s *MetricsService) watchUpdates(
+	req *proto.WatchRequest,
+	selector hub.Selector,
+	stream grpc.ServerStreamingServer[proto.Metric],
+) error {
+	// subscription is made before snapshot is read, so metrics saved while reading are not lost
+	subscription, err := s.hub.Subscribe(selector, watchLimit)
+	if err != nil {
+		return watchError(err)
+	}
+	defer subscription.Close()
+
+	if err := s.sendSnapshot(req, stream, false); err != nil {
+		return err
+	}
+
+	for {
+		updates, err := subscription.Next(stream.Context())
+		if err != nil {
+			return watchError(err)
+		}
+
+		for _, update := range updates {
+			if err := sendRecord(&storage.Record{Metric: update.Metric, Deleted: update.Deleted}, stream); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// sendSnapshot sends metrics with revisions of their last saves if revisions is set.
+// Metrics saved while snapshot is read could be sent again as changes
+func (s *MetricsService) sendSnapshot(
+	req *proto.WatchRequest,
+	stream grpc.ServerStreamingServer[proto.Metric],
+	revisions bool,
+) error {
+	sent := map[string]struct{}{}
+	for _, filter := range watchFilters(req.GetNames(), req.GetPrefixes()) {
+		records, err := s.manager.GetFiltered(stream.Context(), filter)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+
+		for record, err := range records {
+			if err != nil {
+				return status.Error(codes.Internal, err.Error())
+			}
+			// selected by name and by prefix
+			if _, ok := sent[record.Metric.Name()]; ok {
+				continue
+			}
+			sent[record.Metric.Name()] = struct{}{}
+
+			if !revisions {
+				record = &storage.Record{Metric: record.Metric}
+			}
+			if err := sendRecord(record, stream); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// sendChanges sends selected metrics saved after since and returns head revision to continue from
+func (s *MetricsService) sendChanges(
+	selector hub.Selector,
+	since uint64,
+	stream grpc.ServerStreamingServer[proto.Metric],
+) (uint64, error) {
+	records, head, err := s.manager.GetChanges(stream.Context(), since)
+	if err != nil {
+		return 0, status.Error(codes.Internal, err.Error())
+	}
+
+	for record, err := range records {
+		if err != nil {
+			return 0, status.Error(codes.Internal, err.Error())
+		}
+		if !selector(record.Metric.Name()) {
+			continue
+		}
+
+		if err := sendRecord(record, stream); err != nil {
+			return 0, err
+		}
+	}
+
+	return head, nil
+}
+
+func sendRecord(record *storage.Record, stream grpc.ServerStreamingServer[proto.Metric]) error {
+	resp, err := transformer.TransformToGRPCMetric(record.Metric, record.Revision)
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	resp.Deleted = record.Deleted
+
+	return stream.Send(resp)
+}
+
+func watchSelector(names, prefixes []string) hub.Selector {
+	if len(names) == 0 && len(prefixes) == 0 {
+		return hub.MatchAll
+	}
+
+	selected := make(map[string]struct{}, len(names))
+	for _, name := range names {
+		selected[name] = struct{}{}
+	}
+
+	return func(name string) bool {
+		if _, ok := selected[name]; ok {
+			return true
+		}
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// watchFilters reads names by escaped glob, so storages could use index instead of scan
+func watchFilters(names, prefixes []string) []storage.Filter {
+	if len(names) == 0 && len(prefixes) == 0 {
+		return []storage.Filter{{}}
+	}
+
+	filters := make([]storage.Filter, 0, len(names)+len(prefixes))
+	for _, name := range names {
+		filters = append(filters, storage.Filter{Match: globEscaper.Replace(name)})
+	}
+	for _, prefix := range prefixes {
+		filters = append(filters, storage.Filter{Prefix: prefix})
+	}
+
+	return filters
+}
+
+var globEscaper = strings.NewReplacer(`\`, `\\`, `*`, `\*`, `?`, `\?`, `[`, `\[`)
+
+func watchError(err error) error {
+	switch {
+	case errors.Is(err, hub.ErrSlowSubscriber):
+		return status.Error(codes.ResourceExhausted, "client does not keep up with updates")
+	case errors.Is(err, hub.ErrHubClosed):
+		return status.Error(codes.Unavailable, "server is shutting down")
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return status.FromContextError(err).Err()
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
+
 func combineErrors(errs []error) string {
 	var result string
 	for _, e := range errs {
@@ -2,18 +2,40 @@ package rpc
 
 import (
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"iter"
+	"net"
+	"path"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/hub"
+	"github.com/m1khal3v/gometheus/internal/server/manager"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
 	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
 	"github.com/m1khal3v/gometheus/pkg/proto"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	gproto "google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/types/known/wrapperspb"
 )
 
 func TestMetricsService_SaveMetric(t *testing.T) {
 	inMemoryStorage := memory.New()
 
-	metricsService := NewMetricsService(inMemoryStorage)
+	metricsService := NewMetricsService(manager.New(inMemoryStorage), nil)
 
 	request := &proto.SaveMetricRequest{
 		MetricName: "test_metric",
@@ -39,7 +61,7 @@ func TestMetricsService_SaveMetric(t *testing.T) {
 func TestMetricsService_SaveMetrics(t *testing.T) {
 	inMemoryStorage := memory.New()
 
-	metricsService := NewMetricsService(inMemoryStorage)
+	metricsService := NewMetricsService(manager.New(inMemoryStorage), nil)
 
 	request := &proto.SaveMetricsBatchRequest{
 		Metrics: []*proto.SaveMetricRequest{
@@ -84,3 +106,282 @@ func TestMetricsService_SaveMetrics(t *testing.T) {
 	require.Equal(t, "gauge", savedMetric2.Type())
 	require.Equal(t, "100", savedMetric2.StringValue())
 }
+
+func TestMetricsService_DeleteMetric(t *testing.T) {
+	inMemoryStorage := memory.New()
+	require.NoError(t, inMemoryStorage.Save(context.Background(), counter.New("test_metric", 1)))
+
+	metricsService := NewMetricsService(manager.New(inMemoryStorage), nil)
+
+	_, err := metricsService.DeleteMetric(context.Background(), &proto.DeleteMetricRequest{
+		MetricName: "test_metric",
+		MetricType: "gauge",
+	})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	response, err := metricsService.DeleteMetric(context.Background(), &proto.DeleteMetricRequest{
+		MetricName: "test_metric",
+		MetricType: "counter",
+	})
+	require.NoError(t, err)
+	require.Equal(t, "test_metric", response.GetMetricName())
+	require.Equal(t, "counter", response.GetMetricType())
+
+	deletedMetric, err := inMemoryStorage.Get(context.Background(), "test_metric")
+	require.NoError(t, err)
+	require.Nil(t, deletedMetric)
+}
+
+// newWatchClient serves Watch from updates if they are not nil, like server started by app
+func newWatchClient(t *testing.T, storage storage.Storage, updates *hub.Hub, options ...ServerOption) proto.MetricsServiceClient {
+	var managerOptions []manager.Option
+	if updates != nil {
+		managerOptions = append(managerOptions, manager.WithPublisher(updates))
+		options = append(options, WithHub(updates))
+	}
+
+	server, err := NewGRPCServer(manager.New(storage, managerOptions...), options...)
+	require.NoError(t, err)
+	listener := bufconn.Listen(1024 * 1024)
+	go server.server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	connection, err := grpc.NewClient(
+		"passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { connection.Close() })
+
+	return proto.NewMetricsServiceClient(connection)
+}
+
+func receive(t *testing.T, stream grpc.ServerStreamingClient[proto.Metric], count int) []*proto.Metric {
+	metrics := make([]*proto.Metric, 0, count)
+	for range count {
+		metric, err := stream.Recv()
+		require.NoError(t, err)
+		metrics = append(metrics, metric)
+	}
+
+	return metrics
+}
+
+func TestMetricsService_Watch(t *testing.T) {
+	ctx := context.Background()
+	inMemoryStorage := memory.New()
+	require.NoError(t, inMemoryStorage.SaveBatch(ctx, []metric.Metric{
+		gauge.New("cpu1", 1),
+		gauge.New("cpu2", 2),
+		counter.New("poll", 3),
+		gauge.New("mem", 4),
+	}))
+	updates := hub.New()
+	client := newWatchClient(t, inMemoryStorage, updates)
+	start, err := inMemoryStorage.Revision(ctx)
+	require.NoError(t, err)
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	stream, err := client.Watch(watchCtx, &proto.WatchRequest{Names: []string{"poll", "cpu1"}, Prefixes: []string{"cpu"}})
+	require.NoError(t, err)
+	snapshot := receive(t, stream, 3)
+	assert.ElementsMatch(t, []string{"cpu1", "cpu2", "poll"}, []string{
+		snapshot[0].GetMetricName(),
+		snapshot[1].GetMetricName(),
+		snapshot[2].GetMetricName(),
+	})
+	for _, metric := range snapshot {
+		assert.NotZero(t, metric.GetRevision())
+		assert.LessOrEqual(t, metric.GetRevision(), start)
+	}
+
+	_, err = client.SaveMetrics(ctx, &proto.SaveMetricsBatchRequest{Metrics: []*proto.SaveMetricRequest{
+		{MetricName: "mem", MetricType: "gauge", Value: wrapperspb.Double(5)},
+		{MetricName: "cpu2", MetricType: "gauge", Value: wrapperspb.Double(6)},
+		{MetricName: "poll", MetricType: "counter", Delta: wrapperspb.Int64(1)},
+	}})
+	require.NoError(t, err)
+	head, err := inMemoryStorage.Revision(ctx)
+	require.NoError(t, err)
+	changes := receive(t, stream, 2)
+	// changes are sent in order of revisions, which is not order of request
+	if changes[0].GetMetricName() != "cpu2" {
+		changes[0], changes[1] = changes[1], changes[0]
+	}
+	assert.Equal(t, 6.0, changes[0].GetValue().GetValue())
+	assert.Equal(t, int64(4), changes[1].GetDelta().GetValue())
+	for _, change := range changes {
+		assert.Greater(t, change.GetRevision(), start)
+		assert.LessOrEqual(t, change.GetRevision(), head)
+	}
+	cancel()
+
+	// changes made while client was disconnected are sent without snapshot, deleted metrics too
+	_, err = client.SaveMetric(ctx, &proto.SaveMetricRequest{MetricName: "cpu1", MetricType: "gauge", Value: wrapperspb.Double(7)})
+	require.NoError(t, err)
+	record, err := inMemoryStorage.GetRecord(ctx, "cpu1")
+	require.NoError(t, err)
+	require.NoError(t, inMemoryStorage.Delete(ctx, "cpu2"))
+	resumeCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err = client.Watch(resumeCtx, &proto.WatchRequest{Prefixes: []string{"cpu"}, Revision: head})
+	require.NoError(t, err)
+	resumed := receive(t, stream, 2)
+	assert.True(t, gproto.Equal(&proto.Metric{MetricName: "cpu1", MetricType: "gauge", Value: wrapperspb.Double(7), Revision: record.Revision}, resumed[0]))
+	assert.True(t, gproto.Equal(&proto.Metric{MetricName: "cpu2", MetricType: "gauge", Value: wrapperspb.Double(6), Revision: record.Revision + 1, Deleted: true}, resumed[1]))
+
+	// revision exceeding head of storage falls back to snapshot
+	record, err = inMemoryStorage.GetRecord(ctx, "mem")
+	require.NoError(t, err)
+	unknownCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err = client.Watch(unknownCtx, &proto.WatchRequest{Names: []string{"mem", "missing"}, Revision: record.Revision + 100})
+	require.NoError(t, err)
+	snapshot = receive(t, stream, 1)
+	assert.True(t, gproto.Equal(&proto.Metric{MetricName: "mem", MetricType: "gauge", Value: wrapperspb.Double(5), Revision: record.Revision}, snapshot[0]))
+
+	// streams are finished before server shutdown
+	updates.Close()
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unavailable, status.Code(err))
+}
+
+// sharedStorage is storage changed by another server, which is reported to subscribers
+type sharedStorage struct {
+	*memory.Storage
+	handlers chan func(change storage.Change)
+}
+
+func (storage *sharedStorage) Subscribe(handler func(change storage.Change)) func() {
+	storage.handlers <- handler
+	return func() {}
+}
+
+func TestMetricsService_WatchSharedStorage(t *testing.T) {
+	ctx := context.Background()
+	shared := &sharedStorage{Storage: memory.New(), handlers: make(chan func(change storage.Change), 1)}
+	client := newWatchClient(t, shared, hub.New())
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Watch(watchCtx, &proto.WatchRequest{Names: []string{"m1"}})
+	require.NoError(t, err)
+	handler := <-shared.handlers
+
+	// metric saved by another server is not published to hub of this server
+	require.NoError(t, shared.Save(ctx, gauge.New("m1", 1)))
+	handler(storage.Change{Kind: storage.ChangeSave, Name: "m1"})
+	changes := receive(t, stream, 1)
+	assert.Equal(t, "m1", changes[0].GetMetricName())
+	assert.Equal(t, 1.0, changes[0].GetValue().GetValue())
+}
+
+func TestMetricsService_WatchWithoutHub(t *testing.T) {
+	client := newWatchClient(t, memory.New(), nil)
+	stream, err := client.Watch(context.Background(), &proto.WatchRequest{})
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unimplemented, status.Code(err))
+}
+
+// storageWithoutFeed hides change feed of decorated storage
+type storageWithoutFeed struct {
+	storage.Storage
+}
+
+func TestMetricsService_WatchWithoutChangeFeed(t *testing.T) {
+	ctx := context.Background()
+	withoutFeed := storageWithoutFeed{memory.New()}
+	require.NoError(t, withoutFeed.Save(ctx, gauge.New("m1", 1)))
+	client := newWatchClient(t, withoutFeed, hub.New())
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	// revision is ignored, snapshot is sent anyway
+	stream, err := client.Watch(watchCtx, &proto.WatchRequest{Names: []string{"m1"}, Revision: 1})
+	require.NoError(t, err)
+	snapshot := receive(t, stream, 1)
+	assert.True(t, gproto.Equal(&proto.Metric{MetricName: "m1", MetricType: "gauge", Value: wrapperspb.Double(1)}, snapshot[0]))
+
+	// metrics published to hub are sent without revisions
+	_, err = client.SaveMetric(ctx, &proto.SaveMetricRequest{MetricName: "m1", MetricType: "gauge", Value: wrapperspb.Double(2)})
+	require.NoError(t, err)
+	updates := receive(t, stream, 1)
+	assert.True(t, gproto.Equal(&proto.Metric{MetricName: "m1", MetricType: "gauge", Value: wrapperspb.Double(2)}, updates[0]))
+}
+
+// countingStorage counts reads of change feed
+type countingStorage struct {
+	*memory.Storage
+	changes atomic.Int64
+}
+
+func (storage *countingStorage) GetChanges(ctx context.Context, since uint64) (iter.Seq2[*storage.Record, error], uint64, error) {
+	storage.changes.Add(1)
+
+	return storage.Storage.GetChanges(ctx, since)
+}
+
+func TestMetricsService_WatchSharedReads(t *testing.T) {
+	ctx := context.Background()
+	counting := &countingStorage{Storage: memory.New()}
+	require.NoError(t, counting.Save(ctx, gauge.New("m1", 1)))
+	client := newWatchClient(t, counting, hub.New())
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	streams := make([]grpc.ServerStreamingClient[proto.Metric], 0, 5)
+	for range 5 {
+		stream, err := client.Watch(watchCtx, &proto.WatchRequest{Names: []string{"m1"}})
+		require.NoError(t, err)
+		receive(t, stream, 1)
+		streams = append(streams, stream)
+	}
+	// every stream reads changes made before it joined
+	assert.Equal(t, int64(5), counting.changes.Load())
+
+	_, err := client.SaveMetric(ctx, &proto.SaveMetricRequest{MetricName: "m1", MetricType: "gauge", Value: wrapperspb.Double(2)})
+	require.NoError(t, err)
+	for _, stream := range streams {
+		changes := receive(t, stream, 1)
+		assert.Equal(t, 2.0, changes[0].GetValue().GetValue())
+	}
+	// changes are read once for all streams
+	assert.Equal(t, int64(6), counting.changes.Load())
+}
+
+func TestMetricsService_WatchSignature(t *testing.T) {
+	client := newWatchClient(t, memory.New(), hub.New(), WithHMAC("secret", "HashSHA256", sha256.New))
+	request := &proto.WatchRequest{Names: []string{"test"}}
+
+	stream, err := client.Watch(context.Background(), request)
+	require.NoError(t, err)
+	_, err = stream.Recv()
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	raw, err := gproto.Marshal(request)
+	require.NoError(t, err)
+	hasher := hmac.New(sha256.New, []byte("secret"))
+	hasher.Write(raw)
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	ctx = metadata.AppendToOutgoingContext(ctx, "HashSHA256", hex.EncodeToString(hasher.Sum(nil)))
+
+	stream, err = client.Watch(ctx, request)
+	require.NoError(t, err)
+	// signature is accepted, stream waits for changes of missing metric
+	_, err = stream.Recv()
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(err))
+}
+
+func Test_watchFilters(t *testing.T) {
+	assert.Equal(t, []storage.Filter{{}}, watchFilters(nil, nil))
+	assert.Equal(t, []storage.Filter{{Match: `a\*\?\[b\\`}, {Prefix: "c"}}, watchFilters([]string{`a*?[b\`}, []string{"c"}))
+
+	matched, err := path.Match(watchFilters([]string{`a*?[b\`}, nil)[0].Match, `a*?[b\`)
+	require.NoError(t, err)
+	assert.True(t, matched)
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+)
+
+// ErrChangesNotSupported is returned by change feed helpers if storage does not implement ChangeFeed
+var ErrChangesNotSupported = errors.New("storage does not support change feed")
+
+// ChangeFeed is implemented by storages which assign revision to every saved metric.
+// Revisions grow monotonically and are not reused, even after Reset.
+// Delete takes revision too and is reported by feed as deleted record (tombstone),
+// so state built from feed is the same as state of storage
+type ChangeFeed interface {
+	// Revision returns head revision, the greatest revision assigned by storage
+	Revision(ctx context.Context) (uint64, error)
+	// GetChanges returns records saved or deleted after since and up to head revision in order of revisions,
+	// and head revision. Every change made up to head is visible, so feed is continued by request of changes since head
+	GetChanges(ctx context.Context, since uint64) (iter.Seq2[*Record, error], uint64, error)
+	// AdvanceRevision raises head revision to revision if it is lower, e.g. after state was restored from file
+	AdvanceRevision(ctx context.Context, revision uint64) error
+}
+
+// HasChangeFeed reports whether base storage of decorators chain assigns revisions.
+// Decorators pass change feed through, so they implement ChangeFeed even if base storage does not
+func HasChangeFeed(storage Storage) bool {
+	for {
+		wrapper, ok := storage.(Wrapper)
+		if !ok {
+			_, ok := storage.(ChangeFeed)
+			return ok
+		}
+		storage = wrapper.Unwrap()
+	}
+}
+
+// GetChanges returns changes of storage since revision and head revision
+func GetChanges(ctx context.Context, storage Storage, since uint64) (iter.Seq2[*Record, error], uint64, error) {
+	feed, ok := storage.(ChangeFeed)
+	if !ok {
+		return nil, 0, ErrChangesNotSupported
+	}
+
+	return feed.GetChanges(ctx, since)
+}
+
+// Revision returns head revision of storage
+func Revision(ctx context.Context, storage Storage) (uint64, error) {
+	feed, ok := storage.(ChangeFeed)
+	if !ok {
+		return 0, ErrChangesNotSupported
+	}
+
+	return feed.Revision(ctx)
+}
+
+// AdvanceRevision raises head revision of storage
+func AdvanceRevision(ctx context.Context, storage Storage, revision uint64) error {
+	feed, ok := storage.(ChangeFeed)
+	if !ok {
+		return ErrChangesNotSupported
+	}
+
+	return feed.AdvanceRevision(ctx, revision)
+}
+
+// RevisionWriter is implemented by change feed storages which return records of written metrics,
+// so decorators could cache written metrics with revisions assigned by storage
+type RevisionWriter interface {
+	// WriteRecords is SaveRecords returning saved records with revisions
+	WriteRecords(ctx context.Context, records []*Record) ([]*Record, error)
+	// WriteBatchIncrementing is SaveBatchIncrementing returning saved records with revisions, counters with new values
+	WriteBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]*Record, error)
+}
+
+// WriteRecords uses storage.WriteRecords if storage is a RevisionWriter.
+// Otherwise records are saved by SaveRecords and returned without revisions
+func WriteRecords(ctx context.Context, storage Storage, records []*Record) ([]*Record, error) {
+	if writer, ok := storage.(RevisionWriter); ok {
+		return writer.WriteRecords(ctx, records)
+	}
+
+	if err := SaveRecords(ctx, storage, records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// WriteBatchIncrementing uses storage.WriteBatchIncrementing if storage is a RevisionWriter.
+// Otherwise batch is saved by SaveBatchIncrementing and returned without revisions, caller must lock counters of batch
+func WriteBatchIncrementing(ctx context.Context, storage Storage, metrics []metric.Metric) ([]*Record, error) {
+	if writer, ok := storage.(RevisionWriter); ok {
+		return writer.WriteBatchIncrementing(ctx, metrics)
+	}
+
+	updatedAt := time.Now()
+	saved, err := SaveBatchIncrementing(ctx, storage, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return RecordsOf(saved, updatedAt), nil
+}
@@ -7,9 +7,15 @@ import (
 	"fmt"
 
 	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/bolt"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/buffer"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/cache"
 	"github.com/m1khal3v/gometheus/internal/server/storage/kind/dump"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/fault"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/instrument"
 	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
 	"github.com/m1khal3v/gometheus/internal/server/storage/kind/pgsql"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/sqlite"
 )
 
 type UnknownDriverError struct {
@@ -26,20 +32,110 @@ func newErrUnknownDriver(driver string) error {
 	}
 }
 
-func New(ctx context.Context, fileStoragePath, databaseDriver, databaseDSN string, storeInterval uint32, restore bool) (storage.Storage, error) {
+type Option func(options *options)
+
+type options struct {
+	dumpOptions   []dump.Option
+	bufferOptions []buffer.Option
+	buffered      bool
+	cacheOptions  []cache.Option
+	cached        bool
+	pgsqlOptions  []pgsql.Option
+	faultRules    []fault.Rule
+	collector     *instrument.Collector
+}
+
+// WithDumpOptions passes options to dump storage decorator
+func WithDumpOptions(dumpOptions ...dump.Option) Option {
+	return func(options *options) {
+		options.dumpOptions = append(options.dumpOptions, dumpOptions...)
+	}
+}
+
+// WithBuffer enables write-behind buffer in front of database storage
+func WithBuffer(bufferOptions ...buffer.Option) Option {
+	return func(options *options) {
+		options.buffered = true
+		options.bufferOptions = append(options.bufferOptions, bufferOptions...)
+	}
+}
+
+// WithCache enables read-through cache in front of database storage
+func WithCache(cacheOptions ...cache.Option) Option {
+	return func(options *options) {
+		options.cached = true
+		options.cacheOptions = append(options.cacheOptions, cacheOptions...)
+	}
+}
+
+// WithPgsqlOptions passes options to postgres storage
+func WithPgsqlOptions(pgsqlOptions ...pgsql.Option) Option {
+	return func(options *options) {
+		options.pgsqlOptions = append(options.pgsqlOptions, pgsqlOptions...)
+	}
+}
+
+// WithFaults injects faults into base storage (memory or database), so decorators in front of it are tested as well
+func WithFaults(rules ...fault.Rule) Option {
+	return func(options *options) {
+		options.faultRules = append(options.faultRules, rules...)
+	}
+}
+
+// WithInstrumentation records stats of base storage operations labeled by driver ("memory" without database)
+func WithInstrumentation(collector *instrument.Collector) Option {
+	return func(options *options) {
+		options.collector = collector
+	}
+}
+
+func New(ctx context.Context, fileStoragePath, databaseDriver, databaseDSN string, storeInterval uint32, restore bool, optionList ...Option) (storage.Storage, error) {
+	options := &options{}
+	for _, option := range optionList {
+		option(options)
+	}
+
 	var storage storage.Storage = memory.New()
+	database := databaseDSN != "" && databaseDriver != ""
 
-	if databaseDSN != "" && databaseDriver != "" {
+	if database {
 		var err error
-		storage, err = newDBStorage(databaseDriver, databaseDSN)
+		storage, err = newDBStorage(databaseDriver, databaseDSN, options)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	if len(options.faultRules) > 0 {
+		storage = fault.New(storage, options.faultRules...)
+	}
+
+	// injected faults are recorded as well
+	if options.collector != nil {
+		driver := "memory"
+		if database {
+			driver = databaseDriver
+		}
+		storage = instrument.New(storage, options.collector, driver)
+	}
+
+	if database {
+		if options.buffered {
+			storage = buffer.New(ctx, storage, options.bufferOptions...)
+		}
+
+		if options.cached {
+			cached := cache.New(storage, options.cacheOptions...)
+			if options.collector != nil {
+				options.collector.Register(cacheSamples(cached.(cacheStats)))
+			}
+			storage = cached
+		}
+	}
+
 	if fileStoragePath != "" {
 		var err error
-		storage, err = dump.New(ctx, storage, fileStoragePath, storeInterval, restore)
+		storage, err = dump.New(ctx, storage, fileStoragePath, storeInterval, restore, options.dumpOptions...)
 		if err != nil {
 			return nil, err
 		}
@@ -48,10 +144,33 @@ func New(ctx context.Context, fileStoragePath, databaseDriver, databaseDSN strin
 	return storage, nil
 }
 
-func newDBStorage(databaseDriver, databaseDSN string) (storage.Storage, error) {
+// cacheStats is implemented by cache decorators, both cache.Storage and cache.IncrementingStorage
+type cacheStats interface {
+	Stats() cache.Stats
+}
+
+// cacheSamples exposes cache stats with storage stats
+func cacheSamples(cached cacheStats) func() []instrument.Sample {
+	return func() []instrument.Sample {
+		stats := cached.Stats()
+
+		return []instrument.Sample{
+			{Name: "gometheus_cache_hits_total", Help: "Count of metrics read from cache", Type: "counter", Value: stats.Hits},
+			{Name: "gometheus_cache_misses_total", Help: "Count of metrics read from decorated storage", Type: "counter", Value: stats.Misses},
+			{Name: "gometheus_cache_evictions_total", Help: "Count of metrics evicted from full cache", Type: "counter", Value: stats.Evictions},
+			{Name: "gometheus_cache_size", Help: "Count of cached metrics", Type: "gauge", Value: uint64(stats.Size)},
+		}
+	}
+}
+
+func newDBStorage(databaseDriver, databaseDSN string, options *options) (storage.Storage, error) {
 	switch databaseDriver {
 	case "pgx":
-		return pgsql.New(databaseDSN), nil
+		return pgsql.New(databaseDSN, options.pgsqlOptions...), nil
+	case "sqlite":
+		return sqlite.New(databaseDSN), nil
+	case "bolt":
+		return bolt.New(databaseDSN), nil
 	default:
 		return nil, newErrUnknownDriver(databaseDriver)
 	}
@@ -1,12 +1,20 @@
 package factory
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"path/filepath"
 	"testing"
 
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/bolt"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/buffer"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/cache"
 	"github.com/m1khal3v/gometheus/internal/server/storage/kind/dump"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/fault"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/instrument"
 	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/sqlite"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -21,14 +29,122 @@ func TestNewMemoryStorage(t *testing.T) {
 
 func TestNewDumpStorage(t *testing.T) {
 	ctx := context.Background()
-	fileStoragePath := "/tmp/test.db"
+	fileStoragePath := filepath.Join(t.TempDir(), "test.db")
 	storeInterval := uint32(60)
 	restore := true
 
 	storage, err := New(ctx, fileStoragePath, "", "", storeInterval, restore)
 
 	assert.NoError(t, err)
-	assert.IsType(t, &dump.Storage{}, storage)
+	assert.IsType(t, &dump.IncrementingStorage{}, storage)
+	assert.NoError(t, storage.Close(ctx))
+}
+
+func TestNewDumpStorageWithOptions(t *testing.T) {
+	ctx := context.Background()
+	fileStoragePath := filepath.Join(t.TempDir(), "test.db")
+
+	storage, err := New(ctx, fileStoragePath, "", "", 60, true, WithDumpOptions(
+		dump.WithEncoding(dump.EncodingProtobuf),
+		dump.WithCompression(dump.CompressionZstd),
+	))
+
+	assert.NoError(t, err)
+	assert.IsType(t, &dump.IncrementingStorage{}, storage)
+	assert.NoError(t, storage.Close(ctx))
+}
+
+func TestNewSQLiteStorage(t *testing.T) {
+	ctx := context.Background()
+	databaseDSN := filepath.Join(t.TempDir(), "metrics.db")
+
+	storage, err := New(ctx, "", "sqlite", databaseDSN, 0, false)
+
+	assert.NoError(t, err)
+	assert.IsType(t, &sqlite.Storage{}, storage)
+	assert.NoError(t, storage.Close(ctx))
+}
+
+func TestNewBoltStorage(t *testing.T) {
+	ctx := context.Background()
+	databaseDSN := filepath.Join(t.TempDir(), "metrics.bolt")
+
+	storage, err := New(ctx, "", "bolt", databaseDSN, 0, false)
+
+	assert.NoError(t, err)
+	assert.IsType(t, &bolt.Storage{}, storage)
+	assert.NoError(t, storage.Close(ctx))
+}
+
+func TestNewBufferedStorage(t *testing.T) {
+	ctx := context.Background()
+	databaseDSN := filepath.Join(t.TempDir(), "metrics.db")
+
+	storage, err := New(ctx, "", "sqlite", databaseDSN, 0, false, WithBuffer(buffer.WithSize(10)))
+
+	assert.NoError(t, err)
+	assert.IsType(t, &buffer.Storage{}, storage)
+	assert.NoError(t, storage.Close(ctx))
+}
+
+func TestNewCachedStorage(t *testing.T) {
+	ctx := context.Background()
+	databaseDSN := filepath.Join(t.TempDir(), "metrics.db")
+
+	storage, err := New(ctx, "", "sqlite", databaseDSN, 0, false, WithCache(cache.WithSize(10)))
+
+	assert.NoError(t, err)
+	assert.IsType(t, &cache.Storage{}, storage)
+	assert.NoError(t, storage.Close(ctx))
+}
+
+func TestNewFaultyStorage(t *testing.T) {
+	ctx := context.Background()
+	databaseDSN := filepath.Join(t.TempDir(), "metrics.db")
+
+	storage, err := New(ctx, "", "sqlite", databaseDSN, 0, false,
+		WithCache(),
+		WithFaults(fault.Rule{Operation: fault.PingOperation, Fault: fault.Permanent}),
+	)
+
+	assert.NoError(t, err)
+	assert.IsType(t, &cache.Storage{}, storage)
+	assert.IsType(t, &fault.Storage{}, storage.(*cache.Storage).Unwrap())
+	assert.ErrorIs(t, storage.Ping(ctx), fault.ErrInjected)
+	assert.NoError(t, storage.Close(ctx))
+}
+
+func TestNewInstrumentedStorage(t *testing.T) {
+	ctx := context.Background()
+	collector := instrument.NewCollector()
+
+	storage, err := New(ctx, "", "", "", 0, false, WithInstrumentation(collector))
+
+	assert.NoError(t, err)
+	assert.IsType(t, &instrument.IncrementingStorage{}, storage)
+	assert.NoError(t, storage.Ping(ctx))
+
+	buffer := &bytes.Buffer{}
+	assert.NoError(t, collector.WritePrometheus(buffer))
+	assert.Contains(t, buffer.String(), `gometheus_storage_operations_total{driver="memory",operation="ping"} 1`)
+}
+
+func TestNewInstrumentedCachedStorage(t *testing.T) {
+	ctx := context.Background()
+	databaseDSN := filepath.Join(t.TempDir(), "metrics.db")
+	collector := instrument.NewCollector()
+
+	storage, err := New(ctx, "", "sqlite", databaseDSN, 0, false, WithCache(), WithInstrumentation(collector))
+
+	assert.NoError(t, err)
+	_, err = storage.Get(ctx, "missing")
+	assert.NoError(t, err)
+
+	buffer := &bytes.Buffer{}
+	assert.NoError(t, collector.WritePrometheus(buffer))
+	assert.Contains(t, buffer.String(), "gometheus_cache_misses_total 1\n")
+	assert.Contains(t, buffer.String(), "gometheus_cache_hits_total 0\n")
+	assert.NoError(t, storage.Close(ctx))
 }
 
 func TestNewUnknownDriver(t *testing.T) {
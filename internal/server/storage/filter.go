@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"cmp"
+	"context"
+	"iter"
+	"path"
+	"slices"
+	"strings"
+)
+
+// Filter selects metrics returned by GetFiltered. Zero value selects all metrics
+type Filter struct {
+	Type       string // Type of metrics, empty means any type
+	Prefix     string // Prefix of metric names
+	Match      string // Match is glob pattern of metric names, syntax of path.Match
+	After      string // After is cursor, only names following it in sort order are selected
+	Descending bool   // Descending sorts names in reverse order
+	Limit      int    // Limit of selected metrics, 0 means unlimited
+}
+
+// Validate returns path.ErrBadPattern if Match is malformed
+func (filter Filter) Validate() error {
+	if filter.Match == "" {
+		return nil
+	}
+
+	_, err := path.Match(filter.Match, "")
+
+	return err
+}
+
+// Matches reports whether record satisfies filter predicates. Cursor and limit are not checked
+func (filter Filter) Matches(record *Record) bool {
+	if filter.Type != "" && record.Metric.Type() != filter.Type {
+		return false
+	}
+	if !strings.HasPrefix(record.Metric.Name(), filter.Prefix) {
+		return false
+	}
+	if filter.Match != "" {
+		matched, err := path.Match(filter.Match, record.Metric.Name())
+		if err != nil || !matched {
+			return false
+		}
+	}
+
+	return true
+}
+
+// follows reports whether name is after the cursor in sort order
+func (filter Filter) follows(name string) bool {
+	if filter.After == "" {
+		return true
+	}
+	if filter.Descending {
+		return name < filter.After
+	}
+
+	return name > filter.After
+}
+
+// Filterer is implemented by storages which select metrics by filter themselves, e.g. in SQL query
+type Filterer interface {
+	// GetFiltered returns records selected by filter sorted by name bytewise
+	GetFiltered(ctx context.Context, filter Filter) (iter.Seq2[*Record, error], error)
+}
+
+// GetFiltered returns records of storage selected by filter sorted by name bytewise.
+// If storage is not a Filterer, all records are read and filtered in memory
+func GetFiltered(ctx context.Context, storage Storage, filter Filter) (iter.Seq2[*Record, error], error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	if filterer, ok := storage.(Filterer); ok {
+		return filterer.GetFiltered(ctx, filter)
+	}
+
+	records, err := storage.GetAllRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]*Record, 0)
+	for record, err := range records {
+		if err != nil {
+			return nil, err
+		}
+		if filter.Matches(record) && filter.follows(record.Metric.Name()) {
+			selected = append(selected, record)
+		}
+	}
+
+	slices.SortFunc(selected, func(a, b *Record) int {
+		if filter.Descending {
+			return cmp.Compare(b.Metric.Name(), a.Metric.Name())
+		}
+
+		return cmp.Compare(a.Metric.Name(), b.Metric.Name())
+	})
+	if filter.Limit > 0 && len(selected) > filter.Limit {
+		selected = selected[:filter.Limit]
+	}
+
+	return func(yield func(*Record, error) bool) {
+		for _, record := range selected {
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}, nil
+}
@@ -0,0 +1,367 @@
+// Package bolt
+// contains embedded key-value (bbolt) storage implementation
+package bolt
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"iter"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/factory"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/pkg/generator"
+	"github.com/m1khal3v/gometheus/pkg/retry"
+	"go.etcd.io/bbolt"
+	boltErrors "go.etcd.io/bbolt/errors"
+)
+
+// cursorPageSize is count of metrics read by GetAll in one read transaction
+const cursorPageSize = 256
+
+var metricBucket = []byte("metric")
+
+type Storage struct {
+	db     *bbolt.DB
+	mutex  *sync.Mutex
+	closed *atomic.Bool
+}
+
+type record struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+	// UpdatedAt is unix time in nanoseconds, records written by older versions have no update time
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+}
+
+func New(filepath string) *Storage {
+	var db *bbolt.DB
+	err := retry.Retry(retry.RetryOptions{
+		BaseDelay:  time.Second,
+		MaxDelay:   5 * time.Second,
+		Attempts:   4,
+		Multiplier: 2,
+	}, func() error {
+		var err error
+		// file is locked by another process while timeout is not exceeded
+		db, err = bbolt.Open(filepath, 0666, &bbolt.Options{Timeout: time.Second})
+		return err
+	}, isRetryableError)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(metricBucket)
+		return err
+	}); err != nil {
+		panic(err)
+	}
+
+	return &Storage{
+		db:     db,
+		mutex:  &sync.Mutex{},
+		closed: &atomic.Bool{},
+	}
+}
+
+func (storage *Storage) Get(ctx context.Context, name string) (metric.Metric, error) {
+	record, err := storage.GetRecord(ctx, name)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	return record.Metric, nil
+}
+
+func (storage *Storage) GetRecord(ctx context.Context, name string) (*store.Record, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return nil, err
+	}
+
+	var record *store.Record
+	err := storage.db.View(func(tx *bbolt.Tx) error {
+		value := tx.Bucket(metricBucket).Get([]byte(name))
+		if value == nil {
+			return nil
+		}
+
+		var err error
+		record, err = decode([]byte(name), value)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return record, nil
+}
+
+func (storage *Storage) GetAll(ctx context.Context) (iter.Seq2[metric.Metric, error], error) {
+	records, err := storage.GetAllRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.MetricsOf(records), nil
+}
+
+// GetAllRecords iterates over metrics by pages. Each page is read in separate short transaction,
+// so slow consumer does not block writers
+func (storage *Storage) GetAllRecords(ctx context.Context) (iter.Seq2[*store.Record, error], error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return nil, err
+	}
+
+	var page []*store.Record
+	var lastKey []byte
+	exhausted := false
+
+	return generator.NewSeq2FromFunctionWithContext(ctx, func() (*store.Record, bool, error) {
+		if len(page) == 0 {
+			if exhausted {
+				return nil, false, nil
+			}
+
+			var err error
+			page, lastKey, err = storage.readPage(lastKey)
+			if err != nil {
+				return nil, false, err
+			}
+
+			exhausted = len(page) < cursorPageSize
+			if len(page) == 0 {
+				return nil, false, nil
+			}
+		}
+
+		record := page[0]
+		page = page[1:]
+
+		return record, true, nil
+	}, nil), nil
+}
+
+func (storage *Storage) Save(ctx context.Context, metric metric.Metric) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	value, err := encode(metric, time.Now())
+	if err != nil {
+		return err
+	}
+
+	// Batch coalesces concurrent single saves into one transaction
+	return storage.db.Batch(func(tx *bbolt.Tx) error {
+		return tx.Bucket(metricBucket).Put([]byte(metric.Name()), value)
+	})
+}
+
+func (storage *Storage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+	return storage.SaveRecords(ctx, store.RecordsOf(metrics, time.Now()))
+}
+
+// SaveRecords saves records in one transaction
+func (storage *Storage) SaveRecords(ctx context.Context, records []*store.Record) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	return storage.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(metricBucket)
+
+		for _, record := range records {
+			value, err := encode(record.Metric, record.UpdatedAt)
+			if err != nil {
+				return err
+			}
+
+			if err := bucket.Put([]byte(record.Metric.Name()), value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (storage *Storage) Delete(ctx context.Context, name string) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	return storage.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(metricBucket).Delete([]byte(name))
+	})
+}
+
+// DeleteStale reads and deletes metric in one write transaction
+func (storage *Storage) DeleteStale(ctx context.Context, name string, cutoff time.Time) (bool, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return false, err
+	}
+
+	deleted := false
+	err := storage.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(metricBucket)
+		value := bucket.Get([]byte(name))
+		if value == nil {
+			return nil
+		}
+
+		record, err := decode([]byte(name), value)
+		if err != nil || record.UpdatedAt.After(cutoff) {
+			return err
+		}
+
+		deleted = true
+		return bucket.Delete([]byte(name))
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+// DeleteByPrefix seeks to prefix, because keys are sorted
+func (storage *Storage) DeleteByPrefix(ctx context.Context, prefix string) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	return storage.db.Update(func(tx *bbolt.Tx) error {
+		bucket := tx.Bucket(metricBucket)
+		cursor := bucket.Cursor()
+
+		// keys are collected first, cursor could skip keys if bucket is modified during iteration
+		var keys [][]byte
+		for key, _ := cursor.Seek([]byte(prefix)); key != nil && bytes.HasPrefix(key, []byte(prefix)); key, _ = cursor.Next() {
+			keys = append(keys, bytes.Clone(key))
+		}
+
+		for _, key := range keys {
+			if err := bucket.Delete(key); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (storage *Storage) Ping(ctx context.Context) error {
+	return storage.checkStorageClosed()
+}
+
+// Close waits for running transactions and closes database file.
+// All committed transactions are already synced to disk
+func (storage *Storage) Close(ctx context.Context) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if storage.closed.Load() {
+		return store.ErrStorageClosed
+	}
+
+	if err := storage.db.Close(); err != nil {
+		return err
+	}
+
+	storage.closed.Store(true)
+	return nil
+}
+
+func (storage *Storage) Reset(ctx context.Context) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	return storage.db.Update(func(tx *bbolt.Tx) error {
+		if err := tx.DeleteBucket(metricBucket); err != nil {
+			return err
+		}
+
+		_, err := tx.CreateBucket(metricBucket)
+		return err
+	})
+}
+
+func (storage *Storage) readPage(after []byte) ([]*store.Record, []byte, error) {
+	page := make([]*store.Record, 0, cursorPageSize)
+	var lastKey []byte
+
+	err := storage.db.View(func(tx *bbolt.Tx) error {
+		cursor := tx.Bucket(metricBucket).Cursor()
+
+		var key, value []byte
+		if after == nil {
+			key, value = cursor.First()
+		} else {
+			key, value = cursor.Seek(after)
+			if bytes.Equal(key, after) {
+				key, value = cursor.Next()
+			}
+		}
+
+		for ; key != nil && len(page) < cursorPageSize; key, value = cursor.Next() {
+			record, err := decode(key, value)
+			if err != nil {
+				return err
+			}
+
+			page = append(page, record)
+			// key is valid only during transaction
+			lastKey = bytes.Clone(key)
+		}
+
+		return nil
+	})
+
+	return page, lastKey, err
+}
+
+func (storage *Storage) checkStorageClosed() error {
+	if storage.closed.Load() {
+		return store.ErrStorageClosed
+	}
+
+	return nil
+}
+
+func encode(metric metric.Metric, updatedAt time.Time) ([]byte, error) {
+	return json.Marshal(record{
+		Type:      metric.Type(),
+		Value:     metric.StringValue(),
+		UpdatedAt: updatedAt.UnixNano(),
+	})
+}
+
+func decode(key, value []byte) (*store.Record, error) {
+	record := &record{}
+	if err := json.Unmarshal(value, record); err != nil {
+		return nil, err
+	}
+
+	metric, err := factory.New(record.Type, string(key), record.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	var updatedAt time.Time
+	if record.UpdatedAt != 0 {
+		updatedAt = time.Unix(0, record.UpdatedAt)
+	}
+
+	return &store.Record{Metric: metric, UpdatedAt: updatedAt}, nil
+}
+
+func isRetryableError(err error) bool {
+	return errors.Is(err, store.ErrTransient) || errors.Is(err, boltErrors.ErrTimeout)
+}
@@ -0,0 +1,114 @@
+package bolt
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/storagetest"
+	"github.com/m1khal3v/gometheus/pkg/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) store.Storage {
+		return createStorage(t)
+	})
+}
+
+func TestStorage_GetAllPages(t *testing.T) {
+	ctx := context.Background()
+	storage := createStorage(t)
+
+	metrics := make([]metric.Metric, 0, cursorPageSize*2+1)
+	for i := 0; i < cap(metrics); i++ {
+		metrics = append(metrics, counter.New(fmt.Sprintf("m%04d", i), int64(i)))
+	}
+	require.NoError(t, storage.SaveBatch(ctx, metrics))
+
+	seq, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	// keys are sorted, so the order is preserved
+	assert.Equal(t, metrics, all)
+}
+
+func TestStorage_GetAllCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	storage := createStorage(t)
+
+	metrics := make([]metric.Metric, 0, cursorPageSize*2)
+	for i := 0; i < cap(metrics); i++ {
+		metrics = append(metrics, gauge.New(fmt.Sprintf("m%04d", i), float64(i)))
+	}
+	require.NoError(t, storage.SaveBatch(ctx, metrics))
+
+	seq, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	read := 0
+	for _, err = range seq {
+		if err != nil {
+			break
+		}
+		read++
+		cancel()
+	}
+	assert.ErrorIs(t, err, context.Canceled)
+	// write transaction must not be blocked by abandoned read
+	require.NoError(t, storage.Save(context.Background(), gauge.New("m1", 1)))
+	assert.Less(t, read, len(metrics))
+}
+
+func TestStorage_Persistence(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "metrics.bolt")
+
+	storage := New(path)
+	require.NoError(t, storage.SaveBatch(ctx, []metric.Metric{
+		counter.New("m1", 123),
+		gauge.New("m2", 123.321),
+	}))
+	require.NoError(t, storage.Close(ctx))
+
+	storage = New(path)
+	t.Cleanup(func() {
+		storage.Close(ctx)
+	})
+	seq, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []metric.Metric{
+		counter.New("m1", 123),
+		gauge.New("m2", 123.321),
+	}, all)
+}
+
+func TestStorage_Close(t *testing.T) {
+	ctx := context.Background()
+	storage := New(filepath.Join(t.TempDir(), "metrics.bolt"))
+	require.NoError(t, storage.Close(ctx))
+	assert.ErrorIs(t, storage.Close(ctx), store.ErrStorageClosed)
+	assert.ErrorIs(t, storage.Save(ctx, counter.New("m1", 1)), store.ErrStorageClosed)
+	assert.ErrorIs(t, storage.Ping(ctx), store.ErrStorageClosed)
+	_, err := storage.Get(ctx, "m1")
+	assert.ErrorIs(t, err, store.ErrStorageClosed)
+}
+
+func createStorage(t *testing.T) *Storage {
+	t.Helper()
+	storage := New(filepath.Join(t.TempDir(), "metrics.bolt"))
+	t.Cleanup(func() {
+		storage.Close(context.Background())
+	})
+
+	return storage
+}
@@ -0,0 +1,342 @@
+// Package buffer
+// contains write-behind storage decorator.
+// Saves are coalesced per metric in memory and written to decorated storage
+// with one batch save when buffer is full or flush interval is passed
+package buffer
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/logger"
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSize          = 1000
+	defaultFlushInterval = time.Second
+)
+
+type Storage struct {
+	storage       store.Storage
+	size          int
+	flushInterval time.Duration
+	// pending contains metrics saved after last flush start with time they were buffered
+	pending map[string]*store.Record
+	// flushing contains metrics written by running flush, they are visible for reads until flush is done
+	flushing   map[string]*store.Record
+	mutex      *sync.RWMutex
+	flushMutex *sync.Mutex
+	flush      chan struct{}
+	done       chan struct{}
+	closed     bool
+}
+
+type Option func(storage *Storage)
+
+// WithSize sets count of buffered metrics which triggers flush
+func WithSize(size int) Option {
+	return func(storage *Storage) {
+		storage.size = size
+	}
+}
+
+// WithFlushInterval sets max time metric is kept in buffer
+func WithFlushInterval(interval time.Duration) Option {
+	return func(storage *Storage) {
+		storage.flushInterval = interval
+	}
+}
+
+func New(ctx context.Context, storage store.Storage, options ...Option) *Storage {
+	if storage == nil {
+		panic("Decorated storage cannot be nil")
+	}
+
+	decorator := &Storage{
+		storage:       storage,
+		size:          defaultSize,
+		flushInterval: defaultFlushInterval,
+		pending:       map[string]*store.Record{},
+		flushing:      map[string]*store.Record{},
+		mutex:         &sync.RWMutex{},
+		flushMutex:    &sync.Mutex{},
+		flush:         make(chan struct{}, 1),
+		done:          make(chan struct{}),
+	}
+	for _, option := range options {
+		option(decorator)
+	}
+
+	go func() {
+		ticker := time.NewTicker(decorator.flushInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-decorator.done:
+				return
+			case <-ticker.C:
+			case <-decorator.flush:
+			}
+
+			if err := decorator.Flush(ctx); err != nil {
+				logger.Logger.Error("Failed to flush buffer", zap.Error(err))
+			}
+		}
+	}()
+
+	return decorator
+}
+
+// Get reads buffered metric first, decorated storage is read only if metric is not buffered
+func (storage *Storage) Get(ctx context.Context, name string) (metric.Metric, error) {
+	if record, ok := storage.buffered(name); ok {
+		return record.Metric, nil
+	}
+
+	return storage.storage.Get(ctx, name)
+}
+
+// GetRecord returns time metric was buffered, the same time is saved to decorated storage on flush
+func (storage *Storage) GetRecord(ctx context.Context, name string) (*store.Record, error) {
+	if record, ok := storage.buffered(name); ok {
+		return record, nil
+	}
+
+	return storage.storage.GetRecord(ctx, name)
+}
+
+// GetAll flushes buffer, so decorated storage contains all metrics
+func (storage *Storage) GetAll(ctx context.Context) (iter.Seq2[metric.Metric, error], error) {
+	if err := storage.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	return storage.storage.GetAll(ctx)
+}
+
+// GetAllRecords flushes buffer, so decorated storage contains all metrics
+func (storage *Storage) GetAllRecords(ctx context.Context) (iter.Seq2[*store.Record, error], error) {
+	if err := storage.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	return storage.storage.GetAllRecords(ctx)
+}
+
+// GetFiltered flushes buffer, so decorated storage contains all metrics
+func (storage *Storage) GetFiltered(ctx context.Context, filter store.Filter) (iter.Seq2[*store.Record, error], error) {
+	if err := storage.Flush(ctx); err != nil {
+		return nil, err
+	}
+
+	return store.GetFiltered(ctx, storage.storage, filter)
+}
+
+// GetChanges flushes buffer, so buffered metrics get revisions before changes are read
+func (storage *Storage) GetChanges(ctx context.Context, since uint64) (iter.Seq2[*store.Record, error], uint64, error) {
+	if err := storage.Flush(ctx); err != nil {
+		return nil, 0, err
+	}
+
+	return store.GetChanges(ctx, storage.storage, since)
+}
+
+// Revision of decorated storage does not count buffered metrics
+func (storage *Storage) Revision(ctx context.Context) (uint64, error) {
+	return store.Revision(ctx, storage.storage)
+}
+
+func (storage *Storage) AdvanceRevision(ctx context.Context, revision uint64) error {
+	return store.AdvanceRevision(ctx, storage.storage, revision)
+}
+
+func (storage *Storage) Save(ctx context.Context, metric metric.Metric) error {
+	return storage.SaveRecords(ctx, []*store.Record{{Metric: metric, UpdatedAt: time.Now()}})
+}
+
+func (storage *Storage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+	return storage.SaveRecords(ctx, store.RecordsOf(metrics, time.Now()))
+}
+
+// SaveRecords buffers metrics with update time of records
+func (storage *Storage) SaveRecords(ctx context.Context, records []*store.Record) error {
+	storage.mutex.Lock()
+	if storage.closed {
+		storage.mutex.Unlock()
+		return store.ErrStorageClosed
+	}
+
+	for _, record := range records {
+		storage.pending[record.Metric.Name()] = &store.Record{Metric: record.Metric.Clone(), UpdatedAt: record.UpdatedAt}
+	}
+	pending := len(storage.pending)
+	storage.mutex.Unlock()
+
+	switch {
+	case pending >= 2*storage.size:
+		// decorated storage does not keep up, so writers wait for flush
+		return storage.Flush(ctx)
+	case pending >= storage.size:
+		select {
+		case storage.flush <- struct{}{}:
+		default:
+			// flush is already scheduled
+		}
+	}
+
+	return nil
+}
+
+// Flush writes buffered metrics to decorated storage.
+// Metrics are returned to buffer if write is failed, unless they were saved again
+func (storage *Storage) Flush(ctx context.Context) error {
+	storage.flushMutex.Lock()
+	defer storage.flushMutex.Unlock()
+
+	storage.mutex.Lock()
+	if len(storage.pending) == 0 {
+		storage.mutex.Unlock()
+		return nil
+	}
+	storage.flushing, storage.pending = storage.pending, make(map[string]*store.Record, len(storage.pending))
+	records := make([]*store.Record, 0, len(storage.flushing))
+	for _, record := range storage.flushing {
+		records = append(records, record)
+	}
+	storage.mutex.Unlock()
+
+	err := store.SaveRecords(ctx, storage.storage, records)
+
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if err != nil {
+		for name, record := range storage.flushing {
+			if _, ok := storage.pending[name]; !ok {
+				storage.pending[name] = record
+			}
+		}
+	}
+	storage.flushing = map[string]*store.Record{}
+
+	return err
+}
+
+// Delete waits for running flush, so flushed metric does not appear after delete
+func (storage *Storage) Delete(ctx context.Context, name string) error {
+	return storage.delete(func(pending string) bool {
+		return pending == name
+	}, func() error {
+		return storage.storage.Delete(ctx, name)
+	})
+}
+
+func (storage *Storage) DeleteByPrefix(ctx context.Context, prefix string) error {
+	return storage.delete(func(pending string) bool {
+		return strings.HasPrefix(pending, prefix)
+	}, func() error {
+		return storage.storage.DeleteByPrefix(ctx, prefix)
+	})
+}
+
+// DeleteStale checks buffered metric first, it is newer than metric of decorated storage
+func (storage *Storage) DeleteStale(ctx context.Context, name string, cutoff time.Time) (bool, error) {
+	storage.flushMutex.Lock()
+	defer storage.flushMutex.Unlock()
+
+	storage.mutex.Lock()
+	if storage.closed {
+		storage.mutex.Unlock()
+		return false, store.ErrStorageClosed
+	}
+
+	record, buffered := storage.pending[name]
+	if buffered && record.UpdatedAt.After(cutoff) {
+		storage.mutex.Unlock()
+		return false, nil
+	}
+	delete(storage.pending, name)
+	storage.mutex.Unlock()
+
+	deleted, err := store.DeleteStale(ctx, storage.storage, name, cutoff)
+
+	return buffered || deleted, err
+}
+
+// delete removes metrics from buffer under lock and from decorated storage after it, so reads and saves
+// are not blocked by decorated storage. Flush is blocked until metrics are deleted from decorated storage
+func (storage *Storage) delete(match func(name string) bool, deleteFromStorage func() error) error {
+	storage.flushMutex.Lock()
+	defer storage.flushMutex.Unlock()
+
+	storage.mutex.Lock()
+	if storage.closed {
+		storage.mutex.Unlock()
+		return store.ErrStorageClosed
+	}
+
+	for name := range storage.pending {
+		if match(name) {
+			delete(storage.pending, name)
+		}
+	}
+	storage.mutex.Unlock()
+
+	return deleteFromStorage()
+}
+
+func (storage *Storage) Unwrap() store.Storage {
+	return storage.storage
+}
+
+func (storage *Storage) Ping(ctx context.Context) error {
+	return storage.storage.Ping(ctx)
+}
+
+func (storage *Storage) Close(ctx context.Context) error {
+	storage.mutex.Lock()
+	if storage.closed {
+		storage.mutex.Unlock()
+		return store.ErrStorageClosed
+	}
+	storage.closed = true
+	close(storage.done)
+	storage.mutex.Unlock()
+
+	// decorated storage is closed even if buffered metrics are not written
+	return errors.Join(storage.Flush(ctx), storage.storage.Close(ctx))
+}
+
+// Reset waits for running flush, so flushed metrics do not appear after reset
+func (storage *Storage) Reset(ctx context.Context) error {
+	return storage.delete(func(name string) bool {
+		return true
+	}, func() error {
+		return storage.storage.Reset(ctx)
+	})
+}
+
+func (storage *Storage) buffered(name string) (*store.Record, bool) {
+	storage.mutex.RLock()
+	defer storage.mutex.RUnlock()
+
+	record, ok := storage.pending[name]
+	if !ok {
+		record, ok = storage.flushing[name]
+	}
+	if !ok {
+		return nil, false
+	}
+
+	return &store.Record{Metric: record.Metric.Clone(), UpdatedAt: record.UpdatedAt}, true
+}
@@ -0,0 +1,228 @@
+package buffer
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/m1khal3v/gometheus/internal/server/storage/storagetest"
+	"github.com/m1khal3v/gometheus/pkg/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return New(context.Background(), memory.New(), WithFlushInterval(time.Hour))
+	})
+}
+
+func TestNew(t *testing.T) {
+	assert.PanicsWithValue(t, "Decorated storage cannot be nil", func() {
+		New(context.Background(), nil)
+	})
+}
+
+func TestStorage_writeBehind(t *testing.T) {
+	ctx := context.Background()
+	inner := memory.New()
+	decorator := New(ctx, inner, WithFlushInterval(time.Hour))
+
+	require.NoError(t, decorator.Save(ctx, counter.New("m1", 1)))
+	require.NoError(t, decorator.Save(ctx, counter.New("m1", 2)))
+	require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{gauge.New("m2", 1.5)}))
+
+	got, err := inner.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Nil(t, got, "metric must not be written before flush")
+
+	got, err = decorator.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, counter.New("m1", 2), got)
+
+	require.NoError(t, decorator.Flush(ctx))
+	seq, err := inner.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []metric.Metric{counter.New("m1", 2), gauge.New("m2", 1.5)}, all)
+}
+
+func TestStorage_flushTriggers(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		saves   int
+	}{
+		{
+			name:    "size",
+			options: []Option{WithSize(3), WithFlushInterval(time.Hour)},
+			saves:   3,
+		},
+		{
+			name:    "interval",
+			options: []Option{WithSize(1000), WithFlushInterval(10 * time.Millisecond)},
+			saves:   1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			inner := memory.New()
+			decorator := New(ctx, inner, tt.options...)
+			for i := 0; i < tt.saves; i++ {
+				require.NoError(t, decorator.Save(ctx, counter.New("m"+string(rune('0'+i)), int64(i))))
+			}
+
+			assert.Eventually(t, func() bool {
+				seq, err := inner.GetAll(ctx)
+				require.NoError(t, err)
+				all, err := slice.FromSeq2(seq)
+				require.NoError(t, err)
+				return len(all) == tt.saves
+			}, time.Second, 5*time.Millisecond)
+		})
+	}
+}
+
+// unclosableStorage keeps decorated storage readable after decorator is closed
+type unclosableStorage struct {
+	storage.Storage
+}
+
+func (unclosableStorage) Close(context.Context) error {
+	return nil
+}
+
+func TestStorage_Close(t *testing.T) {
+	ctx := context.Background()
+	inner := unclosableStorage{memory.New()}
+	decorator := New(ctx, inner, WithFlushInterval(time.Hour))
+	require.NoError(t, decorator.Save(ctx, counter.New("m1", 1)))
+	require.NoError(t, decorator.Close(ctx))
+
+	got, err := inner.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, counter.New("m1", 1), got)
+	assert.ErrorIs(t, decorator.Save(ctx, counter.New("m1", 2)), storage.ErrStorageClosed)
+	assert.ErrorIs(t, decorator.Close(ctx), storage.ErrStorageClosed)
+}
+
+// failingStorage fails SaveBatch while fail is true
+type failingStorage struct {
+	storage.Storage
+	fail bool
+}
+
+func (storage *failingStorage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+	if storage.fail {
+		return errors.New("unavailable")
+	}
+
+	return storage.Storage.SaveBatch(ctx, metrics)
+}
+
+func TestStorage_failedFlush(t *testing.T) {
+	ctx := context.Background()
+	inner := &failingStorage{Storage: memory.New(), fail: true}
+	decorator := New(ctx, inner, WithFlushInterval(time.Hour))
+	require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{
+		counter.New("m1", 1),
+		counter.New("m2", 1),
+	}))
+
+	require.Error(t, decorator.Flush(ctx))
+	// metric saved after failed flush is not replaced by returned one
+	require.NoError(t, decorator.Save(ctx, counter.New("m2", 2)))
+
+	got, err := decorator.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, counter.New("m1", 1), got)
+
+	inner.fail = false
+	require.NoError(t, decorator.Flush(ctx))
+	seq, err := inner.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []metric.Metric{counter.New("m1", 1), counter.New("m2", 2)}, all)
+}
+
+func TestStorage_closeFailedFlush(t *testing.T) {
+	ctx := context.Background()
+	inner := &failingStorage{Storage: memory.New(), fail: true}
+	decorator := New(ctx, inner, WithFlushInterval(time.Hour))
+	require.NoError(t, decorator.Save(ctx, counter.New("m1", 1)))
+
+	assert.Error(t, decorator.Close(ctx))
+	// decorated storage is closed anyway
+	assert.ErrorIs(t, inner.Ping(ctx), storage.ErrStorageClosed)
+}
+
+// blockingStorage blocks Delete and Reset until unblock is closed
+type blockingStorage struct {
+	storage.Storage
+	called  chan struct{}
+	unblock chan struct{}
+}
+
+func (storage *blockingStorage) Delete(ctx context.Context, name string) error {
+	storage.called <- struct{}{}
+	<-storage.unblock
+
+	return storage.Storage.Delete(ctx, name)
+}
+
+func (storage *blockingStorage) Reset(ctx context.Context) error {
+	storage.called <- struct{}{}
+	<-storage.unblock
+
+	return storage.Storage.Reset(ctx)
+}
+
+func TestStorage_deleteDoesNotBlock(t *testing.T) {
+	tests := map[string]func(ctx context.Context, decorator *Storage) error{
+		"delete": func(ctx context.Context, decorator *Storage) error {
+			return decorator.Delete(ctx, "m1")
+		},
+		"reset": func(ctx context.Context, decorator *Storage) error {
+			return decorator.Reset(ctx)
+		},
+	}
+	for name, operation := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			inner := &blockingStorage{Storage: memory.New(), called: make(chan struct{}), unblock: make(chan struct{})}
+			decorator := New(ctx, inner, WithFlushInterval(time.Hour))
+			require.NoError(t, decorator.Save(ctx, counter.New("m1", 1)))
+
+			done := make(chan error)
+			go func() {
+				done <- operation(ctx, decorator)
+			}()
+			<-inner.called
+
+			// buffer is not locked while decorated storage deletes metrics
+			got, err := decorator.Get(ctx, "m1")
+			require.NoError(t, err)
+			assert.Nil(t, got)
+			require.NoError(t, decorator.Save(ctx, counter.New("m2", 2)))
+			got, err = decorator.Get(ctx, "m2")
+			require.NoError(t, err)
+			assert.Equal(t, counter.New("m2", 2), got)
+
+			close(inner.unblock)
+			require.NoError(t, <-done)
+			require.NoError(t, decorator.Flush(ctx))
+			got, err = inner.Get(ctx, "m2")
+			require.NoError(t, err)
+			assert.Equal(t, counter.New("m2", 2), got)
+		})
+	}
+}
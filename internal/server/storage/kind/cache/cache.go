@@ -0,0 +1,531 @@
+// Package cache
+// contains read-through LRU cache storage decorator.
+// Saved metrics are written to decorated storage first and then to cache.
+// Revisions are assigned by decorated storage, so if it has change feed, saved metrics are cached
+// with revisions returned by its writes. Metrics written without revision, e.g. through write-behind buffer,
+// are invalidated instead and cached with revision on the next read
+package cache
+
+import (
+	"container/list"
+	"context"
+	"hash/maphash"
+	"iter"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/logger"
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSize = 10000
+	defaultTTL  = time.Minute
+	// lockStripes is count of locks which serialize writes of the same metric,
+	// so decorated storage and cache are updated in the same order
+	lockStripes = 64
+)
+
+// Stats of cache usage since decorator creation
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Size      int
+}
+
+type item struct {
+	name     string
+	record   *store.Record
+	cachedAt time.Time
+}
+
+type Storage struct {
+	storage store.Storage
+	size    int
+	ttl     time.Duration
+	mutex   *sync.Mutex
+	items   map[string]*list.Element
+	// order of items, front is most recently used
+	order *list.List
+	// generations are incremented on invalidation of stripe metrics,
+	// so read started before it does not fill cache with stale or deleted metric
+	generations [lockStripes]uint64
+	stripes     [lockStripes]sync.Mutex
+	// revisions is true if decorated storage has change feed
+	revisions bool
+	seed      maphash.Seed
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	evictions atomic.Uint64
+	now       func() time.Time
+	// unsubscribe stops invalidation by changes of other servers
+	unsubscribe func()
+}
+
+// IncrementingStorage decorates storage which increments counters atomically, increments are forwarded to it
+type IncrementingStorage struct {
+	*Storage
+	incrementer store.CounterIncrementer
+}
+
+type Option func(storage *Storage)
+
+// WithSize sets max count of cached metrics
+func WithSize(size int) Option {
+	return func(storage *Storage) {
+		storage.size = size
+	}
+}
+
+// WithTTL sets max time metric is served from cache. Zero TTL keeps metric until it is evicted.
+// TTL limits staleness if decorated storage is written by another process
+func WithTTL(ttl time.Duration) Option {
+	return func(storage *Storage) {
+		storage.ttl = ttl
+	}
+}
+
+// New decorates storage. IncrementingStorage is returned if storage implements storage.CounterIncrementer
+func New(storage store.Storage, options ...Option) store.Storage {
+	if storage == nil {
+		panic("Decorated storage cannot be nil")
+	}
+
+	decorator := &Storage{
+		storage: storage,
+		size:    defaultSize,
+		ttl:     defaultTTL,
+		mutex:   &sync.Mutex{},
+		items:   map[string]*list.Element{},
+		order:   list.New(),
+		seed:    maphash.MakeSeed(),
+		now:     time.Now,
+		// revision of saved metric is unknown until it is read
+		revisions: store.HasChangeFeed(storage),
+	}
+	for _, option := range options {
+		option(decorator)
+	}
+
+	if decorator.size <= 0 {
+		panic("Cache size must be positive")
+	}
+
+	decorator.unsubscribe = func() {}
+	if subscriber, ok := store.FindChangeSubscriber(storage); ok {
+		decorator.unsubscribe = subscriber.Subscribe(decorator.applyChange)
+	}
+
+	if incrementer, ok := storage.(store.CounterIncrementer); ok {
+		return &IncrementingStorage{Storage: decorator, incrementer: incrementer}
+	}
+
+	return decorator
+}
+
+func (storage *Storage) Get(ctx context.Context, name string) (metric.Metric, error) {
+	record, err := storage.GetRecord(ctx, name)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	return record.Metric, nil
+}
+
+// GetRecord reads decorated storage on cache miss. Missing metrics are not cached.
+// Update time of metric saved through decorator is set by decorator and could slightly differ from decorated storage
+func (storage *Storage) GetRecord(ctx context.Context, name string) (*store.Record, error) {
+	if record, ok := storage.lookup(name); ok {
+		storage.hits.Add(1)
+		return record, nil
+	}
+	storage.misses.Add(1)
+
+	storage.mutex.Lock()
+	generation := storage.generations[storage.stripe(name)]
+	storage.mutex.Unlock()
+
+	record, err := storage.storage.GetRecord(ctx, name)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	storage.fill(name, record, generation)
+
+	return record, nil
+}
+
+func (storage *Storage) GetAll(ctx context.Context) (iter.Seq2[metric.Metric, error], error) {
+	return storage.storage.GetAll(ctx)
+}
+
+func (storage *Storage) GetAllRecords(ctx context.Context) (iter.Seq2[*store.Record, error], error) {
+	return storage.storage.GetAllRecords(ctx)
+}
+
+// GetFiltered bypasses cache, so decorated storage could select metrics itself
+func (storage *Storage) GetFiltered(ctx context.Context, filter store.Filter) (iter.Seq2[*store.Record, error], error) {
+	return store.GetFiltered(ctx, storage.storage, filter)
+}
+
+func (storage *Storage) GetChanges(ctx context.Context, since uint64) (iter.Seq2[*store.Record, error], uint64, error) {
+	return store.GetChanges(ctx, storage.storage, since)
+}
+
+func (storage *Storage) Revision(ctx context.Context) (uint64, error) {
+	return store.Revision(ctx, storage.storage)
+}
+
+func (storage *Storage) AdvanceRevision(ctx context.Context, revision uint64) error {
+	return store.AdvanceRevision(ctx, storage.storage, revision)
+}
+
+func (storage *Storage) Save(ctx context.Context, metric metric.Metric) error {
+	if storage.revisions {
+		return storage.SaveRecords(ctx, []*store.Record{{Metric: metric, UpdatedAt: storage.now()}})
+	}
+
+	unlock := storage.lock(metric.Name())
+	defer unlock()
+
+	updatedAt := storage.now()
+	if err := storage.storage.Save(ctx, metric); err != nil {
+		// metric could be partially written, so it is read from decorated storage next time
+		storage.invalidate(metric.Name())
+		return err
+	}
+
+	storage.saved(&store.Record{Metric: metric, UpdatedAt: updatedAt})
+
+	return nil
+}
+
+func (storage *Storage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+	return storage.SaveRecords(ctx, store.RecordsOf(metrics, storage.now()))
+}
+
+// SaveRecords caches metrics with update time of records
+func (storage *Storage) SaveRecords(ctx context.Context, records []*store.Record) error {
+	names := make([]string, 0, len(records))
+	for _, record := range records {
+		names = append(names, record.Metric.Name())
+	}
+
+	unlock := storage.lock(names...)
+	defer unlock()
+
+	written, err := storage.writeRecords(ctx, records)
+	if err != nil {
+		storage.invalidate(names...)
+		return err
+	}
+
+	for _, record := range written {
+		storage.saved(record)
+	}
+
+	return nil
+}
+
+// writeRecords returns records with revisions if decorated storage has change feed
+func (storage *Storage) writeRecords(ctx context.Context, records []*store.Record) ([]*store.Record, error) {
+	if storage.revisions {
+		return store.WriteRecords(ctx, storage.storage, records)
+	}
+
+	if err := store.SaveRecords(ctx, storage.storage, records); err != nil {
+		return nil, err
+	}
+
+	return records, nil
+}
+
+// IncrementCounter caches new value of counter
+func (storage *IncrementingStorage) IncrementCounter(ctx context.Context, name string, delta int64) (int64, error) {
+	if storage.revisions {
+		saved, err := storage.SaveBatchIncrementing(ctx, []metric.Metric{counter.New(name, delta)})
+		if err != nil {
+			return 0, err
+		}
+
+		return saved[0].(*counter.Metric).GetValue(), nil
+	}
+
+	unlock := storage.lock(name)
+	defer unlock()
+
+	updatedAt := storage.now()
+	value, err := storage.incrementer.IncrementCounter(ctx, name, delta)
+	if err != nil {
+		storage.invalidate(name)
+		return 0, err
+	}
+
+	storage.saved(&store.Record{Metric: counter.New(name, value), UpdatedAt: updatedAt})
+
+	return value, nil
+}
+
+// SaveBatchIncrementing caches saved metrics, counters with new values
+func (storage *IncrementingStorage) SaveBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]metric.Metric, error) {
+	names := make([]string, 0, len(metrics))
+	for _, metric := range metrics {
+		names = append(names, metric.Name())
+	}
+
+	unlock := storage.lock(names...)
+	defer unlock()
+
+	written, err := storage.writeBatchIncrementing(ctx, metrics)
+	if err != nil {
+		storage.invalidate(names...)
+		return nil, err
+	}
+
+	saved := make([]metric.Metric, 0, len(written))
+	for _, record := range written {
+		storage.saved(record)
+		saved = append(saved, record.Metric)
+	}
+
+	return saved, nil
+}
+
+// writeBatchIncrementing returns records with revisions if decorated storage has change feed
+func (storage *IncrementingStorage) writeBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]*store.Record, error) {
+	if storage.revisions {
+		return store.WriteBatchIncrementing(ctx, storage.storage, metrics)
+	}
+
+	updatedAt := storage.now()
+	saved, err := storage.incrementer.SaveBatchIncrementing(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.RecordsOf(saved, updatedAt), nil
+}
+
+func (storage *Storage) Delete(ctx context.Context, name string) error {
+	unlock := storage.lock(name)
+	defer unlock()
+
+	// cache is invalidated even if delete is failed, metric could be deleted anyway
+	defer storage.invalidate(name)
+
+	return storage.storage.Delete(ctx, name)
+}
+
+func (storage *Storage) DeleteStale(ctx context.Context, name string, cutoff time.Time) (bool, error) {
+	unlock := storage.lock(name)
+	defer unlock()
+
+	// cache is invalidated even if metric is kept, its update time could be changed by another server
+	defer storage.invalidate(name)
+
+	return store.DeleteStale(ctx, storage.storage, name, cutoff)
+}
+
+func (storage *Storage) DeleteByPrefix(ctx context.Context, prefix string) error {
+	defer storage.invalidateIf(func(name string) bool {
+		return strings.HasPrefix(name, prefix)
+	})
+
+	return storage.storage.DeleteByPrefix(ctx, prefix)
+}
+
+func (storage *Storage) Ping(ctx context.Context) error {
+	return storage.storage.Ping(ctx)
+}
+
+func (storage *Storage) Close(ctx context.Context) error {
+	stats := storage.Stats()
+	logger.Logger.Info(
+		"Cache statistics",
+		zap.Uint64("hits", stats.Hits),
+		zap.Uint64("misses", stats.Misses),
+		zap.Uint64("evictions", stats.Evictions),
+	)
+	storage.unsubscribe()
+	defer storage.invalidateIf(func(string) bool { return true })
+
+	return storage.storage.Close(ctx)
+}
+
+func (storage *Storage) Reset(ctx context.Context) error {
+	defer storage.invalidateIf(func(string) bool { return true })
+
+	return storage.storage.Reset(ctx)
+}
+
+func (storage *Storage) Unwrap() store.Storage {
+	return storage.storage
+}
+
+func (storage *Storage) Stats() Stats {
+	storage.mutex.Lock()
+	size := storage.order.Len()
+	storage.mutex.Unlock()
+
+	return Stats{
+		Hits:      storage.hits.Load(),
+		Misses:    storage.misses.Load(),
+		Evictions: storage.evictions.Load(),
+		Size:      size,
+	}
+}
+
+// applyChange invalidates metrics changed by other servers
+func (storage *Storage) applyChange(change store.Change) {
+	if change.Kind == store.ChangeAll {
+		storage.invalidateIf(func(string) bool { return true })
+		return
+	}
+
+	storage.invalidate(change.Name)
+}
+
+func (storage *Storage) lookup(name string) (*store.Record, bool) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	element, ok := storage.items[name]
+	if !ok {
+		return nil, false
+	}
+
+	item := element.Value.(*item)
+	if storage.ttl > 0 && storage.now().Sub(item.cachedAt) > storage.ttl {
+		storage.remove(element)
+		return nil, false
+	}
+
+	storage.order.MoveToFront(element)
+
+	return copyRecord(item.record), true
+}
+
+// fill caches metric read from decorated storage unless it was saved or invalidated during read
+func (storage *Storage) fill(name string, record *store.Record, generation uint64) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if storage.generations[storage.stripe(name)] != generation {
+		return
+	}
+	if _, ok := storage.items[name]; ok {
+		return
+	}
+
+	storage.add(name, copyRecord(record))
+}
+
+// saved caches copy of saved record, record without revision is invalidated if revisions are assigned by decorated storage
+func (storage *Storage) saved(record *store.Record) {
+	if storage.revisions && record.Revision == 0 {
+		storage.invalidate(record.Metric.Name())
+		return
+	}
+
+	storage.put(record.Metric.Name(), copyRecord(record))
+}
+
+func (storage *Storage) put(name string, record *store.Record) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if element, ok := storage.items[name]; ok {
+		item := element.Value.(*item)
+		item.record = record
+		item.cachedAt = storage.now()
+		storage.order.MoveToFront(element)
+		return
+	}
+
+	storage.add(name, record)
+}
+
+// add must be called under mutex
+func (storage *Storage) add(name string, record *store.Record) {
+	storage.items[name] = storage.order.PushFront(&item{
+		name:     name,
+		record:   record,
+		cachedAt: storage.now(),
+	})
+
+	for storage.order.Len() > storage.size {
+		storage.remove(storage.order.Back())
+		storage.evictions.Add(1)
+	}
+}
+
+// remove must be called under mutex
+func (storage *Storage) remove(element *list.Element) {
+	delete(storage.items, element.Value.(*item).name)
+	storage.order.Remove(element)
+}
+
+func (storage *Storage) invalidate(names ...string) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	for _, name := range names {
+		storage.generations[storage.stripe(name)]++
+		if element, ok := storage.items[name]; ok {
+			storage.remove(element)
+		}
+	}
+}
+
+func (storage *Storage) invalidateIf(match func(name string) bool) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	for stripe := range storage.generations {
+		storage.generations[stripe]++
+	}
+	for name, element := range storage.items {
+		if match(name) {
+			storage.remove(element)
+		}
+	}
+}
+
+// lock stripes of names in ascending order to avoid deadlock, returns unlock function
+func (storage *Storage) lock(names ...string) func() {
+	stripes := make([]int, 0, len(names))
+	for _, name := range names {
+		stripes = append(stripes, storage.stripe(name))
+	}
+	slices.Sort(stripes)
+	stripes = slices.Compact(stripes)
+
+	for _, stripe := range stripes {
+		storage.stripes[stripe].Lock()
+	}
+
+	return func() {
+		for _, stripe := range stripes {
+			storage.stripes[stripe].Unlock()
+		}
+	}
+}
+
+func (storage *Storage) stripe(name string) int {
+	return int(maphash.String(storage.seed, name) % lockStripes)
+}
+
+func copyRecord(record *store.Record) *store.Record {
+	return &store.Record{
+		Metric:    record.Metric.Clone(),
+		UpdatedAt: record.UpdatedAt,
+		Revision:  record.Revision,
+	}
+}
@@ -0,0 +1,352 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/m1khal3v/gometheus/internal/server/storage/storagetest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return New(memory.New())
+	})
+}
+
+func TestNew(t *testing.T) {
+	assert.PanicsWithValue(t, "Decorated storage cannot be nil", func() {
+		New(nil)
+	})
+	assert.PanicsWithValue(t, "Cache size must be positive", func() {
+		New(memory.New(), WithSize(0))
+	})
+	// increments are forwarded only to storage which increments counters atomically
+	assert.IsType(t, &IncrementingStorage{}, New(memory.New()))
+	assert.IsType(t, &Storage{}, New(&countingStorage{Storage: memory.New()}))
+}
+
+// countingStorage counts reads of decorated storage and fails writes while fail is true
+type countingStorage struct {
+	storage.Storage
+	reads int
+	fail  bool
+}
+
+func (inner *countingStorage) GetRecord(ctx context.Context, name string) (*storage.Record, error) {
+	inner.reads++
+	return inner.Storage.GetRecord(ctx, name)
+}
+
+func (inner *countingStorage) Save(ctx context.Context, metric metric.Metric) error {
+	if inner.fail {
+		return errors.New("unavailable")
+	}
+
+	return inner.Storage.Save(ctx, metric)
+}
+
+func (inner *countingStorage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+	if inner.fail {
+		return errors.New("unavailable")
+	}
+
+	return inner.Storage.SaveBatch(ctx, metrics)
+}
+
+func TestStorage_readThrough(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStorage{Storage: memory.New()}
+	require.NoError(t, inner.Storage.Save(ctx, gauge.New("m1", 1.5)))
+	decorator := New(inner).(*Storage)
+
+	for i := 0; i < 3; i++ {
+		got, err := decorator.Get(ctx, "m1")
+		require.NoError(t, err)
+		assert.Equal(t, gauge.New("m1", 1.5), got)
+	}
+
+	// missing metrics are not cached
+	for i := 0; i < 2; i++ {
+		got, err := decorator.Get(ctx, "m2")
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	}
+
+	assert.Equal(t, 3, inner.reads)
+	assert.Equal(t, Stats{Hits: 2, Misses: 3, Size: 1}, decorator.Stats())
+}
+
+// incrementingStorage is countingStorage which increments counters atomically
+type incrementingStorage struct {
+	*countingStorage
+	storage.CounterIncrementer
+}
+
+func TestStorage_writeThrough(t *testing.T) {
+	ctx := context.Background()
+	memoryStorage := memory.New()
+	inner := &countingStorage{Storage: memoryStorage}
+	decorator := New(incrementingStorage{countingStorage: inner, CounterIncrementer: memoryStorage}).(*IncrementingStorage)
+
+	require.NoError(t, decorator.Save(ctx, gauge.New("m1", 1.5)))
+	require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{counter.New("m2", 1), counter.New("m2", 2)}))
+	value, err := decorator.IncrementCounter(ctx, "m2", 3)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), value)
+
+	got, err := decorator.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, gauge.New("m1", 1.5), got)
+	got, err = decorator.Get(ctx, "m2")
+	require.NoError(t, err)
+	assert.Equal(t, counter.New("m2", 5), got)
+	got, err = inner.Storage.Get(ctx, "m2")
+	require.NoError(t, err)
+	assert.Equal(t, counter.New("m2", 5), got)
+
+	assert.Equal(t, 0, inner.reads)
+}
+
+// feedStorage counts reads of decorated storage, change feed and revision writes of memory storage are kept
+type feedStorage struct {
+	*memory.Storage
+	reads int
+}
+
+func (inner *feedStorage) GetRecord(ctx context.Context, name string) (*storage.Record, error) {
+	inner.reads++
+	return inner.Storage.GetRecord(ctx, name)
+}
+
+func TestStorage_revision(t *testing.T) {
+	ctx := context.Background()
+	inner := &feedStorage{Storage: memory.New()}
+	decorator := New(inner).(*IncrementingStorage)
+
+	for i, want := range []uint64{1, 4} {
+		require.NoError(t, decorator.Save(ctx, gauge.New("m1", float64(i))))
+		_, err := decorator.IncrementCounter(ctx, "c1", 1)
+		require.NoError(t, err)
+		_, err = decorator.SaveBatchIncrementing(ctx, []metric.Metric{counter.New("c2", 1)})
+		require.NoError(t, err)
+
+		// saved metrics are cached with revision assigned by decorated storage
+		for name, revision := range map[string]uint64{"m1": want, "c1": want + 1, "c2": want + 2} {
+			record, err := decorator.GetRecord(ctx, name)
+			require.NoError(t, err)
+			stored, err := inner.Storage.GetRecord(ctx, name)
+			require.NoError(t, err)
+			assert.Equal(t, revision, record.Revision)
+			assert.Equal(t, stored, record)
+		}
+	}
+	assert.Equal(t, 0, inner.reads)
+	assert.Equal(t, Stats{Hits: 6, Size: 3}, decorator.Stats())
+}
+
+// writeBehindStorage hides revision writes of change feed storage, like buffer between cache and database
+type writeBehindStorage struct {
+	wrapper
+}
+
+func TestStorage_revisionUnknown(t *testing.T) {
+	ctx := context.Background()
+	inner := &feedStorage{Storage: memory.New()}
+	decorator := New(writeBehindStorage{wrapper{inner}}).(*Storage)
+
+	require.NoError(t, decorator.Save(ctx, gauge.New("m1", 1)))
+	// metric saved without revision is read with revision assigned by decorated storage and then served from cache
+	for range 2 {
+		record, err := decorator.GetRecord(ctx, "m1")
+		require.NoError(t, err)
+		assert.Equal(t, uint64(1), record.Revision)
+	}
+	assert.Equal(t, 1, inner.reads)
+	assert.Equal(t, Stats{Hits: 1, Misses: 1, Size: 1}, decorator.Stats())
+}
+
+func TestStorage_failedWrite(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStorage{Storage: memory.New()}
+	decorator := New(inner)
+	require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{gauge.New("m1", 1.5), gauge.New("m2", 2.5)}))
+
+	inner.fail = true
+	require.Error(t, decorator.Save(ctx, gauge.New("m1", 2)))
+	require.Error(t, decorator.SaveBatch(ctx, []metric.Metric{gauge.New("m2", 3)}))
+
+	// failed writes invalidate cache, so metrics are read from decorated storage
+	for _, want := range []metric.Metric{gauge.New("m1", 1.5), gauge.New("m2", 2.5)} {
+		got, err := decorator.Get(ctx, want.Name())
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+	assert.Equal(t, 2, inner.reads)
+}
+
+func TestStorage_eviction(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStorage{Storage: memory.New()}
+	decorator := New(inner, WithSize(2)).(*Storage)
+
+	require.NoError(t, decorator.Save(ctx, gauge.New("m1", 1)))
+	require.NoError(t, decorator.Save(ctx, gauge.New("m2", 2)))
+	// m1 becomes most recently used, so m2 is evicted
+	_, err := decorator.Get(ctx, "m1")
+	require.NoError(t, err)
+	require.NoError(t, decorator.Save(ctx, gauge.New("m3", 3)))
+
+	_, err = decorator.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, inner.reads)
+
+	got, err := decorator.Get(ctx, "m2")
+	require.NoError(t, err)
+	assert.Equal(t, gauge.New("m2", 2), got)
+	assert.Equal(t, 1, inner.reads)
+	assert.Equal(t, Stats{Hits: 2, Misses: 1, Evictions: 2, Size: 2}, decorator.Stats())
+}
+
+func TestStorage_ttl(t *testing.T) {
+	ctx := context.Background()
+	inner := &countingStorage{Storage: memory.New()}
+	decorator := New(inner, WithTTL(time.Minute)).(*Storage)
+	now := time.Now()
+	decorator.now = func() time.Time {
+		return now
+	}
+
+	require.NoError(t, decorator.Save(ctx, gauge.New("m1", 1)))
+	// another process updates decorated storage
+	require.NoError(t, inner.Storage.Save(ctx, gauge.New("m1", 2)))
+
+	got, err := decorator.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, gauge.New("m1", 1), got)
+
+	now = now.Add(2 * time.Minute)
+	got, err = decorator.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, gauge.New("m1", 2), got)
+	assert.Equal(t, 1, inner.reads)
+}
+
+func TestStorage_deleteInvalidates(t *testing.T) {
+	ctx := context.Background()
+	decorator := New(memory.New()).(*IncrementingStorage)
+	require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{
+		gauge.New("m1", 1),
+		counter.New("cpu_user", 2),
+		counter.New("cpu_system", 3),
+		counter.New("ram", 4),
+	}))
+
+	require.NoError(t, decorator.Delete(ctx, "m1"))
+	require.NoError(t, decorator.DeleteByPrefix(ctx, "cpu_"))
+
+	for _, name := range []string{"m1", "cpu_user", "cpu_system"} {
+		got, err := decorator.Get(ctx, name)
+		require.NoError(t, err)
+		assert.Nil(t, got, name)
+	}
+	got, err := decorator.Get(ctx, "ram")
+	require.NoError(t, err)
+	assert.Equal(t, counter.New("ram", 4), got)
+	assert.Equal(t, 1, decorator.Stats().Size)
+}
+
+func TestStorage_concurrentSaves(t *testing.T) {
+	ctx := context.Background()
+	inner := memory.New()
+	decorator := New(inner, WithSize(16)).(*IncrementingStorage)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := decorator.IncrementCounter(ctx, "c1", 1)
+				assert.NoError(t, err)
+				assert.NoError(t, decorator.Save(ctx, gauge.New("g1", float64(j))))
+				_, err = decorator.Get(ctx, "g1")
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, name := range []string{"c1", "g1"} {
+		cached, err := decorator.Get(ctx, name)
+		require.NoError(t, err)
+		stored, err := inner.Get(ctx, name)
+		require.NoError(t, err)
+		assert.Equal(t, stored, cached)
+	}
+	got, err := decorator.Get(ctx, "c1")
+	require.NoError(t, err)
+	assert.Equal(t, counter.New("c1", 800), got)
+}
+
+// sharedStorage emulates storage changed by another server
+type sharedStorage struct {
+	storage.Storage
+	handler func(change storage.Change)
+}
+
+func (shared *sharedStorage) Subscribe(handler func(change storage.Change)) func() {
+	shared.handler = handler
+
+	return func() {
+		shared.handler = nil
+	}
+}
+
+// wrapper emulates decorator between cache and shared storage
+type wrapper struct {
+	storage.Storage
+}
+
+func (wrapper wrapper) Unwrap() storage.Storage {
+	return wrapper.Storage
+}
+
+func TestStorage_remoteChanges(t *testing.T) {
+	ctx := context.Background()
+	shared := &sharedStorage{Storage: memory.New()}
+	decorator := New(wrapper{shared})
+	require.NotNil(t, shared.handler, "cache must subscribe through decorators chain")
+
+	require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{gauge.New("m1", 1), gauge.New("m2", 2), gauge.New("m3", 3)}))
+
+	// another server updates m1 and deletes m2
+	require.NoError(t, shared.Storage.Save(ctx, gauge.New("m1", 10)))
+	shared.handler(storage.Change{Kind: storage.ChangeSave, Name: "m1"})
+	require.NoError(t, shared.Storage.Delete(ctx, "m2"))
+	shared.handler(storage.Change{Kind: storage.ChangeDelete, Name: "m2"})
+
+	got, err := decorator.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, gauge.New("m1", 10), got)
+	got, err = decorator.Get(ctx, "m2")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	require.NoError(t, shared.Storage.Reset(ctx))
+	shared.handler(storage.Change{Kind: storage.ChangeAll})
+	got, err = decorator.Get(ctx, "m3")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	require.NoError(t, decorator.Close(ctx))
+	assert.Nil(t, shared.handler)
+}
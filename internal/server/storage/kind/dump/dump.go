@@ -1,45 +1,98 @@
 // Package dump
-// contains dump to file storage decorator
+// contains dump to file storage decorator.
+// Every save is appended to write-ahead log, full snapshot is written periodically
+// (or when log grows too much) and replaces log segments written before it
 package dump
 
 import (
-	"bufio"
 	"context"
-	"encoding/json"
 	"errors"
+	"iter"
 	"os"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/m1khal3v/gometheus/internal/common/logger"
 	"github.com/m1khal3v/gometheus/internal/common/metric"
-	"github.com/m1khal3v/gometheus/internal/common/metric/factory"
-	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
 	"github.com/m1khal3v/gometheus/pkg/retry"
+	"go.uber.org/zap"
 )
 
+// walCompactionSize is WAL segment size which triggers snapshot before store interval
+const walCompactionSize = 16 << 20
+
 type Storage struct {
-	storage storage.Storage
-	file    *os.File
-	sync    bool
-	mutex   *sync.Mutex
+	storage   store.Storage
+	path      string
+	wal       *wal
+	mutex     *sync.Mutex
+	dumpMutex *sync.Mutex
+	compact   chan struct{}
+	done      chan struct{}
+	closed    bool
+	options   *options
+}
+
+// IncrementingStorage decorates storage which increments counters atomically, increments are forwarded to it
+type IncrementingStorage struct {
+	*Storage
+	incrementer store.CounterIncrementer
 }
 
-func New(ctx context.Context, storage storage.Storage, filepath string, storeInterval uint32, restore bool) (*Storage, error) {
+// New restores and decorates storage. IncrementingStorage is returned if storage implements storage.CounterIncrementer
+func New(ctx context.Context, storage store.Storage, filepath string, storeInterval uint32, restore bool, options ...Option) (store.Storage, error) {
 	if storage == nil {
 		panic("Decorated storage cannot be nil")
 	}
 
-	file, err := openFile(filepath)
-	if err != nil {
+	decorator := &Storage{
+		storage:   storage,
+		path:      filepath,
+		mutex:     &sync.Mutex{},
+		dumpMutex: &sync.Mutex{},
+		compact:   make(chan struct{}, 1),
+		done:      make(chan struct{}),
+		options:   newOptions(options...),
+	}
+
+	if err := decorator.restoreRevision(ctx); err != nil {
 		return nil, err
 	}
 
-	decorator := &Storage{
-		storage: storage,
-		file:    file,
-		sync:    storeInterval == 0,
-		mutex:   &sync.Mutex{},
+	pointInTime := restore && !decorator.options.restoreAt.IsZero() && decorator.options.restoreMode != RestoreSkip
+	if pointInTime {
+		restored, err := restoredAt(filepath, decorator.options.restoreAt)
+		if err != nil {
+			return nil, err
+		}
+
+		// restore point is done once, the latest state is restored after it
+		if restored {
+			logger.Logger.Warn(
+				"Point-in-time restore is already done, restoring the latest state",
+				zap.Time("restore_at", decorator.options.restoreAt),
+			)
+			decorator.options.restoreAt = time.Time{}
+			pointInTime = false
+		}
+	}
+
+	addCounters := restore && decorator.options.restoreMode == RestoreMergeAddCounters
+	if addCounters {
+		imported, err := countersImported(filepath)
+		if err != nil {
+			return nil, err
+		}
+
+		// dumped counters are added once, otherwise they are added again on every start
+		if imported {
+			logger.Logger.Warn("Dumped counters are already added, merging as merge-keep-newer")
+			decorator.options.restoreMode = RestoreMergeKeepNewer
+			addCounters = false
+		}
 	}
 
 	if restore {
@@ -48,19 +101,53 @@ func New(ctx context.Context, storage storage.Storage, filepath string, storeInt
 		}
 	}
 
-	if !decorator.sync {
-		go func() {
+	if addCounters {
+		if err := markCountersImported(filepath); err != nil {
+			return nil, err
+		}
+	}
+
+	var err error
+	// every write is synced to disk if store interval is 0
+	if decorator.wal, err = openWAL(filepath, storeInterval == 0); err != nil {
+		return nil, err
+	}
+
+	// restored historical state replaces the latest snapshot and discards log written after it
+	if pointInTime {
+		if err := decorator.dump(ctx); err != nil {
+			return nil, err
+		}
+
+		if err := markRestored(filepath, decorator.options.restoreAt); err != nil {
+			return nil, err
+		}
+	}
+
+	go func() {
+		var tick <-chan time.Time
+		if storeInterval > 0 {
 			ticker := time.NewTicker(time.Duration(storeInterval) * time.Second)
+			defer ticker.Stop()
+			tick = ticker.C
+		}
 
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				case <-ticker.C:
-					decorator.mustDump(ctx)
-				}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-decorator.done:
+				return
+			case <-tick:
+				decorator.mustDump(ctx)
+			case <-decorator.compact:
+				decorator.mustDump(ctx)
 			}
-		}()
+		}
+	}()
+
+	if incrementer, ok := storage.(store.CounterIncrementer); ok {
+		return &IncrementingStorage{Storage: decorator, incrementer: incrementer}, nil
 	}
 
 	return decorator, nil
@@ -70,32 +157,138 @@ func (storage *Storage) Get(ctx context.Context, name string) (metric.Metric, er
 	return storage.storage.Get(ctx, name)
 }
 
-func (storage *Storage) GetAll(ctx context.Context) (<-chan metric.Metric, error) {
+func (storage *Storage) GetAll(ctx context.Context) (iter.Seq2[metric.Metric, error], error) {
 	return storage.storage.GetAll(ctx)
 }
 
+func (storage *Storage) GetRecord(ctx context.Context, name string) (*store.Record, error) {
+	return storage.storage.GetRecord(ctx, name)
+}
+
+func (storage *Storage) GetAllRecords(ctx context.Context) (iter.Seq2[*store.Record, error], error) {
+	return storage.storage.GetAllRecords(ctx)
+}
+
+func (storage *Storage) GetFiltered(ctx context.Context, filter store.Filter) (iter.Seq2[*store.Record, error], error) {
+	return store.GetFiltered(ctx, storage.storage, filter)
+}
+
+func (storage *Storage) GetChanges(ctx context.Context, since uint64) (iter.Seq2[*store.Record, error], uint64, error) {
+	return store.GetChanges(ctx, storage.storage, since)
+}
+
+func (storage *Storage) Revision(ctx context.Context) (uint64, error) {
+	return store.Revision(ctx, storage.storage)
+}
+
+// AdvanceRevision records raised revision to WAL, so it is kept after restart.
+// Head could be greater than revision, it is restored from preceding records then
+func (storage *Storage) AdvanceRevision(ctx context.Context, revision uint64) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if err := store.AdvanceRevision(ctx, storage.storage, revision); err != nil {
+		return err
+	}
+
+	return storage.appendToWAL(walRecord{Operation: revisionOperation, Revision: revision})
+}
+
 func (storage *Storage) Save(ctx context.Context, metric metric.Metric) error {
-	if err := storage.storage.Save(ctx, metric); err != nil {
+	return storage.SaveRecords(ctx, []*store.Record{{Metric: metric, UpdatedAt: time.Now()}})
+}
+
+func (storage *Storage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+	return storage.SaveRecords(ctx, store.RecordsOf(metrics, time.Now()))
+}
+
+// SaveRecords saves records to decorated storage and WAL with the same update time, so it is kept after restart
+func (storage *Storage) SaveRecords(ctx context.Context, records []*store.Record) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if err := store.SaveRecords(ctx, storage.storage, records); err != nil {
 		return err
 	}
 
-	if storage.sync {
-		storage.mustDump(ctx)
+	walRecords := make([]walRecord, 0, len(records))
+	for _, record := range records {
+		walRecords = append(walRecords, newSaveRecord(record))
 	}
 
-	return nil
+	return storage.appendToWAL(walRecords...)
 }
 
-func (storage *Storage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
-	if err := storage.storage.SaveBatch(ctx, metrics); err != nil {
+// IncrementCounter appends new value of counter to WAL
+func (storage *IncrementingStorage) IncrementCounter(ctx context.Context, name string, delta int64) (int64, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	value, err := storage.incrementer.IncrementCounter(ctx, name, delta)
+	if err != nil {
+		return 0, err
+	}
+
+	record := &store.Record{Metric: counter.New(name, value), UpdatedAt: time.Now()}
+
+	return value, storage.appendToWAL(newSaveRecord(record))
+}
+
+// SaveBatchIncrementing appends saved values to WAL
+func (storage *IncrementingStorage) SaveBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]metric.Metric, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	saved, err := storage.incrementer.SaveBatchIncrementing(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	updatedAt := time.Now()
+	records := make([]walRecord, 0, len(saved))
+	for _, metric := range saved {
+		records = append(records, newSaveRecord(&store.Record{Metric: metric, UpdatedAt: updatedAt}))
+	}
+
+	return saved, storage.appendToWAL(records...)
+}
+
+func (storage *Storage) Delete(ctx context.Context, name string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if err := storage.storage.Delete(ctx, name); err != nil {
 		return err
 	}
 
-	if storage.sync {
-		storage.mustDump(ctx)
+	return storage.appendToWAL(walRecord{Operation: deleteOperation, Name: name})
+}
+
+func (storage *Storage) DeleteStale(ctx context.Context, name string, cutoff time.Time) (bool, error) {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	deleted, err := store.DeleteStale(ctx, storage.storage, name, cutoff)
+	if err != nil || !deleted {
+		return false, err
 	}
 
-	return nil
+	return true, storage.appendToWAL(walRecord{Operation: deleteOperation, Name: name})
+}
+
+func (storage *Storage) DeleteByPrefix(ctx context.Context, prefix string) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if err := storage.storage.DeleteByPrefix(ctx, prefix); err != nil {
+		return err
+	}
+
+	return storage.appendToWAL(storage.withRevision(ctx, walRecord{Operation: deleteByPrefixOperation, Name: prefix})...)
+}
+
+func (storage *Storage) Unwrap() store.Storage {
+	return storage.storage
 }
 
 func (storage *Storage) Ping(ctx context.Context) error {
@@ -107,7 +300,16 @@ func (storage *Storage) Close(ctx context.Context) error {
 		return err
 	}
 
-	if err := storage.file.Close(); err != nil {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if storage.closed {
+		return storage.storage.Close(ctx)
+	}
+
+	storage.closed = true
+	close(storage.done)
+	if err := storage.wal.close(); err != nil {
 		return err
 	}
 
@@ -115,13 +317,35 @@ func (storage *Storage) Close(ctx context.Context) error {
 }
 
 func (storage *Storage) Reset(ctx context.Context) error {
-	return storage.storage.Reset(ctx)
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if err := storage.storage.Reset(ctx); err != nil {
+		return err
+	}
+
+	return storage.appendToWAL(storage.withRevision(ctx, walRecord{Operation: resetOperation})...)
 }
 
-type anonymousMetric struct {
-	Type  string `json:"type"`
-	Name  string `json:"name"`
-	Value string `json:"value"`
+// appendToWAL must be called under mutex
+func (storage *Storage) appendToWAL(records ...walRecord) error {
+	if storage.closed {
+		return store.ErrStorageClosed
+	}
+
+	if err := storage.wal.append(records...); err != nil {
+		return err
+	}
+
+	if storage.wal.size >= walCompactionSize {
+		select {
+		case storage.compact <- struct{}{}:
+		default:
+			// compaction is already scheduled
+		}
+	}
+
+	return nil
 }
 
 func (storage *Storage) mustDump(ctx context.Context) {
@@ -130,76 +354,81 @@ func (storage *Storage) mustDump(ctx context.Context) {
 	}
 }
 
+// dump writes snapshot of decorated storage and removes WAL segments covered by it.
+// Records are appended to WAL after decorated storage is updated, so snapshot taken
+// after rotation contains every record of rotated segments
 func (storage *Storage) dump(ctx context.Context) error {
-	storage.mutex.Lock()
-	defer storage.mutex.Unlock()
+	storage.dumpMutex.Lock()
+	defer storage.dumpMutex.Unlock()
 
-	allMetrics, err := storage.storage.GetAll(ctx)
+	storage.mutex.Lock()
+	if storage.closed {
+		storage.mutex.Unlock()
+		return nil
+	}
+	compacted, err := storage.wal.rotate()
+	if err == nil {
+		// segments with revisions are removed after snapshot, so head revision is carried to new segment
+		if record := storage.revisionRecord(ctx); record.Revision > 0 {
+			err = storage.appendToWAL(record)
+		}
+	}
+	storage.mutex.Unlock()
 	if err != nil {
 		return err
 	}
 
-	if _, err := storage.file.Seek(0, 0); err != nil {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	records, err := storage.storage.GetAllRecords(ctx)
+	if err != nil {
 		return err
 	}
 
-	if err := storage.file.Truncate(0); err != nil {
+	if err := writeSnapshot(storage.path, records, storage.options); err != nil {
 		return err
 	}
 
-	for metric := range allMetrics {
-		anonMetric := anonymousMetric{
-			Type:  metric.Type(),
-			Name:  metric.Name(),
-			Value: metric.StringValue(),
-		}
-		jsonMetric, err := json.Marshal(anonMetric)
-		if err != nil {
-			return err
-		}
-
-		if _, err := storage.file.Write(append(jsonMetric, "\n"...)); err != nil {
-			return err
-		}
+	if err := archiveSnapshot(storage.path, time.Now(), storage.options); err != nil {
+		return err
 	}
 
-	return nil
+	return storage.wal.removeUpTo(compacted)
 }
 
-func (storage *Storage) restoreFromFile(ctx context.Context) error {
-	if err := storage.storage.Reset(ctx); err != nil {
-		return err
-	}
-
-	if _, err := storage.file.Seek(0, 0); err != nil {
-		return err
+// revisionRecord carries head revision of decorated storage. Revision is not set if storage has no change feed
+// or it cannot be read, saves following record raise restored revision anyway
+func (storage *Storage) revisionRecord(ctx context.Context) walRecord {
+	record := walRecord{Operation: revisionOperation}
+	if revision, err := store.Revision(ctx, storage.storage); err == nil {
+		record.Revision = revision
 	}
 
-	reader := bufio.NewScanner(storage.file)
-	for reader.Scan() {
-		if reader.Text() == "" {
-			continue
-		}
+	return record
+}
 
-		anonymousMetric := &anonymousMetric{}
-		if err := json.Unmarshal(reader.Bytes(), anonymousMetric); err != nil {
-			return err
-		}
+// withRevision appends head revision to record of operation taking unknown count of revisions,
+// e.g. delete by prefix makes tombstone of every deleted metric
+func (storage *Storage) withRevision(ctx context.Context, record walRecord) []walRecord {
+	if revision := storage.revisionRecord(ctx); revision.Revision > 0 {
+		return []walRecord{record, revision}
+	}
 
-		metric, err := factory.New(anonymousMetric.Type, anonymousMetric.Name, anonymousMetric.Value)
-		if err != nil {
-			return err
-		}
+	return []walRecord{record}
+}
 
-		if err := storage.storage.Save(ctx, metric); err != nil {
-			return err
-		}
+func newSaveRecord(record *store.Record) walRecord {
+	return walRecord{
+		Operation: saveOperation,
+		Type:      record.Metric.Type(),
+		Name:      record.Metric.Name(),
+		Value:     record.Metric.StringValue(),
+		UpdatedAt: unixNano(record.UpdatedAt),
 	}
-
-	return nil
 }
 
-func openFile(filepath string) (*os.File, error) {
+func openFile(filepath string, flag int) (*os.File, error) {
 	var file *os.File
 	err := retry.Retry(retry.RetryOptions{
 		BaseDelay:  time.Second,
@@ -208,7 +437,7 @@ func openFile(filepath string) (*os.File, error) {
 		Multiplier: 2,
 	}, func() error {
 		var err error
-		file, err = os.OpenFile(filepath, os.O_RDWR|os.O_CREATE, 0666)
+		file, err = os.OpenFile(filepath, flag, 0666)
 		return err
 	}, isRetryableError)
 	if err != nil {
@@ -219,6 +448,10 @@ func openFile(filepath string) (*os.File, error) {
 }
 
 func isRetryableError(err error) bool {
+	if errors.Is(err, store.ErrTransient) {
+		return true
+	}
+
 	var pathErr *os.PathError
 	if !errors.As(err, &pathErr) {
 		return false
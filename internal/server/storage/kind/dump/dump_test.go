@@ -2,10 +2,7 @@ package dump
 
 import (
 	"context"
-	"fmt"
-	"io"
-	"os"
-	"strings"
+	"path"
 	"testing"
 
 	"github.com/m1khal3v/gometheus/internal/common/metric"
@@ -13,11 +10,25 @@ import (
 	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
 	"github.com/m1khal3v/gometheus/internal/server/storage"
 	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/m1khal3v/gometheus/internal/server/storage/storagetest"
 	"github.com/m1khal3v/gometheus/pkg/slice"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		ctx := context.Background()
+		decorator, err := New(ctx, memory.New(), path.Join(t.TempDir(), "dump.json"), 0, false)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			decorator.Close(ctx)
+		})
+
+		return decorator
+	})
+}
+
 func TestNew(t *testing.T) {
 	type args struct {
 		storage       storage.Storage
@@ -26,6 +37,7 @@ func TestNew(t *testing.T) {
 		restore       bool
 	}
 	storage := memory.New()
+	filepath := path.Join(t.TempDir(), "dump.json")
 	tests := []struct {
 		name      string
 		args      args
@@ -42,7 +54,7 @@ func TestNew(t *testing.T) {
 			name: "valid 1",
 			args: args{
 				storage:       storage,
-				filepath:      "/tmp/dump.json",
+				filepath:      filepath,
 				storeInterval: 0,
 				restore:       false,
 			},
@@ -51,7 +63,7 @@ func TestNew(t *testing.T) {
 			name: "valid 2",
 			args: args{
 				storage:       storage,
-				filepath:      "/tmp/dump.json",
+				filepath:      filepath,
 				storeInterval: 0,
 				restore:       true,
 			},
@@ -60,7 +72,7 @@ func TestNew(t *testing.T) {
 			name: "valid 3",
 			args: args{
 				storage:       storage,
-				filepath:      "/tmp/dump.json",
+				filepath:      filepath,
 				storeInterval: 3000,
 				restore:       true,
 			},
@@ -118,44 +130,26 @@ func TestStorage_dump(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
-			storage := memory.New()
-			file, err := os.CreateTemp("", "dump_test_*.json")
-			if err != nil {
-				t.Fatal(err)
-			}
-			defer file.Close()
-			defer os.Remove(file.Name())
+			filepath := path.Join(t.TempDir(), "dump.json")
 
-			decorator, err := New(ctx, storage, file.Name(), 9999, false)
+			decorator, err := New(ctx, memory.New(), filepath, 9999, false)
 			require.NoError(t, err)
 			for _, item := range tt.items {
 				decorator.Save(ctx, item)
 			}
-			decorator.dump(ctx)
+			require.NoError(t, dumpOf(decorator).dump(ctx))
 
-			require.FileExists(t, file.Name())
-			all, err := io.ReadAll(file)
-			if err != nil {
-				t.Fatal(err)
-			}
+			require.FileExists(t, filepath)
+			items := []metric.Metric{}
+			require.NoError(t, readSnapshot(filepath, func(record *storage.Record) error {
+				items = append(items, record.Metric)
+				return nil
+			}))
 
-			items := strings.Split(strings.TrimRight(string(all), "\n"), "\n")
-			if len(items) == 1 && items[0] == "" {
-				items = []string{}
-			}
 			if tt.wantItems == nil {
 				tt.wantItems = tt.items
 			}
-			require.Len(t, items, len(tt.wantItems))
-
-			for _, metric := range tt.wantItems {
-				assert.Contains(t, items, fmt.Sprintf(
-					"{\"type\":\"%s\",\"name\":\"%s\",\"value\":\"%s\"}",
-					metric.Type(),
-					metric.Name(),
-					metric.StringValue(),
-				))
-			}
+			assert.ElementsMatch(t, tt.wantItems, items)
 		})
 	}
 }
@@ -206,7 +200,7 @@ func TestStorage_Get(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
 			storage := memory.New()
-			decorator, err := New(ctx, storage, "/tmp/test", 9999, false)
+			decorator, err := New(ctx, storage, path.Join(t.TempDir(), "dump.json"), 9999, false)
 			require.NoError(t, err)
 			for _, item := range tt.items {
 				decorator.Save(ctx, item)
@@ -264,15 +258,17 @@ func TestStorage_GetAll(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
 			storage := memory.New()
-			decorator, err := New(ctx, storage, "/tmp/test", 9999, false)
+			decorator, err := New(ctx, storage, path.Join(t.TempDir(), "dump.json"), 9999, false)
 			require.NoError(t, err)
 			for _, item := range tt.items {
 				require.NoError(t, decorator.Save(ctx, item))
 			}
 
-			all, err := decorator.GetAll(ctx)
+			seq, err := decorator.GetAll(ctx)
 			require.NoError(t, err)
-			assert.ElementsMatch(t, tt.wantItems, slice.FromChannel(all))
+			all, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.wantItems, all)
 		})
 	}
 }
@@ -295,7 +291,7 @@ func TestStorage_Save(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
 			storage := memory.New()
-			decorator, err := New(ctx, storage, "/tmp/test", 9999, false)
+			decorator, err := New(ctx, storage, path.Join(t.TempDir(), "dump.json"), 9999, false)
 			require.NoError(t, err)
 			decorator.Save(ctx, tt.metric)
 			metric, err := decorator.Get(ctx, tt.metric.Name())
@@ -352,24 +348,130 @@ func Test_restoreFromFile(t *testing.T) {
 		t.Run(tt.name, func(t *testing.T) {
 			ctx := context.Background()
 			storage := memory.New()
-			file, err := os.CreateTemp("", "restore_test_*.json")
-			if err != nil {
-				t.Fatal(err)
-			}
-			defer file.Close()
-			defer os.Remove(file.Name())
-
-			decorator, err := New(ctx, storage, file.Name(), 9999, false)
+			decorator, err := New(ctx, storage, path.Join(t.TempDir(), "dump.json"), 9999, false)
 			require.NoError(t, err)
 			for _, item := range tt.items {
 				decorator.Save(ctx, item)
 			}
-			require.NoError(t, decorator.dump(ctx))
+			require.NoError(t, dumpOf(decorator).dump(ctx))
+
+			dumpOf(decorator).restoreFromFile(ctx)
+			seq, err := decorator.GetAll(ctx)
+			require.NoError(t, err)
+			all, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.wantItems, all)
+		})
+	}
+}
+
+// dumpOf returns dump decorator of storage returned by New
+func dumpOf(decorator storage.Storage) *Storage {
+	if incrementing, ok := decorator.(*IncrementingStorage); ok {
+		return incrementing.Storage
+	}
+
+	return decorator.(*Storage)
+}
+
+// plainStorage hides optional interfaces of decorated storage
+type plainStorage struct {
+	storage.Storage
+}
+
+func TestNew_incrementer(t *testing.T) {
+	ctx := context.Background()
+
+	// increments are forwarded only to storage which increments counters atomically
+	decorator, err := New(ctx, plainStorage{memory.New()}, path.Join(t.TempDir(), "dump.json"), 9999, false)
+	require.NoError(t, err)
+	assert.IsType(t, &Storage{}, decorator)
+	require.NoError(t, decorator.Close(ctx))
+}
+
+func TestStorage_IncrementCounter(t *testing.T) {
+	ctx := context.Background()
+	filepath := path.Join(t.TempDir(), "dump.json")
+	decorator, err := New(ctx, memory.New(), filepath, 9999, false)
+	require.NoError(t, err)
+	require.IsType(t, &IncrementingStorage{}, decorator)
+	incrementer := decorator.(*IncrementingStorage)
+	require.NoError(t, decorator.Save(ctx, gauge.New("m2", 1.5)))
+
+	value, err := incrementer.IncrementCounter(ctx, "m1", 5)
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), value)
+	value, err = incrementer.IncrementCounter(ctx, "m1", -2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), value)
+	// gauge is replaced by counter
+	value, err = incrementer.IncrementCounter(ctx, "m2", 7)
+	require.NoError(t, err)
+	assert.Equal(t, int64(7), value)
+	require.NoError(t, incrementer.wal.close())
+
+	restored, err := New(ctx, memory.New(), filepath, 9999, true)
+	require.NoError(t, err)
+	seq, err := restored.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []metric.Metric{
+		counter.New("m1", 3),
+		counter.New("m2", 7),
+	}, all)
+}
+
+func TestStorage_restoreRevision(t *testing.T) {
+	tests := []struct {
+		name    string
+		close   bool
+		restore bool
+	}{
+		{name: "from WAL after crash", restore: true},
+		{name: "from snapshot after close", close: true, restore: true},
+		{name: "without restore", close: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			filepath := path.Join(t.TempDir(), "dump.json")
+			decorator, err := New(ctx, memory.New(), filepath, 300, false)
+			require.NoError(t, err)
+			require.NoError(t, decorator.Save(ctx, gauge.New("m1", 1)))
+			require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{counter.New("m2", 2), gauge.New("m3", 3)}))
+			// deletes take revisions too
+			require.NoError(t, decorator.Delete(ctx, "m3"))
+			require.NoError(t, decorator.DeleteByPrefix(ctx, "m2"))
+			head, err := storage.Revision(ctx, decorator)
+			require.NoError(t, err)
+			if tt.close {
+				require.NoError(t, decorator.Close(ctx))
+			}
+
+			restored, err := New(ctx, memory.New(), filepath, 300, tt.restore)
+			require.NoError(t, err)
+			defer restored.Close(ctx)
+
+			revision, err := storage.Revision(ctx, restored)
+			require.NoError(t, err)
+			assert.GreaterOrEqual(t, revision, head)
+
+			// restored metrics are reported again, revisions are not reused
+			seq, _, err := storage.GetChanges(ctx, restored, head)
+			require.NoError(t, err)
+			records, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			if tt.restore {
+				assert.Len(t, records, 1)
+			} else {
+				assert.Empty(t, records)
+			}
 
-			decorator.restoreFromFile(ctx)
-			all, err := decorator.GetAll(ctx)
+			require.NoError(t, restored.Save(ctx, gauge.New("m4", 4)))
+			record, err := restored.GetRecord(ctx, "m4")
 			require.NoError(t, err)
-			assert.ElementsMatch(t, tt.wantItems, slice.FromChannel(all))
+			assert.Greater(t, record.Revision, head)
 		})
 	}
 }
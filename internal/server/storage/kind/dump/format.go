@@ -0,0 +1,98 @@
+package dump
+
+import (
+	"fmt"
+)
+
+// Encoding of metrics in snapshot
+type Encoding byte
+
+const (
+	EncodingJSON     Encoding = 1
+	EncodingProtobuf Encoding = 2
+)
+
+// Compression of snapshot body
+type Compression byte
+
+const (
+	CompressionNone Compression = 0
+	CompressionGzip Compression = 1
+	CompressionZstd Compression = 2
+)
+
+type UnknownEncodingError struct {
+	Encoding string
+}
+
+func (err UnknownEncodingError) Error() string {
+	return fmt.Sprintf("snapshot encoding '%s' is not defined", err.Encoding)
+}
+
+func newErrUnknownEncoding(encoding string) error {
+	return &UnknownEncodingError{
+		Encoding: encoding,
+	}
+}
+
+type UnknownCompressionError struct {
+	Compression string
+}
+
+func (err UnknownCompressionError) Error() string {
+	return fmt.Sprintf("snapshot compression '%s' is not defined", err.Compression)
+}
+
+func newErrUnknownCompression(compression string) error {
+	return &UnknownCompressionError{
+		Compression: compression,
+	}
+}
+
+func ParseEncoding(name string) (Encoding, error) {
+	switch name {
+	case "json":
+		return EncodingJSON, nil
+	case "protobuf":
+		return EncodingProtobuf, nil
+	default:
+		return 0, newErrUnknownEncoding(name)
+	}
+}
+
+func (encoding Encoding) String() string {
+	switch encoding {
+	case EncodingJSON:
+		return "json"
+	case EncodingProtobuf:
+		return "protobuf"
+	default:
+		return fmt.Sprintf("%d", byte(encoding))
+	}
+}
+
+func ParseCompression(name string) (Compression, error) {
+	switch name {
+	case "none", "":
+		return CompressionNone, nil
+	case "gzip":
+		return CompressionGzip, nil
+	case "zstd":
+		return CompressionZstd, nil
+	default:
+		return 0, newErrUnknownCompression(name)
+	}
+}
+
+func (compression Compression) String() string {
+	switch compression {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("%d", byte(compression))
+	}
+}
@@ -0,0 +1,147 @@
+package dump
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// historyTimeLayout is sortable UTC time of historical snapshot in its file name
+const historyTimeLayout = "20060102T150405.000000000Z"
+
+type SnapshotNotFoundError struct {
+	Time time.Time
+}
+
+func (err SnapshotNotFoundError) Error() string {
+	return fmt.Sprintf("snapshot taken at or before %s is not found", err.Time.Format(time.RFC3339))
+}
+
+func newErrSnapshotNotFound(time time.Time) error {
+	return &SnapshotNotFoundError{
+		Time: time,
+	}
+}
+
+type historicalSnapshot struct {
+	path string
+	time time.Time
+}
+
+// archiveSnapshot links current snapshot to timestamped file and removes
+// historical snapshots which are not covered by retention policy
+func archiveSnapshot(path string, now time.Time, options *options) error {
+	if options.historySize == 0 {
+		return nil
+	}
+
+	// snapshot is immutable after rename, so hard link is enough
+	if err := os.Link(path, historyPath(path, now)); err != nil && !errors.Is(err, os.ErrExist) {
+		return err
+	}
+
+	snapshots, err := listHistory(path)
+	if err != nil {
+		return err
+	}
+
+	for i, snapshot := range snapshots {
+		expired := options.historyMaxAge > 0 && now.Sub(snapshot.time) > options.historyMaxAge
+		if uint(i) < options.historySize && !expired {
+			continue
+		}
+
+		if err := os.Remove(snapshot.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// findHistoricalSnapshot returns newest historical snapshot taken at or before specified time
+func findHistoricalSnapshot(path string, at time.Time) (string, error) {
+	snapshots, err := listHistory(path)
+	if err != nil {
+		return "", err
+	}
+
+	for _, snapshot := range snapshots {
+		if !snapshot.time.After(at) {
+			return snapshot.path, nil
+		}
+	}
+
+	return "", newErrSnapshotNotFound(at)
+}
+
+// restoredAt reports whether point-in-time restore to specified time was already done,
+// so restore point kept in config does not discard state saved after restore on every start
+func restoredAt(path string, at time.Time) (bool, error) {
+	content, err := os.ReadFile(restorePointPath(path))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	point, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(string(content)))
+	if err != nil {
+		// unreadable marker does not block restore
+		return false, nil
+	}
+
+	return point.Equal(at), nil
+}
+
+// markRestored records point of finished point-in-time restore
+func markRestored(path string, at time.Time) error {
+	if err := os.WriteFile(restorePointPath(path), []byte(at.UTC().Format(time.RFC3339Nano)), 0666); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+func restorePointPath(path string) string {
+	return path + ".restore-point"
+}
+
+func historyPath(path string, time time.Time) string {
+	return path + ".snapshot." + time.UTC().Format(historyTimeLayout)
+}
+
+// listHistory returns historical snapshots from newest to oldest
+func listHistory(path string) ([]historicalSnapshot, error) {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), filepath.Base(path)+".snapshot.*"))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(path) + ".snapshot."
+	snapshots := make([]historicalSnapshot, 0, len(matches))
+	for _, match := range matches {
+		snapshotTime, err := time.Parse(historyTimeLayout, strings.TrimPrefix(filepath.Base(match), prefix))
+		if err != nil {
+			// not a snapshot
+			continue
+		}
+
+		snapshots = append(snapshots, historicalSnapshot{
+			path: match,
+			time: snapshotTime,
+		})
+	}
+
+	slices.SortFunc(snapshots, func(a, b historicalSnapshot) int {
+		return b.time.Compare(a.time)
+	})
+
+	return snapshots, nil
+}
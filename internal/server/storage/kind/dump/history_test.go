@@ -0,0 +1,166 @@
+package dump
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/m1khal3v/gometheus/pkg/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_archiveSnapshot(t *testing.T) {
+	start := time.Date(2026, 10, 19, 4, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		size    uint
+		maxAge  time.Duration
+		archive int
+		want    []time.Time
+	}{
+		{
+			name:    "disabled",
+			size:    0,
+			archive: 3,
+			want:    []time.Time{},
+		},
+		{
+			name:    "keep count",
+			size:    2,
+			archive: 4,
+			want:    []time.Time{start.Add(3 * time.Minute), start.Add(2 * time.Minute)},
+		},
+		{
+			name:    "keep age",
+			size:    10,
+			maxAge:  90 * time.Second,
+			archive: 4,
+			want:    []time.Time{start.Add(3 * time.Minute), start.Add(2 * time.Minute)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filepath := path.Join(t.TempDir(), "dump")
+			options := newOptions(WithHistory(tt.size, tt.maxAge))
+			for i := 0; i < tt.archive; i++ {
+				require.NoError(t, writeSnapshot(filepath, seqOf(snapshotMetrics[:i]), options))
+				require.NoError(t, archiveSnapshot(filepath, start.Add(time.Duration(i)*time.Minute), options))
+			}
+
+			snapshots, err := listHistory(filepath)
+			require.NoError(t, err)
+			got := make([]time.Time, 0, len(snapshots))
+			for _, snapshot := range snapshots {
+				got = append(got, snapshot.time)
+			}
+			assert.Equal(t, tt.want, got)
+
+			// historical snapshot is not changed by following dumps
+			for i, snapshot := range snapshots {
+				metrics, err := readAll(t, snapshot.path)
+				require.NoError(t, err)
+				assert.Equal(t, snapshotMetrics[:tt.archive-1-i], metrics)
+			}
+		})
+	}
+}
+
+func Test_findHistoricalSnapshot(t *testing.T) {
+	start := time.Date(2026, 10, 19, 4, 0, 0, 0, time.UTC)
+	filepath := path.Join(t.TempDir(), "dump")
+	options := newOptions(WithHistory(10, 0))
+	for i := 0; i < 3; i++ {
+		require.NoError(t, writeSnapshot(filepath, seqOf(snapshotMetrics[:i]), options))
+		require.NoError(t, archiveSnapshot(filepath, start.Add(time.Duration(i)*time.Minute), options))
+	}
+
+	tests := []struct {
+		name    string
+		at      time.Time
+		want    string
+		wantErr error
+	}{
+		{
+			name: "exact time",
+			at:   start.Add(time.Minute),
+			want: historyPath(filepath, start.Add(time.Minute)),
+		},
+		{
+			name: "between snapshots",
+			at:   start.Add(90 * time.Second),
+			want: historyPath(filepath, start.Add(time.Minute)),
+		},
+		{
+			name: "after last snapshot",
+			at:   start.Add(time.Hour),
+			want: historyPath(filepath, start.Add(2*time.Minute)),
+		},
+		{
+			name:    "before first snapshot",
+			at:      start.Add(-time.Second),
+			wantErr: newErrSnapshotNotFound(start.Add(-time.Second)),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findHistoricalSnapshot(filepath, tt.at)
+			if tt.wantErr != nil {
+				assert.Equal(t, tt.wantErr, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStorage_restoreAt(t *testing.T) {
+	ctx := context.Background()
+	filepath := path.Join(t.TempDir(), "dump")
+
+	decorator, err := New(ctx, memory.New(), filepath, 9999, false, WithHistory(10, 0))
+	require.NoError(t, err)
+	require.NoError(t, decorator.Save(ctx, counter.New("m1", 1)))
+	require.NoError(t, dumpOf(decorator).dump(ctx))
+	between := time.Now()
+	require.NoError(t, decorator.Save(ctx, counter.New("m1", 2)))
+	require.NoError(t, dumpOf(decorator).dump(ctx))
+	// written to log only
+	require.NoError(t, decorator.Save(ctx, counter.New("m2", 3)))
+	require.NoError(t, dumpOf(decorator).wal.close())
+
+	restored, err := New(ctx, memory.New(), filepath, 9999, true, WithHistory(10, 0), WithRestoreAt(between))
+	require.NoError(t, err)
+	seq, err := restored.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []metric.Metric{counter.New("m1", 1)}, all)
+	require.NoError(t, restored.Close(ctx))
+
+	// restored state became the latest one
+	latest, err := New(ctx, memory.New(), filepath, 9999, true)
+	require.NoError(t, err)
+	seq, err = latest.GetAll(ctx)
+	require.NoError(t, err)
+	all, err = slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []metric.Metric{counter.New("m1", 1)}, all)
+	require.NoError(t, latest.Save(ctx, counter.New("m3", 4)))
+	require.NoError(t, latest.Close(ctx))
+
+	// restore to the same time is not repeated, so metrics saved after it are kept
+	restarted, err := New(ctx, memory.New(), filepath, 9999, true, WithHistory(10, 0), WithRestoreAt(between))
+	require.NoError(t, err)
+	seq, err = restarted.GetAll(ctx)
+	require.NoError(t, err)
+	all, err = slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []metric.Metric{counter.New("m1", 1), counter.New("m3", 4)}, all)
+	require.NoError(t, restarted.Close(ctx))
+}
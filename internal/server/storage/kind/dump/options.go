@@ -0,0 +1,68 @@
+package dump
+
+import (
+	"time"
+)
+
+type Option func(options *options)
+
+type options struct {
+	encoding      Encoding
+	compression   Compression
+	historySize   uint
+	historyMaxAge time.Duration
+	restoreAt     time.Time
+	restoreMode   RestoreMode
+}
+
+func newOptions(optionList ...Option) *options {
+	options := &options{
+		encoding:    EncodingJSON,
+		compression: CompressionNone,
+		restoreMode: RestoreReplace,
+	}
+	for _, option := range optionList {
+		option(options)
+	}
+
+	return options
+}
+
+// WithEncoding sets encoding of written snapshots. Snapshot of any encoding could be restored
+func WithEncoding(encoding Encoding) Option {
+	return func(options *options) {
+		options.encoding = encoding
+	}
+}
+
+// WithCompression sets compression of written snapshots. Snapshot of any compression could be restored
+func WithCompression(compression Compression) Option {
+	return func(options *options) {
+		options.compression = compression
+	}
+}
+
+// WithHistory keeps size latest snapshots as timestamped files (<path>.snapshot.<time>).
+// Snapshots older than maxAge are removed if maxAge is not 0
+func WithHistory(size uint, maxAge time.Duration) Option {
+	return func(options *options) {
+		options.historySize = size
+		options.historyMaxAge = maxAge
+	}
+}
+
+// WithRestoreAt restores state from the newest historical snapshot taken at or before specified time
+// instead of the latest state. Write-ahead log is discarded in this case.
+// Restore to the same time is done once, the latest state is restored on next starts
+func WithRestoreAt(at time.Time) Option {
+	return func(options *options) {
+		options.restoreAt = at
+	}
+}
+
+// WithRestoreMode defines how dumped state is combined with state of decorated storage on restore
+func WithRestoreMode(mode RestoreMode) Option {
+	return func(options *options) {
+		options.restoreMode = mode
+	}
+}
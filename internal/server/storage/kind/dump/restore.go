@@ -0,0 +1,347 @@
+package dump
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric/factory"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+)
+
+// restoreBatchSize is count of metrics saved to decorated storage in one batch on restore
+const restoreBatchSize = 1000
+
+// RestoreMode defines how dumped state is combined with state of decorated storage
+type RestoreMode byte
+
+const (
+	// RestoreReplace resets decorated storage and loads dumped state
+	RestoreReplace RestoreMode = iota
+	// RestoreMergeKeepNewer loads dumped metrics which are missing in decorated storage
+	// or updated later than metrics of decorated storage
+	RestoreMergeKeepNewer
+	// RestoreMergeAddCounters works as RestoreMergeKeepNewer, but adds dumped counter values to existing counters.
+	// It is one-time import of dump: decorated storage holds dumped counters after it,
+	// so the next starts with the same dump file work as RestoreMergeKeepNewer
+	RestoreMergeAddCounters
+	// RestoreSkip does not load dumped state
+	RestoreSkip
+)
+
+type UnknownRestoreModeError struct {
+	Mode string
+}
+
+func (err UnknownRestoreModeError) Error() string {
+	return fmt.Sprintf("restore mode '%s' is not defined", err.Mode)
+}
+
+func newErrUnknownRestoreMode(mode string) error {
+	return &UnknownRestoreModeError{
+		Mode: mode,
+	}
+}
+
+func ParseRestoreMode(name string) (RestoreMode, error) {
+	switch name {
+	case "replace":
+		return RestoreReplace, nil
+	case "merge-keep-newer":
+		return RestoreMergeKeepNewer, nil
+	case "merge-add-counters":
+		return RestoreMergeAddCounters, nil
+	case "skip":
+		return RestoreSkip, nil
+	default:
+		return 0, newErrUnknownRestoreMode(name)
+	}
+}
+
+func (mode RestoreMode) String() string {
+	switch mode {
+	case RestoreReplace:
+		return "replace"
+	case RestoreMergeKeepNewer:
+		return "merge-keep-newer"
+	case RestoreMergeAddCounters:
+		return "merge-add-counters"
+	case RestoreSkip:
+		return "skip"
+	default:
+		return fmt.Sprintf("%d", byte(mode))
+	}
+}
+
+// restoreFromFile loads snapshot and replays WAL on top of it.
+// Records contain final values, so replay of records already included into snapshot is harmless.
+// Historical snapshot is loaded without WAL, because log is written after the latest snapshot
+func (storage *Storage) restoreFromFile(ctx context.Context) error {
+	mode := storage.options.restoreMode
+	if mode == RestoreSkip {
+		return nil
+	}
+
+	batch := newRestoreBatch(storage.storage, mode)
+	if mode == RestoreReplace {
+		if err := storage.storage.Reset(ctx); err != nil {
+			return err
+		}
+	}
+
+	if !storage.options.restoreAt.IsZero() {
+		path, err := findHistoricalSnapshot(storage.path, storage.options.restoreAt)
+		if err != nil {
+			return err
+		}
+
+		if err := readSnapshot(path, func(record *store.Record) error {
+			return batch.add(ctx, record)
+		}); err != nil {
+			return err
+		}
+
+		return batch.flush(ctx)
+	}
+
+	if err := readSnapshot(storage.path, func(record *store.Record) error {
+		return batch.add(ctx, record)
+	}); err != nil {
+		return err
+	}
+
+	if err := replayWAL(storage.path, func(record walRecord) error {
+		switch record.Operation {
+		case saveOperation:
+			metric, err := factory.New(record.Type, record.Name, record.Value)
+			if err != nil {
+				return err
+			}
+
+			return batch.add(ctx, &store.Record{Metric: metric, UpdatedAt: fromUnixNano(record.UpdatedAt)})
+		case resetOperation:
+			return batch.reset(ctx)
+		case deleteOperation:
+			return batch.delete(ctx, record.Name)
+		case deleteByPrefixOperation:
+			return batch.deleteByPrefix(ctx, record.Name)
+		case revisionOperation:
+			// applied by restoreRevision before state is loaded
+			return nil
+		default:
+			return ErrCorruptedRecord
+		}
+	}); err != nil {
+		return err
+	}
+
+	return batch.flush(ctx)
+}
+
+// restoreRevision raises head revision of decorated storage to revision of the last revision record in WAL
+// plus count of saves and deletes following it. Every save and delete takes at most one revision, deletes by prefix
+// and resets are followed by revision record, so metrics saved after restart (restored ones too) get revisions
+// greater than any revision reported before it. It is done even if dumped state is not restored
+func (storage *Storage) restoreRevision(ctx context.Context) error {
+	if _, ok := storage.storage.(store.ChangeFeed); !ok {
+		return nil
+	}
+
+	var revision uint64
+	if err := replayWAL(storage.path, func(record walRecord) error {
+		if record.Operation == saveOperation || record.Operation == deleteOperation {
+			revision++
+		}
+		revision = max(revision, record.Revision)
+		return nil
+	}); err != nil {
+		return err
+	}
+	if revision == 0 {
+		return nil
+	}
+
+	return store.AdvanceRevision(ctx, storage.storage, revision)
+}
+
+// restoreBatch collects last record of every metric and saves them with their update time.
+// In merge modes whole dumped state is collected before merge, so reset and delete
+// records in log never touch decorated storage
+type restoreBatch struct {
+	storage store.Storage
+	mode    RestoreMode
+	records map[string]*store.Record
+	// restoredAt is update time of records dumped without it
+	restoredAt time.Time
+}
+
+func newRestoreBatch(storage store.Storage, mode RestoreMode) *restoreBatch {
+	return &restoreBatch{
+		storage:    storage,
+		mode:       mode,
+		records:    make(map[string]*store.Record, restoreBatchSize),
+		restoredAt: time.Now(),
+	}
+}
+
+func (batch *restoreBatch) add(ctx context.Context, record *store.Record) error {
+	if record.UpdatedAt.IsZero() {
+		record.UpdatedAt = batch.restoredAt
+	}
+
+	batch.records[record.Metric.Name()] = record
+	if batch.mode != RestoreReplace || len(batch.records) < restoreBatchSize {
+		return nil
+	}
+
+	return batch.flush(ctx)
+}
+
+func (batch *restoreBatch) reset(ctx context.Context) error {
+	clear(batch.records)
+	if batch.mode != RestoreReplace {
+		return nil
+	}
+
+	return batch.storage.Reset(ctx)
+}
+
+// delete removes metric from decorated storage too in replace mode, because it could be flushed already
+func (batch *restoreBatch) delete(ctx context.Context, name string) error {
+	delete(batch.records, name)
+	if batch.mode != RestoreReplace {
+		return nil
+	}
+
+	return batch.storage.Delete(ctx, name)
+}
+
+func (batch *restoreBatch) deleteByPrefix(ctx context.Context, prefix string) error {
+	for name := range batch.records {
+		if strings.HasPrefix(name, prefix) {
+			delete(batch.records, name)
+		}
+	}
+	if batch.mode != RestoreReplace {
+		return nil
+	}
+
+	return batch.storage.DeleteByPrefix(ctx, prefix)
+}
+
+func (batch *restoreBatch) flush(ctx context.Context) error {
+	records := make([]*store.Record, 0, min(len(batch.records), restoreBatchSize))
+	for _, record := range batch.records {
+		records = append(records, record)
+		if len(records) < restoreBatchSize {
+			continue
+		}
+
+		if err := batch.save(ctx, records); err != nil {
+			return err
+		}
+		records = records[:0]
+	}
+	clear(batch.records)
+
+	return batch.save(ctx, records)
+}
+
+func (batch *restoreBatch) save(ctx context.Context, records []*store.Record) error {
+	if batch.mode != RestoreReplace {
+		var err error
+		if records, err = batch.merge(ctx, records); err != nil {
+			return err
+		}
+	}
+
+	if len(records) == 0 {
+		return nil
+	}
+
+	return store.SaveRecords(ctx, batch.storage, records)
+}
+
+// merge returns dumped records which should be saved to decorated storage
+func (batch *restoreBatch) merge(ctx context.Context, records []*store.Record) ([]*store.Record, error) {
+	merged := make([]*store.Record, 0, len(records))
+	for _, dumped := range records {
+		existing, err := batch.storage.GetRecord(ctx, dumped.Metric.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		if existing == nil {
+			merged = append(merged, dumped)
+			continue
+		}
+
+		if sum, ok := batch.addCounters(existing, dumped); ok {
+			merged = append(merged, sum)
+			continue
+		}
+
+		if dumped.UpdatedAt.After(existing.UpdatedAt) {
+			merged = append(merged, dumped)
+		}
+	}
+
+	return merged, nil
+}
+
+// addCounters returns sum of counters in RestoreMergeAddCounters mode, sum is updated at the latest time of both
+func (batch *restoreBatch) addCounters(existing, dumped *store.Record) (*store.Record, bool) {
+	if batch.mode != RestoreMergeAddCounters {
+		return nil, false
+	}
+
+	existingCounter, ok := existing.Metric.(*counter.Metric)
+	if !ok {
+		return nil, false
+	}
+
+	dumpedCounter, ok := dumped.Metric.(*counter.Metric)
+	if !ok {
+		return nil, false
+	}
+
+	sum := existingCounter.Clone().(*counter.Metric)
+	sum.Add(dumpedCounter.GetValue())
+	updatedAt := existing.UpdatedAt
+	if dumped.UpdatedAt.After(updatedAt) {
+		updatedAt = dumped.UpdatedAt
+	}
+
+	return &store.Record{Metric: sum, UpdatedAt: updatedAt}, true
+}
+
+// countersImported reports whether dumped counters were already added to decorated storage
+func countersImported(path string) (bool, error) {
+	if _, err := os.Stat(countersImportedPath(path)); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// markCountersImported records finished RestoreMergeAddCounters restore
+func markCountersImported(path string) error {
+	if err := os.WriteFile(countersImportedPath(path), nil, 0666); err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+func countersImportedPath(path string) string {
+	return path + ".counters-imported"
+}
@@ -0,0 +1,198 @@
+package dump
+
+import (
+	"context"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/m1khal3v/gometheus/pkg/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRestoreMode(t *testing.T) {
+	for _, mode := range []RestoreMode{RestoreReplace, RestoreMergeKeepNewer, RestoreMergeAddCounters, RestoreSkip} {
+		parsed, err := ParseRestoreMode(mode.String())
+		require.NoError(t, err)
+		assert.Equal(t, mode, parsed)
+	}
+
+	_, err := ParseRestoreMode("unknown")
+	assert.Equal(t, newErrUnknownRestoreMode("unknown"), err)
+}
+
+func TestStorage_restoreMode(t *testing.T) {
+	// state of decorated storage before restore
+	existing := []metric.Metric{
+		counter.New("c1", 10),
+		gauge.New("g1", 1.5),
+		counter.New("c3", 1),
+	}
+	tests := []struct {
+		name string
+		mode RestoreMode
+		want []metric.Metric
+	}{
+		{
+			name: "replace",
+			mode: RestoreReplace,
+			want: []metric.Metric{
+				counter.New("c1", 5),
+				gauge.New("g1", 2.5),
+				counter.New("c2", 7),
+				gauge.New("c3", 3),
+			},
+		},
+		{
+			name: "merge keep newer",
+			mode: RestoreMergeKeepNewer,
+			want: []metric.Metric{
+				counter.New("c1", 10),
+				gauge.New("g1", 1.5),
+				counter.New("c2", 7),
+				counter.New("c3", 1),
+			},
+		},
+		{
+			name: "merge add counters",
+			mode: RestoreMergeAddCounters,
+			want: []metric.Metric{
+				counter.New("c1", 15),
+				gauge.New("g1", 1.5),
+				counter.New("c2", 7),
+				counter.New("c3", 1),
+			},
+		},
+		{
+			name: "skip",
+			mode: RestoreSkip,
+			want: existing,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			filepath := path.Join(t.TempDir(), "dump")
+
+			decorator, err := New(ctx, memory.New(), filepath, 0, false)
+			require.NoError(t, err)
+			require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{
+				counter.New("old", 1),
+				gauge.New("g1", 2.5),
+			}))
+			require.NoError(t, dumpOf(decorator).dump(ctx))
+			// reset in log drops dumped state before it, but not state of decorated storage
+			require.NoError(t, decorator.Reset(ctx))
+			require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{
+				counter.New("c1", 5),
+				gauge.New("g1", 2.5),
+				counter.New("c2", 7),
+				gauge.New("c3", 3),
+			}))
+			require.NoError(t, dumpOf(decorator).wal.close())
+
+			storage := memory.New()
+			require.NoError(t, storage.SaveBatch(ctx, existing))
+			restored, err := New(ctx, storage, filepath, 0, true, WithRestoreMode(tt.mode))
+			require.NoError(t, err)
+
+			seq, err := restored.GetAll(ctx)
+			require.NoError(t, err)
+			all, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, all)
+			require.NoError(t, restored.Close(ctx))
+		})
+	}
+}
+
+func TestStorage_restoreUpdatedAt(t *testing.T) {
+	ctx := context.Background()
+	filepath := path.Join(t.TempDir(), "dump")
+	snapshotted, logged := time.Unix(0, 1760875200000000000), time.Unix(0, 1760875260000000000)
+
+	decorator, err := New(ctx, memory.New(), filepath, 0, false)
+	require.NoError(t, err)
+	require.NoError(t, store.SaveRecords(ctx, decorator, []*store.Record{{Metric: counter.New("c1", 1), UpdatedAt: snapshotted}}))
+	require.NoError(t, dumpOf(decorator).dump(ctx))
+	require.NoError(t, store.SaveRecords(ctx, decorator, []*store.Record{{Metric: gauge.New("g1", 1.5), UpdatedAt: logged}}))
+	require.NoError(t, dumpOf(decorator).wal.close())
+
+	restored, err := New(ctx, memory.New(), filepath, 0, true)
+	require.NoError(t, err)
+	defer restored.Close(ctx)
+
+	// update time is restored both from snapshot and WAL
+	for name, want := range map[string]time.Time{"c1": snapshotted, "g1": logged} {
+		record, err := restored.GetRecord(ctx, name)
+		require.NoError(t, err)
+		require.NotNil(t, record)
+		assert.True(t, want.Equal(record.UpdatedAt), "%s: want %s, got %s", name, want, record.UpdatedAt)
+	}
+}
+
+func TestStorage_restoreMergeKeepNewer(t *testing.T) {
+	ctx := context.Background()
+	filepath := path.Join(t.TempDir(), "dump")
+	older, newer := time.Unix(0, 1760875200000000000), time.Unix(0, 1760875260000000000)
+
+	decorator, err := New(ctx, memory.New(), filepath, 0, false)
+	require.NoError(t, err)
+	require.NoError(t, store.SaveRecords(ctx, decorator, []*store.Record{
+		{Metric: gauge.New("g1", 1), UpdatedAt: newer},
+		{Metric: gauge.New("g2", 2), UpdatedAt: older},
+	}))
+	require.NoError(t, decorator.Close(ctx))
+
+	storage := memory.New()
+	require.NoError(t, storage.SaveRecords(ctx, []*store.Record{
+		{Metric: gauge.New("g1", 10), UpdatedAt: older},
+		{Metric: gauge.New("g2", 20), UpdatedAt: newer},
+	}))
+	restored, err := New(ctx, storage, filepath, 0, true, WithRestoreMode(RestoreMergeKeepNewer))
+	require.NoError(t, err)
+	defer restored.Close(ctx)
+
+	seq, err := restored.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []metric.Metric{gauge.New("g1", 1), gauge.New("g2", 20)}, all)
+}
+
+func TestStorage_restoreMergeAddCountersOnce(t *testing.T) {
+	ctx := context.Background()
+	filepath := path.Join(t.TempDir(), "dump")
+
+	decorator, err := New(ctx, memory.New(), filepath, 0, false)
+	require.NoError(t, err)
+	require.NoError(t, decorator.Save(ctx, counter.New("c1", 5)))
+	require.NoError(t, decorator.Close(ctx))
+
+	storage := memory.New()
+	require.NoError(t, storage.Save(ctx, counter.New("c1", 10)))
+	for i := 0; i < 2; i++ {
+		restored, err := New(ctx, persistentStorage{storage}, filepath, 0, true, WithRestoreMode(RestoreMergeAddCounters))
+		require.NoError(t, err)
+		require.NoError(t, restored.Close(ctx))
+
+		got, err := storage.Get(ctx, "c1")
+		require.NoError(t, err)
+		assert.Equal(t, counter.New("c1", 15), got)
+	}
+}
+
+// persistentStorage keeps state of decorated storage between starts, as database does
+type persistentStorage struct {
+	store.Storage
+}
+
+func (persistentStorage) Close(ctx context.Context) error {
+	return nil
+}
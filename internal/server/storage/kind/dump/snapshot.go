@@ -0,0 +1,386 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/factory"
+	"github.com/m1khal3v/gometheus/internal/common/metric/transformer"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/pkg/proto"
+	gproto "google.golang.org/protobuf/proto"
+)
+
+// Snapshot layout:
+//
+//	header: magic | version (1 byte) | encoding (1 byte) | compression (1 byte)
+//	body (compressed): { uvarint length | varint updated at (unix nano) | encoded metric }... | uvarint 0 | uint32 crc32 of all metrics
+//
+// Version 1 snapshot has no update time in chunks. Snapshot without magic is legacy NDJSON of anonymousMetric
+var snapshotMagic = []byte("GMSNAP")
+
+const snapshotVersion = 2
+
+// snapshotVersionWithoutTime is the last version without update time of metrics, metrics are restored as updated now
+const snapshotVersionWithoutTime = 1
+
+var ErrCorruptedSnapshot = errors.New("snapshot is corrupted")
+
+type UnsupportedVersionError struct {
+	Version byte
+}
+
+func (err UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("snapshot version %d is not supported", err.Version)
+}
+
+func newErrUnsupportedVersion(version byte) error {
+	return &UnsupportedVersionError{
+		Version: version,
+	}
+}
+
+type anonymousMetric struct {
+	Type  string `json:"type"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// writeSnapshot writes records to temporary file and atomically replaces snapshot with it,
+// so snapshot is never left partially written
+func writeSnapshot(path string, records iter.Seq2[*store.Record, error], options *options) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	if err := writeChunks(file, records, options); err != nil {
+		return errors.Join(err, file.Close(), os.Remove(file.Name()))
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.Join(err, os.Remove(file.Name()))
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return errors.Join(err, os.Remove(file.Name()))
+	}
+
+	return syncDir(filepath.Dir(path))
+}
+
+func writeChunks(file *os.File, records iter.Seq2[*store.Record, error], options *options) error {
+	writer := bufio.NewWriter(file)
+	if _, err := writer.Write(append(bytes.Clone(snapshotMagic), snapshotVersion, byte(options.encoding), byte(options.compression))); err != nil {
+		return err
+	}
+
+	body, err := newCompressor(writer, options.compression)
+	if err != nil {
+		return err
+	}
+
+	checksum := crc32.New(crcTable)
+	buffer := make([]byte, 0, 128)
+	for record, err := range records {
+		if err != nil {
+			return err
+		}
+
+		payload, err := encodeMetric(binary.AppendVarint(buffer[:0], unixNano(record.UpdatedAt)), record.Metric, options.encoding)
+		if err != nil {
+			return err
+		}
+
+		if err := writeChunk(body, payload); err != nil {
+			return err
+		}
+		checksum.Write(payload)
+		buffer = payload
+	}
+
+	if err := writeTrailer(body, checksum); err != nil {
+		return err
+	}
+
+	if err := body.Close(); err != nil {
+		return err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return err
+	}
+
+	return file.Sync()
+}
+
+func writeChunk(writer io.Writer, payload []byte) error {
+	length := binary.AppendUvarint(make([]byte, 0, binary.MaxVarintLen64), uint64(len(payload)))
+	if _, err := writer.Write(length); err != nil {
+		return err
+	}
+
+	_, err := writer.Write(payload)
+	return err
+}
+
+func writeTrailer(writer io.Writer, checksum hash.Hash32) error {
+	trailer := binary.AppendUvarint(nil, 0)
+	trailer = binary.LittleEndian.AppendUint32(trailer, checksum.Sum32())
+	_, err := writer.Write(trailer)
+
+	return err
+}
+
+// readSnapshot reads records from snapshot of any version. Missing snapshot is treated as empty.
+// Update time of records is zero if snapshot does not contain it
+func readSnapshot(path string, apply func(record *store.Record) error) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	magic, err := reader.Peek(len(snapshotMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	if !bytes.Equal(magic, snapshotMagic) {
+		return readLegacySnapshot(reader, apply)
+	}
+
+	header := make([]byte, len(snapshotMagic)+3)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return errors.Join(ErrCorruptedSnapshot, err)
+	}
+
+	version, encoding, compression := header[len(snapshotMagic)], Encoding(header[len(snapshotMagic)+1]), Compression(header[len(snapshotMagic)+2])
+	if version != snapshotVersion && version != snapshotVersionWithoutTime {
+		return newErrUnsupportedVersion(version)
+	}
+
+	body, err := newDecompressor(reader, compression)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	return readChunks(bufio.NewReader(body), version, encoding, apply)
+}
+
+func readChunks(reader *bufio.Reader, version byte, encoding Encoding, apply func(record *store.Record) error) error {
+	checksum := crc32.New(crcTable)
+	var payload []byte
+
+	for {
+		length, err := binary.ReadUvarint(reader)
+		if err != nil {
+			return errors.Join(ErrCorruptedSnapshot, err)
+		}
+
+		if length == 0 {
+			return readTrailer(reader, checksum)
+		}
+
+		if length > maxRecordSize {
+			return ErrCorruptedSnapshot
+		}
+
+		if uint64(cap(payload)) < length {
+			payload = make([]byte, length)
+		}
+		payload = payload[:length]
+		if _, err := io.ReadFull(reader, payload); err != nil {
+			return errors.Join(ErrCorruptedSnapshot, err)
+		}
+		checksum.Write(payload)
+
+		record := &store.Record{}
+		encoded := payload
+		if version != snapshotVersionWithoutTime {
+			updatedAt, size := binary.Varint(payload)
+			if size <= 0 {
+				return ErrCorruptedSnapshot
+			}
+			record.UpdatedAt, encoded = fromUnixNano(updatedAt), payload[size:]
+		}
+
+		if record.Metric, err = decodeMetric(encoded, encoding); err != nil {
+			return err
+		}
+
+		if err := apply(record); err != nil {
+			return err
+		}
+	}
+}
+
+func readTrailer(reader io.Reader, checksum hash.Hash32) error {
+	trailer := make([]byte, 4)
+	if _, err := io.ReadFull(reader, trailer); err != nil {
+		return errors.Join(ErrCorruptedSnapshot, err)
+	}
+
+	if binary.LittleEndian.Uint32(trailer) != checksum.Sum32() {
+		return ErrCorruptedSnapshot
+	}
+
+	return nil
+}
+
+// readLegacySnapshot reads NDJSON snapshot written before versioned format
+func readLegacySnapshot(reader io.Reader, apply func(record *store.Record) error) error {
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		metric, err := decodeMetric(scanner.Bytes(), EncodingJSON)
+		if err != nil {
+			return err
+		}
+
+		if err := apply(&store.Record{Metric: metric}); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
+
+func encodeMetric(buffer []byte, metric metric.Metric, encoding Encoding) ([]byte, error) {
+	switch encoding {
+	case EncodingJSON:
+		payload, err := json.Marshal(anonymousMetric{
+			Type:  metric.Type(),
+			Name:  metric.Name(),
+			Value: metric.StringValue(),
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return append(buffer, payload...), nil
+	case EncodingProtobuf:
+		request, err := transformer.TransformToGRPCSaveRequest(metric)
+		if err != nil {
+			return nil, err
+		}
+
+		return gproto.MarshalOptions{}.MarshalAppend(buffer, request)
+	default:
+		return nil, newErrUnknownEncoding(encoding.String())
+	}
+}
+
+func decodeMetric(payload []byte, encoding Encoding) (metric.Metric, error) {
+	switch encoding {
+	case EncodingJSON:
+		anonymousMetric := &anonymousMetric{}
+		if err := json.Unmarshal(payload, anonymousMetric); err != nil {
+			return nil, err
+		}
+
+		return factory.New(anonymousMetric.Type, anonymousMetric.Name, anonymousMetric.Value)
+	case EncodingProtobuf:
+		request := &proto.SaveMetricRequest{}
+		if err := gproto.Unmarshal(payload, request); err != nil {
+			return nil, err
+		}
+
+		return factory.NewFromGRPCRequest(request)
+	default:
+		return nil, newErrUnknownEncoding(encoding.String())
+	}
+}
+
+func newCompressor(writer io.Writer, compression Compression) (io.WriteCloser, error) {
+	switch compression {
+	case CompressionNone:
+		return nopWriteCloser{writer}, nil
+	case CompressionGzip:
+		return gzip.NewWriter(writer), nil
+	case CompressionZstd:
+		return zstd.NewWriter(writer)
+	default:
+		return nil, newErrUnknownCompression(compression.String())
+	}
+}
+
+func newDecompressor(reader io.Reader, compression Compression) (io.ReadCloser, error) {
+	switch compression {
+	case CompressionNone:
+		return io.NopCloser(reader), nil
+	case CompressionGzip:
+		return gzip.NewReader(reader)
+	case CompressionZstd:
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+	default:
+		return nil, newErrUnknownCompression(compression.String())
+	}
+}
+
+// unixNano converts update time to nanoseconds, zero time is converted to zero
+func unixNano(updatedAt time.Time) int64 {
+	if updatedAt.IsZero() {
+		return 0
+	}
+
+	return updatedAt.UnixNano()
+}
+
+func fromUnixNano(updatedAt int64) time.Time {
+	if updatedAt == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(0, updatedAt)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// syncDir persists rename in directory entry
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	if err := dir.Sync(); err != nil {
+		return errors.Join(err, dir.Close())
+	}
+
+	return dir.Close()
+}
@@ -0,0 +1,197 @@
+package dump
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"iter"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var snapshotMetrics = []metric.Metric{
+	gauge.New("m1", 123.321),
+	counter.New("m2", 123),
+	gauge.New("m3", 0.1+0.2),
+	counter.New("m4", -1),
+}
+
+// snapshotTime is update time of snapshot metrics
+var snapshotTime = time.Unix(0, 1760875200123456789)
+
+func seqOf(metrics []metric.Metric) iter.Seq2[*store.Record, error] {
+	return func(yield func(*store.Record, error) bool) {
+		for _, metric := range metrics {
+			if !yield(&store.Record{Metric: metric, UpdatedAt: snapshotTime}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func readAll(t *testing.T, filepath string) ([]metric.Metric, error) {
+	t.Helper()
+	records, err := readAllRecords(t, filepath)
+	metrics := []metric.Metric{}
+	for _, record := range records {
+		metrics = append(metrics, record.Metric)
+	}
+
+	return metrics, err
+}
+
+func readAllRecords(t *testing.T, filepath string) ([]*store.Record, error) {
+	t.Helper()
+	records := []*store.Record{}
+	err := readSnapshot(filepath, func(record *store.Record) error {
+		records = append(records, record)
+		return nil
+	})
+
+	return records, err
+}
+
+func TestSnapshot_roundTrip(t *testing.T) {
+	for _, encoding := range []Encoding{EncodingJSON, EncodingProtobuf} {
+		for _, compression := range []Compression{CompressionNone, CompressionGzip, CompressionZstd} {
+			t.Run(encoding.String()+"/"+compression.String(), func(t *testing.T) {
+				filepath := path.Join(t.TempDir(), "dump")
+				options := newOptions(WithEncoding(encoding), WithCompression(compression))
+				require.NoError(t, writeSnapshot(filepath, seqOf(snapshotMetrics), options))
+
+				got, err := readAllRecords(t, filepath)
+				require.NoError(t, err)
+				require.Len(t, got, len(snapshotMetrics))
+				for i, record := range got {
+					assert.Equal(t, snapshotMetrics[i], record.Metric)
+					assert.Equal(t, snapshotTime, record.UpdatedAt)
+				}
+
+				empty := path.Join(t.TempDir(), "empty")
+				require.NoError(t, writeSnapshot(empty, seqOf([]metric.Metric{}), options))
+				got, err = readAllRecords(t, empty)
+				require.NoError(t, err)
+				assert.Empty(t, got)
+			})
+		}
+	}
+}
+
+func TestSnapshot_writeFailed(t *testing.T) {
+	filepath := path.Join(t.TempDir(), "dump")
+	require.NoError(t, writeSnapshot(filepath, seqOf(snapshotMetrics), newOptions()))
+
+	failed := errors.New("failed")
+	metrics := func(yield func(*store.Record, error) bool) {
+		if yield(&store.Record{Metric: counter.New("m5", 1), UpdatedAt: snapshotTime}, nil) {
+			yield(nil, failed)
+		}
+	}
+	assert.ErrorIs(t, writeSnapshot(filepath, metrics, newOptions()), failed)
+
+	// previous snapshot is not replaced by partial one
+	got, err := readAll(t, filepath)
+	require.NoError(t, err)
+	assert.Equal(t, snapshotMetrics, got)
+}
+
+func TestSnapshot_read(t *testing.T) {
+	valid := path.Join(t.TempDir(), "dump")
+	require.NoError(t, writeSnapshot(valid, seqOf(snapshotMetrics), newOptions()))
+	data, err := os.ReadFile(valid)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		data    []byte
+		want    []metric.Metric
+		wantErr error
+	}{
+		{
+			name: "legacy",
+			data: []byte("{\"type\":\"gauge\",\"name\":\"m1\",\"value\":\"123.321\"}\n" +
+				"{\"type\":\"counter\",\"name\":\"m2\",\"value\":\"123\"}\n"),
+			want: snapshotMetrics[:2],
+		},
+		{
+			name: "version without update time",
+			data: func() []byte {
+				data := append(bytes.Clone(snapshotMagic), snapshotVersionWithoutTime, byte(EncodingJSON), byte(CompressionNone))
+				checksum := crc32.New(crcTable)
+				for _, payload := range []string{
+					`{"type":"gauge","name":"m1","value":"123.321"}`,
+					`{"type":"counter","name":"m2","value":"123"}`,
+				} {
+					data = binary.AppendUvarint(data, uint64(len(payload)))
+					data = append(data, payload...)
+					checksum.Write([]byte(payload))
+				}
+				data = binary.AppendUvarint(data, 0)
+				return binary.LittleEndian.AppendUint32(data, checksum.Sum32())
+			}(),
+			want: snapshotMetrics[:2],
+		},
+		{
+			name: "legacy empty",
+			data: []byte{},
+			want: []metric.Metric{},
+		},
+		{
+			name:    "truncated",
+			data:    data[:len(data)-10],
+			wantErr: ErrCorruptedSnapshot,
+		},
+		{
+			name: "checksum mismatch",
+			data: func() []byte {
+				corrupted := append([]byte{}, data...)
+				corrupted[len(corrupted)-1] ^= 0xff
+				return corrupted
+			}(),
+			wantErr: ErrCorruptedSnapshot,
+		},
+		{
+			name: "unsupported version",
+			data: func() []byte {
+				unsupported := append([]byte{}, data...)
+				unsupported[len(snapshotMagic)] = snapshotVersion + 1
+				return unsupported
+			}(),
+			wantErr: newErrUnsupportedVersion(snapshotVersion + 1),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filepath := path.Join(t.TempDir(), "dump")
+			require.NoError(t, os.WriteFile(filepath, tt.data, 0666))
+
+			got, err := readAll(t, filepath)
+			if tt.wantErr != nil {
+				if _, ok := tt.wantErr.(*UnsupportedVersionError); ok {
+					assert.Equal(t, tt.wantErr, err)
+				} else {
+					assert.ErrorIs(t, err, tt.wantErr)
+				}
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestSnapshot_readMissing(t *testing.T) {
+	got, err := readAll(t, path.Join(t.TempDir(), "missing"))
+	require.NoError(t, err)
+	assert.Empty(t, got)
+}
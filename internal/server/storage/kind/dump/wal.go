@@ -0,0 +1,295 @@
+package dump
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	saveOperation           = "save"
+	resetOperation          = "reset"
+	deleteOperation         = "delete"
+	deleteByPrefixOperation = "delete-prefix"
+	// revisionOperation carries head revision of decorated storage to new segment
+	revisionOperation = "revision"
+)
+
+// recordHeaderSize is uint32 payload length + uint32 payload checksum
+const recordHeaderSize = 8
+
+// maxRecordSize protects from huge allocations when length is corrupted
+const maxRecordSize = 1 << 20
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+var ErrCorruptedRecord = errors.New("wal record is corrupted")
+
+type walRecord struct {
+	Operation string `json:"op"`
+	Type      string `json:"type,omitempty"`
+	Name      string `json:"name,omitempty"`
+	Value     string `json:"value,omitempty"`
+	// UpdatedAt is update time of saved metric in unix nanoseconds
+	UpdatedAt int64 `json:"at,omitempty"`
+	// Revision is head revision of decorated storage, it is set by revision records if storage has change feed
+	Revision uint64 `json:"rev,omitempty"`
+}
+
+// wal is append-only log of save operations split into numbered segments.
+// New segment is started on every rotation, so segments could be removed after snapshot
+type wal struct {
+	path   string
+	file   *os.File
+	seq    uint64
+	size   int64
+	sync   bool
+	buffer *bytes.Buffer
+}
+
+func openWAL(path string, sync bool) (*wal, error) {
+	segments, err := listSegments(path)
+	if err != nil {
+		return nil, err
+	}
+
+	seq := uint64(1)
+	if len(segments) > 0 {
+		seq = segments[len(segments)-1] + 1
+	}
+
+	file, err := openFile(segmentPath(path, seq), os.O_WRONLY|os.O_APPEND|os.O_CREATE)
+	if err != nil {
+		return nil, err
+	}
+
+	return &wal{
+		path:   path,
+		file:   file,
+		seq:    seq,
+		sync:   sync,
+		buffer: &bytes.Buffer{},
+	}, nil
+}
+
+// append records to current segment with one write call
+func (wal *wal) append(records ...walRecord) error {
+	wal.buffer.Reset()
+	for _, record := range records {
+		if err := encodeRecord(wal.buffer, record); err != nil {
+			return err
+		}
+	}
+
+	written, err := wal.file.Write(wal.buffer.Bytes())
+	wal.size += int64(written)
+	if err != nil {
+		return err
+	}
+
+	if wal.sync {
+		return wal.file.Sync()
+	}
+
+	return nil
+}
+
+// rotate closes current segment and starts new one. Returns seq of closed segment
+func (wal *wal) rotate() (uint64, error) {
+	file, err := openFile(segmentPath(wal.path, wal.seq+1), os.O_WRONLY|os.O_APPEND|os.O_CREATE)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := wal.close(); err != nil {
+		return 0, errors.Join(err, file.Close())
+	}
+
+	previous := wal.seq
+	wal.file = file
+	wal.seq++
+	wal.size = 0
+
+	return previous, nil
+}
+
+// removeUpTo removes all segments with seq less or equal than specified
+func (wal *wal) removeUpTo(seq uint64) error {
+	segments, err := listSegments(wal.path)
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		if segment > seq {
+			break
+		}
+
+		if err := os.Remove(segmentPath(wal.path, segment)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (wal *wal) close() error {
+	if err := wal.file.Sync(); err != nil {
+		return errors.Join(err, wal.file.Close())
+	}
+
+	return wal.file.Close()
+}
+
+// replayWAL reads all segments in order. Corrupted tail of the last written segment is
+// treated as torn write and truncated, corruption in other segments is an error
+func replayWAL(path string, apply func(record walRecord) error) error {
+	segments, err := listSegments(path)
+	if err != nil {
+		return err
+	}
+
+	for i, segment := range segments {
+		file, err := os.OpenFile(segmentPath(path, segment), os.O_RDWR, 0)
+		if err != nil {
+			return err
+		}
+
+		valid, err := readRecords(file, apply)
+		if errors.Is(err, ErrCorruptedRecord) {
+			var empty bool
+			if empty, err = segmentsEmpty(path, segments[i+1:]); err == nil {
+				if empty {
+					err = file.Truncate(valid)
+				} else {
+					err = fmt.Errorf("segment %d: %w", segment, ErrCorruptedRecord)
+				}
+			}
+		}
+
+		if err != nil {
+			return errors.Join(err, file.Close())
+		}
+
+		if err := file.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func segmentsEmpty(path string, segments []uint64) (bool, error) {
+	for _, segment := range segments {
+		info, err := os.Stat(segmentPath(path, segment))
+		if err != nil {
+			return false, err
+		}
+
+		if info.Size() > 0 {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func encodeRecord(buffer *bytes.Buffer, record walRecord) error {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	header := make([]byte, recordHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(header[4:8], crc32.Checksum(payload, crcTable))
+	buffer.Write(header)
+	buffer.Write(payload)
+
+	return nil
+}
+
+// readRecords reads records until EOF and returns size of valid part of reader
+func readRecords(reader io.Reader, apply func(record walRecord) error) (int64, error) {
+	buffered := bufio.NewReader(reader)
+	header := make([]byte, recordHeaderSize)
+	var valid int64
+
+	for {
+		if _, err := io.ReadFull(buffered, header); err != nil {
+			if errors.Is(err, io.EOF) {
+				return valid, nil
+			}
+			if errors.Is(err, io.ErrUnexpectedEOF) {
+				return valid, ErrCorruptedRecord
+			}
+
+			return valid, err
+		}
+
+		length := binary.LittleEndian.Uint32(header[0:4])
+		if length > maxRecordSize {
+			return valid, ErrCorruptedRecord
+		}
+
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(buffered, payload); err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				return valid, ErrCorruptedRecord
+			}
+
+			return valid, err
+		}
+
+		if crc32.Checksum(payload, crcTable) != binary.LittleEndian.Uint32(header[4:8]) {
+			return valid, ErrCorruptedRecord
+		}
+
+		record := walRecord{}
+		if err := json.Unmarshal(payload, &record); err != nil {
+			return valid, errors.Join(ErrCorruptedRecord, err)
+		}
+
+		if err := apply(record); err != nil {
+			return valid, err
+		}
+
+		valid += int64(recordHeaderSize + length)
+	}
+}
+
+func segmentPath(path string, seq uint64) string {
+	return fmt.Sprintf("%s.wal.%d", path, seq)
+}
+
+func listSegments(path string) ([]uint64, error) {
+	matches, err := filepath.Glob(filepath.Join(filepath.Dir(path), filepath.Base(path)+".wal.*"))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(path) + ".wal."
+	segments := make([]uint64, 0, len(matches))
+	for _, match := range matches {
+		seq, err := strconv.ParseUint(strings.TrimPrefix(filepath.Base(match), prefix), 10, 64)
+		if err != nil {
+			// not a segment
+			continue
+		}
+
+		segments = append(segments, seq)
+	}
+	slices.Sort(segments)
+
+	return segments, nil
+}
@@ -0,0 +1,298 @@
+package dump
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/m1khal3v/gometheus/pkg/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_readRecords(t *testing.T) {
+	records := []walRecord{
+		{Operation: saveOperation, Type: "gauge", Name: "m1", Value: "1.5"},
+		{Operation: resetOperation},
+		{Operation: saveOperation, Type: "counter", Name: "m2", Value: "10"},
+	}
+	buffer := &bytes.Buffer{}
+	for _, record := range records {
+		require.NoError(t, encodeRecord(buffer, record))
+	}
+	encoded := buffer.Bytes()
+	first := &bytes.Buffer{}
+	require.NoError(t, encodeRecord(first, records[0]))
+	firstSize := int64(first.Len())
+
+	tests := []struct {
+		name      string
+		data      []byte
+		want      []walRecord
+		wantValid int64
+		wantErr   error
+	}{
+		{
+			name:      "empty",
+			data:      []byte{},
+			want:      []walRecord{},
+			wantValid: 0,
+		},
+		{
+			name:      "valid",
+			data:      encoded,
+			want:      records,
+			wantValid: int64(len(encoded)),
+		},
+		{
+			name:      "torn header",
+			data:      encoded[:firstSize+3],
+			want:      records[:1],
+			wantValid: firstSize,
+			wantErr:   ErrCorruptedRecord,
+		},
+		{
+			name:      "torn payload",
+			data:      encoded[:firstSize+recordHeaderSize+1],
+			want:      records[:1],
+			wantValid: firstSize,
+			wantErr:   ErrCorruptedRecord,
+		},
+		{
+			name: "checksum mismatch",
+			data: func() []byte {
+				data := bytes.Clone(encoded)
+				data[firstSize+recordHeaderSize] ^= 0xff
+				return data
+			}(),
+			want:      records[:1],
+			wantValid: firstSize,
+			wantErr:   ErrCorruptedRecord,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []walRecord{}
+			valid, err := readRecords(bytes.NewReader(tt.data), func(record walRecord) error {
+				got = append(got, record)
+				return nil
+			})
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+			assert.Equal(t, tt.wantValid, valid)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestWAL_rotate(t *testing.T) {
+	filepath := path.Join(t.TempDir(), "dump.json")
+	wal, err := openWAL(filepath, true)
+	require.NoError(t, err)
+	require.NoError(t, wal.append(walRecord{Operation: resetOperation}))
+
+	previous, err := wal.rotate()
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), previous)
+	assert.Equal(t, int64(0), wal.size)
+
+	segments, err := listSegments(filepath)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{1, 2}, segments)
+
+	require.NoError(t, wal.removeUpTo(previous))
+	segments, err = listSegments(filepath)
+	require.NoError(t, err)
+	assert.Equal(t, []uint64{2}, segments)
+	require.NoError(t, wal.close())
+
+	// new process continues numbering
+	wal, err = openWAL(filepath, true)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), wal.seq)
+	require.NoError(t, wal.close())
+}
+
+func TestStorage_restoreFromWAL(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, decorator *Storage)
+		// corrupt is called after decorator is abandoned without Close (crash)
+		corrupt func(t *testing.T, filepath string)
+		want    []metric.Metric
+		wantErr error
+	}{
+		{
+			name: "log without snapshot",
+			prepare: func(t *testing.T, decorator *Storage) {
+				ctx := context.Background()
+				require.NoError(t, decorator.Save(ctx, gauge.New("m1", 1.5)))
+				require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{
+					counter.New("m2", 10),
+					counter.New("m3", 20),
+				}))
+				require.NoError(t, decorator.Save(ctx, counter.New("m2", 15)))
+			},
+			want: []metric.Metric{
+				gauge.New("m1", 1.5),
+				counter.New("m2", 15),
+				counter.New("m3", 20),
+			},
+		},
+		{
+			name: "log after snapshot",
+			prepare: func(t *testing.T, decorator *Storage) {
+				ctx := context.Background()
+				require.NoError(t, decorator.Save(ctx, gauge.New("m1", 1.5)))
+				require.NoError(t, decorator.Save(ctx, counter.New("m2", 10)))
+				require.NoError(t, decorator.dump(ctx))
+				require.NoError(t, decorator.Save(ctx, counter.New("m2", 15)))
+			},
+			want: []metric.Metric{
+				gauge.New("m1", 1.5),
+				counter.New("m2", 15),
+			},
+		},
+		{
+			name: "reset in log",
+			prepare: func(t *testing.T, decorator *Storage) {
+				ctx := context.Background()
+				require.NoError(t, decorator.Save(ctx, gauge.New("m1", 1.5)))
+				require.NoError(t, decorator.dump(ctx))
+				require.NoError(t, decorator.Reset(ctx))
+				require.NoError(t, decorator.Save(ctx, counter.New("m2", 10)))
+			},
+			want: []metric.Metric{
+				counter.New("m2", 10),
+			},
+		},
+		{
+			name: "torn tail",
+			prepare: func(t *testing.T, decorator *Storage) {
+				ctx := context.Background()
+				require.NoError(t, decorator.Save(ctx, gauge.New("m1", 1.5)))
+				require.NoError(t, decorator.Save(ctx, counter.New("m2", 10)))
+			},
+			corrupt: func(t *testing.T, filepath string) {
+				segment := segmentPath(filepath, 1)
+				info, err := os.Stat(segment)
+				require.NoError(t, err)
+				require.NoError(t, os.Truncate(segment, info.Size()-2))
+			},
+			want: []metric.Metric{
+				gauge.New("m1", 1.5),
+			},
+		},
+		{
+			name: "corrupted segment before last",
+			prepare: func(t *testing.T, decorator *Storage) {
+				ctx := context.Background()
+				require.NoError(t, decorator.Save(ctx, gauge.New("m1", 1.5)))
+				_, err := decorator.wal.rotate()
+				require.NoError(t, err)
+				require.NoError(t, decorator.Save(ctx, counter.New("m2", 10)))
+			},
+			corrupt: func(t *testing.T, filepath string) {
+				segment := segmentPath(filepath, 1)
+				info, err := os.Stat(segment)
+				require.NoError(t, err)
+				require.NoError(t, os.Truncate(segment, info.Size()-2))
+			},
+			wantErr: ErrCorruptedRecord,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			filepath := path.Join(t.TempDir(), "dump.json")
+
+			decorator, err := New(ctx, memory.New(), filepath, 0, false)
+			require.NoError(t, err)
+			tt.prepare(t, dumpOf(decorator))
+			require.NoError(t, dumpOf(decorator).wal.close())
+			if tt.corrupt != nil {
+				tt.corrupt(t, filepath)
+			}
+
+			restored, err := New(ctx, memory.New(), filepath, 0, true)
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			seq, err := restored.GetAll(ctx)
+			require.NoError(t, err)
+			all, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, all)
+
+			// torn tail is truncated, so the next restore sees the same state
+			require.NoError(t, restored.Close(ctx))
+			again, err := New(ctx, memory.New(), filepath, 0, true)
+			require.NoError(t, err)
+			seq, err = again.GetAll(ctx)
+			require.NoError(t, err)
+			all, err = slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, all)
+		})
+	}
+}
+
+func TestStorage_restoreDeletesFromWAL(t *testing.T) {
+	tests := []struct {
+		name string
+		mode RestoreMode
+		want []metric.Metric
+	}{
+		{
+			name: "replace",
+			mode: RestoreReplace,
+			want: []metric.Metric{gauge.New("m2", 1.5)},
+		},
+		{
+			name: "merge keeps existing metrics",
+			mode: RestoreMergeKeepNewer,
+			want: []metric.Metric{counter.New("m1", 7), gauge.New("m2", 1.5)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			filepath := path.Join(t.TempDir(), "dump")
+
+			decorator, err := New(ctx, memory.New(), filepath, 0, false)
+			require.NoError(t, err)
+			require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{
+				counter.New("m1", 1),
+				gauge.New("m2", 1.5),
+				counter.New("cpu_user", 2),
+				counter.New("cpu_system", 3),
+			}))
+			require.NoError(t, decorator.Delete(ctx, "m1"))
+			require.NoError(t, decorator.DeleteByPrefix(ctx, "cpu_"))
+			require.NoError(t, dumpOf(decorator).wal.close())
+
+			storage := memory.New()
+			require.NoError(t, storage.Save(ctx, counter.New("m1", 7)))
+			restored, err := New(ctx, storage, filepath, 0, true, WithRestoreMode(tt.mode))
+			require.NoError(t, err)
+
+			seq, err := restored.GetAll(ctx)
+			require.NoError(t, err)
+			all, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, all)
+			require.NoError(t, restored.Close(ctx))
+		})
+	}
+}
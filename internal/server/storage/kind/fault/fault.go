@@ -0,0 +1,350 @@
+// Package fault
+// contains storage decorator which injects latency and errors for resilience testing.
+// It must not be used in production
+package fault
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+)
+
+// ErrInjected is wrapped by every injected error
+var ErrInjected = errors.New("injected fault")
+
+type TransientError struct {
+	Operation Operation
+}
+
+func (err TransientError) Error() string {
+	return fmt.Sprintf("transient fault injected into %s", err.Operation)
+}
+
+func (err TransientError) Unwrap() []error {
+	return []error{ErrInjected, store.ErrTransient}
+}
+
+func newErrTransient(operation Operation) error {
+	return &TransientError{
+		Operation: operation,
+	}
+}
+
+type PermanentError struct {
+	Operation Operation
+}
+
+func (err PermanentError) Error() string {
+	return fmt.Sprintf("permanent fault injected into %s", err.Operation)
+}
+
+func (err PermanentError) Unwrap() error {
+	return ErrInjected
+}
+
+func newErrPermanent(operation Operation) error {
+	return &PermanentError{
+		Operation: operation,
+	}
+}
+
+type Storage struct {
+	storage   store.Storage
+	schedules []*schedule
+}
+
+// IncrementingStorage decorates storage which increments counters atomically, increments are forwarded to it
+type IncrementingStorage struct {
+	*Storage
+	incrementer store.CounterIncrementer
+}
+
+// New decorates storage with rules, all matched and due rules are applied in order before operation.
+// Latency is applied first, the first injected error fails operation.
+// IncrementingStorage is returned if storage implements storage.CounterIncrementer
+func New(storage store.Storage, rules ...Rule) store.Storage {
+	if storage == nil {
+		panic("Decorated storage cannot be nil")
+	}
+
+	schedules := make([]*schedule, 0, len(rules))
+	for _, rule := range rules {
+		schedules = append(schedules, &schedule{Rule: rule})
+	}
+
+	decorator := &Storage{
+		storage:   storage,
+		schedules: schedules,
+	}
+	if incrementer, ok := storage.(store.CounterIncrementer); ok {
+		return &IncrementingStorage{Storage: decorator, incrementer: incrementer}
+	}
+
+	return decorator
+}
+
+func (storage *Storage) Save(ctx context.Context, metric metric.Metric) error {
+	if err := storage.inject(ctx, SaveOperation); err != nil {
+		return err
+	}
+
+	return storage.storage.Save(ctx, metric)
+}
+
+func (storage *Storage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+	if err := storage.inject(ctx, SaveBatchOperation); err != nil {
+		return err
+	}
+
+	return storage.storage.SaveBatch(ctx, metrics)
+}
+
+func (storage *Storage) SaveRecords(ctx context.Context, records []*store.Record) error {
+	if err := storage.inject(ctx, SaveRecordsOperation); err != nil {
+		return err
+	}
+
+	return store.SaveRecords(ctx, storage.storage, records)
+}
+
+// WriteRecords is injected with SaveRecords rules, it is the same write returning revisions
+func (storage *Storage) WriteRecords(ctx context.Context, records []*store.Record) ([]*store.Record, error) {
+	if err := storage.inject(ctx, SaveRecordsOperation); err != nil {
+		return nil, err
+	}
+
+	return store.WriteRecords(ctx, storage.storage, records)
+}
+
+func (storage *IncrementingStorage) IncrementCounter(ctx context.Context, name string, delta int64) (int64, error) {
+	if err := storage.inject(ctx, IncrementCounterOperation); err != nil {
+		return 0, err
+	}
+
+	return storage.incrementer.IncrementCounter(ctx, name, delta)
+}
+
+func (storage *IncrementingStorage) SaveBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]metric.Metric, error) {
+	if err := storage.inject(ctx, SaveBatchIncrementingOperation); err != nil {
+		return nil, err
+	}
+
+	return storage.incrementer.SaveBatchIncrementing(ctx, metrics)
+}
+
+// WriteBatchIncrementing is injected with SaveBatchIncrementing rules, it is the same write returning revisions
+func (storage *Storage) WriteBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]*store.Record, error) {
+	if err := storage.inject(ctx, SaveBatchIncrementingOperation); err != nil {
+		return nil, err
+	}
+
+	return store.WriteBatchIncrementing(ctx, storage.storage, metrics)
+}
+
+func (storage *Storage) Get(ctx context.Context, name string) (metric.Metric, error) {
+	if err := storage.inject(ctx, GetOperation); err != nil {
+		return nil, err
+	}
+
+	return storage.storage.Get(ctx, name)
+}
+
+func (storage *Storage) GetRecord(ctx context.Context, name string) (*store.Record, error) {
+	if err := storage.inject(ctx, GetRecordOperation); err != nil {
+		return nil, err
+	}
+
+	return storage.storage.GetRecord(ctx, name)
+}
+
+func (storage *Storage) GetAll(ctx context.Context) (iter.Seq2[metric.Metric, error], error) {
+	if err := storage.inject(ctx, GetAllOperation); err != nil {
+		return nil, err
+	}
+
+	seq, err := storage.storage.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if after, ok := storage.partial(GetAllOperation); ok {
+		return interrupt(seq, after, newErrTransient(GetAllOperation)), nil
+	}
+
+	return seq, nil
+}
+
+func (storage *Storage) GetAllRecords(ctx context.Context) (iter.Seq2[*store.Record, error], error) {
+	if err := storage.inject(ctx, GetAllRecordsOperation); err != nil {
+		return nil, err
+	}
+
+	seq, err := storage.storage.GetAllRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if after, ok := storage.partial(GetAllRecordsOperation); ok {
+		return interrupt(seq, after, newErrTransient(GetAllRecordsOperation)), nil
+	}
+
+	return seq, nil
+}
+
+// GetFiltered keeps filter pushdown of decorated storage
+func (storage *Storage) GetFiltered(ctx context.Context, filter store.Filter) (iter.Seq2[*store.Record, error], error) {
+	if err := storage.inject(ctx, GetFilteredOperation); err != nil {
+		return nil, err
+	}
+
+	seq, err := store.GetFiltered(ctx, storage.storage, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	if after, ok := storage.partial(GetFilteredOperation); ok {
+		return interrupt(seq, after, newErrTransient(GetFilteredOperation)), nil
+	}
+
+	return seq, nil
+}
+
+func (storage *Storage) GetChanges(ctx context.Context, since uint64) (iter.Seq2[*store.Record, error], uint64, error) {
+	if err := storage.inject(ctx, GetChangesOperation); err != nil {
+		return nil, 0, err
+	}
+
+	return store.GetChanges(ctx, storage.storage, since)
+}
+
+func (storage *Storage) Revision(ctx context.Context) (uint64, error) {
+	return store.Revision(ctx, storage.storage)
+}
+
+func (storage *Storage) AdvanceRevision(ctx context.Context, revision uint64) error {
+	return store.AdvanceRevision(ctx, storage.storage, revision)
+}
+
+func (storage *Storage) Delete(ctx context.Context, name string) error {
+	if err := storage.inject(ctx, DeleteOperation); err != nil {
+		return err
+	}
+
+	return storage.storage.Delete(ctx, name)
+}
+
+func (storage *Storage) DeleteStale(ctx context.Context, name string, cutoff time.Time) (bool, error) {
+	if err := storage.inject(ctx, DeleteStaleOperation); err != nil {
+		return false, err
+	}
+
+	return store.DeleteStale(ctx, storage.storage, name, cutoff)
+}
+
+func (storage *Storage) DeleteByPrefix(ctx context.Context, prefix string) error {
+	if err := storage.inject(ctx, DeleteByPrefixOperation); err != nil {
+		return err
+	}
+
+	return storage.storage.DeleteByPrefix(ctx, prefix)
+}
+
+func (storage *Storage) Ping(ctx context.Context) error {
+	if err := storage.inject(ctx, PingOperation); err != nil {
+		return err
+	}
+
+	return storage.storage.Ping(ctx)
+}
+
+func (storage *Storage) Reset(ctx context.Context) error {
+	if err := storage.inject(ctx, ResetOperation); err != nil {
+		return err
+	}
+
+	return storage.storage.Reset(ctx)
+}
+
+func (storage *Storage) Close(ctx context.Context) error {
+	if err := storage.inject(ctx, CloseOperation); err != nil {
+		return err
+	}
+
+	return storage.storage.Close(ctx)
+}
+
+func (storage *Storage) Unwrap() store.Storage {
+	return storage.storage
+}
+
+// inject applies latency and error rules due for operation
+func (storage *Storage) inject(ctx context.Context, operation Operation) error {
+	var latency time.Duration
+	var err error
+	for _, schedule := range storage.schedules {
+		if schedule.Fault == Partial || !schedule.matches(operation) || !schedule.due() {
+			continue
+		}
+
+		switch schedule.Fault {
+		case Latency:
+			latency += schedule.Latency
+		case Transient:
+			if err == nil {
+				err = newErrTransient(operation)
+			}
+		case Permanent:
+			if err == nil {
+				err = newErrPermanent(operation)
+			}
+		}
+	}
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+
+	return err
+}
+
+// partial returns count of items yielded before iterator of operation is interrupted
+func (storage *Storage) partial(operation Operation) (int, bool) {
+	for _, schedule := range storage.schedules {
+		if schedule.Fault == Partial && schedule.matches(operation) && schedule.due() {
+			return schedule.After, true
+		}
+	}
+
+	return 0, false
+}
+
+// interrupt yields error instead of item after count of items
+func interrupt[T any](seq iter.Seq2[T, error], after int, err error) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		yielded := 0
+		for item, itemErr := range seq {
+			if yielded == after {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			if !yield(item, itemErr) {
+				return
+			}
+			yielded++
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package fault
+
+import (
+	"context"
+	"errors"
+	"iter"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/sqlite"
+	"github.com/m1khal3v/gometheus/internal/server/storage/storagetest"
+	"github.com/m1khal3v/gometheus/pkg/retry"
+	"github.com/m1khal3v/gometheus/pkg/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return New(memory.New())
+	})
+}
+
+func TestStorage_withoutIncrementer(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		inner := sqlite.New(filepath.Join(t.TempDir(), "metrics.db"))
+		t.Cleanup(func() {
+			inner.Close(context.Background())
+		})
+
+		decorator := New(inner)
+		// increments are forwarded only to storage which increments counters atomically
+		require.IsType(t, &Storage{}, decorator)
+
+		return decorator
+	})
+}
+
+func TestNew(t *testing.T) {
+	assert.PanicsWithValue(t, "Decorated storage cannot be nil", func() {
+		New(nil)
+	})
+	assert.IsType(t, &IncrementingStorage{}, New(memory.New()))
+}
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		want    []Rule
+		wantErr bool
+	}{
+		{
+			name:  "empty",
+			rules: " ",
+		},
+		{
+			name:  "valid",
+			rules: "save:transient:every=3, *:latency=50ms:p=0.2,GetAll:partial=10,delete:permanent",
+			want: []Rule{
+				{Operation: SaveOperation, Fault: Transient, Every: 3},
+				{Operation: AnyOperation, Fault: Latency, Latency: 50 * time.Millisecond, Probability: 0.2},
+				{Operation: GetAllOperation, Fault: Partial, After: 10},
+				{Operation: DeleteOperation, Fault: Permanent},
+			},
+		},
+		{
+			name:    "unknown operation",
+			rules:   "update:transient",
+			wantErr: true,
+		},
+		{
+			name:    "unknown fault",
+			rules:   "save:slow",
+			wantErr: true,
+		},
+		{
+			name:    "latency without value",
+			rules:   "save:latency",
+			wantErr: true,
+		},
+		{
+			name:    "partial save",
+			rules:   "save:partial=1",
+			wantErr: true,
+		},
+		{
+			name:    "error with value",
+			rules:   "save:transient=1",
+			wantErr: true,
+		},
+		{
+			name:    "invalid probability",
+			rules:   "save:transient:p=2",
+			wantErr: true,
+		},
+		{
+			name:    "unknown schedule",
+			rules:   "save:transient:once",
+			wantErr: true,
+		},
+		{
+			name:    "no fault",
+			rules:   "save",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRules(tt.rules)
+			if tt.wantErr {
+				assert.ErrorAs(t, err, new(*InvalidRuleError))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStorage_every(t *testing.T) {
+	ctx := context.Background()
+	decorator := New(memory.New(), Rule{Operation: SaveOperation, Fault: Transient, Every: 3})
+
+	for i := 1; i <= 6; i++ {
+		err := decorator.Save(ctx, gauge.New("m1", float64(i)))
+		if i%3 != 0 {
+			assert.NoError(t, err)
+			continue
+		}
+
+		assert.ErrorIs(t, err, ErrInjected)
+		assert.ErrorIs(t, err, storage.ErrTransient)
+	}
+
+	// other operations are not affected
+	got, err := decorator.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, gauge.New("m1", 5), got)
+}
+
+func TestStorage_permanent(t *testing.T) {
+	ctx := context.Background()
+	decorator := New(memory.New(), Rule{Operation: AnyOperation, Fault: Permanent}).(*IncrementingStorage)
+
+	err := decorator.SaveBatch(ctx, []metric.Metric{counter.New("m1", 1)})
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.NotErrorIs(t, err, storage.ErrTransient)
+	assert.ErrorAs(t, err, new(*PermanentError))
+
+	_, err = decorator.IncrementCounter(ctx, "m1", 1)
+	assert.ErrorIs(t, err, ErrInjected)
+	assert.ErrorIs(t, decorator.Ping(ctx), ErrInjected)
+	assert.NoError(t, decorator.Unwrap().Ping(ctx))
+}
+
+func TestStorage_retried(t *testing.T) {
+	ctx := context.Background()
+	decorator := New(memory.New(), Rule{Operation: SaveOperation, Fault: Transient, Every: 2})
+	require.NoError(t, decorator.Save(ctx, counter.New("m1", 1)))
+
+	attempts := 0
+	err := retry.Retry(retry.RetryOptions{
+		BaseDelay:  time.Millisecond,
+		MaxDelay:   time.Millisecond,
+		Attempts:   2,
+		Multiplier: 2,
+	}, func() error {
+		attempts++
+		return decorator.Save(ctx, counter.New("m1", 2))
+	}, func(err error) bool {
+		return errors.Is(err, storage.ErrTransient)
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, 2, attempts)
+}
+
+func TestStorage_latency(t *testing.T) {
+	ctx := context.Background()
+	decorator := New(memory.New(), Rule{Operation: GetOperation, Fault: Latency, Latency: 50 * time.Millisecond})
+
+	started := time.Now()
+	_, err := decorator.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(started), 50*time.Millisecond)
+
+	decorator = New(memory.New(), Rule{Operation: GetOperation, Fault: Latency, Latency: time.Hour})
+	timeoutCtx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	_, err = decorator.Get(timeoutCtx, "m1")
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestStorage_partial(t *testing.T) {
+	ctx := context.Background()
+	decorator := New(memory.New(), Rule{Operation: AnyOperation, Fault: Partial, After: 2, Every: 2})
+	require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{
+		gauge.New("m1", 1),
+		gauge.New("m2", 2),
+		gauge.New("m3", 3),
+	}))
+
+	// the first stream is complete
+	seq, err := decorator.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+
+	records, err := decorator.GetAllRecords(ctx)
+	require.NoError(t, err)
+	count := 0
+	var streamErr error
+	for _, err := range records {
+		if err != nil {
+			streamErr = err
+			break
+		}
+		count++
+	}
+	assert.Equal(t, 2, count)
+	assert.ErrorIs(t, streamErr, storage.ErrTransient)
+	assert.ErrorAs(t, streamErr, new(*TransientError))
+}
+
+// filteringStorage counts filters pushed down to decorated storage
+type filteringStorage struct {
+	*memory.Storage
+	filters int
+}
+
+func (inner *filteringStorage) GetFiltered(ctx context.Context, filter storage.Filter) (iter.Seq2[*storage.Record, error], error) {
+	inner.filters++
+	return storage.GetFiltered(ctx, inner.Storage, filter)
+}
+
+func TestStorage_GetFiltered(t *testing.T) {
+	ctx := context.Background()
+	inner := &filteringStorage{Storage: memory.New()}
+	decorator := New(inner, Rule{Operation: GetFilteredOperation, Fault: Partial, After: 1, Every: 2})
+	require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{
+		gauge.New("m1", 1),
+		gauge.New("m2", 2),
+		gauge.New("other", 3),
+	}))
+
+	// filter is pushed down to decorated storage
+	seq, err := storage.GetFiltered(ctx, decorator, storage.Filter{Prefix: "m"})
+	require.NoError(t, err)
+	records, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.Len(t, records, 2)
+	assert.Equal(t, 1, inner.filters)
+
+	// the second stream is interrupted
+	seq, err = storage.GetFiltered(ctx, decorator, storage.Filter{Prefix: "m"})
+	require.NoError(t, err)
+	_, err = slice.FromSeq2(seq)
+	assert.ErrorIs(t, err, storage.ErrTransient)
+	assert.Equal(t, 2, inner.filters)
+}
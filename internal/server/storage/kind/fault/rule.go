@@ -0,0 +1,217 @@
+package fault
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Fault defines how operation misbehaves
+type Fault byte
+
+const (
+	// Latency delays operation
+	Latency Fault = iota
+	// Transient fails operation with error wrapping storage.ErrTransient
+	Transient
+	// Permanent fails operation with error which is not retryable
+	Permanent
+	// Partial interrupts GetAll, GetAllRecords and GetFiltered iterators with transient error
+	Partial
+)
+
+var faults = map[string]Fault{
+	"latency":   Latency,
+	"transient": Transient,
+	"permanent": Permanent,
+	"partial":   Partial,
+}
+
+// Operation is lowercase name of storage method
+type Operation string
+
+const (
+	AnyOperation              Operation = "*"
+	SaveOperation             Operation = "save"
+	SaveBatchOperation        Operation = "savebatch"
+	SaveRecordsOperation      Operation = "saverecords"
+	IncrementCounterOperation Operation = "incrementcounter"
+	// SaveBatchIncrementingOperation is batch save of manager with counter increments
+	SaveBatchIncrementingOperation Operation = "savebatchincrementing"
+	GetOperation                   Operation = "get"
+	GetRecordOperation             Operation = "getrecord"
+	GetAllOperation                Operation = "getall"
+	GetAllRecordsOperation         Operation = "getallrecords"
+	GetFilteredOperation           Operation = "getfiltered"
+	GetChangesOperation            Operation = "getchanges"
+	DeleteOperation                Operation = "delete"
+	DeleteStaleOperation           Operation = "deletestale"
+	DeleteByPrefixOperation        Operation = "deletebyprefix"
+	PingOperation                  Operation = "ping"
+	ResetOperation                 Operation = "reset"
+	CloseOperation                 Operation = "close"
+)
+
+var operations = map[Operation]struct{}{
+	AnyOperation:                   {},
+	SaveOperation:                  {},
+	SaveBatchOperation:             {},
+	SaveRecordsOperation:           {},
+	IncrementCounterOperation:      {},
+	SaveBatchIncrementingOperation: {},
+	GetOperation:                   {},
+	GetRecordOperation:             {},
+	GetAllOperation:                {},
+	GetAllRecordsOperation:         {},
+	GetFilteredOperation:           {},
+	GetChangesOperation:            {},
+	DeleteOperation:                {},
+	DeleteStaleOperation:           {},
+	DeleteByPrefixOperation:        {},
+	PingOperation:                  {},
+	ResetOperation:                 {},
+	CloseOperation:                 {},
+}
+
+type InvalidRuleError struct {
+	Rule string
+}
+
+func (err InvalidRuleError) Error() string {
+	return fmt.Sprintf("invalid fault rule '%s', expected 'operation:fault[=value][:every=N|:p=probability]'", err.Rule)
+}
+
+func newErrInvalidRule(rule string) error {
+	return &InvalidRuleError{
+		Rule: rule,
+	}
+}
+
+// Rule injects Fault into Operation according to schedule.
+// Rule without schedule (zero Every and Probability) is applied to every call
+type Rule struct {
+	Operation Operation
+	Fault     Fault
+	// Latency is delay of Latency fault
+	Latency time.Duration
+	// After is count of items yielded before iterator is interrupted by Partial fault
+	After int
+	// Every applies rule to every N-th call of operation
+	Every uint64
+	// Probability applies rule to random calls, it is used if Every is zero
+	Probability float64
+}
+
+// ParseRules parses comma separated rules, e.g.
+// "save:transient:every=3,*:latency=50ms:p=0.2,getall:partial=10"
+func ParseRules(rules string) ([]Rule, error) {
+	if strings.TrimSpace(rules) == "" {
+		return nil, nil
+	}
+
+	parsed := make([]Rule, 0, strings.Count(rules, ",")+1)
+	for _, rule := range strings.Split(rules, ",") {
+		parsedRule, err := parseRule(strings.TrimSpace(rule))
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", newErrInvalidRule(rule), err)
+		}
+
+		parsed = append(parsed, parsedRule)
+	}
+
+	return parsed, nil
+}
+
+func parseRule(rule string) (Rule, error) {
+	parts := strings.Split(rule, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return Rule{}, fmt.Errorf("unexpected count of parts %d", len(parts))
+	}
+
+	parsed := Rule{Operation: Operation(strings.ToLower(parts[0]))}
+	if _, ok := operations[parsed.Operation]; !ok {
+		return Rule{}, fmt.Errorf("unknown operation '%s'", parts[0])
+	}
+
+	name, value, hasValue := strings.Cut(parts[1], "=")
+	fault, ok := faults[name]
+	if !ok {
+		return Rule{}, fmt.Errorf("unknown fault '%s'", name)
+	}
+	parsed.Fault = fault
+
+	var err error
+	switch fault {
+	case Latency:
+		if !hasValue {
+			return Rule{}, fmt.Errorf("latency value is required")
+		}
+		if parsed.Latency, err = time.ParseDuration(value); err != nil {
+			return Rule{}, err
+		}
+	case Partial:
+		switch parsed.Operation {
+		case AnyOperation, GetAllOperation, GetAllRecordsOperation, GetFilteredOperation:
+		default:
+			return Rule{}, fmt.Errorf("partial fault is not applicable to '%s'", parsed.Operation)
+		}
+		if hasValue {
+			if parsed.After, err = strconv.Atoi(value); err != nil {
+				return Rule{}, err
+			}
+		}
+	default:
+		if hasValue {
+			return Rule{}, fmt.Errorf("fault '%s' has no value", name)
+		}
+	}
+
+	if len(parts) == 2 {
+		return parsed, nil
+	}
+
+	schedule, value, _ := strings.Cut(parts[2], "=")
+	switch schedule {
+	case "every":
+		if parsed.Every, err = strconv.ParseUint(value, 10, 64); err != nil {
+			return Rule{}, err
+		}
+	case "p":
+		if parsed.Probability, err = strconv.ParseFloat(value, 64); err != nil {
+			return Rule{}, err
+		}
+		if parsed.Probability <= 0 || parsed.Probability > 1 {
+			return Rule{}, fmt.Errorf("probability must be in (0, 1]")
+		}
+	default:
+		return Rule{}, fmt.Errorf("unknown schedule '%s'", schedule)
+	}
+
+	return parsed, nil
+}
+
+// schedule counts calls matched by rule
+type schedule struct {
+	Rule
+	calls atomic.Uint64
+}
+
+func (schedule *schedule) matches(operation Operation) bool {
+	return schedule.Operation == AnyOperation || schedule.Operation == operation
+}
+
+// due reports whether fault is injected into current call
+func (schedule *schedule) due() bool {
+	calls := schedule.calls.Add(1)
+	switch {
+	case schedule.Every > 0:
+		return calls%schedule.Every == 0
+	case schedule.Probability > 0:
+		return rand.Float64() < schedule.Probability
+	default:
+		return true
+	}
+}
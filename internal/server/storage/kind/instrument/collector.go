@@ -0,0 +1,184 @@
+package instrument
+
+import (
+	"bufio"
+	"cmp"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/logger"
+	"go.uber.org/zap"
+)
+
+// buckets are upper bounds of latency histogram in seconds
+var buckets = [...]float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+type key struct {
+	driver    string
+	operation string
+}
+
+// stats of one operation of one driver
+type stats struct {
+	calls   atomic.Uint64
+	errors  atomic.Uint64
+	retries atomic.Uint64
+	// durations counts calls per bucket, the last one is +Inf
+	durations [len(buckets) + 1]atomic.Uint64
+	sum       atomic.Int64
+}
+
+func (stats *stats) record(duration time.Duration, err error) {
+	stats.calls.Add(1)
+	if err != nil {
+		stats.errors.Add(1)
+	}
+
+	seconds := duration.Seconds()
+	bucket, _ := slices.BinarySearch(buckets[:], seconds)
+	stats.durations[bucket].Add(1)
+	stats.sum.Add(int64(duration))
+}
+
+// Sample is value of another component read on every write, e.g. stats of cache
+type Sample struct {
+	Name string
+	Help string
+	// Type is Prometheus type of sample, counter or gauge
+	Type  string
+	Value uint64
+}
+
+// Collector accumulates stats of instrumented storages and writes them in Prometheus text format
+type Collector struct {
+	mutex   *sync.RWMutex
+	stats   map[key]*stats
+	sources []func() []Sample
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		mutex: &sync.RWMutex{},
+		stats: map[key]*stats{},
+	}
+}
+
+func (collector *Collector) get(driver, operation string) *stats {
+	key := key{driver: driver, operation: operation}
+
+	collector.mutex.RLock()
+	found, ok := collector.stats[key]
+	collector.mutex.RUnlock()
+	if ok {
+		return found
+	}
+
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	if found, ok := collector.stats[key]; ok {
+		return found
+	}
+	created := &stats{}
+	collector.stats[key] = created
+
+	return created
+}
+
+// Register adds source of samples written after stats of storages
+func (collector *Collector) Register(source func() []Sample) {
+	collector.mutex.Lock()
+	defer collector.mutex.Unlock()
+
+	collector.sources = append(collector.sources, source)
+}
+
+type entry struct {
+	key
+	*stats
+}
+
+// WritePrometheus writes stats sorted by driver and operation
+func (collector *Collector) WritePrometheus(writer io.Writer) error {
+	collector.mutex.RLock()
+	entries := make([]entry, 0, len(collector.stats))
+	for key, stats := range collector.stats {
+		entries = append(entries, entry{key: key, stats: stats})
+	}
+	sources := slices.Clone(collector.sources)
+	collector.mutex.RUnlock()
+
+	slices.SortFunc(entries, func(a, b entry) int {
+		return cmp.Or(cmp.Compare(a.driver, b.driver), cmp.Compare(a.operation, b.operation))
+	})
+
+	buffered := bufio.NewWriter(writer)
+	counters := []struct {
+		name  string
+		help  string
+		value func(stats *stats) uint64
+	}{
+		{
+			name:  "gometheus_storage_operations_total",
+			help:  "Count of storage operations",
+			value: func(stats *stats) uint64 { return stats.calls.Load() },
+		},
+		{
+			name:  "gometheus_storage_errors_total",
+			help:  "Count of failed storage operations",
+			value: func(stats *stats) uint64 { return stats.errors.Load() },
+		},
+		{
+			name:  "gometheus_storage_retries_total",
+			help:  "Count of repeated attempts of storage operations",
+			value: func(stats *stats) uint64 { return stats.retries.Load() },
+		},
+	}
+	for _, counter := range counters {
+		fmt.Fprintf(buffered, "# HELP %s %s\n# TYPE %s counter\n", counter.name, counter.help, counter.name)
+		for _, entry := range entries {
+			fmt.Fprintf(buffered, "%s{%s} %d\n", counter.name, entry.labels(), counter.value(entry.stats))
+		}
+	}
+
+	const histogram = "gometheus_storage_operation_duration_seconds"
+	fmt.Fprintf(buffered, "# HELP %s Duration of storage operations\n# TYPE %s histogram\n", histogram, histogram)
+	for _, entry := range entries {
+		cumulative := uint64(0)
+		for i := range entry.durations {
+			cumulative += entry.durations[i].Load()
+			bound := "+Inf"
+			if i < len(buckets) {
+				bound = strconv.FormatFloat(buckets[i], 'g', -1, 64)
+			}
+			fmt.Fprintf(buffered, "%s_bucket{%s,le=\"%s\"} %d\n", histogram, entry.labels(), bound, cumulative)
+		}
+		fmt.Fprintf(buffered, "%s_sum{%s} %s\n", histogram, entry.labels(), strconv.FormatFloat(time.Duration(entry.sum.Load()).Seconds(), 'g', -1, 64))
+		fmt.Fprintf(buffered, "%s_count{%s} %d\n", histogram, entry.labels(), cumulative)
+	}
+
+	for _, source := range sources {
+		for _, sample := range source() {
+			fmt.Fprintf(buffered, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", sample.Name, sample.Help, sample.Name, sample.Type, sample.Name, sample.Value)
+		}
+	}
+
+	return buffered.Flush()
+}
+
+func (collector *Collector) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	writer.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := collector.WritePrometheus(writer); err != nil {
+		logger.Logger.Error("Failed to write storage metrics", zap.Error(err))
+	}
+}
+
+func (key key) labels() string {
+	return fmt.Sprintf("driver=%q,operation=%q", key.driver, key.operation)
+}
@@ -0,0 +1,283 @@
+// Package instrument
+// contains storage decorator which records count, errors, retries and latency of operations
+package instrument
+
+import (
+	"context"
+	"iter"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/pkg/retry"
+)
+
+type Storage struct {
+	storage   store.Storage
+	collector *Collector
+	driver    string
+}
+
+// IncrementingStorage decorates storage which increments counters atomically, increments are forwarded to it
+type IncrementingStorage struct {
+	*Storage
+	incrementer store.CounterIncrementer
+}
+
+// New decorates storage, stats are labeled by driver.
+// IncrementingStorage is returned if storage implements storage.CounterIncrementer
+func New(storage store.Storage, collector *Collector, driver string) store.Storage {
+	if storage == nil {
+		panic("Decorated storage cannot be nil")
+	}
+	if collector == nil {
+		panic("Collector cannot be nil")
+	}
+
+	decorator := &Storage{
+		storage:   storage,
+		collector: collector,
+		driver:    driver,
+	}
+	if incrementer, ok := storage.(store.CounterIncrementer); ok {
+		return &IncrementingStorage{Storage: decorator, incrementer: incrementer}
+	}
+
+	return decorator
+}
+
+// call measures one operation
+type call struct {
+	stats   *stats
+	started time.Time
+}
+
+// start returns context which counts retries of decorated storage
+func (storage *Storage) start(ctx context.Context, operation string) (context.Context, *call) {
+	stats := storage.collector.get(storage.driver, operation)
+	ctx = retry.ContextWithHook(ctx, func(uint64, error) {
+		stats.retries.Add(1)
+	})
+
+	return ctx, &call{stats: stats, started: time.Now()}
+}
+
+func (call *call) done(err error) {
+	call.stats.record(time.Since(call.started), err)
+}
+
+func (storage *Storage) Save(ctx context.Context, metric metric.Metric) error {
+	ctx, call := storage.start(ctx, "save")
+	err := storage.storage.Save(ctx, metric)
+	call.done(err)
+
+	return err
+}
+
+func (storage *Storage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+	ctx, call := storage.start(ctx, "savebatch")
+	err := storage.storage.SaveBatch(ctx, metrics)
+	call.done(err)
+
+	return err
+}
+
+func (storage *Storage) SaveRecords(ctx context.Context, records []*store.Record) error {
+	ctx, call := storage.start(ctx, "saverecords")
+	err := store.SaveRecords(ctx, storage.storage, records)
+	call.done(err)
+
+	return err
+}
+
+// WriteRecords is recorded as SaveRecords, it is the same write returning revisions
+func (storage *Storage) WriteRecords(ctx context.Context, records []*store.Record) ([]*store.Record, error) {
+	ctx, call := storage.start(ctx, "saverecords")
+	written, err := store.WriteRecords(ctx, storage.storage, records)
+	call.done(err)
+
+	return written, err
+}
+
+func (storage *IncrementingStorage) IncrementCounter(ctx context.Context, name string, delta int64) (int64, error) {
+	ctx, call := storage.start(ctx, "incrementcounter")
+	value, err := storage.incrementer.IncrementCounter(ctx, name, delta)
+	call.done(err)
+
+	return value, err
+}
+
+func (storage *IncrementingStorage) SaveBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]metric.Metric, error) {
+	ctx, call := storage.start(ctx, "savebatchincrementing")
+	saved, err := storage.incrementer.SaveBatchIncrementing(ctx, metrics)
+	call.done(err)
+
+	return saved, err
+}
+
+// WriteBatchIncrementing is recorded as SaveBatchIncrementing, it is the same write returning revisions
+func (storage *Storage) WriteBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]*store.Record, error) {
+	ctx, call := storage.start(ctx, "savebatchincrementing")
+	written, err := store.WriteBatchIncrementing(ctx, storage.storage, metrics)
+	call.done(err)
+
+	return written, err
+}
+
+func (storage *Storage) Get(ctx context.Context, name string) (metric.Metric, error) {
+	ctx, call := storage.start(ctx, "get")
+	metric, err := storage.storage.Get(ctx, name)
+	call.done(err)
+
+	return metric, err
+}
+
+func (storage *Storage) GetRecord(ctx context.Context, name string) (*store.Record, error) {
+	ctx, call := storage.start(ctx, "getrecord")
+	record, err := storage.storage.GetRecord(ctx, name)
+	call.done(err)
+
+	return record, err
+}
+
+// GetAll is recorded when iteration is finished, time spent by consumer of iterator is not counted
+func (storage *Storage) GetAll(ctx context.Context) (iter.Seq2[metric.Metric, error], error) {
+	ctx, call := storage.start(ctx, "getall")
+	seq, err := storage.storage.GetAll(ctx)
+	if err != nil {
+		call.done(err)
+		return nil, err
+	}
+
+	return measure(seq, call.stats, time.Since(call.started)), nil
+}
+
+// GetAllRecords is recorded when iteration is finished, time spent by consumer of iterator is not counted
+func (storage *Storage) GetAllRecords(ctx context.Context) (iter.Seq2[*store.Record, error], error) {
+	ctx, call := storage.start(ctx, "getallrecords")
+	seq, err := storage.storage.GetAllRecords(ctx)
+	if err != nil {
+		call.done(err)
+		return nil, err
+	}
+
+	return measure(seq, call.stats, time.Since(call.started)), nil
+}
+
+// GetFiltered is recorded when iteration is finished, time spent by consumer of iterator is not counted
+func (storage *Storage) GetFiltered(ctx context.Context, filter store.Filter) (iter.Seq2[*store.Record, error], error) {
+	ctx, call := storage.start(ctx, "getfiltered")
+	seq, err := store.GetFiltered(ctx, storage.storage, filter)
+	if err != nil {
+		call.done(err)
+		return nil, err
+	}
+
+	return measure(seq, call.stats, time.Since(call.started)), nil
+}
+
+// GetChanges is recorded when iteration is finished, time spent by consumer of iterator is not counted
+func (storage *Storage) GetChanges(ctx context.Context, since uint64) (iter.Seq2[*store.Record, error], uint64, error) {
+	ctx, call := storage.start(ctx, "getchanges")
+	seq, head, err := store.GetChanges(ctx, storage.storage, since)
+	if err != nil {
+		call.done(err)
+		return nil, 0, err
+	}
+
+	return measure(seq, call.stats, time.Since(call.started)), head, nil
+}
+
+func (storage *Storage) Revision(ctx context.Context) (uint64, error) {
+	ctx, call := storage.start(ctx, "revision")
+	revision, err := store.Revision(ctx, storage.storage)
+	call.done(err)
+
+	return revision, err
+}
+
+func (storage *Storage) AdvanceRevision(ctx context.Context, revision uint64) error {
+	ctx, call := storage.start(ctx, "advancerevision")
+	err := store.AdvanceRevision(ctx, storage.storage, revision)
+	call.done(err)
+
+	return err
+}
+
+func (storage *Storage) Delete(ctx context.Context, name string) error {
+	ctx, call := storage.start(ctx, "delete")
+	err := storage.storage.Delete(ctx, name)
+	call.done(err)
+
+	return err
+}
+
+func (storage *Storage) DeleteStale(ctx context.Context, name string, cutoff time.Time) (bool, error) {
+	ctx, call := storage.start(ctx, "deletestale")
+	deleted, err := store.DeleteStale(ctx, storage.storage, name, cutoff)
+	call.done(err)
+
+	return deleted, err
+}
+
+func (storage *Storage) DeleteByPrefix(ctx context.Context, prefix string) error {
+	ctx, call := storage.start(ctx, "deletebyprefix")
+	err := storage.storage.DeleteByPrefix(ctx, prefix)
+	call.done(err)
+
+	return err
+}
+
+func (storage *Storage) Ping(ctx context.Context) error {
+	ctx, call := storage.start(ctx, "ping")
+	err := storage.storage.Ping(ctx)
+	call.done(err)
+
+	return err
+}
+
+func (storage *Storage) Reset(ctx context.Context) error {
+	ctx, call := storage.start(ctx, "reset")
+	err := storage.storage.Reset(ctx)
+	call.done(err)
+
+	return err
+}
+
+func (storage *Storage) Close(ctx context.Context) error {
+	ctx, call := storage.start(ctx, "close")
+	err := storage.storage.Close(ctx)
+	call.done(err)
+
+	return err
+}
+
+func (storage *Storage) Unwrap() store.Storage {
+	return storage.storage
+}
+
+// measure records call when iteration is finished, the first error of iterator fails call.
+// Elapsed is time spent by GetAll before iteration
+func measure[T any](seq iter.Seq2[T, error], stats *stats, elapsed time.Duration) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		total := elapsed
+		var failure error
+		defer func() {
+			stats.record(total, failure)
+		}()
+
+		started := time.Now()
+		for item, err := range seq {
+			total += time.Since(started)
+			if err != nil && failure == nil {
+				failure = err
+			}
+
+			if !yield(item, err) {
+				return
+			}
+			started = time.Now()
+		}
+		total += time.Since(started)
+	}
+}
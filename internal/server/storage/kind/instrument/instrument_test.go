@@ -0,0 +1,188 @@
+package instrument
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/fault"
+	"github.com/m1khal3v/gometheus/internal/server/storage/kind/memory"
+	"github.com/m1khal3v/gometheus/internal/server/storage/storagetest"
+	"github.com/m1khal3v/gometheus/pkg/retry"
+	"github.com/m1khal3v/gometheus/pkg/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return New(memory.New(), NewCollector(), "memory")
+	})
+}
+
+func TestNew(t *testing.T) {
+	assert.PanicsWithValue(t, "Decorated storage cannot be nil", func() {
+		New(nil, NewCollector(), "memory")
+	})
+	assert.PanicsWithValue(t, "Collector cannot be nil", func() {
+		New(memory.New(), nil, "memory")
+	})
+	// increments are forwarded only to storage which increments counters atomically
+	assert.IsType(t, &IncrementingStorage{}, New(memory.New(), NewCollector(), "memory"))
+	assert.IsType(t, &Storage{}, New(&retryingStorage{Storage: memory.New()}, NewCollector(), "memory"))
+}
+
+// retryingStorage fails Save with retryable error the first time, as drivers do
+type retryingStorage struct {
+	storage.Storage
+	failed bool
+}
+
+func (retrying *retryingStorage) Save(ctx context.Context, metric metric.Metric) error {
+	return retry.Retry(retry.RetryOptions{
+		Attempts: 2,
+		Hook:     retry.HookFromContext(ctx),
+	}, func() error {
+		if !retrying.failed {
+			retrying.failed = true
+			return errors.New("busy")
+		}
+
+		return retrying.Storage.Save(ctx, metric)
+	}, nil)
+}
+
+func TestStorage_stats(t *testing.T) {
+	ctx := context.Background()
+	collector := NewCollector()
+	decorator := New(&retryingStorage{Storage: memory.New()}, collector, "memory")
+	require.NoError(t, decorator.Save(ctx, gauge.New("m1", 1)))
+	_, err := decorator.Get(ctx, "m1")
+	require.NoError(t, err)
+
+	faulty := New(fault.New(memory.New(), fault.Rule{Operation: fault.PingOperation, Fault: fault.Permanent}), collector, "faulty")
+	require.Error(t, faulty.Ping(ctx))
+	require.Error(t, faulty.Ping(ctx))
+
+	save := collector.get("memory", "save")
+	assert.Equal(t, uint64(1), save.calls.Load())
+	assert.Equal(t, uint64(0), save.errors.Load())
+	assert.Equal(t, uint64(1), save.retries.Load())
+	assert.Equal(t, uint64(1), collector.get("memory", "get").calls.Load())
+
+	ping := collector.get("faulty", "ping")
+	assert.Equal(t, uint64(2), ping.calls.Load())
+	assert.Equal(t, uint64(2), ping.errors.Load())
+}
+
+func TestStorage_GetAll(t *testing.T) {
+	ctx := context.Background()
+	collector := NewCollector()
+	decorator := New(memory.New(), collector, "memory")
+	require.NoError(t, decorator.SaveBatch(ctx, []metric.Metric{gauge.New("m1", 1), gauge.New("m2", 2)}))
+
+	seq, err := decorator.GetAll(ctx)
+	require.NoError(t, err)
+	// call is recorded when iteration is finished
+	assert.Equal(t, uint64(0), collector.get("memory", "getall").calls.Load())
+	_, err = slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), collector.get("memory", "getall").calls.Load())
+
+	// stopped iteration is recorded too
+	for range seq {
+		break
+	}
+	assert.Equal(t, uint64(2), collector.get("memory", "getall").calls.Load())
+
+	filtered, err := storage.GetFiltered(ctx, decorator, storage.Filter{Prefix: "m"})
+	require.NoError(t, err)
+	_, err = slice.FromSeq2(filtered)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1), collector.get("memory", "getfiltered").calls.Load())
+
+	partial := New(fault.New(memory.New(), fault.Rule{Operation: fault.AnyOperation, Fault: fault.Partial}), collector, "partial")
+	records, err := partial.GetAllRecords(ctx)
+	require.NoError(t, err)
+	_, err = slice.FromSeq2(records)
+	require.NoError(t, err, "empty stream cannot be interrupted")
+	require.NoError(t, partial.Save(ctx, gauge.New("m1", 1)))
+	records, err = partial.GetAllRecords(ctx)
+	require.NoError(t, err)
+	_, err = slice.FromSeq2(records)
+	require.Error(t, err)
+	assert.Equal(t, uint64(1), collector.get("partial", "getallrecords").errors.Load())
+}
+
+func TestCollector_WritePrometheus(t *testing.T) {
+	collector := NewCollector()
+	collector.get("pgx", "save").record(3*time.Millisecond, nil)
+	collector.get("pgx", "save").record(2*time.Second, errors.New("failed"))
+	collector.get("pgx", "save").retries.Add(4)
+	collector.get("memory", "get").record(10*time.Second, nil)
+
+	buffer := &bytes.Buffer{}
+	require.NoError(t, collector.WritePrometheus(buffer))
+	output := buffer.String()
+
+	for _, line := range []string{
+		"# TYPE gometheus_storage_operations_total counter",
+		`gometheus_storage_operations_total{driver="memory",operation="get"} 1`,
+		`gometheus_storage_operations_total{driver="pgx",operation="save"} 2`,
+		`gometheus_storage_errors_total{driver="pgx",operation="save"} 1`,
+		`gometheus_storage_retries_total{driver="pgx",operation="save"} 4`,
+		"# TYPE gometheus_storage_operation_duration_seconds histogram",
+		`gometheus_storage_operation_duration_seconds_bucket{driver="pgx",operation="save",le="0.0025"} 0`,
+		`gometheus_storage_operation_duration_seconds_bucket{driver="pgx",operation="save",le="0.005"} 1`,
+		`gometheus_storage_operation_duration_seconds_bucket{driver="pgx",operation="save",le="2.5"} 2`,
+		`gometheus_storage_operation_duration_seconds_bucket{driver="memory",operation="get",le="5"} 0`,
+		`gometheus_storage_operation_duration_seconds_bucket{driver="memory",operation="get",le="+Inf"} 1`,
+		`gometheus_storage_operation_duration_seconds_sum{driver="pgx",operation="save"} 2.003`,
+		`gometheus_storage_operation_duration_seconds_count{driver="pgx",operation="save"} 2`,
+	} {
+		assert.Contains(t, output, line+"\n")
+	}
+
+	// series are sorted by driver
+	assert.Less(t, strings.Index(output, `driver="memory"`), strings.Index(output, `driver="pgx"`))
+}
+
+func TestCollector_Register(t *testing.T) {
+	collector := NewCollector()
+	value := uint64(1)
+	collector.Register(func() []Sample {
+		return []Sample{{Name: "gometheus_cache_hits_total", Help: "Count of hits", Type: "counter", Value: value}}
+	})
+
+	// samples are read on every write
+	for _, want := range []uint64{1, 2} {
+		value = want
+		buffer := &bytes.Buffer{}
+		require.NoError(t, collector.WritePrometheus(buffer))
+		assert.Contains(t, buffer.String(), fmt.Sprintf(
+			"# HELP gometheus_cache_hits_total Count of hits\n# TYPE gometheus_cache_hits_total counter\ngometheus_cache_hits_total %d\n",
+			want,
+		))
+	}
+}
+
+func TestCollector_ServeHTTP(t *testing.T) {
+	collector := NewCollector()
+	collector.get("memory", "save").record(time.Millisecond, nil)
+
+	recorder := httptest.NewRecorder()
+	collector.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, recorder.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", recorder.Header().Get("Content-Type"))
+	assert.Contains(t, recorder.Body.String(), `gometheus_storage_operations_total{driver="memory",operation="save"} 1`)
+}
@@ -1,53 +1,177 @@
 // Package memory
-// contains in-memory storage implementation
+// contains in-memory storage implementation.
+// Metrics are distributed between shards with own locks, every slot publishes immutable state
+// with value, update time and revision by one atomic pointer, so readers do not lock slot and do not allocate.
+// Metrics returned by storage are shared, so they must not be modified.
+// Slots are updated under shard read lock and change feed reads shards under write lock,
+// so every save with revision up to head is visible to feed.
+// Deleted metric is kept as tombstone with revision of delete, so feed reports it, until the name is saved again
 package memory
 
 import (
+	"cmp"
 	"context"
+	"fmt"
+	"hash/maphash"
+	"iter"
+	"math"
+	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
 	store "github.com/m1khal3v/gometheus/internal/server/storage"
 	"github.com/m1khal3v/gometheus/pkg/generator"
 )
 
+// shardCount must be power of two
+const shardCount = 64
+
+type UnsupportedTypeError struct {
+	Type string
+}
+
+func (err UnsupportedTypeError) Error() string {
+	return fmt.Sprintf("metric type '%s' is not supported", err.Type)
+}
+
+func newErrUnsupportedType(metricType string) error {
+	return &UnsupportedTypeError{
+		Type: metricType,
+	}
+}
+
+// slot type is never changed, slot is replaced when metric type changes
+type slot struct {
+	metricType string
+	state      atomic.Pointer[state]
+}
+
+// state is replaced as a whole, so value is never paired with update time or revision of another update
+type state struct {
+	// metric points to counter or gauge of the same state, so it is allocated with state
+	metric  metric.Metric
+	counter counter.Metric
+	gauge   gauge.Metric
+	// unix nanoseconds of last update
+	updatedAt int64
+	// revision of last update
+	revision uint64
+	// deleted state is tombstone keeping the last value
+	deleted bool
+}
+
+type shard struct {
+	mutex *sync.RWMutex
+	slots map[string]*slot
+}
+
 type Storage struct {
-	metrics *sync.Map
-	mutex   *sync.Mutex
-	closed  bool
+	shards []shard
+	seed   maphash.Seed
+	mutex  *sync.Mutex
+	closed *atomic.Bool
+	// head revision
+	revision *atomic.Uint64
 }
 
 func New() *Storage {
+	shards := make([]shard, shardCount)
+	for i := range shards {
+		shards[i] = shard{
+			mutex: &sync.RWMutex{},
+			slots: map[string]*slot{},
+		}
+	}
+
 	return &Storage{
-		metrics: &sync.Map{},
-		mutex:   &sync.Mutex{},
-		closed:  false,
+		shards:   shards,
+		seed:     maphash.MakeSeed(),
+		mutex:    &sync.Mutex{},
+		closed:   &atomic.Bool{},
+		revision: &atomic.Uint64{},
 	}
 }
 
 func (storage *Storage) Get(ctx context.Context, name string) (metric.Metric, error) {
-	value, ok := storage.metrics.Load(name)
+	if err := storage.checkStorageClosed(); err != nil {
+		return nil, err
+	}
+
+	shard := storage.shard(name)
+	shard.mutex.RLock()
+	slot, ok := shard.slots[name]
+	shard.mutex.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+
+	state := slot.state.Load()
+	if state.deleted {
+		return nil, nil
+	}
+
+	return state.metric, nil
+}
+
+func (storage *Storage) GetRecord(ctx context.Context, name string) (*store.Record, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return nil, err
+	}
+
+	shard := storage.shard(name)
+	shard.mutex.RLock()
+	slot, ok := shard.slots[name]
+	shard.mutex.RUnlock()
 	if !ok {
 		return nil, nil
 	}
 
-	return value.(metric.Metric).Clone(), nil
+	state := slot.state.Load()
+	if state.deleted {
+		return nil, nil
+	}
+
+	return state.record(), nil
+}
+
+func (storage *Storage) GetAll(ctx context.Context) (iter.Seq2[metric.Metric, error], error) {
+	records, err := storage.GetAllRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.MetricsOf(records), nil
 }
 
-func (storage *Storage) GetAll(ctx context.Context) (<-chan metric.Metric, error) {
+// GetAllRecords copies records shard by shard, so shard is locked only while it is copied
+func (storage *Storage) GetAllRecords(ctx context.Context) (iter.Seq2[*store.Record, error], error) {
 	if err := storage.checkStorageClosed(); err != nil {
 		return nil, err
 	}
 
-	values := generator.NewFromSyncMapOnlyValueWithContext(
-		ctx,
-		storage.metrics,
-		func(value metric.Metric) metric.Metric {
-			return value.Clone()
-		},
-	)
+	next := 0
+	var page []*store.Record
 
-	return values, nil
+	return generator.NewSeq2FromFunctionWithContext(ctx, func() (*store.Record, bool, error) {
+		for len(page) == 0 {
+			if next == len(storage.shards) {
+				return nil, false, nil
+			}
+
+			page = storage.shards[next].records()
+			next++
+		}
+
+		record := page[0]
+		page = page[1:]
+
+		return record, true, nil
+	}, nil), nil
 }
 
 func (storage *Storage) Save(ctx context.Context, metric metric.Metric) error {
@@ -55,18 +179,197 @@ func (storage *Storage) Save(ctx context.Context, metric metric.Metric) error {
 		return err
 	}
 
-	storage.metrics.Store(metric.Name(), metric.Clone())
+	metricType, value, err := encode(metric)
+	if err != nil {
+		return err
+	}
+
+	storage.shard(metric.Name()).store(metric.Name(), metricType, value, time.Now().UnixNano(), storage.revision)
 
 	return nil
 }
 
 func (storage *Storage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+	return storage.SaveRecords(ctx, store.RecordsOf(metrics, time.Now()))
+}
+
+// SaveRecords saves all records or none of them if any metric type is not supported
+func (storage *Storage) SaveRecords(ctx context.Context, records []*store.Record) error {
+	_, err := storage.WriteRecords(ctx, records)
+
+	return err
+}
+
+// WriteRecords returns saved records with revisions, saved metrics are shared with storage and must not be modified
+func (storage *Storage) WriteRecords(ctx context.Context, records []*store.Record) ([]*store.Record, error) {
 	if err := storage.checkStorageClosed(); err != nil {
-		return err
+		return nil, err
+	}
+
+	for _, record := range records {
+		if _, _, err := encode(record.Metric); err != nil {
+			return nil, err
+		}
+	}
+
+	written := make([]*store.Record, 0, len(records))
+	for _, record := range records {
+		metricType, value, _ := encode(record.Metric)
+		state := storage.shard(record.Metric.Name()).store(record.Metric.Name(), metricType, value, record.UpdatedAt.UnixNano(), storage.revision)
+		written = append(written, state.record())
+	}
+
+	return written, nil
+}
+
+// IncrementCounter atomically adds delta to counter. Missing metric or metric
+// of another type is replaced by counter with delta value
+func (storage *Storage) IncrementCounter(ctx context.Context, name string, delta int64) (int64, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return 0, err
+	}
+
+	return storage.shard(name).increment(name, delta, storage.revision).counter.GetValue(), nil
+}
+
+// SaveBatchIncrementing applies all metrics or none of them if any metric type is not supported
+func (storage *Storage) SaveBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]metric.Metric, error) {
+	written, err := storage.WriteBatchIncrementing(ctx, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	saved := make([]metric.Metric, 0, len(written))
+	for _, record := range written {
+		saved = append(saved, record.Metric.Clone())
+	}
+
+	return saved, nil
+}
+
+// WriteBatchIncrementing returns saved records with revisions, saved metrics are shared with storage and must not be modified
+func (storage *Storage) WriteBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]*store.Record, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return nil, err
 	}
 
 	for _, metric := range metrics {
-		storage.metrics.Store(metric.Name(), metric.Clone())
+		if _, _, err := encode(metric); err != nil {
+			return nil, err
+		}
+	}
+
+	updatedAt := time.Now().UnixNano()
+	written := make([]*store.Record, 0, len(metrics))
+	for _, metric := range metrics {
+		var state *state
+		if delta, ok := metric.(*counter.Metric); ok {
+			state = storage.shard(metric.Name()).increment(metric.Name(), delta.GetValue(), storage.revision)
+		} else {
+			metricType, value, _ := encode(metric)
+			state = storage.shard(metric.Name()).store(metric.Name(), metricType, value, updatedAt, storage.revision)
+		}
+		written = append(written, state.record())
+	}
+
+	return written, nil
+}
+
+func (storage *Storage) Revision(ctx context.Context) (uint64, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return 0, err
+	}
+
+	return storage.revision.Load(), nil
+}
+
+// GetChanges copies changed records shard by shard and sorts them by revision
+func (storage *Storage) GetChanges(ctx context.Context, since uint64) (iter.Seq2[*store.Record, error], uint64, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return nil, 0, err
+	}
+
+	head := storage.revision.Load()
+	changes := make([]*store.Record, 0)
+	for i := range storage.shards {
+		changes = append(changes, storage.shards[i].changes(since, head)...)
+	}
+	slices.SortFunc(changes, func(a, b *store.Record) int {
+		return cmp.Or(cmp.Compare(a.Revision, b.Revision), cmp.Compare(a.Metric.Name(), b.Metric.Name()))
+	})
+
+	return func(yield func(*store.Record, error) bool) {
+		for _, record := range changes {
+			if !yield(record, nil) {
+				return
+			}
+		}
+	}, head, nil
+}
+
+func (storage *Storage) AdvanceRevision(ctx context.Context, revision uint64) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	raise(storage.revision, revision)
+
+	return nil
+}
+
+func (storage *Storage) Delete(ctx context.Context, name string) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	shard := storage.shard(name)
+	shard.mutex.Lock()
+	if slot, ok := shard.slots[name]; ok {
+		slot.delete(time.Now().UnixNano(), storage.revision)
+	}
+	shard.mutex.Unlock()
+
+	return nil
+}
+
+// DeleteStale checks update time under shard write lock, so slot could not be updated concurrently
+func (storage *Storage) DeleteStale(ctx context.Context, name string, cutoff time.Time) (bool, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return false, err
+	}
+
+	shard := storage.shard(name)
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	slot, ok := shard.slots[name]
+	if !ok {
+		return false, nil
+	}
+
+	state := slot.state.Load()
+	if state.deleted || state.updatedAt > cutoff.UnixNano() {
+		return false, nil
+	}
+
+	return slot.delete(time.Now().UnixNano(), storage.revision), nil
+}
+
+func (storage *Storage) DeleteByPrefix(ctx context.Context, prefix string) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	deletedAt := time.Now().UnixNano()
+	for i := range storage.shards {
+		shard := &storage.shards[i]
+		shard.mutex.Lock()
+		for name, slot := range shard.slots {
+			if strings.HasPrefix(name, prefix) {
+				slot.delete(deletedAt, storage.revision)
+			}
+		}
+		shard.mutex.Unlock()
 	}
 
 	return nil
@@ -80,32 +383,217 @@ func (storage *Storage) Close(ctx context.Context) error {
 	storage.mutex.Lock()
 	defer storage.mutex.Unlock()
 
-	if storage.closed {
+	if storage.closed.Load() {
 		return store.ErrStorageClosed
 	}
 
-	storage.closed = true
+	storage.closed.Store(true)
 	return nil
 }
 
+// Reset replaces all metrics by tombstones, so change feed reports them as deleted
 func (storage *Storage) Reset(ctx context.Context) error {
 	if err := storage.checkStorageClosed(); err != nil {
 		return err
 	}
 
-	storage.metrics.Range(func(key, value any) bool {
-		storage.metrics.Delete(key)
-
-		return true
-	})
+	deletedAt := time.Now().UnixNano()
+	for i := range storage.shards {
+		shard := &storage.shards[i]
+		shard.mutex.Lock()
+		for _, slot := range shard.slots {
+			slot.delete(deletedAt, storage.revision)
+		}
+		shard.mutex.Unlock()
+	}
 
 	return nil
 }
 
 func (storage *Storage) checkStorageClosed() error {
-	if storage.closed {
+	if storage.closed.Load() {
 		return store.ErrStorageClosed
 	}
 
 	return nil
 }
+
+func (storage *Storage) shard(name string) *shard {
+	return &storage.shards[maphash.String(storage.seed, name)&(shardCount-1)]
+}
+
+// store updates existing slot of the same type in place and replaces slot otherwise, tombstone is updated too.
+// Slot is updated while shard is locked, so update of slot removed by delete, reset or type change is not lost.
+// Revision is taken from head while shard is locked, so change feed waits for the update. Stored state is returned
+func (shard *shard) store(name, metricType string, value uint64, updatedAt int64, head *atomic.Uint64) *state {
+	shard.mutex.RLock()
+	current, ok := shard.slots[name]
+	if ok && current.metricType == metricType {
+		state := newState(name, metricType, value, updatedAt, head.Add(1))
+		current.store(state)
+		shard.mutex.RUnlock()
+		return state
+	}
+	shard.mutex.RUnlock()
+
+	created := &slot{metricType: metricType}
+	state := newState(name, metricType, value, updatedAt, 0)
+
+	shard.mutex.Lock()
+	// state is not published yet
+	state.revision = head.Add(1)
+	created.state.Store(state)
+	shard.slots[name] = created
+	shard.mutex.Unlock()
+
+	return state
+}
+
+// increment adds delta to counter slot in place and replaces slot of another type.
+// Deleted counter is incremented from zero. State with new value is returned
+func (shard *shard) increment(name string, delta int64, head *atomic.Uint64) *state {
+	shard.mutex.RLock()
+	current, ok := shard.slots[name]
+	if ok && current.metricType == counter.MetricType {
+		value := current.increment(name, delta, head)
+		shard.mutex.RUnlock()
+		return value
+	}
+	shard.mutex.RUnlock()
+
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	// slot could be created while shard was unlocked
+	current, ok = shard.slots[name]
+	if ok && current.metricType == counter.MetricType {
+		return current.increment(name, delta, head)
+	}
+
+	created := &slot{metricType: counter.MetricType}
+	state := newState(name, counter.MetricType, uint64(delta), time.Now().UnixNano(), head.Add(1))
+	created.state.Store(state)
+	shard.slots[name] = created
+
+	return state
+}
+
+// changes locks shard exclusively, so updates which took revision up to head are finished
+func (shard *shard) changes(since, head uint64) []*store.Record {
+	shard.mutex.Lock()
+	defer shard.mutex.Unlock()
+
+	changes := make([]*store.Record, 0)
+	for _, slot := range shard.slots {
+		state := slot.state.Load()
+		if state.revision > since && state.revision <= head {
+			changes = append(changes, state.record())
+		}
+	}
+
+	return changes
+}
+
+func (shard *shard) records() []*store.Record {
+	shard.mutex.RLock()
+	defer shard.mutex.RUnlock()
+
+	records := make([]*store.Record, 0, len(shard.slots))
+	for _, slot := range shard.slots {
+		if state := slot.state.Load(); !state.deleted {
+			records = append(records, state.record())
+		}
+	}
+
+	return records
+}
+
+// store publishes state unless concurrent update took greater revision, state of that update replaces this one then
+func (slot *slot) store(next *state) {
+	for {
+		previous := slot.state.Load()
+		if previous.revision > next.revision || slot.state.CompareAndSwap(previous, next) {
+			return
+		}
+	}
+}
+
+// increment takes revision once, so failed attempts do not waste revisions.
+// State includes increments of all concurrent updates, so it takes the greatest revision of them
+func (slot *slot) increment(name string, delta int64, head *atomic.Uint64) *state {
+	revision := head.Add(1)
+	updatedAt := time.Now().UnixNano()
+	for {
+		previous := slot.state.Load()
+		value := delta
+		if !previous.deleted {
+			value += previous.counter.GetValue()
+		}
+		next := newState(name, counter.MetricType, uint64(value), max(previous.updatedAt, updatedAt), max(previous.revision, revision))
+		if slot.state.CompareAndSwap(previous, next) {
+			return next
+		}
+	}
+}
+
+// delete replaces state by tombstone and reports whether metric was not deleted already.
+// Shard must be locked exclusively, so slot is not updated concurrently
+func (slot *slot) delete(deletedAt int64, head *atomic.Uint64) bool {
+	previous := slot.state.Load()
+	if previous.deleted {
+		return false
+	}
+
+	tombstone := *previous
+	tombstone.updatedAt = deletedAt
+	tombstone.revision = head.Add(1)
+	tombstone.deleted = true
+	// metric of copied state points to value of previous state, which is never modified
+	slot.state.Store(&tombstone)
+
+	return true
+}
+
+func newState(name, metricType string, value uint64, updatedAt int64, revision uint64) *state {
+	state := &state{updatedAt: updatedAt, revision: revision}
+	switch metricType {
+	case counter.MetricType:
+		state.counter = *counter.New(name, int64(value))
+		state.metric = &state.counter
+	default:
+		state.gauge = *gauge.New(name, math.Float64frombits(value))
+		state.metric = &state.gauge
+	}
+
+	return state
+}
+
+func (state *state) record() *store.Record {
+	return &store.Record{
+		Metric:    state.metric,
+		UpdatedAt: time.Unix(0, state.updatedAt),
+		Revision:  state.revision,
+		Deleted:   state.deleted,
+	}
+}
+
+// raise stores revision if it is greater, concurrent updates of slot could take revisions in another order
+func raise(current *atomic.Uint64, revision uint64) {
+	for {
+		previous := current.Load()
+		if previous >= revision || current.CompareAndSwap(previous, revision) {
+			return
+		}
+	}
+}
+
+func encode(metric metric.Metric) (string, uint64, error) {
+	switch metric := metric.(type) {
+	case *counter.Metric:
+		return counter.MetricType, uint64(metric.GetValue()), nil
+	case *gauge.Metric:
+		return gauge.MetricType, math.Float64bits(metric.GetValue()), nil
+	default:
+		return "", 0, newErrUnsupportedType(metric.Type())
+	}
+}
@@ -0,0 +1,115 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+)
+
+// syncMapStorage is previous implementation based on sync.Map, kept for comparison
+type syncMapStorage struct {
+	storage.Storage
+	metrics *sync.Map
+}
+
+func newSyncMapStorage() *syncMapStorage {
+	return &syncMapStorage{metrics: &sync.Map{}}
+}
+
+func (storage *syncMapStorage) Get(ctx context.Context, name string) (metric.Metric, error) {
+	value, ok := storage.metrics.Load(name)
+	if !ok {
+		return nil, nil
+	}
+
+	return value.(metric.Metric).Clone(), nil
+}
+
+func (storage *syncMapStorage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+	for _, metric := range metrics {
+		storage.metrics.Store(metric.Name(), metric.Clone())
+	}
+
+	return nil
+}
+
+var benchmarkStorages = map[string]func() storage.Storage{
+	"sync.Map": func() storage.Storage { return newSyncMapStorage() },
+	"sharded":  func() storage.Storage { return New() },
+}
+
+func benchmarkBatch(size int) []metric.Metric {
+	metrics := make([]metric.Metric, 0, size)
+	for i := 0; i < size; i++ {
+		if i%2 == 0 {
+			metrics = append(metrics, counter.New(fmt.Sprintf("counter_%d", i), int64(i)))
+		} else {
+			metrics = append(metrics, gauge.New(fmt.Sprintf("gauge_%d", i), float64(i)))
+		}
+	}
+
+	return metrics
+}
+
+func BenchmarkStorage_SaveBatchParallel(b *testing.B) {
+	ctx := context.Background()
+	batch := benchmarkBatch(200)
+	for name, newStorage := range benchmarkStorages {
+		b.Run(name, func(b *testing.B) {
+			storage := newStorage()
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := storage.SaveBatch(ctx, batch); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkStorage_GetParallel(b *testing.B) {
+	ctx := context.Background()
+	batch := benchmarkBatch(200)
+	for name, newStorage := range benchmarkStorages {
+		b.Run(name, func(b *testing.B) {
+			storage := newStorage()
+			if err := storage.SaveBatch(ctx, batch); err != nil {
+				b.Fatal(err)
+			}
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, err := storage.Get(ctx, batch[i%len(batch)].Name()); err != nil {
+						b.Fatal(err)
+					}
+					i++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkStorage_IncrementCounterParallel(b *testing.B) {
+	ctx := context.Background()
+	storage := New()
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, err := storage.IncrementCounter(ctx, "m1", 1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
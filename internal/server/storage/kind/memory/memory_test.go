@@ -2,16 +2,25 @@ package memory
 
 import (
 	"context"
+	"sync"
 	"testing"
 
 	"github.com/m1khal3v/gometheus/internal/common/metric"
 	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
 	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/storagetest"
 	"github.com/m1khal3v/gometheus/pkg/slice"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return New()
+	})
+}
+
 func TestStorage_Save(t *testing.T) {
 	tests := []struct {
 		name   string
@@ -138,9 +147,11 @@ func TestStorage_GetAll(t *testing.T) {
 			for _, metric := range tt.preset {
 				storage.Save(ctx, metric)
 			}
-			all, err := storage.GetAll(ctx)
+			seq, err := storage.GetAll(ctx)
 			require.NoError(t, err)
-			assert.ElementsMatch(t, tt.preset, slice.FromChannel(all))
+			all, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.preset, all)
 		})
 	}
 }
@@ -154,9 +165,162 @@ func TestStorage_SaveGet(t *testing.T) {
 	require.NoError(t, err)
 	assert.Equal(t, metric, get)
 	assert.NotSame(t, metric, get)
-	all, err := storage.GetAll(ctx)
+	seq, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
 	require.NoError(t, err)
-	allSlice := slice.FromChannel(all)
+	allSlice := all
 	assert.Equal(t, metric, allSlice[0])
 	assert.NotSame(t, metric, allSlice[0])
 }
+
+func TestStorage_IncrementCounter(t *testing.T) {
+	tests := []struct {
+		name   string
+		preset []metric.Metric
+		delta  int64
+		want   int64
+	}{
+		{
+			name:  "new counter",
+			delta: 5,
+			want:  5,
+		},
+		{
+			name:   "existing counter",
+			preset: []metric.Metric{counter.New("m1", 10)},
+			delta:  -3,
+			want:   7,
+		},
+		{
+			name:   "gauge -> counter",
+			preset: []metric.Metric{gauge.New("m1", 1.5)},
+			delta:  5,
+			want:   5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := New()
+			require.NoError(t, storage.SaveBatch(ctx, tt.preset))
+			got, err := storage.IncrementCounter(ctx, "m1", tt.delta)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+
+			value, err := storage.Get(ctx, "m1")
+			require.NoError(t, err)
+			assert.Equal(t, counter.New("m1", tt.want), value)
+		})
+	}
+}
+
+func TestStorage_IncrementCounterConcurrent(t *testing.T) {
+	ctx := context.Background()
+	storage := New()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := storage.IncrementCounter(ctx, "m1", 1)
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	value, err := storage.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, counter.New("m1", 2000), value)
+}
+
+// TestStorage_SaveConcurrent checks that state of update with the greatest revision is kept
+func TestStorage_SaveConcurrent(t *testing.T) {
+	ctx := context.Background()
+	storage := New()
+	require.NoError(t, storage.Save(ctx, gauge.New("m1", 0)))
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				assert.NoError(t, storage.Save(ctx, gauge.New("m1", float64(j))))
+			}
+		}()
+	}
+	wg.Wait()
+
+	record, err := storage.GetRecord(ctx, "m1")
+	require.NoError(t, err)
+	head, err := storage.Revision(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, head, record.Revision)
+	assert.Equal(t, gauge.New("m1", 99), record.Metric)
+}
+
+func TestStorage_GetAllocs(t *testing.T) {
+	ctx := context.Background()
+	storage := New()
+	require.NoError(t, storage.SaveBatch(ctx, []metric.Metric{counter.New("m1", 1), gauge.New("m2", 2)}))
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _ = storage.Get(ctx, "m1")
+		_, _ = storage.Get(ctx, "m2")
+	})
+	assert.Zero(t, allocs)
+}
+
+// TestStorage_replaceConcurrent checks that slots are not updated after they are replaced, run it with race detector
+func TestStorage_replaceConcurrent(t *testing.T) {
+	ctx := context.Background()
+	storage := New()
+	wg := &sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := storage.IncrementCounter(ctx, "m1", 1)
+				assert.NoError(t, err)
+				assert.NoError(t, storage.Save(ctx, gauge.New("m1", float64(j))))
+				assert.NoError(t, storage.Save(ctx, counter.New("m1", int64(j))))
+				assert.NoError(t, storage.Delete(ctx, "m1"))
+				assert.NoError(t, storage.Reset(ctx))
+			}
+		}()
+	}
+	wg.Wait()
+
+	// increment after replace is applied to new slot
+	require.NoError(t, storage.Save(ctx, gauge.New("m1", 1.5)))
+	value, err := storage.IncrementCounter(ctx, "m1", 2)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), value)
+	got, err := storage.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, counter.New("m1", 2), got)
+}
+
+func TestStorage_SaveUnsupportedType(t *testing.T) {
+	ctx := context.Background()
+	storage := New()
+	assert.Equal(t, newErrUnsupportedType("invalid"), storage.Save(ctx, invalidMetric{}))
+	assert.Equal(t, newErrUnsupportedType("invalid"), storage.SaveBatch(ctx, []metric.Metric{
+		counter.New("m1", 1),
+		invalidMetric{},
+	}))
+	// batch is not applied partially
+	got, err := storage.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+}
+
+type invalidMetric struct{}
+
+func (invalidMetric) Type() string         { return "invalid" }
+func (invalidMetric) Name() string         { return "invalid" }
+func (invalidMetric) StringValue() string  { return "invalid" }
+func (invalidMetric) Clone() metric.Metric { return invalidMetric{} }
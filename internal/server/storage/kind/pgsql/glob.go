@@ -0,0 +1,73 @@
+package pgsql
+
+import (
+	"regexp"
+	"strings"
+)
+
+// globToRegexp converts valid path.Match pattern to anchored regular expression
+// with the same semantics, so pattern could be matched by postgres ~ operator
+func globToRegexp(pattern string) string {
+	builder := &strings.Builder{}
+	builder.WriteString("^")
+
+	runes := []rune(pattern)
+	for i := 0; i < len(runes); i++ {
+		switch runes[i] {
+		case '*':
+			builder.WriteString("[^/]*")
+		case '?':
+			builder.WriteString("[^/]")
+		case '\\':
+			i++
+			builder.WriteString(regexp.QuoteMeta(string(runes[i])))
+		case '[':
+			i = writeClass(builder, runes, i+1)
+		default:
+			builder.WriteString(regexp.QuoteMeta(string(runes[i])))
+		}
+	}
+	builder.WriteString("$")
+
+	return builder.String()
+}
+
+// writeClass writes character class which starts at i and returns index of its closing bracket
+func writeClass(builder *strings.Builder, runes []rune, i int) int {
+	builder.WriteString("[")
+	if runes[i] == '^' {
+		builder.WriteString("^")
+		i++
+	}
+
+	for ranges := 0; runes[i] != ']' || ranges == 0; ranges++ {
+		var lo rune
+		lo, i = classChar(runes, i)
+		writeClassChar(builder, lo)
+		if runes[i] == '-' {
+			var hi rune
+			hi, i = classChar(runes, i+1)
+			builder.WriteString("-")
+			writeClassChar(builder, hi)
+		}
+	}
+	builder.WriteString("]")
+
+	return i
+}
+
+// classChar returns possibly escaped character at i and index following it
+func classChar(runes []rune, i int) (rune, int) {
+	if runes[i] == '\\' {
+		i++
+	}
+
+	return runes[i], i + 1
+}
+
+func writeClassChar(builder *strings.Builder, char rune) {
+	if strings.ContainsRune(`\]-^[`, char) {
+		builder.WriteString(`\`)
+	}
+	builder.WriteRune(char)
+}
@@ -0,0 +1,38 @@
+package pgsql
+
+import (
+	"path"
+	"regexp"
+	"testing"
+
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_globToRegexp(t *testing.T) {
+	names := []string{"", "a", "abc", "a/c", "a.c", "a-c", "a]c", "a^c", "a\\c", "a*c", "[abc]", "привет", "a\nc"}
+	patterns := []string{
+		"*", "a*", "*c", "a?c", "a.c", "a\\*c", "a\\?c", "[abc]*", "[^a]*", "a[^b]c", "a[!b]c",
+		"a[\\]]c", "a[\\^]c", "a[\\-]c", "a[a-z]c", "a[\\\\]c", "\\[abc\\]", "пр?вет", "a[а-я]c", "a(b|c)+",
+	}
+	for _, pattern := range patterns {
+		expression, err := regexp.Compile(globToRegexp(pattern))
+		require.NoError(t, err, pattern)
+		for _, name := range names {
+			matched, err := path.Match(pattern, name)
+			require.NoError(t, err)
+			assert.Equal(t, matched, expression.MatchString(name), "pattern %q, name %q", pattern, name)
+		}
+	}
+}
+
+func Test_filterQuery(t *testing.T) {
+	query, arguments := filterQuery(store.Filter{})
+	assert.Equal(t, getAllSQL+` ORDER BY name COLLATE "C"`, query)
+	assert.Empty(t, arguments)
+
+	query, arguments = filterQuery(store.Filter{Type: "gauge", Match: "m?", After: "m1", Descending: true, Limit: 10})
+	assert.Equal(t, getAllSQL+` AND type = $1 AND name ~ $2 AND name COLLATE "C" < $3 ORDER BY name COLLATE "C" DESC LIMIT $4`, query)
+	assert.Equal(t, []any{"gauge", "^m[^/]$", "m1", 10}, arguments)
+}
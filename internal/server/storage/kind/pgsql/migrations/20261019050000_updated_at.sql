@@ -0,0 +1,10 @@
+-- +goose Up
+-- +goose StatementBegin
+-- existing metrics are considered updated at migration time
+ALTER TABLE metric ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT now();
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE metric DROP COLUMN updated_at;
+-- +goose StatementEnd
@@ -0,0 +1,39 @@
+-- +goose Up
+-- +goose StatementBegin
+-- revisions are taken from sequence, so writers do not serialize on head revision
+CREATE SEQUENCE metric_revision AS BIGINT;
+-- +goose StatementEnd
+-- +goose StatementBegin
+-- existing metrics are considered saved at revision 1
+SELECT setval('metric_revision', 1) WHERE EXISTS (SELECT FROM metric);
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE metric ADD COLUMN revision BIGINT NOT NULL DEFAULT 1;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE metric ALTER COLUMN revision DROP DEFAULT;
+-- +goose StatementEnd
+-- +goose StatementBegin
+-- deleted metrics are kept as tombstones until they are saved again, so change feed reports deletes
+ALTER TABLE metric ADD COLUMN deleted BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+-- +goose StatementBegin
+CREATE INDEX metric_revision_idx ON metric (revision);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DELETE FROM metric WHERE deleted;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP INDEX metric_revision_idx;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE metric DROP COLUMN deleted;
+-- +goose StatementEnd
+-- +goose StatementBegin
+ALTER TABLE metric DROP COLUMN revision;
+-- +goose StatementEnd
+-- +goose StatementBegin
+DROP SEQUENCE metric_revision;
+-- +goose StatementEnd
@@ -0,0 +1,221 @@
+package pgsql
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/m1khal3v/gometheus/internal/common/logger"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"go.uber.org/zap"
+)
+
+const (
+	changesChannel = "metric_changes"
+	// reconnectDelay is pause between attempts to restore listening connection
+	reconnectDelay       = time.Second
+	resetNotificationSQL = "SELECT pg_notify('" + changesChannel + "', json_build_object('source', $1::TEXT, 'kind', 'all', 'name', '')::TEXT)"
+)
+
+var changeKinds = map[string]store.ChangeKind{
+	"save":   store.ChangeSave,
+	"delete": store.ChangeDelete,
+	"all":    store.ChangeAll,
+}
+
+// statements used for writes, they publish changed names if notifications are enabled
+type statements struct {
+	save             string
+	saveBatch        string
+	incrementCounter string
+	// saveBatch and saveBatchIncrementing return written records
+	saveBatchIncrementing string
+	delete                string
+	deleteStale           string
+	deleteByPrefix        string
+}
+
+func newStatements(notifications bool) statements {
+	if !notifications {
+		return statements{
+			save:                  "WITH " + writingSQL + saveSQL,
+			saveBatch:             "WITH " + writingSQL + saveBatchSQL + " RETURNING " + writtenColumns,
+			incrementCounter:      "WITH " + writingSQL + incrementCounterSQL + " RETURNING value::BIGINT",
+			saveBatchIncrementing: "WITH " + writingSQL + saveBatchIncrementingSQL + " RETURNING " + writtenColumns,
+			delete:                "WITH " + writingSQL + deleteSQL,
+			deleteStale:           "WITH " + writingSQL + deleteStaleSQL,
+			deleteByPrefix:        "WITH " + writingSQL + deleteByPrefixSQL,
+		}
+	}
+
+	return statements{
+		save:                  notifying(writingSQL, saveSQL, "save", 5, "changed.name"),
+		saveBatch:             notifying(writingSQL, saveBatchSQL, "save", 5, writtenColumns),
+		incrementCounter:      notifying(writingSQL, incrementCounterSQL, "save", 4, "changed.value::BIGINT"),
+		saveBatchIncrementing: notifying(writingSQL, saveBatchIncrementingSQL, "save", 5, writtenColumns),
+		delete:                notifying(writingSQL, deleteSQL, "delete", 2, "changed.name"),
+		deleteStale:           notifying(writingSQL, deleteStaleSQL, "delete", 3, "changed.name"),
+		deleteByPrefix:        notifying(writingSQL, deleteByPrefixSQL, "delete", 2, "changed.name"),
+	}
+}
+
+// notifying wraps data-modifying statement, so NOTIFY is sent for every changed row in the same transaction.
+// Data-modifying CTE is allowed at top level only, so CTE used by statement is passed separately.
+// Source of change is passed as parameter with sourceParameter index
+func notifying(cte, statement, kind string, sourceParameter int, columns string) string {
+	return fmt.Sprintf(`
+	WITH %s, changed AS (%s
+	RETURNING type, name, value, updated_at, revision)
+	SELECT %s FROM changed
+	CROSS JOIN LATERAL pg_notify('%s', json_build_object('source', $%d::TEXT, 'kind', '%s', 'name', changed.name)::TEXT) AS notification`,
+		cte, statement, columns, changesChannel, sourceParameter, kind,
+	)
+}
+
+type notification struct {
+	Source string `json:"source"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+}
+
+// notifier listens for changes published by other storages on dedicated pool connection
+type notifier struct {
+	pool *pgxpool.Pool
+	// source identifies storage, so its own notifications are skipped
+	source      string
+	mutex       *sync.Mutex
+	handlers    map[uint64]func(change store.Change)
+	nextHandler uint64
+	cancel      context.CancelFunc
+	done        chan struct{}
+}
+
+func newNotifier(pool *pgxpool.Pool) *notifier {
+	source := make([]byte, 16)
+	if _, err := rand.Read(source); err != nil {
+		panic(err)
+	}
+
+	return &notifier{
+		pool:     pool,
+		source:   hex.EncodeToString(source),
+		mutex:    &sync.Mutex{},
+		handlers: map[uint64]func(change store.Change){},
+	}
+}
+
+// subscribe starts listening with the first handler
+func (notifier *notifier) subscribe(handler func(change store.Change)) func() {
+	notifier.mutex.Lock()
+	defer notifier.mutex.Unlock()
+
+	id := notifier.nextHandler
+	notifier.nextHandler++
+	notifier.handlers[id] = handler
+
+	if notifier.cancel == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		notifier.cancel = cancel
+		notifier.done = make(chan struct{})
+		go notifier.listen(ctx)
+	}
+
+	return func() {
+		notifier.mutex.Lock()
+		defer notifier.mutex.Unlock()
+
+		delete(notifier.handlers, id)
+	}
+}
+
+func (notifier *notifier) close() {
+	notifier.mutex.Lock()
+	cancel, done := notifier.cancel, notifier.done
+	notifier.mutex.Unlock()
+
+	if cancel == nil {
+		return
+	}
+
+	cancel()
+	<-done
+}
+
+func (notifier *notifier) listen(ctx context.Context) {
+	defer close(notifier.done)
+
+	for reconnect := false; ; reconnect = true {
+		err := notifier.listenConnection(ctx, reconnect)
+		if ctx.Err() != nil {
+			return
+		}
+		logger.Logger.Error("Change notifications connection is lost", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(reconnectDelay):
+		}
+	}
+}
+
+// listenConnection returns error when connection is lost.
+// Changes could be missed while connection was lost, so subscribers are asked to invalidate all state on reconnect
+func (notifier *notifier) listenConnection(ctx context.Context, reconnect bool) error {
+	connection, err := notifier.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// connection interrupted by cancel is closed, so pool does not reuse it
+	defer connection.Release()
+
+	if _, err := connection.Exec(ctx, "LISTEN "+changesChannel); err != nil {
+		return err
+	}
+
+	if reconnect {
+		notifier.dispatch(store.Change{Kind: store.ChangeAll})
+	}
+
+	for {
+		received, err := connection.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		notification := &notification{}
+		if err := json.Unmarshal([]byte(received.Payload), notification); err != nil {
+			logger.Logger.Error("Invalid change notification", zap.String("payload", received.Payload), zap.Error(err))
+			continue
+		}
+		if notification.Source == notifier.source {
+			continue
+		}
+
+		kind, ok := changeKinds[notification.Kind]
+		if !ok {
+			logger.Logger.Error("Unknown change notification kind", zap.String("kind", notification.Kind))
+			continue
+		}
+
+		notifier.dispatch(store.Change{Kind: kind, Name: notification.Name})
+	}
+}
+
+func (notifier *notifier) dispatch(change store.Change) {
+	notifier.mutex.Lock()
+	handlers := make([]func(change store.Change), 0, len(notifier.handlers))
+	for _, handler := range notifier.handlers {
+		handlers = append(handlers, handler)
+	}
+	notifier.mutex.Unlock()
+
+	for _, handler := range handlers {
+		handler(change)
+	}
+}
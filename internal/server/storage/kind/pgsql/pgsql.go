@@ -4,75 +4,216 @@ package pgsql
 
 import (
 	"context"
-	"database/sql"
 	"embed"
 	"errors"
+	"fmt"
+	"io/fs"
+	"iter"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
-	_ "github.com/jackc/pgx/v5/stdlib"
-	"github.com/m1khal3v/gometheus/internal/common/logger"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/m1khal3v/gometheus/internal/common/metric"
 	"github.com/m1khal3v/gometheus/internal/common/metric/factory"
 	store "github.com/m1khal3v/gometheus/internal/server/storage"
 	"github.com/m1khal3v/gometheus/pkg/generator"
 	"github.com/m1khal3v/gometheus/pkg/retry"
 	"github.com/pressly/goose/v3"
-	"go.uber.org/zap"
 )
 
 const (
-	getStatement  = "get"
-	saveStatement = "save"
+	// deleted metrics are kept as tombstones, so change feed reports deletes
+	getSQL    = "SELECT type, value::VARCHAR, updated_at, revision FROM metric WHERE name = $1 AND NOT deleted"
+	selectSQL = "SELECT type, name, value::VARCHAR, updated_at, revision, deleted FROM metric"
+	getAllSQL = selectSQL + " WHERE NOT deleted"
+	// getChangesSQL selects metrics saved or deleted after revision $1 up to head revision $2
+	getChangesSQL = selectSQL + ` WHERE revision > $1 AND revision <= $2 ORDER BY revision, name COLLATE "C"`
+	// revisionLock is key of advisory lock guarding revisions. Writers hold it shared until commit, so they
+	// do not wait for each other. Lock is held exclusively only while head revision is advanced
+	revisionLock = "4701203938574231"
+	headLockSQL  = "SELECT pg_advisory_xact_lock(" + revisionLock + ")"
+	// headSQL reads the last revision taken from sequence, max(revision) of metrics would not include discarded ones
+	headSQL    = "SELECT CASE WHEN is_called THEN last_value ELSE 0 END FROM metric_revision"
+	advanceSQL = "SELECT setval('metric_revision', $1::BIGINT) FROM (" + headSQL + ") AS head (revision) WHERE $1::BIGINT > head.revision"
+	// writersSQL returns transactions holding revision lock. Lock is taken before revision, so writers
+	// which took revisions up to head read before are listed, bigint key is split to classid and objid
+	writersSQL = `
+	SELECT coalesce(array_agg(virtualtransaction), '{}') FROM pg_locks
+	WHERE locktype = 'advisory' AND objsubid = 1 AND granted
+	AND database = (SELECT oid FROM pg_database WHERE datname = current_database())
+	AND (classid::BIGINT << 32 | objid::BIGINT) = ` + revisionLock
+	// remainingWritersSQL returns writers of $1 which still hold revision lock
+	remainingWritersSQL = writersSQL + " AND virtualtransaction = ANY($1::TEXT[])"
+	// writingSQL is CTE taking shared revision lock, statements join it, so lock is taken before revisions
+	writingSQL = "writing AS (SELECT pg_advisory_xact_lock_shared(" + revisionLock + "))"
+	saveSQL    = `
+	INSERT INTO metric (type, name, value, updated_at, revision)
+	SELECT $1, $2, $3::DOUBLE PRECISION, $4, nextval('metric_revision') FROM writing
+	ON CONFLICT (name) DO UPDATE
+	SET type = EXCLUDED.type, value = EXCLUDED.value, updated_at = EXCLUDED.updated_at, revision = EXCLUDED.revision,
+	    deleted = FALSE`
+	// saveBatchSQL upserts whole batch with one statement, names in batch must be unique
+	saveBatchSQL = `
+	INSERT INTO metric (type, name, value, updated_at, revision)
+	SELECT batch.type, batch.name, batch.value::DOUBLE PRECISION, batch.updated_at, nextval('metric_revision')
+	FROM unnest($1::VARCHAR[], $2::VARCHAR[], $3::VARCHAR[], $4::TIMESTAMPTZ[]) AS batch (type, name, value, updated_at)
+	CROSS JOIN writing
+	ON CONFLICT (name) DO UPDATE
+	SET type = EXCLUDED.type, value = EXCLUDED.value, updated_at = EXCLUDED.updated_at, revision = EXCLUDED.revision,
+	    deleted = FALSE`
+	// incrementCounterSQL adds delta in one statement, so concurrent servers do not lose increments.
+	// Metric of another type or deleted one is replaced by counter
+	incrementCounterSQL = `
+	INSERT INTO metric (type, name, value, updated_at, revision)
+	SELECT 'counter', $1, $2::BIGINT, $3, nextval('metric_revision') FROM writing
+	ON CONFLICT (name) DO UPDATE
+	SET value = CASE WHEN metric.type = 'counter' AND NOT metric.deleted THEN metric.value + EXCLUDED.value ELSE EXCLUDED.value END,
+	    type = EXCLUDED.type, updated_at = EXCLUDED.updated_at, revision = EXCLUDED.revision, deleted = FALSE`
+	// saveBatchIncrementingSQL upserts whole batch with one statement, counter values are added to counters.
+	// Metric of another type or deleted one is replaced, names in batch must be unique
+	saveBatchIncrementingSQL = `
+	INSERT INTO metric (type, name, value, updated_at, revision)
+	SELECT batch.type, batch.name, batch.value::DOUBLE PRECISION, $4, nextval('metric_revision')
+	FROM unnest($1::VARCHAR[], $2::VARCHAR[], $3::VARCHAR[]) AS batch (type, name, value) CROSS JOIN writing
+	ON CONFLICT (name) DO UPDATE
+	SET value = CASE WHEN metric.type = 'counter' AND EXCLUDED.type = 'counter' AND NOT metric.deleted
+	        THEN metric.value + EXCLUDED.value ELSE EXCLUDED.value END,
+	    type = EXCLUDED.type, updated_at = EXCLUDED.updated_at, revision = EXCLUDED.revision, deleted = FALSE`
+	// writtenColumns return saved metric with update time and revision, counter is converted to integer to keep precision
+	writtenColumns = "type, name, CASE WHEN type = 'counter' THEN value::BIGINT::VARCHAR ELSE value::VARCHAR END, updated_at, revision"
+	// tombstoneSQL replaces metrics by tombstones with revision of delete, statements add conditions
+	tombstoneSQL = `
+	UPDATE metric SET deleted = TRUE, updated_at = now(), revision = nextval('metric_revision')
+	FROM writing WHERE NOT deleted`
+	deleteSQL         = tombstoneSQL + " AND name = $1"
+	deleteStaleSQL    = tombstoneSQL + " AND name = $1 AND updated_at <= $2"
+	deleteByPrefixSQL = tombstoneSQL + " AND starts_with(name, $1)"
+	// resetSQL keeps revisions, so they are not reused
+	resetSQL = "WITH " + writingSQL + tombstoneSQL
+)
+
+// writersMinDelay and writersMaxDelay limit pause between checks of writers holding revision lock
+const (
+	writersMinDelay = time.Millisecond
+	writersMaxDelay = 100 * time.Millisecond
 )
 
 type Storage struct {
-	db         *sql.DB
+	pool       *pgxpool.Pool
 	mutex      *sync.Mutex
-	closed     bool
-	statements map[string]*sql.Stmt
+	closed     *atomic.Bool
+	statements statements
+	notifier   *notifier
+}
+
+type options struct {
+	pool          *pgxpool.Config
+	notifications bool
+}
+
+type Option func(options *options)
+
+// WithMaxConns sets max size of connection pool
+func WithMaxConns(maxConns int32) Option {
+	return func(options *options) {
+		options.pool.MaxConns = maxConns
+	}
+}
+
+// WithMinConns sets count of connections kept open while pool is idle
+func WithMinConns(minConns int32) Option {
+	return func(options *options) {
+		options.pool.MinConns = minConns
+	}
+}
+
+// WithStatementCacheCapacity sets count of prepared statements cached per connection
+func WithStatementCacheCapacity(capacity int) Option {
+	return func(options *options) {
+		options.pool.ConnConfig.StatementCacheCapacity = capacity
+	}
+}
+
+// WithChangeNotifications publishes every change with NOTIFY, so storages of other servers
+// using the same database could notify their subscribers.
+// NOTIFY serializes commits of writing transactions, so it is disabled by default
+func WithChangeNotifications() Option {
+	return func(options *options) {
+		options.notifications = true
+	}
 }
 
 //go:embed migrations/*.sql
 var embedMigrations embed.FS
 
-func New(databaseDSN string) *Storage {
-	db, err := goose.OpenDBWithDriver("pgx", databaseDSN)
+func New(databaseDSN string, optionList ...Option) *Storage {
+	config, err := pgxpool.ParseConfig(databaseDSN)
 	if err != nil {
 		panic(err)
 	}
+	// statements are prepared on first use and cached by connection
+	config.ConnConfig.DefaultQueryExecMode = pgx.QueryExecModeCacheStatement
+	options := &options{pool: config}
+	for _, option := range optionList {
+		option(options)
+	}
 
-	goose.SetBaseFS(embedMigrations)
-	if err := goose.Up(db, "migrations"); err != nil {
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
+	if err != nil {
 		panic(err)
 	}
 
+	migrate(pool)
+
 	storage := &Storage{
-		db:     db,
-		mutex:  &sync.Mutex{},
-		closed: false,
+		pool:       pool,
+		mutex:      &sync.Mutex{},
+		closed:     &atomic.Bool{},
+		statements: newStatements(options.notifications),
+	}
+	if options.notifications {
+		storage.notifier = newNotifier(pool)
 	}
-	storage.prepareStatements()
 
 	return storage
 }
 
 func (storage *Storage) Get(ctx context.Context, name string) (metric.Metric, error) {
+	record, err := storage.GetRecord(ctx, name)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	return record.Metric, nil
+}
+
+func (storage *Storage) GetRecord(ctx context.Context, name string) (*store.Record, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return nil, err
+	}
+
 	var metricType, metricValue string
+	var updatedAt time.Time
+	var revision uint64
 
 	err := retry.Retry(retry.RetryOptions{
 		BaseDelay:  time.Second,
 		MaxDelay:   5 * time.Second,
 		Attempts:   4,
 		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
 	}, func() error {
-		return storage.statements[getStatement].QueryRowContext(ctx, name).Scan(&metricType, &metricValue)
+		return storage.pool.QueryRow(ctx, getSQL, name).Scan(&metricType, &metricValue, &updatedAt, &revision)
 	}, storage.isRetryableError)
 
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
+		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, nil
 		}
 
@@ -84,59 +225,232 @@ func (storage *Storage) Get(ctx context.Context, name string) (metric.Metric, er
 		return nil, err
 	}
 
-	return metric, nil
+	return &store.Record{Metric: metric, UpdatedAt: updatedAt, Revision: revision}, nil
+}
+
+func (storage *Storage) GetAll(ctx context.Context) (iter.Seq2[metric.Metric, error], error) {
+	records, err := storage.GetAllRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.MetricsOf(records), nil
+}
+
+// GetAllRecords executes query when iteration starts, so connection is not held by unused iterator
+func (storage *Storage) GetAllRecords(ctx context.Context) (iter.Seq2[*store.Record, error], error) {
+	return storage.queryRecords(ctx, getAllSQL)
+}
+
+// GetFiltered selects metrics in query, glob pattern is converted to regular expression
+func (storage *Storage) GetFiltered(ctx context.Context, filter store.Filter) (iter.Seq2[*store.Record, error], error) {
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	query, arguments := filterQuery(filter)
+
+	return storage.queryRecords(ctx, query, arguments...)
+}
+
+// filterQuery builds query with conditions of non-empty filter fields only
+func filterQuery(filter store.Filter) (string, []any) {
+	conditions := make([]string, 0, 4)
+	arguments := make([]any, 0, 5)
+	condition := func(format string, argument any) {
+		arguments = append(arguments, argument)
+		conditions = append(conditions, fmt.Sprintf(format, len(arguments)))
+	}
+
+	if filter.Type != "" {
+		condition("type = $%d", filter.Type)
+	}
+	if filter.Prefix != "" {
+		condition("starts_with(name, $%d)", filter.Prefix)
+	}
+	if filter.Match != "" {
+		condition("name ~ $%d", globToRegexp(filter.Match))
+	}
+	if filter.After != "" {
+		if filter.Descending {
+			condition(`name COLLATE "C" < $%d`, filter.After)
+		} else {
+			condition(`name COLLATE "C" > $%d`, filter.After)
+		}
+	}
+
+	builder := &strings.Builder{}
+	builder.WriteString(getAllSQL)
+	for _, condition := range conditions {
+		builder.WriteString(" AND ")
+		builder.WriteString(condition)
+	}
+	// names are compared bytewise as in other storages
+	builder.WriteString(` ORDER BY name COLLATE "C"`)
+	if filter.Descending {
+		builder.WriteString(" DESC")
+	}
+	if filter.Limit > 0 {
+		arguments = append(arguments, filter.Limit)
+		fmt.Fprintf(builder, " LIMIT $%d", len(arguments))
+	}
+
+	return builder.String(), arguments
 }
 
-func (storage *Storage) GetAll(ctx context.Context) (<-chan metric.Metric, error) {
+// queryRecords executes query when iteration starts, so connection is not held by unused iterator
+func (storage *Storage) queryRecords(ctx context.Context, query string, arguments ...any) (iter.Seq2[*store.Record, error], error) {
 	if err := storage.checkStorageClosed(); err != nil {
 		return nil, err
 	}
 
-	var rows *sql.Rows
+	var rows pgx.Rows
+
+	return generator.NewSeq2FromFunctionWithContext(ctx, func() (*store.Record, bool, error) {
+		if rows == nil {
+			err := retry.Retry(retry.RetryOptions{
+				BaseDelay:  time.Second,
+				MaxDelay:   5 * time.Second,
+				Attempts:   4,
+				Multiplier: 2,
+				Hook:       retry.HookFromContext(ctx),
+			}, func() error {
+				var err error
+				rows, err = storage.pool.Query(ctx, query, arguments...)
+				if err != nil {
+					return err
+				}
+				return rows.Err()
+			}, storage.isRetryableError)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+
+		if !rows.Next() {
+			return nil, false, rows.Err()
+		}
+
+		var metricType, metricName, metricValue string
+		var updatedAt time.Time
+		var revision uint64
+		var deleted bool
+		if err := rows.Scan(&metricType, &metricName, &metricValue, &updatedAt, &revision, &deleted); err != nil {
+			return nil, false, err
+		}
+
+		metric, err := factory.New(metricType, metricName, metricValue)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return &store.Record{Metric: metric, UpdatedAt: updatedAt, Revision: revision, Deleted: deleted}, true, nil
+	}, func() {
+		// rows hold pool connection until they are closed
+		if rows != nil {
+			rows.Close()
+		}
+	}), nil
+}
+
+// Revision returns head revision stored in database, so it is shared by all servers using the same database.
+// Revision waits for writers which held revision lock when head was read, so every revision up to returned head
+// is committed or discarded. Lock is not taken, so writers are not blocked and new writers are not waited for
+func (storage *Storage) Revision(ctx context.Context) (uint64, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return 0, err
+	}
+
+	var revision uint64
+	var writers []string
 	err := retry.Retry(retry.RetryOptions{
 		BaseDelay:  time.Second,
 		MaxDelay:   5 * time.Second,
 		Attempts:   4,
 		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
 	}, func() error {
-		var err error
-		rows, err = storage.db.QueryContext(ctx, "SELECT type, name, value::VARCHAR FROM metric")
-		if err != nil {
+		// writers are listed after head is read, so writer which took revision up to head is not missed
+		if err := storage.pool.QueryRow(ctx, headSQL).Scan(&revision); err != nil {
 			return err
 		}
-		return rows.Err()
+
+		return storage.pool.QueryRow(ctx, writersSQL).Scan(&writers)
 	}, storage.isRetryableError)
 	if err != nil {
-		return nil, err
+		return 0, err
 	}
 
-	return generator.NewFromFunctionWithContext(ctx, func() (metric.Metric, bool) {
-		if !rows.Next() {
-			return nil, false
+	return revision, storage.waitWriters(ctx, writers)
+}
+
+// waitWriters polls lock of writers with growing delay, writing statements are short
+func (storage *Storage) waitWriters(ctx context.Context, writers []string) error {
+	delay := writersMinDelay
+	for len(writers) > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
 		}
+		delay = min(delay*2, writersMaxDelay)
+
+		err := retry.Retry(retry.RetryOptions{
+			BaseDelay:  time.Second,
+			MaxDelay:   5 * time.Second,
+			Attempts:   4,
+			Multiplier: 2,
+			Hook:       retry.HookFromContext(ctx),
+		}, func() error {
+			return storage.pool.QueryRow(ctx, remainingWritersSQL, writers).Scan(&writers)
+		}, storage.isRetryableError)
+		if err != nil {
+			return err
+		}
+	}
 
-		var metricType, metricName, metricValue string
-		if err := rows.Scan(&metricType, &metricName, &metricValue); err != nil {
-			logger.Logger.Error("Failed to scan row", zap.Error(err))
-			if err := rows.Close(); err != nil {
-				logger.Logger.Error("Failed to close rows", zap.Error(err))
-			}
+	return nil
+}
 
-			return nil, false
-		}
+// GetChanges reads head before changes. Every revision up to head is committed when head is returned,
+// so changes query started after it sees all of them, deleted metrics are returned as tombstones
+func (storage *Storage) GetChanges(ctx context.Context, since uint64) (iter.Seq2[*store.Record, error], uint64, error) {
+	head, err := storage.Revision(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	if since >= head {
+		return func(yield func(*store.Record, error) bool) {}, head, nil
+	}
 
-		metric, err := factory.New(metricType, metricName, metricValue)
-		if err != nil {
-			logger.Logger.Error("Failed to create metric", zap.Error(err))
-			if err := rows.Close(); err != nil {
-				logger.Logger.Error("Failed to close rows", zap.Error(err))
-			}
+	records, err := storage.queryRecords(ctx, getChangesSQL, since, head)
 
-			return nil, false
-		}
+	return records, head, err
+}
 
-		return metric.Clone(), true
-	}), nil
+// AdvanceRevision holds exclusive revision lock, so sequence is not raised while writers take revisions.
+// It is called on start only, so blocked writers are acceptable
+func (storage *Storage) AdvanceRevision(ctx context.Context, revision uint64) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	return retry.Retry(retry.RetryOptions{
+		BaseDelay:  time.Second,
+		MaxDelay:   5 * time.Second,
+		Attempts:   4,
+		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
+	}, func() error {
+		return pgx.BeginFunc(ctx, storage.pool, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, headLockSQL); err != nil {
+				return err
+			}
+
+			_, err := tx.Exec(ctx, advanceSQL, revision)
+			return err
+		})
+	}, storage.isRetryableError)
 }
 
 func (storage *Storage) Save(ctx context.Context, metric metric.Metric) error {
@@ -144,85 +458,200 @@ func (storage *Storage) Save(ctx context.Context, metric metric.Metric) error {
 		return err
 	}
 
-	err := retry.Retry(retry.RetryOptions{
+	return retry.Retry(retry.RetryOptions{
 		BaseDelay:  time.Second,
 		MaxDelay:   5 * time.Second,
 		Attempts:   4,
 		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
 	}, func() error {
-		_, err := storage.statements[saveStatement].ExecContext(ctx, metric.Type(), metric.Name(), metric.StringValue())
+		_, err := storage.pool.Exec(ctx, storage.statements.save, storage.arguments(metric.Type(), metric.Name(), metric.StringValue(), time.Now())...)
 
 		return err
 	}, storage.isRetryableError)
+}
+
+// SaveBatch upserts metrics with one statement. Only last metric is saved if batch contains same name multiple times
+func (storage *Storage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+	return storage.SaveRecords(ctx, store.RecordsOf(metrics, time.Now()))
+}
+
+// SaveRecords upserts records with one statement. Only last record is saved if batch contains same name multiple times
+func (storage *Storage) SaveRecords(ctx context.Context, records []*store.Record) error {
+	_, err := storage.WriteRecords(ctx, records)
+
+	return err
+}
+
+// WriteRecords returns records saved by upsert with revisions assigned to them
+func (storage *Storage) WriteRecords(ctx context.Context, records []*store.Record) ([]*store.Record, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return []*store.Record{}, nil
+	}
+
+	types, names, values, updatedAt := columns(records)
+
+	return storage.write(ctx, storage.statements.saveBatch, storage.arguments(types, names, values, updatedAt)...)
+}
+
+// IncrementCounter is atomic for all servers using the same database
+func (storage *Storage) IncrementCounter(ctx context.Context, name string, delta int64) (int64, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return 0, err
+	}
+
+	var value int64
+	err := retry.Retry(retry.RetryOptions{
+		BaseDelay:  time.Second,
+		MaxDelay:   5 * time.Second,
+		Attempts:   4,
+		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
+	}, func() error {
+		return storage.pool.QueryRow(ctx, storage.statements.incrementCounter, storage.arguments(name, delta, time.Now())...).Scan(&value)
+	}, storage.isRetryableError)
 
+	return value, err
+}
+
+// SaveBatchIncrementing saves batch with one statement, so batch is applied by all servers atomically
+func (storage *Storage) SaveBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]metric.Metric, error) {
+	written, err := storage.WriteBatchIncrementing(ctx, metrics)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	saved := make([]metric.Metric, 0, len(written))
+	for _, record := range written {
+		saved = append(saved, record.Metric)
+	}
+
+	return saved, nil
 }
 
-func (storage *Storage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+// WriteBatchIncrementing returns records saved by upsert with revisions assigned to them
+func (storage *Storage) WriteBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]*store.Record, error) {
 	if err := storage.checkStorageClosed(); err != nil {
-		return err
+		return nil, err
+	}
+	if len(metrics) == 0 {
+		return []*store.Record{}, nil
 	}
 
+	types, names, values, _ := columns(store.RecordsOf(metrics, time.Time{}))
+
+	return storage.write(ctx, storage.statements.saveBatchIncrementing, storage.arguments(types, names, values, time.Now())...)
+}
+
+// write executes upsert returning writtenColumns
+func (storage *Storage) write(ctx context.Context, query string, arguments ...any) ([]*store.Record, error) {
+	var written []*store.Record
 	err := retry.Retry(retry.RetryOptions{
 		BaseDelay:  time.Second,
 		MaxDelay:   5 * time.Second,
 		Attempts:   4,
 		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
 	}, func() error {
-		transaction, err := storage.db.BeginTx(ctx, nil)
+		rows, err := storage.pool.Query(ctx, query, arguments...)
 		if err != nil {
 			return err
 		}
-		statement := transaction.StmtContext(ctx, storage.statements[saveStatement])
 
-		for _, metric := range metrics {
-			if _, err := statement.ExecContext(ctx, metric.Type(), metric.Name(), metric.StringValue()); err != nil {
-				if rollbackErr := transaction.Rollback(); rollbackErr != nil {
-					return errors.Join(err, rollbackErr)
-				}
+		written, err = pgx.CollectRows(rows, func(row pgx.CollectableRow) (*store.Record, error) {
+			var metricType, metricName, metricValue string
+			var updatedAt time.Time
+			var revision uint64
+			if err := row.Scan(&metricType, &metricName, &metricValue, &updatedAt, &revision); err != nil {
+				return nil, err
+			}
 
-				return err
+			metric, err := factory.New(metricType, metricName, metricValue)
+			if err != nil {
+				return nil, err
 			}
-		}
 
-		return transaction.Commit()
+			return &store.Record{Metric: metric, UpdatedAt: updatedAt, Revision: revision}, nil
+		})
+
+		return err
 	}, storage.isRetryableError)
+	if err != nil {
+		return nil, err
+	}
 
-	return err
+	return written, nil
 }
 
-func (storage *Storage) Ping(ctx context.Context) error {
+func (storage *Storage) Delete(ctx context.Context, name string) error {
+	return storage.exec(ctx, storage.statements.delete, storage.arguments(name)...)
+}
+
+// DeleteStale checks update time in delete statement, so metric saved concurrently by any server is kept
+func (storage *Storage) DeleteStale(ctx context.Context, name string, cutoff time.Time) (bool, error) {
 	if err := storage.checkStorageClosed(); err != nil {
+		return false, err
+	}
+
+	var deleted int64
+	err := retry.Retry(retry.RetryOptions{
+		BaseDelay:  time.Second,
+		MaxDelay:   5 * time.Second,
+		Attempts:   4,
+		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
+	}, func() error {
+		tag, err := storage.pool.Exec(ctx, storage.statements.deleteStale, storage.arguments(name, cutoff)...)
+		deleted = tag.RowsAffected()
 		return err
+	}, storage.isRetryableError)
+
+	return deleted > 0, err
+}
+
+func (storage *Storage) DeleteByPrefix(ctx context.Context, prefix string) error {
+	return storage.exec(ctx, storage.statements.deleteByPrefix, storage.arguments(prefix)...)
+}
+
+// Subscribe listens for changes made by other servers. Storage must be created with WithChangeNotifications,
+// otherwise changes are not published and handler is never called
+func (storage *Storage) Subscribe(handler func(change store.Change)) func() {
+	if storage.notifier == nil {
+		return func() {}
 	}
 
-	if err := storage.db.PingContext(ctx); err != nil {
+	return storage.notifier.subscribe(handler)
+}
+
+func (storage *Storage) Ping(ctx context.Context) error {
+	if err := storage.checkStorageClosed(); err != nil {
 		return err
 	}
 
-	return nil
+	return storage.pool.Ping(ctx)
 }
 
 func (storage *Storage) Close(ctx context.Context) error {
 	storage.mutex.Lock()
 	defer storage.mutex.Unlock()
 
-	if storage.closed {
+	if storage.closed.Load() {
 		return store.ErrStorageClosed
 	}
 
-	if err := storage.db.Close(); err != nil {
-		return err
+	// listening connection must be released before pool is closed
+	if storage.notifier != nil {
+		storage.notifier.close()
 	}
-
-	storage.closed = true
+	storage.pool.Close()
+	storage.closed.Store(true)
 	return nil
 }
 
+// Reset replaces all metrics by tombstones, so change feed reports them as deleted
 func (storage *Storage) Reset(ctx context.Context) error {
 	if err := storage.checkStorageClosed(); err != nil {
 		return err
@@ -233,14 +662,52 @@ func (storage *Storage) Reset(ctx context.Context) error {
 		MaxDelay:   5 * time.Second,
 		Attempts:   4,
 		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
 	}, func() error {
-		_, err := storage.db.ExecContext(ctx, "TRUNCATE TABLE metric")
+		if storage.notifier == nil {
+			_, err := storage.pool.Exec(ctx, resetSQL)
+			return err
+		}
+
+		return pgx.BeginFunc(ctx, storage.pool, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, resetSQL); err != nil {
+				return err
+			}
+
+			_, err := tx.Exec(ctx, resetNotificationSQL, storage.notifier.source)
+			return err
+		})
+	}, storage.isRetryableError)
+}
+
+func (storage *Storage) exec(ctx context.Context, query string, arguments ...any) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	return retry.Retry(retry.RetryOptions{
+		BaseDelay:  time.Second,
+		MaxDelay:   5 * time.Second,
+		Attempts:   4,
+		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
+	}, func() error {
+		_, err := storage.pool.Exec(ctx, query, arguments...)
 		return err
 	}, storage.isRetryableError)
 }
 
+// arguments appends source of change notification to statement arguments if notifications are enabled
+func (storage *Storage) arguments(arguments ...any) []any {
+	if storage.notifier == nil {
+		return arguments
+	}
+
+	return append(arguments, storage.notifier.source)
+}
+
 func (storage *Storage) checkStorageClosed() error {
-	if storage.closed {
+	if storage.closed.Load() {
 		return store.ErrStorageClosed
 	}
 
@@ -248,6 +715,10 @@ func (storage *Storage) checkStorageClosed() error {
 }
 
 func (storage *Storage) isRetryableError(err error) bool {
+	if errors.Is(err, store.ErrTransient) {
+		return true
+	}
+
 	var pgsqlErr *pgconn.PgError
 	if !errors.As(err, &pgsqlErr) {
 		return false
@@ -260,31 +731,50 @@ func (storage *Storage) isRetryableError(err error) bool {
 		pgerrcode.IsTransactionRollback(pgsqlErr.Code)
 }
 
-func (storage *Storage) prepareStatements() {
-	items := []struct {
-		name string
-		sql  string
-	}{
-		{
-			name: getStatement,
-			sql:  "SELECT type, value::VARCHAR FROM metric WHERE name = $1",
-		},
-		{
-			name: saveStatement,
-			sql: `
-			INSERT INTO metric (type, name, value) 
-			VALUES ($1, $2, $3::DOUBLE PRECISION)
-			ON CONFLICT (name) DO UPDATE
-			SET type = $1, value = $3::DOUBLE PRECISION`,
-		},
-	}
-	storage.statements = make(map[string]*sql.Stmt, len(items))
-
-	for _, item := range items {
-		var err error
-		storage.statements[item.name], err = storage.db.Prepare(item.sql)
-		if err != nil {
-			panic(err)
+// columns converts records to unnest arrays, names are deduplicated because
+// ON CONFLICT cannot update same row twice in one statement
+func columns(records []*store.Record) ([]string, []string, []string, []time.Time) {
+	positions := make(map[string]int, len(records))
+	types := make([]string, 0, len(records))
+	names := make([]string, 0, len(records))
+	values := make([]string, 0, len(records))
+	updatedAt := make([]time.Time, 0, len(records))
+
+	for _, record := range records {
+		metric := record.Metric
+		if position, ok := positions[metric.Name()]; ok {
+			types[position] = metric.Type()
+			values[position] = metric.StringValue()
+			updatedAt[position] = record.UpdatedAt
+			continue
 		}
+
+		positions[metric.Name()] = len(names)
+		types = append(types, metric.Type())
+		names = append(names, metric.Name())
+		values = append(values, metric.StringValue())
+		updatedAt = append(updatedAt, record.UpdatedAt)
+	}
+
+	return types, names, values, updatedAt
+}
+
+func migrate(pool *pgxpool.Pool) {
+	// closing db does not close pool
+	db := stdlib.OpenDBFromPool(pool)
+	defer db.Close()
+
+	// own provider keeps global state of goose untouched, so storages of other drivers could be used in one process
+	migrations, err := fs.Sub(embedMigrations, "migrations")
+	if err != nil {
+		panic(err)
+	}
+
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, migrations)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := provider.Up(context.Background()); err != nil {
+		panic(err)
 	}
 }
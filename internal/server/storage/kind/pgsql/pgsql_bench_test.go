@@ -0,0 +1,62 @@
+package pgsql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+)
+
+func benchmarkBatch(size int) []metric.Metric {
+	metrics := make([]metric.Metric, 0, size)
+	for i := 0; i < size; i++ {
+		if i%2 == 0 {
+			metrics = append(metrics, counter.New(fmt.Sprintf("counter_%d", i), int64(i)))
+		} else {
+			metrics = append(metrics, gauge.New(fmt.Sprintf("gauge_%d", i), float64(i)))
+		}
+	}
+
+	return metrics
+}
+
+func BenchmarkStorage_SaveBatch(b *testing.B) {
+	ctx := context.Background()
+	for _, size := range []int{200, 1000, 5000, 10000} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			storage := createStorage(b, ctx, nil)
+			batch := benchmarkBatch(size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if err := storage.SaveBatch(ctx, batch); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "metrics/s")
+		})
+	}
+}
+
+func BenchmarkStorage_SaveBatchParallel(b *testing.B) {
+	ctx := context.Background()
+	for _, size := range []int{200, 1000, 5000, 10000} {
+		b.Run(fmt.Sprintf("size=%d", size), func(b *testing.B) {
+			storage := createStorage(b, ctx, nil, WithMaxConns(8))
+			batch := benchmarkBatch(size)
+			b.ReportAllocs()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := storage.SaveBatch(ctx, batch); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.ReportMetric(float64(size*b.N)/b.Elapsed().Seconds(), "metrics/s")
+		})
+	}
+}
@@ -0,0 +1,14 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE metric
+(
+    name  TEXT NOT NULL PRIMARY KEY,
+    type  TEXT NOT NULL,
+    value TEXT NOT NULL
+) WITHOUT ROWID;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE metric;
+-- +goose StatementEnd
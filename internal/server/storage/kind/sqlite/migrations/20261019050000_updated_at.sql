@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE metric ADD COLUMN updated_at INTEGER NOT NULL DEFAULT 0;
+-- +goose StatementEnd
+-- +goose StatementBegin
+-- existing metrics are considered updated at migration time (unix nanoseconds)
+UPDATE metric SET updated_at = unixepoch() * 1000000000;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE metric DROP COLUMN updated_at;
+-- +goose StatementEnd
@@ -0,0 +1,408 @@
+// Package sqlite
+// contains sqlite storage implementation
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"io/fs"
+	"iter"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/logger"
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/factory"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/pkg/generator"
+	"github.com/m1khal3v/gometheus/pkg/retry"
+	"github.com/pressly/goose/v3"
+	"go.uber.org/zap"
+	driver "modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+const (
+	getStatement  = "get"
+	saveStatement = "save"
+)
+
+// pragmas applied to every connection of the pool
+var pragmas = []string{
+	"journal_mode(WAL)",
+	"synchronous(NORMAL)",
+	"busy_timeout(5000)",
+}
+
+type Storage struct {
+	db         *sql.DB
+	mutex      *sync.Mutex
+	closed     *atomic.Bool
+	statements map[string]*sql.Stmt
+}
+
+//go:embed migrations/*.sql
+var embedMigrations embed.FS
+
+func New(databaseDSN string) *Storage {
+	db, err := sql.Open("sqlite", withPragmas(databaseDSN))
+	if err != nil {
+		panic(err)
+	}
+
+	migrate(db)
+
+	storage := &Storage{
+		db:     db,
+		mutex:  &sync.Mutex{},
+		closed: &atomic.Bool{},
+	}
+	storage.prepareStatements()
+
+	return storage
+}
+
+func (storage *Storage) Get(ctx context.Context, name string) (metric.Metric, error) {
+	record, err := storage.GetRecord(ctx, name)
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	return record.Metric, nil
+}
+
+func (storage *Storage) GetRecord(ctx context.Context, name string) (*store.Record, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return nil, err
+	}
+
+	var metricType, metricValue string
+	var updatedAt int64
+
+	err := retry.Retry(retry.RetryOptions{
+		BaseDelay:  time.Second,
+		MaxDelay:   5 * time.Second,
+		Attempts:   4,
+		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
+	}, func() error {
+		return storage.statements[getStatement].QueryRowContext(ctx, name).Scan(&metricType, &metricValue, &updatedAt)
+	}, storage.isRetryableError)
+
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	metric, err := factory.New(metricType, name, metricValue)
+	if err != nil {
+		return nil, err
+	}
+
+	return &store.Record{Metric: metric, UpdatedAt: time.Unix(0, updatedAt)}, nil
+}
+
+func (storage *Storage) GetAll(ctx context.Context) (iter.Seq2[metric.Metric, error], error) {
+	records, err := storage.GetAllRecords(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return store.MetricsOf(records), nil
+}
+
+// GetAllRecords executes query when iteration starts, so connection is not held by unused iterator
+func (storage *Storage) GetAllRecords(ctx context.Context) (iter.Seq2[*store.Record, error], error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return nil, err
+	}
+
+	var rows *sql.Rows
+
+	return generator.NewSeq2FromFunctionWithContext(ctx, func() (*store.Record, bool, error) {
+		if rows == nil {
+			err := retry.Retry(retry.RetryOptions{
+				BaseDelay:  time.Second,
+				MaxDelay:   5 * time.Second,
+				Attempts:   4,
+				Multiplier: 2,
+				Hook:       retry.HookFromContext(ctx),
+			}, func() error {
+				var err error
+				rows, err = storage.db.QueryContext(ctx, "SELECT type, name, value, updated_at FROM metric")
+				if err != nil {
+					return err
+				}
+				return rows.Err()
+			}, storage.isRetryableError)
+			if err != nil {
+				return nil, false, err
+			}
+		}
+
+		if !rows.Next() {
+			return nil, false, rows.Err()
+		}
+
+		var metricType, metricName, metricValue string
+		var updatedAt int64
+		if err := rows.Scan(&metricType, &metricName, &metricValue, &updatedAt); err != nil {
+			return nil, false, err
+		}
+
+		metric, err := factory.New(metricType, metricName, metricValue)
+		if err != nil {
+			return nil, false, err
+		}
+
+		return &store.Record{Metric: metric, UpdatedAt: time.Unix(0, updatedAt)}, true, nil
+	}, func() {
+		if rows == nil {
+			return
+		}
+		if err := rows.Close(); err != nil {
+			logger.Logger.Error("Failed to close rows", zap.Error(err))
+		}
+	}), nil
+}
+
+func (storage *Storage) Save(ctx context.Context, metric metric.Metric) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	return retry.Retry(retry.RetryOptions{
+		BaseDelay:  time.Second,
+		MaxDelay:   5 * time.Second,
+		Attempts:   4,
+		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
+	}, func() error {
+		_, err := storage.statements[saveStatement].ExecContext(ctx, metric.Type(), metric.Name(), metric.StringValue(), time.Now().UnixNano())
+
+		return err
+	}, storage.isRetryableError)
+}
+
+func (storage *Storage) SaveBatch(ctx context.Context, metrics []metric.Metric) error {
+	return storage.SaveRecords(ctx, store.RecordsOf(metrics, time.Now()))
+}
+
+// SaveRecords saves records in one transaction
+func (storage *Storage) SaveRecords(ctx context.Context, records []*store.Record) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	return retry.Retry(retry.RetryOptions{
+		BaseDelay:  time.Second,
+		MaxDelay:   5 * time.Second,
+		Attempts:   4,
+		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
+	}, func() error {
+		transaction, err := storage.db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		statement := transaction.StmtContext(ctx, storage.statements[saveStatement])
+
+		for _, record := range records {
+			metric := record.Metric
+			if _, err := statement.ExecContext(ctx, metric.Type(), metric.Name(), metric.StringValue(), record.UpdatedAt.UnixNano()); err != nil {
+				if rollbackErr := transaction.Rollback(); rollbackErr != nil {
+					return errors.Join(err, rollbackErr)
+				}
+
+				return err
+			}
+		}
+
+		return transaction.Commit()
+	}, storage.isRetryableError)
+}
+
+func (storage *Storage) Delete(ctx context.Context, name string) error {
+	return storage.exec(ctx, "DELETE FROM metric WHERE name = ?1", name)
+}
+
+func (storage *Storage) DeleteStale(ctx context.Context, name string, cutoff time.Time) (bool, error) {
+	if err := storage.checkStorageClosed(); err != nil {
+		return false, err
+	}
+
+	var deleted int64
+	err := retry.Retry(retry.RetryOptions{
+		BaseDelay:  time.Second,
+		MaxDelay:   5 * time.Second,
+		Attempts:   4,
+		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
+	}, func() error {
+		result, err := storage.db.ExecContext(ctx, "DELETE FROM metric WHERE name = ?1 AND updated_at <= ?2", name, cutoff.UnixNano())
+		if err != nil {
+			return err
+		}
+
+		deleted, err = result.RowsAffected()
+		return err
+	}, storage.isRetryableError)
+
+	return deleted > 0, err
+}
+
+func (storage *Storage) DeleteByPrefix(ctx context.Context, prefix string) error {
+	return storage.exec(ctx, "DELETE FROM metric WHERE substr(name, 1, length(?1)) = ?1", prefix)
+}
+
+func (storage *Storage) Ping(ctx context.Context) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	return storage.db.PingContext(ctx)
+}
+
+func (storage *Storage) Close(ctx context.Context) error {
+	storage.mutex.Lock()
+	defer storage.mutex.Unlock()
+
+	if storage.closed.Load() {
+		return store.ErrStorageClosed
+	}
+
+	if err := storage.db.Close(); err != nil {
+		return err
+	}
+
+	storage.closed.Store(true)
+	return nil
+}
+
+func (storage *Storage) Reset(ctx context.Context) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	return retry.Retry(retry.RetryOptions{
+		BaseDelay:  time.Second,
+		MaxDelay:   5 * time.Second,
+		Attempts:   4,
+		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
+	}, func() error {
+		_, err := storage.db.ExecContext(ctx, "DELETE FROM metric")
+		return err
+	}, storage.isRetryableError)
+}
+
+func (storage *Storage) exec(ctx context.Context, query string, arguments ...any) error {
+	if err := storage.checkStorageClosed(); err != nil {
+		return err
+	}
+
+	return retry.Retry(retry.RetryOptions{
+		BaseDelay:  time.Second,
+		MaxDelay:   5 * time.Second,
+		Attempts:   4,
+		Multiplier: 2,
+		Hook:       retry.HookFromContext(ctx),
+	}, func() error {
+		_, err := storage.db.ExecContext(ctx, query, arguments...)
+		return err
+	}, storage.isRetryableError)
+}
+
+func (storage *Storage) checkStorageClosed() error {
+	if storage.closed.Load() {
+		return store.ErrStorageClosed
+	}
+
+	return nil
+}
+
+func (storage *Storage) isRetryableError(err error) bool {
+	if errors.Is(err, store.ErrTransient) {
+		return true
+	}
+
+	var sqliteErr *driver.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	// extended result codes keep the primary code in the lowest byte.
+	// Only lock conflicts are retried, I/O errors are reported as is
+	switch sqliteErr.Code() & 0xff {
+	case sqlite3.SQLITE_BUSY, sqlite3.SQLITE_LOCKED:
+		return true
+	default:
+		return false
+	}
+}
+
+func (storage *Storage) prepareStatements() {
+	items := []struct {
+		name string
+		sql  string
+	}{
+		{
+			name: getStatement,
+			sql:  "SELECT type, value, updated_at FROM metric WHERE name = ?",
+		},
+		{
+			name: saveStatement,
+			sql: `
+			INSERT INTO metric (type, name, value, updated_at)
+			VALUES (?, ?, ?, ?)
+			ON CONFLICT (name) DO UPDATE
+			SET type = excluded.type, value = excluded.value, updated_at = excluded.updated_at`,
+		},
+	}
+	storage.statements = make(map[string]*sql.Stmt, len(items))
+
+	for _, item := range items {
+		var err error
+		storage.statements[item.name], err = storage.db.Prepare(item.sql)
+		if err != nil {
+			panic(err)
+		}
+	}
+}
+
+// migrate uses own provider, so global state of goose is not shared with storages of other drivers
+func migrate(db *sql.DB) {
+	migrations, err := fs.Sub(embedMigrations, "migrations")
+	if err != nil {
+		panic(err)
+	}
+
+	provider, err := goose.NewProvider(goose.DialectSQLite3, db, migrations)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := provider.Up(context.Background()); err != nil {
+		panic(err)
+	}
+}
+
+func withPragmas(databaseDSN string) string {
+	separator := "?"
+	if strings.Contains(databaseDSN, "?") {
+		separator = "&"
+	}
+
+	for _, pragma := range pragmas {
+		databaseDSN += separator + "_pragma=" + pragma
+		separator = "&"
+	}
+
+	return databaseDSN
+}
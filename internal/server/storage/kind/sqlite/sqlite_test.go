@@ -0,0 +1,256 @@
+package sqlite
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	store "github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/internal/server/storage/storagetest"
+	"github.com/m1khal3v/gometheus/pkg/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	assert.NotPanics(t, func() {
+		storage := New(filepath.Join(t.TempDir(), "metrics.db"))
+		require.NoError(t, storage.Close(context.Background()))
+	})
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) store.Storage {
+		return createStorage(t, context.Background(), nil)
+	})
+}
+
+func TestStorage_Save(t *testing.T) {
+	tests := []struct {
+		name   string
+		preset []metric.Metric
+		metric metric.Metric
+		want   metric.Metric
+	}{
+		{
+			name:   "gauge",
+			metric: gauge.New("m1", 0.1+0.2),
+			want:   gauge.New("m1", 0.1+0.2),
+		},
+		{
+			name:   "counter",
+			metric: counter.New("m1", 1<<60),
+			want:   counter.New("m1", 1<<60),
+		},
+		{
+			name: "update counter",
+			preset: []metric.Metric{
+				counter.New("m1", 123),
+			},
+			metric: counter.New("m1", 5),
+			want:   counter.New("m1", 5), // because the storage should not know about business logic
+		},
+		{
+			name: "gauge -> counter",
+			preset: []metric.Metric{
+				gauge.New("m1", 123.321),
+			},
+			metric: counter.New("m1", 5),
+			want:   counter.New("m1", 5),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := createStorage(t, ctx, tt.preset)
+			require.NoError(t, storage.Save(ctx, tt.metric))
+			got, err := storage.Get(ctx, tt.metric.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStorage_Get(t *testing.T) {
+	tests := []struct {
+		name       string
+		preset     []metric.Metric
+		metricName string
+		want       metric.Metric
+	}{
+		{
+			name: "one metric",
+			preset: []metric.Metric{
+				counter.New("m1", 123),
+			},
+			metricName: "m1",
+			want:       counter.New("m1", 123),
+		},
+		{
+			name: "multiple metrics",
+			preset: []metric.Metric{
+				counter.New("m1", 123),
+				counter.New("m2", 321),
+				gauge.New("m3", 123.321),
+			},
+			metricName: "m2",
+			want:       counter.New("m2", 321),
+		},
+		{
+			name:       "no metrics",
+			preset:     []metric.Metric{},
+			metricName: "m1",
+			want:       nil,
+		},
+		{
+			name: "metric mismatch",
+			preset: []metric.Metric{
+				counter.New("m1", 123),
+			},
+			metricName: "m2",
+			want:       nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := createStorage(t, ctx, tt.preset)
+			got, err := storage.Get(ctx, tt.metricName)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStorage_GetAll(t *testing.T) {
+	tests := []struct {
+		name   string
+		preset []metric.Metric
+	}{
+		{
+			name: "one metric",
+			preset: []metric.Metric{
+				counter.New("m1", 123),
+			},
+		},
+		{
+			name: "multiple metrics",
+			preset: []metric.Metric{
+				counter.New("m1", 123),
+				counter.New("m2", 321),
+				gauge.New("m3", 123.321),
+			},
+		},
+		{
+			name:   "no metrics",
+			preset: []metric.Metric{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := createStorage(t, ctx, tt.preset)
+			seq, err := storage.GetAll(ctx)
+			require.NoError(t, err)
+			got, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.preset, got)
+		})
+	}
+}
+
+func TestStorage_Reset(t *testing.T) {
+	ctx := context.Background()
+	storage := createStorage(t, ctx, []metric.Metric{
+		counter.New("m1", 123),
+		gauge.New("m3", 123.321),
+		counter.New("m2", 321),
+		gauge.New("m4", 321.123),
+	})
+	require.NoError(t, storage.Reset(ctx))
+	seq, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	got, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.Equal(t, []metric.Metric{}, got)
+}
+
+func TestStorage_Persistence(t *testing.T) {
+	ctx := context.Background()
+	dsn := filepath.Join(t.TempDir(), "metrics.db")
+
+	storage := New(dsn)
+	require.NoError(t, storage.SaveBatch(ctx, []metric.Metric{
+		counter.New("m1", 123),
+		gauge.New("m2", 123.321),
+	}))
+	require.NoError(t, storage.Close(ctx))
+
+	storage = New(dsn)
+	t.Cleanup(func() {
+		storage.Close(ctx)
+	})
+	seq, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	got, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []metric.Metric{
+		counter.New("m1", 123),
+		gauge.New("m2", 123.321),
+	}, got)
+}
+
+func TestStorage_Close(t *testing.T) {
+	ctx := context.Background()
+	storage := createStorage(t, ctx, nil)
+	require.NoError(t, storage.Close(ctx))
+	assert.ErrorIs(t, storage.Close(ctx), store.ErrStorageClosed)
+	assert.ErrorIs(t, storage.Save(ctx, counter.New("m1", 1)), store.ErrStorageClosed)
+	assert.ErrorIs(t, storage.Ping(ctx), store.ErrStorageClosed)
+}
+
+func Test_withPragmas(t *testing.T) {
+	tests := []struct {
+		name string
+		dsn  string
+		want string
+	}{
+		{
+			name: "plain path",
+			dsn:  "/tmp/metrics.db",
+			want: "/tmp/metrics.db?_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)",
+		},
+		{
+			name: "uri with params",
+			dsn:  "file:/tmp/metrics.db?mode=rwc",
+			want: "file:/tmp/metrics.db?mode=rwc&_pragma=journal_mode(WAL)&_pragma=synchronous(NORMAL)&_pragma=busy_timeout(5000)",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, withPragmas(tt.dsn))
+		})
+	}
+}
+
+func createStorage(t *testing.T, ctx context.Context, preset []metric.Metric) *Storage {
+	t.Helper()
+	storage := New(filepath.Join(t.TempDir(), "metrics.db"))
+	t.Cleanup(func() {
+		storage.Close(ctx)
+	})
+
+	switch len(preset) {
+	case 0:
+		break
+	case 1:
+		require.NoError(t, storage.Save(ctx, preset[0]))
+	default:
+		require.NoError(t, storage.SaveBatch(ctx, preset))
+	}
+
+	return storage
+}
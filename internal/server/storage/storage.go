@@ -5,18 +5,200 @@ package storage
 import (
 	"context"
 	"errors"
+	"iter"
+	"time"
 
 	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
 )
 
 var ErrStorageClosed = errors.New("storage closed")
 
+// ErrTransient is wrapped by temporary failures, storages treat such errors as retryable
+var ErrTransient = errors.New("transient storage failure")
+
+// Record is metric with time of its last update.
+// Revision of the last save is set by storages implementing ChangeFeed
+type Record struct {
+	Metric    metric.Metric
+	UpdatedAt time.Time
+	Revision  uint64
+	// Deleted is set by change feed for deleted metric, Metric holds the last value then
+	// and UpdatedAt is time of delete
+	Deleted bool
+}
+
 type Storage interface {
-	Save(ctx context.Context, metric metric.Metric) error         // Save one metric to Storage
-	SaveBatch(ctx context.Context, metrics []metric.Metric) error // SaveBatch of metric to Storage
-	Get(ctx context.Context, name string) (metric.Metric, error)  // Get metric from Storage
-	GetAll(ctx context.Context) (<-chan metric.Metric, error)     // GetAll metrics from Storage
-	Ping(ctx context.Context) error                               // Ping Storage connection
-	Reset(ctx context.Context) error                              // Reset Storage (delete all metrics)
-	Close(ctx context.Context) error                              // Close Storage (graceful shutdown)
+	Save(ctx context.Context, metric metric.Metric) error                 // Save one metric to Storage
+	SaveBatch(ctx context.Context, metrics []metric.Metric) error         // SaveBatch of metric to Storage
+	Get(ctx context.Context, name string) (metric.Metric, error)          // Get metric from Storage
+	GetAll(ctx context.Context) (iter.Seq2[metric.Metric, error], error)  // GetAll metrics from Storage, read error is yielded by iterator
+	GetRecord(ctx context.Context, name string) (*Record, error)          // GetRecord returns metric with last update time, nil if metric is not found
+	GetAllRecords(ctx context.Context) (iter.Seq2[*Record, error], error) // GetAllRecords returns all metrics with last update time
+	Delete(ctx context.Context, name string) error                        // Delete metric from Storage, missing metric is not an error
+	DeleteByPrefix(ctx context.Context, prefix string) error              // DeleteByPrefix deletes all metrics which names start with prefix
+	Ping(ctx context.Context) error                                       // Ping Storage connection
+	Reset(ctx context.Context) error                                      // Reset Storage (delete all metrics)
+	Close(ctx context.Context) error                                      // Close Storage (graceful shutdown)
+}
+
+// CounterIncrementer is implemented by storages which add delta to counter atomically,
+// so counters could be updated without external locks
+type CounterIncrementer interface {
+	// IncrementCounter adds delta to counter and returns new value.
+	// Missing metric or metric of another type is replaced by counter with delta value
+	IncrementCounter(ctx context.Context, name string, delta int64) (int64, error)
+	// SaveBatchIncrementing saves gauges and adds counter values to counters in one operation,
+	// so failed batch is not applied partially and could be retried. Names in batch must be unique.
+	// Saved metrics are returned, counters with new values
+	SaveBatchIncrementing(ctx context.Context, metrics []metric.Metric) ([]metric.Metric, error)
+}
+
+// SaveBatchIncrementing uses storage.SaveBatchIncrementing if storage is a CounterIncrementer.
+// Otherwise counters are read and whole batch is saved with one SaveBatch, caller must lock counters of batch
+func SaveBatchIncrementing(ctx context.Context, storage Storage, metrics []metric.Metric) ([]metric.Metric, error) {
+	if incrementer, ok := storage.(CounterIncrementer); ok {
+		return incrementer.SaveBatchIncrementing(ctx, metrics)
+	}
+
+	saved := make([]metric.Metric, 0, len(metrics))
+	for _, metric := range metrics {
+		delta, ok := metric.(*counter.Metric)
+		if !ok {
+			saved = append(saved, metric)
+			continue
+		}
+
+		previous, err := storage.Get(ctx, metric.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		sum := delta.GetValue()
+		if previous, ok := previous.(*counter.Metric); ok {
+			sum += previous.GetValue()
+		}
+		saved = append(saved, counter.New(metric.Name(), sum))
+	}
+
+	if err := storage.SaveBatch(ctx, saved); err != nil {
+		return nil, err
+	}
+
+	return saved, nil
+}
+
+// RecordSaver is implemented by storages which save metrics with known update time, e.g. restored from dump
+type RecordSaver interface {
+	// SaveRecords saves metrics with update time of records, revisions are assigned by storage
+	SaveRecords(ctx context.Context, records []*Record) error
+}
+
+// SaveRecords saves metrics with update time of records. If storage is not a RecordSaver, metrics are saved as updated now
+func SaveRecords(ctx context.Context, storage Storage, records []*Record) error {
+	if saver, ok := storage.(RecordSaver); ok {
+		return saver.SaveRecords(ctx, records)
+	}
+
+	metrics := make([]metric.Metric, 0, len(records))
+	for _, record := range records {
+		metrics = append(metrics, record.Metric)
+	}
+
+	return storage.SaveBatch(ctx, metrics)
+}
+
+// RecordsOf returns records of metrics updated at the same time
+func RecordsOf(metrics []metric.Metric, updatedAt time.Time) []*Record {
+	records := make([]*Record, 0, len(metrics))
+	for _, metric := range metrics {
+		records = append(records, &Record{Metric: metric, UpdatedAt: updatedAt})
+	}
+
+	return records
+}
+
+// StaleDeleter is implemented by storages which check update time and delete metric atomically
+type StaleDeleter interface {
+	// DeleteStale deletes metric only if it was not updated after cutoff and reports whether it was deleted
+	DeleteStale(ctx context.Context, name string, cutoff time.Time) (bool, error)
+}
+
+// DeleteStale uses storage.DeleteStale if storage is a StaleDeleter.
+// Otherwise update time is read before delete, so metric saved between read and delete is deleted too
+func DeleteStale(ctx context.Context, storage Storage, name string, cutoff time.Time) (bool, error) {
+	if deleter, ok := storage.(StaleDeleter); ok {
+		return deleter.DeleteStale(ctx, name, cutoff)
+	}
+
+	record, err := storage.GetRecord(ctx, name)
+	if err != nil || record == nil || record.UpdatedAt.After(cutoff) {
+		return false, err
+	}
+
+	return true, storage.Delete(ctx, name)
+}
+
+// ChangeKind defines what was changed in storage
+type ChangeKind byte
+
+const (
+	// ChangeSave means metric was saved
+	ChangeSave ChangeKind = iota
+	// ChangeDelete means metric was deleted
+	ChangeDelete
+	// ChangeAll means any metric could be changed, e.g. storage was reset or notifications were lost
+	ChangeAll
+)
+
+// Change of storage made by another process. Name is empty for ChangeAll
+type Change struct {
+	Kind ChangeKind
+	Name string
+}
+
+// ChangeSubscriber is implemented by storages shared by several processes (server replicas),
+// so local state derived from storage could be invalidated
+type ChangeSubscriber interface {
+	// Subscribe registers handler of changes made by other processes and returns unsubscribe function.
+	// Handlers are called sequentially from one goroutine, so they must not block
+	Subscribe(handler func(change Change)) (unsubscribe func())
+}
+
+// Wrapper is implemented by storage decorators
+type Wrapper interface {
+	Unwrap() Storage // Unwrap returns decorated storage
+}
+
+// FindChangeSubscriber searches decorated storages chain for ChangeSubscriber
+func FindChangeSubscriber(storage Storage) (ChangeSubscriber, bool) {
+	for storage != nil {
+		if subscriber, ok := storage.(ChangeSubscriber); ok {
+			return subscriber, true
+		}
+
+		wrapper, ok := storage.(Wrapper)
+		if !ok {
+			return nil, false
+		}
+		storage = wrapper.Unwrap()
+	}
+
+	return nil, false
+}
+
+// MetricsOf drops update time of records
+func MetricsOf(records iter.Seq2[*Record, error]) iter.Seq2[metric.Metric, error] {
+	return func(yield func(metric.Metric, error) bool) {
+		for record, err := range records {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			if !yield(record.Metric, nil) {
+				return
+			}
+		}
+	}
 }
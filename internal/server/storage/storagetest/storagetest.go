@@ -0,0 +1,1065 @@
+// Package storagetest
+// contains conformance tests shared by storage implementations.
+// Storage passes the suite if it is run with race detector as well
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
+	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
+	"github.com/m1khal3v/gometheus/pkg/slice"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Factory creates empty storage for a single test. Cleanup should be registered via t.Cleanup
+type Factory func(t *testing.T) storage.Storage
+
+// Run all shared tests against storage created by factory
+func Run(t *testing.T, factory Factory) {
+	t.Run("Save", func(t *testing.T) { RunSave(t, factory) })
+	t.Run("SaveBatch", func(t *testing.T) { RunSaveBatch(t, factory) })
+	t.Run("SaveRecords", func(t *testing.T) { RunSaveRecords(t, factory) })
+	t.Run("SaveBatchIncrementing", func(t *testing.T) { RunSaveBatchIncrementing(t, factory) })
+	t.Run("Get", func(t *testing.T) { RunGet(t, factory) })
+	t.Run("GetAll", func(t *testing.T) { RunGetAll(t, factory) })
+	t.Run("GetRecord", func(t *testing.T) { RunGetRecord(t, factory) })
+	t.Run("GetAllRecords", func(t *testing.T) { RunGetAllRecords(t, factory) })
+	t.Run("GetFiltered", func(t *testing.T) { RunGetFiltered(t, factory) })
+	t.Run("Changes", func(t *testing.T) { RunChanges(t, factory) })
+	t.Run("ChangesConcurrent", func(t *testing.T) { RunChangesConcurrent(t, factory) })
+	t.Run("WriteRecords", func(t *testing.T) { RunWriteRecords(t, factory) })
+	t.Run("Delete", func(t *testing.T) { RunDelete(t, factory) })
+	t.Run("DeleteStale", func(t *testing.T) { RunDeleteStale(t, factory) })
+	t.Run("DeleteByPrefix", func(t *testing.T) { RunDeleteByPrefix(t, factory) })
+	t.Run("Reset", func(t *testing.T) { RunReset(t, factory) })
+	t.Run("GetAllCancel", func(t *testing.T) { RunGetAllCancel(t, factory) })
+	t.Run("Concurrent", func(t *testing.T) { RunConcurrent(t, factory) })
+	t.Run("Closed", func(t *testing.T) { RunClosed(t, factory) })
+}
+
+func RunSave(t *testing.T, factory Factory) {
+	tests := []struct {
+		name   string
+		preset []metric.Metric
+		metric metric.Metric
+		want   metric.Metric
+	}{
+		{
+			name:   "set gauge",
+			metric: gauge.New("m1", 123.321),
+			want:   gauge.New("m1", 123.321),
+		},
+		{
+			name:   "set counter",
+			metric: counter.New("m1", 123),
+			want:   counter.New("m1", 123),
+		},
+		{
+			name:   "update counter",
+			preset: []metric.Metric{counter.New("m1", 123)},
+			metric: counter.New("m1", 5),
+			want:   counter.New("m1", 5), // because the storage should not know about business logic
+		},
+		{
+			name:   "gauge -> counter",
+			preset: []metric.Metric{gauge.New("m1", 123.321)},
+			metric: counter.New("m1", 5),
+			want:   counter.New("m1", 5),
+		},
+		{
+			name:   "counter -> gauge",
+			preset: []metric.Metric{counter.New("m1", 123)},
+			metric: gauge.New("m1", 123.321),
+			want:   gauge.New("m1", 123.321),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := factory(t)
+			for _, metric := range tt.preset {
+				require.NoError(t, storage.Save(ctx, metric))
+			}
+			require.NoError(t, storage.Save(ctx, tt.metric))
+			got, err := storage.Get(ctx, tt.metric.Name())
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func RunSaveBatch(t *testing.T, factory Factory) {
+	tests := []struct {
+		name    string
+		preset  []metric.Metric
+		metrics []metric.Metric
+		want    []metric.Metric
+	}{
+		{
+			name: "new metrics",
+			metrics: []metric.Metric{
+				gauge.New("m1", 123.321),
+				counter.New("m2", 123),
+			},
+			want: []metric.Metric{
+				gauge.New("m1", 123.321),
+				counter.New("m2", 123),
+			},
+		},
+		{
+			name: "replace metrics",
+			preset: []metric.Metric{
+				gauge.New("m1", 321.123),
+				counter.New("m2", 321),
+				gauge.New("m3", 1),
+			},
+			metrics: []metric.Metric{
+				gauge.New("m1", 123.321),
+				counter.New("m2", 123),
+			},
+			want: []metric.Metric{
+				gauge.New("m1", 123.321),
+				counter.New("m2", 123),
+				gauge.New("m3", 1),
+			},
+		},
+		{
+			name: "same name in batch, last wins",
+			metrics: []metric.Metric{
+				counter.New("m1", 1),
+				gauge.New("m2", 1.5),
+				gauge.New("m1", 2.5),
+				gauge.New("m2", 3.5),
+			},
+			want: []metric.Metric{
+				gauge.New("m1", 2.5),
+				gauge.New("m2", 3.5),
+			},
+		},
+		{
+			name: "empty batch",
+			preset: []metric.Metric{
+				gauge.New("m1", 1),
+			},
+			metrics: []metric.Metric{},
+			want: []metric.Metric{
+				gauge.New("m1", 1),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := factory(t)
+			if len(tt.preset) > 0 {
+				require.NoError(t, storage.SaveBatch(ctx, tt.preset))
+			}
+			require.NoError(t, storage.SaveBatch(ctx, tt.metrics))
+			seq, err := storage.GetAll(ctx)
+			require.NoError(t, err)
+			all, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, all)
+		})
+	}
+}
+
+func RunGet(t *testing.T, factory Factory) {
+	tests := []struct {
+		name       string
+		preset     []metric.Metric
+		metricName string
+		want       metric.Metric
+	}{
+		{
+			name:       "empty storage",
+			metricName: "m1",
+			want:       nil,
+		},
+		{
+			name: "defined name",
+			preset: []metric.Metric{
+				counter.New("m1", 1),
+				gauge.New("m2", 1.1),
+			},
+			metricName: "m1",
+			want:       counter.New("m1", 1),
+		},
+		{
+			name: "undefined name",
+			preset: []metric.Metric{
+				gauge.New("m2", 1.1),
+			},
+			metricName: "m1",
+			want:       nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := factory(t)
+			for _, metric := range tt.preset {
+				require.NoError(t, storage.Save(ctx, metric))
+			}
+			got, err := storage.Get(ctx, tt.metricName)
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func RunGetAll(t *testing.T, factory Factory) {
+	tests := []struct {
+		name   string
+		preset []metric.Metric
+	}{
+		{
+			name:   "empty storage",
+			preset: []metric.Metric{},
+		},
+		{
+			name: "not empty storage",
+			preset: []metric.Metric{
+				gauge.New("m1", 123.321),
+				counter.New("m2", 123),
+				gauge.New("m3", 0.1+0.2),
+				counter.New("m4", -1),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := factory(t)
+			for _, metric := range tt.preset {
+				require.NoError(t, storage.Save(ctx, metric))
+			}
+			seq, err := storage.GetAll(ctx)
+			require.NoError(t, err)
+			all, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.preset, all)
+		})
+	}
+}
+
+// timePrecision is the coarsest update time precision of storages (pgsql keeps microseconds)
+const timePrecision = time.Millisecond
+
+func RunGetRecord(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	storage := factory(t)
+
+	record, err := storage.GetRecord(ctx, "m1")
+	require.NoError(t, err)
+	assert.Nil(t, record)
+
+	before := time.Now()
+	require.NoError(t, storage.Save(ctx, counter.New("m1", 1)))
+	after := time.Now()
+
+	record, err = storage.GetRecord(ctx, "m1")
+	require.NoError(t, err)
+	require.NotNil(t, record)
+	assert.Equal(t, counter.New("m1", 1), record.Metric)
+	assert.WithinRange(t, record.UpdatedAt, before.Add(-timePrecision), after.Add(timePrecision))
+
+	time.Sleep(2 * timePrecision)
+	require.NoError(t, storage.SaveBatch(ctx, []metric.Metric{counter.New("m1", 2)}))
+
+	updated, err := storage.GetRecord(ctx, "m1")
+	require.NoError(t, err)
+	require.NotNil(t, updated)
+	assert.Equal(t, counter.New("m1", 2), updated.Metric)
+	assert.True(t, updated.UpdatedAt.After(record.UpdatedAt), "update time is not refreshed")
+}
+
+func RunGetAllRecords(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	storage := factory(t)
+	metrics := []metric.Metric{
+		gauge.New("m1", 123.321),
+		counter.New("m2", 123),
+	}
+
+	before := time.Now()
+	require.NoError(t, storage.SaveBatch(ctx, metrics))
+	after := time.Now()
+
+	seq, err := storage.GetAllRecords(ctx)
+	require.NoError(t, err)
+	records, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+
+	all := make([]metric.Metric, 0, len(records))
+	for _, record := range records {
+		all = append(all, record.Metric)
+		assert.WithinRange(t, record.UpdatedAt, before.Add(-timePrecision), after.Add(timePrecision))
+	}
+	assert.ElementsMatch(t, metrics, all)
+}
+
+// RunSaveRecords checks storage.SaveRecords, storages implementing storage.RecordSaver keep update time of records
+func RunSaveRecords(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	saver := factory(t)
+	_, keepsTime := saver.(storage.RecordSaver)
+	updatedAt := time.Now().Add(-time.Hour).Truncate(timePrecision)
+	before := time.Now()
+	require.NoError(t, storage.SaveRecords(ctx, saver, []*storage.Record{
+		{Metric: gauge.New("m1", 123.321), UpdatedAt: updatedAt},
+		{Metric: counter.New("m2", 123), UpdatedAt: updatedAt.Add(time.Minute)},
+	}))
+	after := time.Now()
+
+	for name, want := range map[string]*storage.Record{
+		"m1": {Metric: gauge.New("m1", 123.321), UpdatedAt: updatedAt},
+		"m2": {Metric: counter.New("m2", 123), UpdatedAt: updatedAt.Add(time.Minute)},
+	} {
+		record, err := saver.GetRecord(ctx, name)
+		require.NoError(t, err)
+		require.NotNil(t, record)
+		assert.Equal(t, want.Metric, record.Metric)
+		if keepsTime {
+			assert.WithinRange(t, record.UpdatedAt, want.UpdatedAt.Add(-timePrecision), want.UpdatedAt.Add(timePrecision))
+		} else {
+			assert.WithinRange(t, record.UpdatedAt, before.Add(-timePrecision), after.Add(timePrecision))
+		}
+	}
+}
+
+// RunSaveBatchIncrementing checks storage.SaveBatchIncrementing, so storages implementing storage.CounterIncrementer behave as fallback
+func RunSaveBatchIncrementing(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	incrementer := factory(t)
+	require.NoError(t, incrementer.SaveBatch(ctx, []metric.Metric{
+		counter.New("c1", 10),
+		gauge.New("c2", 1.5),
+		counter.New("g1", 1),
+	}))
+
+	saved, err := storage.SaveBatchIncrementing(ctx, incrementer, []metric.Metric{
+		counter.New("c1", 5),
+		counter.New("c2", 2),
+		counter.New("c3", -3),
+		gauge.New("g1", 0.1+0.2),
+	})
+	require.NoError(t, err)
+	want := []metric.Metric{
+		counter.New("c1", 15),
+		counter.New("c2", 2),
+		counter.New("c3", -3),
+		gauge.New("g1", 0.1+0.2),
+	}
+	assert.ElementsMatch(t, want, saved)
+
+	for _, metric := range want {
+		got, err := incrementer.Get(ctx, metric.Name())
+		require.NoError(t, err)
+		assert.Equal(t, metric, got)
+	}
+}
+
+// RunGetFiltered checks storage.GetFiltered, so storages implementing storage.Filterer behave as fallback
+func RunGetFiltered(t *testing.T, factory Factory) {
+	preset := []metric.Metric{
+		gauge.New("cpu.user", 1.5),
+		counter.New("cpu.count", 2),
+		gauge.New("cpu/core1.user", 3.5),
+		gauge.New("mem.free", 4.5),
+		counter.New("mem.swaps", 5),
+		gauge.New("Z", 6.5),
+	}
+	tests := []struct {
+		name   string
+		filter storage.Filter
+		want   []string
+	}{
+		{
+			name:   "all sorted bytewise",
+			filter: storage.Filter{},
+			want:   []string{"Z", "cpu.count", "cpu.user", "cpu/core1.user", "mem.free", "mem.swaps"},
+		},
+		{
+			name:   "descending",
+			filter: storage.Filter{Descending: true},
+			want:   []string{"mem.swaps", "mem.free", "cpu/core1.user", "cpu.user", "cpu.count", "Z"},
+		},
+		{
+			name:   "type",
+			filter: storage.Filter{Type: counter.MetricType},
+			want:   []string{"cpu.count", "mem.swaps"},
+		},
+		{
+			name:   "prefix",
+			filter: storage.Filter{Prefix: "cpu"},
+			want:   []string{"cpu.count", "cpu.user", "cpu/core1.user"},
+		},
+		{
+			name:   "star does not match slash",
+			filter: storage.Filter{Match: "*.user"},
+			want:   []string{"cpu.user"},
+		},
+		{
+			name:   "character class",
+			filter: storage.Filter{Match: "[a-m]*.?????"},
+			want:   []string{"cpu.count", "mem.swaps"},
+		},
+		{
+			name:   "escaped pattern",
+			filter: storage.Filter{Match: `cpu\/core[0-9]\.user`},
+			want:   []string{"cpu/core1.user"},
+		},
+		{
+			name:   "cursor",
+			filter: storage.Filter{After: "cpu.user"},
+			want:   []string{"cpu/core1.user", "mem.free", "mem.swaps"},
+		},
+		{
+			name:   "descending cursor",
+			filter: storage.Filter{After: "cpu.user", Descending: true},
+			want:   []string{"cpu.count", "Z"},
+		},
+		{
+			name:   "combined with limit",
+			filter: storage.Filter{Type: gauge.MetricType, Prefix: "c", After: "cpu.count", Limit: 1},
+			want:   []string{"cpu.user"},
+		},
+	}
+	ctx := context.Background()
+	filtered := factory(t)
+	require.NoError(t, filtered.SaveBatch(ctx, preset))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seq, err := storage.GetFiltered(ctx, filtered, tt.filter)
+			require.NoError(t, err)
+			records, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+
+			names := make([]string, 0, len(records))
+			for _, record := range records {
+				names = append(names, record.Metric.Name())
+				assert.True(t, tt.filter.Matches(record))
+			}
+			assert.Equal(t, tt.want, names)
+		})
+	}
+
+	t.Run("bad pattern", func(t *testing.T) {
+		_, err := storage.GetFiltered(ctx, filtered, storage.Filter{Match: "[a-"})
+		assert.ErrorIs(t, err, path.ErrBadPattern)
+	})
+}
+
+// RunChanges checks storage.ChangeFeed, storages which do not implement it are skipped
+func RunChanges(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	feed := factory(t)
+	start, err := storage.Revision(ctx, feed)
+	if errors.Is(err, storage.ErrChangesNotSupported) {
+		t.Skip("storage does not implement change feed")
+	}
+	require.NoError(t, err)
+
+	changes := func(since uint64) ([]*storage.Record, uint64) {
+		seq, head, err := storage.GetChanges(ctx, feed, since)
+		require.NoError(t, err)
+		records, err := slice.FromSeq2(seq)
+		require.NoError(t, err)
+
+		return records, head
+	}
+	names := func(records []*storage.Record) []string {
+		names := make([]string, 0, len(records))
+		for _, record := range records {
+			names = append(names, record.Metric.Name())
+		}
+
+		return names
+	}
+
+	records, head := changes(start)
+	assert.Empty(t, records)
+	assert.Equal(t, start, head)
+
+	require.NoError(t, feed.Save(ctx, gauge.New("m1", 1)))
+	require.NoError(t, feed.SaveBatch(ctx, []metric.Metric{counter.New("m2", 2), gauge.New("m3", 3)}))
+
+	records, head = changes(start)
+	// buffering storages could save metrics in another order
+	assert.ElementsMatch(t, []string{"m1", "m2", "m3"}, names(records))
+	require.Len(t, records, 3)
+	assert.Contains(t, []metric.Metric{records[0].Metric, records[1].Metric, records[2].Metric}, gauge.New("m1", 1))
+	assert.Greater(t, records[0].Revision, start)
+	assert.LessOrEqual(t, records[0].Revision, records[1].Revision)
+	assert.LessOrEqual(t, records[1].Revision, records[2].Revision)
+	assert.LessOrEqual(t, records[2].Revision, head)
+	for _, record := range records {
+		assert.False(t, record.Deleted)
+	}
+	revision, err := storage.Revision(ctx, feed)
+	require.NoError(t, err)
+	assert.Equal(t, head, revision)
+
+	records, next := changes(head)
+	assert.Empty(t, records)
+	assert.Equal(t, head, next)
+
+	// deleted metric is reported with its last value
+	require.NoError(t, feed.Delete(ctx, "m3"))
+	require.NoError(t, feed.Delete(ctx, "missing"))
+	records, next = changes(head)
+	require.Len(t, records, 1)
+	assert.Equal(t, gauge.New("m3", 3), records[0].Metric)
+	assert.True(t, records[0].Deleted)
+	assert.Greater(t, records[0].Revision, head)
+	assert.Equal(t, records[0].Revision, next)
+	// metric deleted again is not reported again
+	require.NoError(t, feed.Delete(ctx, "m3"))
+	records, head = changes(next)
+	assert.Empty(t, records)
+	assert.Equal(t, next, head)
+
+	require.NoError(t, feed.Save(ctx, gauge.New("m1", 4)))
+	require.NoError(t, feed.Save(ctx, gauge.New("m3", 5)))
+	records, next = changes(head)
+	assert.Equal(t, []string{"m1", "m3"}, names(records))
+	assert.Equal(t, gauge.New("m1", 4), records[0].Metric)
+	assert.Equal(t, gauge.New("m3", 5), records[1].Metric)
+	assert.False(t, records[1].Deleted)
+	assert.Greater(t, records[0].Revision, head)
+	assert.Equal(t, records[1].Revision, next)
+
+	// revisions are not reused after reset, reset metrics are reported as deleted
+	require.NoError(t, feed.Reset(ctx))
+	records, head = changes(next)
+	assert.ElementsMatch(t, []string{"m1", "m2", "m3"}, names(records))
+	for _, record := range records {
+		assert.True(t, record.Deleted)
+		assert.Greater(t, record.Revision, next)
+	}
+	records, _ = changes(head)
+	assert.Empty(t, records)
+	require.NoError(t, feed.Save(ctx, gauge.New("m1", 6)))
+	records, next = changes(head)
+	assert.Equal(t, []string{"m1"}, names(records))
+	assert.False(t, records[0].Deleted)
+	seq, err := feed.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.Equal(t, []metric.Metric{gauge.New("m1", 6)}, all)
+	head = next
+
+	require.NoError(t, storage.AdvanceRevision(ctx, feed, head+100))
+	require.NoError(t, storage.AdvanceRevision(ctx, feed, head))
+	revision, err = storage.Revision(ctx, feed)
+	require.NoError(t, err)
+	assert.Equal(t, head+100, revision)
+	require.NoError(t, feed.Save(ctx, gauge.New("m2", 7)))
+	records, _ = changes(head + 100)
+	assert.Equal(t, []string{"m2"}, names(records))
+	assert.Greater(t, records[0].Revision, head+100)
+}
+
+// RunWriteRecords checks storage.RevisionWriter, written records must be the same as records read from storage.
+// Storages which do not implement change feed are skipped
+func RunWriteRecords(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	writer := factory(t)
+	if !storage.HasChangeFeed(writer) {
+		t.Skip("storage does not implement change feed")
+	}
+	if _, ok := writer.(storage.RevisionWriter); !ok {
+		t.Skip("storage does not implement revision writer")
+	}
+
+	assertStored := func(written []*storage.Record) {
+		for _, record := range written {
+			assert.NotZero(t, record.Revision)
+			stored, err := writer.GetRecord(ctx, record.Metric.Name())
+			require.NoError(t, err)
+			require.NotNil(t, stored)
+			assert.Equal(t, stored.Metric, record.Metric)
+			assert.Equal(t, stored.Revision, record.Revision)
+			assert.WithinRange(t, record.UpdatedAt, stored.UpdatedAt.Add(-timePrecision), stored.UpdatedAt.Add(timePrecision))
+		}
+	}
+
+	written, err := storage.WriteRecords(ctx, writer, []*storage.Record{
+		{Metric: gauge.New("m1", 123.321), UpdatedAt: time.Now()},
+		{Metric: counter.New("m2", 10), UpdatedAt: time.Now()},
+	})
+	require.NoError(t, err)
+	require.Len(t, written, 2)
+	assertStored(written)
+
+	written, err = storage.WriteBatchIncrementing(ctx, writer, []metric.Metric{
+		counter.New("m2", 5),
+		counter.New("m3", -3),
+		gauge.New("m1", 0.5),
+	})
+	require.NoError(t, err)
+	require.Len(t, written, 3)
+	assertStored(written)
+	values := make([]metric.Metric, 0, len(written))
+	for _, record := range written {
+		values = append(values, record.Metric)
+	}
+	assert.ElementsMatch(t, []metric.Metric{counter.New("m2", 15), counter.New("m3", -3), gauge.New("m1", 0.5)}, values)
+}
+
+// RunChangesConcurrent follows change feed while metrics are saved and deleted, so state built from feed must match storage
+func RunChangesConcurrent(t *testing.T, factory Factory) {
+	const writers = 4
+	const iterations = 50
+
+	ctx := context.Background()
+	feed := factory(t)
+	since, err := storage.Revision(ctx, feed)
+	if errors.Is(err, storage.ErrChangesNotSupported) {
+		t.Skip("storage does not implement change feed")
+	}
+	require.NoError(t, err)
+
+	wg := &sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				assert.NoError(t, feed.Save(ctx, gauge.New(fmt.Sprintf("g%d", i), float64(j))))
+				assert.NoError(t, feed.SaveBatch(ctx, []metric.Metric{
+					counter.New(fmt.Sprintf("c%d", i), int64(j)),
+					gauge.New("shared", float64(j)),
+				}))
+				if j%3 == 0 {
+					assert.NoError(t, feed.Delete(ctx, fmt.Sprintf("c%d", i)))
+				}
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	followed := map[string]metric.Metric{}
+	follow := func() {
+		seq, head, err := storage.GetChanges(ctx, feed, since)
+		require.NoError(t, err)
+		for record, err := range seq {
+			require.NoError(t, err)
+			assert.Greater(t, record.Revision, since)
+			assert.LessOrEqual(t, record.Revision, head)
+			if record.Deleted {
+				delete(followed, record.Metric.Name())
+			} else {
+				followed[record.Metric.Name()] = record.Metric
+			}
+		}
+		since = head
+	}
+	for following := true; following; {
+		select {
+		case <-done:
+			following = false
+		default:
+		}
+		follow()
+	}
+	follow()
+
+	seq, err := feed.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	stored := map[string]metric.Metric{}
+	for _, metric := range all {
+		stored[metric.Name()] = metric
+	}
+	assert.Equal(t, stored, followed)
+}
+
+func RunDelete(t *testing.T, factory Factory) {
+	tests := []struct {
+		name       string
+		preset     []metric.Metric
+		metricName string
+		want       []metric.Metric
+	}{
+		{
+			name: "existing metric",
+			preset: []metric.Metric{
+				counter.New("m1", 123),
+				gauge.New("m2", 123.321),
+			},
+			metricName: "m1",
+			want:       []metric.Metric{gauge.New("m2", 123.321)},
+		},
+		{
+			name:       "missing metric",
+			preset:     []metric.Metric{counter.New("m1", 123)},
+			metricName: "m2",
+			want:       []metric.Metric{counter.New("m1", 123)},
+		},
+		{
+			name:       "no metrics",
+			metricName: "m1",
+			want:       []metric.Metric{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := factory(t)
+			if len(tt.preset) > 0 {
+				require.NoError(t, storage.SaveBatch(ctx, tt.preset))
+			}
+
+			require.NoError(t, storage.Delete(ctx, tt.metricName))
+
+			got, err := storage.Get(ctx, tt.metricName)
+			require.NoError(t, err)
+			assert.Nil(t, got)
+			seq, err := storage.GetAll(ctx)
+			require.NoError(t, err)
+			all, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, all)
+		})
+	}
+}
+
+// RunDeleteStale checks storage.DeleteStale, so storages implementing storage.StaleDeleter behave as fallback
+func RunDeleteStale(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	deleter := factory(t)
+	require.NoError(t, deleter.SaveBatch(ctx, []metric.Metric{
+		counter.New("m1", 123),
+		gauge.New("m2", 123.321),
+	}))
+
+	deleted, err := storage.DeleteStale(ctx, deleter, "m1", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.True(t, deleted)
+
+	deleted, err = storage.DeleteStale(ctx, deleter, "m2", time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	deleted, err = storage.DeleteStale(ctx, deleter, "m3", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.False(t, deleted)
+
+	seq, err := deleter.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []metric.Metric{gauge.New("m2", 123.321)}, all)
+}
+
+func RunDeleteByPrefix(t *testing.T, factory Factory) {
+	preset := []metric.Metric{
+		counter.New("cpu_user", 1),
+		gauge.New("cpu_system", 1.5),
+		gauge.New("cpu", 2.5),
+		counter.New("memory_used", 3),
+		counter.New("a_cpu_user", 4),
+	}
+	tests := []struct {
+		name   string
+		prefix string
+		want   []metric.Metric
+	}{
+		{
+			name:   "matching prefix",
+			prefix: "cpu_",
+			want: []metric.Metric{
+				gauge.New("cpu", 2.5),
+				counter.New("memory_used", 3),
+				counter.New("a_cpu_user", 4),
+			},
+		},
+		{
+			name:   "whole name",
+			prefix: "cpu",
+			want: []metric.Metric{
+				counter.New("memory_used", 3),
+				counter.New("a_cpu_user", 4),
+			},
+		},
+		{
+			name:   "wildcard characters are not special",
+			prefix: "%_",
+			want:   preset,
+		},
+		{
+			name:   "no matches",
+			prefix: "disk",
+			want:   preset,
+		},
+		{
+			name:   "empty prefix",
+			prefix: "",
+			want:   []metric.Metric{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			storage := factory(t)
+			require.NoError(t, storage.SaveBatch(ctx, preset))
+
+			require.NoError(t, storage.DeleteByPrefix(ctx, tt.prefix))
+
+			seq, err := storage.GetAll(ctx)
+			require.NoError(t, err)
+			all, err := slice.FromSeq2(seq)
+			require.NoError(t, err)
+			assert.ElementsMatch(t, tt.want, all)
+		})
+	}
+}
+
+func RunReset(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	storage := factory(t)
+	require.NoError(t, storage.SaveBatch(ctx, []metric.Metric{
+		counter.New("m1", 123),
+		gauge.New("m2", 123.321),
+	}))
+	require.NoError(t, storage.Reset(ctx))
+
+	got, err := storage.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Nil(t, got)
+
+	seq, err := storage.GetAll(ctx)
+	require.NoError(t, err)
+	all, err := slice.FromSeq2(seq)
+	require.NoError(t, err)
+	assert.Empty(t, all)
+
+	require.NoError(t, storage.Save(ctx, counter.New("m1", 1)))
+	got, err = storage.Get(ctx, "m1")
+	require.NoError(t, err)
+	assert.Equal(t, counter.New("m1", 1), got)
+}
+
+// RunGetAllCancel checks that iteration is stopped by context and storage is usable after it
+func RunGetAllCancel(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	storage := factory(t)
+	metrics := make([]metric.Metric, 0, 600)
+	for i := 0; i < cap(metrics); i++ {
+		metrics = append(metrics, gauge.New(fmt.Sprintf("m%03d", i), float64(i)))
+	}
+	require.NoError(t, storage.SaveBatch(ctx, metrics))
+
+	t.Run("during iteration", func(t *testing.T) {
+		cancelCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		seq, err := storage.GetAll(cancelCtx)
+		require.NoError(t, err)
+
+		count := 0
+		var iterationErr error
+		for _, err := range seq {
+			if err != nil {
+				iterationErr = err
+				break
+			}
+
+			count++
+			if count == 10 {
+				cancel()
+			}
+		}
+		assert.ErrorIs(t, iterationErr, context.Canceled)
+		assert.Less(t, count, len(metrics))
+	})
+
+	t.Run("before iteration", func(t *testing.T) {
+		cancelCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		assert.ErrorIs(t, readAll(cancelCtx, storage), context.Canceled)
+	})
+
+	// resources of stopped iteration are released
+	got, err := storage.Get(ctx, "m001")
+	require.NoError(t, err)
+	assert.Equal(t, gauge.New("m001", 1), got)
+	require.NoError(t, readAll(ctx, storage))
+}
+
+// RunConcurrent runs writers and readers in parallel, each writer owns its metrics
+func RunConcurrent(t *testing.T, factory Factory) {
+	const writers = 8
+	const iterations = 25
+
+	ctx := context.Background()
+	storage := factory(t)
+	wg := &sync.WaitGroup{}
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < iterations; j++ {
+				assert.NoError(t, storage.Save(ctx, gauge.New(fmt.Sprintf("g%d", i), float64(j))))
+				assert.NoError(t, storage.SaveBatch(ctx, []metric.Metric{
+					counter.New(fmt.Sprintf("c%d", i), int64(j)),
+					gauge.New("shared", float64(j)),
+				}))
+				assert.NoError(t, storage.Save(ctx, counter.New(fmt.Sprintf("tmp%d", i), 1)))
+				assert.NoError(t, storage.Delete(ctx, fmt.Sprintf("tmp%d", i)))
+
+				_, err := storage.Get(ctx, "shared")
+				assert.NoError(t, err)
+				assert.NoError(t, readAll(ctx, storage))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := 0; i < writers; i++ {
+		got, err := storage.Get(ctx, fmt.Sprintf("g%d", i))
+		require.NoError(t, err)
+		assert.Equal(t, gauge.New(fmt.Sprintf("g%d", i), iterations-1), got)
+
+		got, err = storage.Get(ctx, fmt.Sprintf("c%d", i))
+		require.NoError(t, err)
+		assert.Equal(t, counter.New(fmt.Sprintf("c%d", i), iterations-1), got)
+
+		got, err = storage.Get(ctx, fmt.Sprintf("tmp%d", i))
+		require.NoError(t, err)
+		assert.Nil(t, got)
+	}
+
+	got, err := storage.Get(ctx, "shared")
+	require.NoError(t, err)
+	assert.Equal(t, gauge.MetricType, got.Type())
+}
+
+// RunClosed checks that every method of closed storage returns storage.ErrStorageClosed
+func RunClosed(t *testing.T, factory Factory) {
+	ctx := context.Background()
+	closed := factory(t)
+	require.NoError(t, closed.Save(ctx, counter.New("m1", 1)))
+	// decorators implement ChangeFeed even if decorated storage does not
+	_, err := storage.Revision(ctx, closed)
+	changes := !errors.Is(err, storage.ErrChangesNotSupported)
+	require.NoError(t, closed.Close(ctx))
+
+	operations := map[string]func() error{
+		"Save": func() error {
+			return closed.Save(ctx, counter.New("m1", 1))
+		},
+		"SaveBatch": func() error {
+			return closed.SaveBatch(ctx, []metric.Metric{counter.New("m1", 1)})
+		},
+		"SaveRecords": func() error {
+			return storage.SaveRecords(ctx, closed, []*storage.Record{{Metric: counter.New("m1", 1), UpdatedAt: time.Now()}})
+		},
+		"Get": func() error {
+			_, err := closed.Get(ctx, "m1")
+			return err
+		},
+		"GetRecord": func() error {
+			_, err := closed.GetRecord(ctx, "m1")
+			return err
+		},
+		"GetAll": func() error {
+			return readAll(ctx, closed)
+		},
+		"GetAllRecords": func() error {
+			seq, err := closed.GetAllRecords(ctx)
+			if err != nil {
+				return err
+			}
+			_, err = slice.FromSeq2(seq)
+			return err
+		},
+		"GetFiltered": func() error {
+			seq, err := storage.GetFiltered(ctx, closed, storage.Filter{})
+			if err != nil {
+				return err
+			}
+			_, err = slice.FromSeq2(seq)
+			return err
+		},
+		"Delete": func() error {
+			return closed.Delete(ctx, "m1")
+		},
+		"DeleteStale": func() error {
+			_, err := storage.DeleteStale(ctx, closed, "m1", time.Now())
+			return err
+		},
+		"DeleteByPrefix": func() error {
+			return closed.DeleteByPrefix(ctx, "m")
+		},
+		"Ping": func() error {
+			return closed.Ping(ctx)
+		},
+		"Reset": func() error {
+			return closed.Reset(ctx)
+		},
+		"Close": func() error {
+			return closed.Close(ctx)
+		},
+	}
+	if changes {
+		operations["GetChanges"] = func() error {
+			seq, _, err := storage.GetChanges(ctx, closed, 0)
+			if err != nil {
+				return err
+			}
+			_, err = slice.FromSeq2(seq)
+			return err
+		}
+		operations["Revision"] = func() error {
+			_, err := storage.Revision(ctx, closed)
+			return err
+		}
+	}
+	if incrementer, ok := closed.(storage.CounterIncrementer); ok {
+		operations["IncrementCounter"] = func() error {
+			_, err := incrementer.IncrementCounter(ctx, "m1", 1)
+			return err
+		}
+		operations["SaveBatchIncrementing"] = func() error {
+			_, err := incrementer.SaveBatchIncrementing(ctx, []metric.Metric{counter.New("m1", 1)})
+			return err
+		}
+	}
+
+	for name, operation := range operations {
+		t.Run(name, func(t *testing.T) {
+			assert.ErrorIs(t, operation(), storage.ErrStorageClosed)
+		})
+	}
+}
+
+// readAll drains GetAll, error is returned either by GetAll or by iterator
+func readAll(ctx context.Context, storage storage.Storage) error {
+	seq, err := storage.GetAll(ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = slice.FromSeq2(seq)
+	return err
+}
@@ -9,7 +9,7 @@ import (
 	"io"
 	"sync"
 
-	"github.com/m1khal3v/gometheus/internal/common/metric"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
 )
 
 type Storage struct {
@@ -25,13 +25,13 @@ func New() *Storage {
 	}
 }
 
-func (storage *Storage) ExecuteAllMetricsTemplate(writer io.Writer, metrics <-chan metric.Metric) error {
+func (storage *Storage) ExecuteAllMetricsTemplate(writer io.Writer, records []*storage.Record) error {
 	template, err := storage.getTemplate("get_all_metrics")
 	if err != nil {
 		return err
 	}
 
-	return template.Execute(writer, metrics)
+	return template.Execute(writer, records)
 }
 
 func (storage *Storage) getTemplate(name string) (*template.Template, error) {
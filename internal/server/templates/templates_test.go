@@ -4,20 +4,21 @@ import (
 	"bytes"
 	"errors"
 	"io"
+	"strings"
 	"testing"
+	"time"
 
-	"github.com/m1khal3v/gometheus/internal/common/metric"
 	"github.com/m1khal3v/gometheus/internal/common/metric/kind/counter"
 	"github.com/m1khal3v/gometheus/internal/common/metric/kind/gauge"
+	"github.com/m1khal3v/gometheus/internal/server/storage"
 )
 
-func generateMetrics() <-chan metric.Metric {
-	ch := make(chan metric.Metric, 3)
-	ch <- gauge.New("metric1", 10)
-	ch <- counter.New("metric2", 20)
-	ch <- gauge.New("metric3", 30)
-	close(ch)
-	return ch
+func generateRecords() []*storage.Record {
+	return []*storage.Record{
+		{Metric: gauge.New("metric1", 10), UpdatedAt: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)},
+		{Metric: counter.New("metric2", 20), UpdatedAt: time.Date(2024, 5, 1, 12, 31, 0, 0, time.UTC)},
+		{Metric: gauge.New("metric3", 30)},
+	}
 }
 
 func TestStorage_getTemplate(t *testing.T) {
@@ -41,12 +42,12 @@ func TestStorage_getTemplate(t *testing.T) {
 func TestStorage_ExecuteAllMetricsTemplate(t *testing.T) {
 	storage := New()
 
-	metrics := generateMetrics()
+	records := generateRecords()
 
 	var buf bytes.Buffer
 	writer := io.Writer(&buf)
 
-	err := storage.ExecuteAllMetricsTemplate(writer, metrics)
+	err := storage.ExecuteAllMetricsTemplate(writer, records)
 	if err != nil {
 		t.Fatalf("expected no error, but got: %v", err)
 	}
@@ -54,6 +55,12 @@ func TestStorage_ExecuteAllMetricsTemplate(t *testing.T) {
 	if buf.Len() == 0 {
 		t.Fatal("expected non-empty output, but got empty")
 	}
+
+	for _, updated := range []string{"2024-05-01 12:30:00 UTC", "2024-05-01 12:31:00 UTC", "unknown"} {
+		if !strings.Contains(buf.String(), updated) {
+			t.Fatalf("expected update time %q in output", updated)
+		}
+	}
 }
 
 func TestStorage_ExecuteAllMetricsTemplate_Errors(t *testing.T) {
@@ -61,8 +68,8 @@ func TestStorage_ExecuteAllMetricsTemplate_Errors(t *testing.T) {
 
 	mockWriter := &failingWriter{}
 
-	metrics := generateMetrics()
-	err := storage.ExecuteAllMetricsTemplate(mockWriter, metrics)
+	records := generateRecords()
+	err := storage.ExecuteAllMetricsTemplate(mockWriter, records)
 	if err == nil {
 		t.Fatal("expected an error, but got nil")
 	}
@@ -0,0 +1,52 @@
+package generator
+
+import (
+	"context"
+	"iter"
+)
+
+// NewSeq2FromFunction returns iterator over generated values with error propagation
+func NewSeq2FromFunction[T any](generate func() (T, bool, error), release func()) iter.Seq2[T, error] {
+	return NewSeq2FromFunctionWithContext[T](context.Background(), generate, release)
+}
+
+// NewSeq2FromFunctionWithContext returns single-use iterator over generated values.
+// Iteration is stopped after first error of generate or context, error is yielded as last pair.
+// Values are generated in consumer goroutine, so nothing is leaked if consumer stops iteration.
+// release (if not nil) is called once iteration is finished for any reason
+func NewSeq2FromFunctionWithContext[T any](
+	ctx context.Context,
+	generate func() (T, bool, error),
+	release func(),
+) iter.Seq2[T, error] {
+	if generate == nil {
+		panic("generate function cannot be nil")
+	}
+
+	return func(yield func(T, error) bool) {
+		if release != nil {
+			defer release()
+		}
+
+		for {
+			var zero T
+			if err := ctx.Err(); err != nil {
+				yield(zero, err)
+				return
+			}
+
+			value, ok, err := generate()
+			if err != nil {
+				yield(zero, err)
+				return
+			}
+			if !ok {
+				return
+			}
+
+			if !yield(value, nil) {
+				return
+			}
+		}
+	}
+}
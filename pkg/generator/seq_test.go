@@ -0,0 +1,92 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSeq2FromFunctionWithContext(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name      string
+		failAt    int
+		breakAt   int
+		cancelAt  int
+		wantItems []int
+		wantErr   error
+	}{
+		{
+			name:      "all items",
+			wantItems: []int{1, 2, 3, 4, 5},
+		},
+		{
+			name:      "generate error",
+			failAt:    3,
+			wantItems: []int{1, 2},
+			wantErr:   failed,
+		},
+		{
+			name:      "context cancelled",
+			cancelAt:  2,
+			wantItems: []int{1, 2},
+			wantErr:   context.Canceled,
+		},
+		{
+			name:      "consumer break",
+			breakAt:   2,
+			wantItems: []int{1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			i := 0
+			generate := func() (int, bool, error) {
+				if i == tt.failAt-1 {
+					return 0, false, failed
+				}
+				if i == 5 {
+					return 0, false, nil
+				}
+				i++
+
+				return i, true, nil
+			}
+			released := 0
+			release := func() {
+				released++
+			}
+
+			items := make([]int, 0)
+			var err error
+			for item, itemErr := range NewSeq2FromFunctionWithContext(ctx, generate, release) {
+				if itemErr != nil {
+					err = itemErr
+					break
+				}
+				items = append(items, item)
+				if len(items) == tt.cancelAt {
+					cancel()
+				}
+				if len(items) == tt.breakAt {
+					break
+				}
+			}
+
+			assert.Equal(t, tt.wantItems, items)
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, 1, released)
+		})
+	}
+}
+
+func TestNewSeq2FromFunction(t *testing.T) {
+	assert.PanicsWithValue(t, "generate function cannot be nil", func() {
+		NewSeq2FromFunction[int](nil, nil)
+	})
+}
@@ -4,6 +4,7 @@ package mutex
 
 import (
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -12,7 +13,7 @@ const deleteFrequency = time.Minute
 
 type mutexItem struct {
 	mutex      *sync.Mutex
-	lastAccess time.Time
+	lastAccess *atomic.Int64 // unix nano, updated concurrently by lockers
 }
 
 type NamedMutex struct {
@@ -33,7 +34,7 @@ func NewNamedMutex() *NamedMutex {
 					panic("invalid mutex item")
 				}
 
-				if now.After(item.lastAccess.Add(ttl)) && item.mutex.TryLock() {
+				if now.After(time.Unix(0, item.lastAccess.Load()).Add(ttl)) && item.mutex.TryLock() {
 					namedMutex.mutexMap.Delete(key)
 					item.mutex.Unlock()
 				}
@@ -47,9 +48,11 @@ func NewNamedMutex() *NamedMutex {
 
 func (namedMutex *NamedMutex) createOrGetLock(name string) *sync.Mutex {
 	now := time.Now()
+	lastAccess := &atomic.Int64{}
+	lastAccess.Store(now.UnixNano())
 	actual, exists := namedMutex.mutexMap.LoadOrStore(name, &mutexItem{
 		mutex:      &sync.Mutex{},
-		lastAccess: now,
+		lastAccess: lastAccess,
 	})
 
 	item, ok := actual.(*mutexItem)
@@ -58,7 +61,7 @@ func (namedMutex *NamedMutex) createOrGetLock(name string) *sync.Mutex {
 	}
 
 	if exists {
-		item.lastAccess = now
+		item.lastAccess.Store(now.UnixNano())
 	}
 
 	return item.mutex
@@ -246,6 +246,258 @@ func (x *SaveMetricsBatchResponse) GetMetrics() []*SaveMetricResponse {
 	return nil
 }
 
+type DeleteMetricRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MetricName    string                 `protobuf:"bytes,1,opt,name=metric_name,json=metricName,proto3" json:"metric_name,omitempty"`
+	MetricType    string                 `protobuf:"bytes,2,opt,name=metric_type,json=metricType,proto3" json:"metric_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteMetricRequest) Reset() {
+	*x = DeleteMetricRequest{}
+	mi := &file_gometheus_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteMetricRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteMetricRequest) ProtoMessage() {}
+
+func (x *DeleteMetricRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gometheus_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteMetricRequest.ProtoReflect.Descriptor instead.
+func (*DeleteMetricRequest) Descriptor() ([]byte, []int) {
+	return file_gometheus_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *DeleteMetricRequest) GetMetricName() string {
+	if x != nil {
+		return x.MetricName
+	}
+	return ""
+}
+
+func (x *DeleteMetricRequest) GetMetricType() string {
+	if x != nil {
+		return x.MetricType
+	}
+	return ""
+}
+
+type DeleteMetricResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	MetricName    string                 `protobuf:"bytes,1,opt,name=metric_name,json=metricName,proto3" json:"metric_name,omitempty"`
+	MetricType    string                 `protobuf:"bytes,2,opt,name=metric_type,json=metricType,proto3" json:"metric_type,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteMetricResponse) Reset() {
+	*x = DeleteMetricResponse{}
+	mi := &file_gometheus_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteMetricResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteMetricResponse) ProtoMessage() {}
+
+func (x *DeleteMetricResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_gometheus_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteMetricResponse.ProtoReflect.Descriptor instead.
+func (*DeleteMetricResponse) Descriptor() ([]byte, []int) {
+	return file_gometheus_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *DeleteMetricResponse) GetMetricName() string {
+	if x != nil {
+		return x.MetricName
+	}
+	return ""
+}
+
+func (x *DeleteMetricResponse) GetMetricType() string {
+	if x != nil {
+		return x.MetricType
+	}
+	return ""
+}
+
+type WatchRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// names and prefixes select metrics, all metrics are selected if both are empty
+	Names    []string `protobuf:"bytes,1,rep,name=names,proto3" json:"names,omitempty"`
+	Prefixes []string `protobuf:"bytes,2,rep,name=prefixes,proto3" json:"prefixes,omitempty"`
+	// revision of the last received metric to resume from, zero requests snapshot
+	Revision      uint64 `protobuf:"varint,3,opt,name=revision,proto3" json:"revision,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *WatchRequest) Reset() {
+	*x = WatchRequest{}
+	mi := &file_gometheus_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *WatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*WatchRequest) ProtoMessage() {}
+
+func (x *WatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_gometheus_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use WatchRequest.ProtoReflect.Descriptor instead.
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return file_gometheus_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *WatchRequest) GetNames() []string {
+	if x != nil {
+		return x.Names
+	}
+	return nil
+}
+
+func (x *WatchRequest) GetPrefixes() []string {
+	if x != nil {
+		return x.Prefixes
+	}
+	return nil
+}
+
+func (x *WatchRequest) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+type Metric struct {
+	state      protoimpl.MessageState  `protogen:"open.v1"`
+	MetricName string                  `protobuf:"bytes,1,opt,name=metric_name,json=metricName,proto3" json:"metric_name,omitempty"`
+	MetricType string                  `protobuf:"bytes,2,opt,name=metric_type,json=metricType,proto3" json:"metric_type,omitempty"`
+	Delta      *wrapperspb.Int64Value  `protobuf:"bytes,3,opt,name=delta,proto3" json:"delta,omitempty"`
+	Value      *wrapperspb.DoubleValue `protobuf:"bytes,4,opt,name=value,proto3" json:"value,omitempty"`
+	// revision of the last save or delete of metric in server storage
+	Revision uint64 `protobuf:"varint,5,opt,name=revision,proto3" json:"revision,omitempty"`
+	// deleted is set by Watch for deleted metric, value is the last value of metric
+	Deleted       bool `protobuf:"varint,6,opt,name=deleted,proto3" json:"deleted,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Metric) Reset() {
+	*x = Metric{}
+	mi := &file_gometheus_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Metric) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Metric) ProtoMessage() {}
+
+func (x *Metric) ProtoReflect() protoreflect.Message {
+	mi := &file_gometheus_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Metric.ProtoReflect.Descriptor instead.
+func (*Metric) Descriptor() ([]byte, []int) {
+	return file_gometheus_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Metric) GetMetricName() string {
+	if x != nil {
+		return x.MetricName
+	}
+	return ""
+}
+
+func (x *Metric) GetMetricType() string {
+	if x != nil {
+		return x.MetricType
+	}
+	return ""
+}
+
+func (x *Metric) GetDelta() *wrapperspb.Int64Value {
+	if x != nil {
+		return x.Delta
+	}
+	return nil
+}
+
+func (x *Metric) GetValue() *wrapperspb.DoubleValue {
+	if x != nil {
+		return x.Value
+	}
+	return nil
+}
+
+func (x *Metric) GetRevision() uint64 {
+	if x != nil {
+		return x.Revision
+	}
+	return 0
+}
+
+func (x *Metric) GetDeleted() bool {
+	if x != nil {
+		return x.Deleted
+	}
+	return false
+}
+
 type APIError struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Code          int32                  `protobuf:"varint,1,opt,name=code,proto3" json:"code,omitempty"`
@@ -257,7 +509,7 @@ type APIError struct {
 
 func (x *APIError) Reset() {
 	*x = APIError{}
-	mi := &file_gometheus_proto_msgTypes[4]
+	mi := &file_gometheus_proto_msgTypes[8]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -269,7 +521,7 @@ func (x *APIError) String() string {
 func (*APIError) ProtoMessage() {}
 
 func (x *APIError) ProtoReflect() protoreflect.Message {
-	mi := &file_gometheus_proto_msgTypes[4]
+	mi := &file_gometheus_proto_msgTypes[8]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -282,7 +534,7 @@ func (x *APIError) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use APIError.ProtoReflect.Descriptor instead.
 func (*APIError) Descriptor() ([]byte, []int) {
-	return file_gometheus_proto_rawDescGZIP(), []int{4}
+	return file_gometheus_proto_rawDescGZIP(), []int{8}
 }
 
 func (x *APIError) GetCode() int32 {
@@ -328,15 +580,40 @@ const file_gometheus_proto_rawDesc = "" +
 	"\x17SaveMetricsBatchRequest\x126\n" +
 	"\ametrics\x18\x01 \x03(\v2\x1c.gometheus.SaveMetricRequestR\ametrics\"S\n" +
 	"\x18SaveMetricsBatchResponse\x127\n" +
-	"\ametrics\x18\x01 \x03(\v2\x1d.gometheus.SaveMetricResponseR\ametrics\"R\n" +
+	"\ametrics\x18\x01 \x03(\v2\x1d.gometheus.SaveMetricResponseR\ametrics\"W\n" +
+	"\x13DeleteMetricRequest\x12\x1f\n" +
+	"\vmetric_name\x18\x01 \x01(\tR\n" +
+	"metricName\x12\x1f\n" +
+	"\vmetric_type\x18\x02 \x01(\tR\n" +
+	"metricType\"X\n" +
+	"\x14DeleteMetricResponse\x12\x1f\n" +
+	"\vmetric_name\x18\x01 \x01(\tR\n" +
+	"metricName\x12\x1f\n" +
+	"\vmetric_type\x18\x02 \x01(\tR\n" +
+	"metricType\"\\\n" +
+	"\fWatchRequest\x12\x14\n" +
+	"\x05names\x18\x01 \x03(\tR\x05names\x12\x1a\n" +
+	"\bprefixes\x18\x02 \x03(\tR\bprefixes\x12\x1a\n" +
+	"\brevision\x18\x03 \x01(\x04R\brevision\"\xe7\x01\n" +
+	"\x06Metric\x12\x1f\n" +
+	"\vmetric_name\x18\x01 \x01(\tR\n" +
+	"metricName\x12\x1f\n" +
+	"\vmetric_type\x18\x02 \x01(\tR\n" +
+	"metricType\x121\n" +
+	"\x05delta\x18\x03 \x01(\v2\x1b.google.protobuf.Int64ValueR\x05delta\x122\n" +
+	"\x05value\x18\x04 \x01(\v2\x1c.google.protobuf.DoubleValueR\x05value\x12\x1a\n" +
+	"\brevision\x18\x05 \x01(\x04R\brevision\x12\x18\n" +
+	"\adeleted\x18\x06 \x01(\bR\adeleted\"R\n" +
 	"\bAPIError\x12\x12\n" +
 	"\x04code\x18\x01 \x01(\x05R\x04code\x12\x18\n" +
 	"\amessage\x18\x02 \x01(\tR\amessage\x12\x18\n" +
-	"\adetails\x18\x03 \x03(\tR\adetails2\xb3\x01\n" +
+	"\adetails\x18\x03 \x03(\tR\adetails2\xbb\x02\n" +
 	"\x0eMetricsService\x12I\n" +
 	"\n" +
 	"SaveMetric\x12\x1c.gometheus.SaveMetricRequest\x1a\x1d.gometheus.SaveMetricResponse\x12V\n" +
-	"\vSaveMetrics\x12\".gometheus.SaveMetricsBatchRequest\x1a#.gometheus.SaveMetricsBatchResponseB)Z'github.com/m1khalev/gometheus/pkg/protob\x06proto3"
+	"\vSaveMetrics\x12\".gometheus.SaveMetricsBatchRequest\x1a#.gometheus.SaveMetricsBatchResponse\x12O\n" +
+	"\fDeleteMetric\x12\x1e.gometheus.DeleteMetricRequest\x1a\x1f.gometheus.DeleteMetricResponse\x125\n" +
+	"\x05Watch\x12\x17.gometheus.WatchRequest\x1a\x11.gometheus.Metric0\x01B)Z'github.com/m1khalev/gometheus/pkg/protob\x06proto3"
 
 var (
 	file_gometheus_proto_rawDescOnce sync.Once
@@ -350,32 +627,42 @@ func file_gometheus_proto_rawDescGZIP() []byte {
 	return file_gometheus_proto_rawDescData
 }
 
-var file_gometheus_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_gometheus_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
 var file_gometheus_proto_goTypes = []any{
 	(*SaveMetricRequest)(nil),        // 0: gometheus.SaveMetricRequest
 	(*SaveMetricResponse)(nil),       // 1: gometheus.SaveMetricResponse
 	(*SaveMetricsBatchRequest)(nil),  // 2: gometheus.SaveMetricsBatchRequest
 	(*SaveMetricsBatchResponse)(nil), // 3: gometheus.SaveMetricsBatchResponse
-	(*APIError)(nil),                 // 4: gometheus.APIError
-	(*wrapperspb.Int64Value)(nil),    // 5: google.protobuf.Int64Value
-	(*wrapperspb.DoubleValue)(nil),   // 6: google.protobuf.DoubleValue
+	(*DeleteMetricRequest)(nil),      // 4: gometheus.DeleteMetricRequest
+	(*DeleteMetricResponse)(nil),     // 5: gometheus.DeleteMetricResponse
+	(*WatchRequest)(nil),             // 6: gometheus.WatchRequest
+	(*Metric)(nil),                   // 7: gometheus.Metric
+	(*APIError)(nil),                 // 8: gometheus.APIError
+	(*wrapperspb.Int64Value)(nil),    // 9: google.protobuf.Int64Value
+	(*wrapperspb.DoubleValue)(nil),   // 10: google.protobuf.DoubleValue
 }
 var file_gometheus_proto_depIdxs = []int32{
-	5, // 0: gometheus.SaveMetricRequest.delta:type_name -> google.protobuf.Int64Value
-	6, // 1: gometheus.SaveMetricRequest.value:type_name -> google.protobuf.DoubleValue
-	5, // 2: gometheus.SaveMetricResponse.delta:type_name -> google.protobuf.Int64Value
-	6, // 3: gometheus.SaveMetricResponse.value:type_name -> google.protobuf.DoubleValue
-	0, // 4: gometheus.SaveMetricsBatchRequest.metrics:type_name -> gometheus.SaveMetricRequest
-	1, // 5: gometheus.SaveMetricsBatchResponse.metrics:type_name -> gometheus.SaveMetricResponse
-	0, // 6: gometheus.MetricsService.SaveMetric:input_type -> gometheus.SaveMetricRequest
-	2, // 7: gometheus.MetricsService.SaveMetrics:input_type -> gometheus.SaveMetricsBatchRequest
-	1, // 8: gometheus.MetricsService.SaveMetric:output_type -> gometheus.SaveMetricResponse
-	3, // 9: gometheus.MetricsService.SaveMetrics:output_type -> gometheus.SaveMetricsBatchResponse
-	8, // [8:10] is the sub-list for method output_type
-	6, // [6:8] is the sub-list for method input_type
-	6, // [6:6] is the sub-list for extension type_name
-	6, // [6:6] is the sub-list for extension extendee
-	0, // [0:6] is the sub-list for field type_name
+	9,  // 0: gometheus.SaveMetricRequest.delta:type_name -> google.protobuf.Int64Value
+	10, // 1: gometheus.SaveMetricRequest.value:type_name -> google.protobuf.DoubleValue
+	9,  // 2: gometheus.SaveMetricResponse.delta:type_name -> google.protobuf.Int64Value
+	10, // 3: gometheus.SaveMetricResponse.value:type_name -> google.protobuf.DoubleValue
+	0,  // 4: gometheus.SaveMetricsBatchRequest.metrics:type_name -> gometheus.SaveMetricRequest
+	1,  // 5: gometheus.SaveMetricsBatchResponse.metrics:type_name -> gometheus.SaveMetricResponse
+	9,  // 6: gometheus.Metric.delta:type_name -> google.protobuf.Int64Value
+	10, // 7: gometheus.Metric.value:type_name -> google.protobuf.DoubleValue
+	0,  // 8: gometheus.MetricsService.SaveMetric:input_type -> gometheus.SaveMetricRequest
+	2,  // 9: gometheus.MetricsService.SaveMetrics:input_type -> gometheus.SaveMetricsBatchRequest
+	4,  // 10: gometheus.MetricsService.DeleteMetric:input_type -> gometheus.DeleteMetricRequest
+	6,  // 11: gometheus.MetricsService.Watch:input_type -> gometheus.WatchRequest
+	1,  // 12: gometheus.MetricsService.SaveMetric:output_type -> gometheus.SaveMetricResponse
+	3,  // 13: gometheus.MetricsService.SaveMetrics:output_type -> gometheus.SaveMetricsBatchResponse
+	5,  // 14: gometheus.MetricsService.DeleteMetric:output_type -> gometheus.DeleteMetricResponse
+	7,  // 15: gometheus.MetricsService.Watch:output_type -> gometheus.Metric
+	12, // [12:16] is the sub-list for method output_type
+	8,  // [8:12] is the sub-list for method input_type
+	8,  // [8:8] is the sub-list for extension type_name
+	8,  // [8:8] is the sub-list for extension extendee
+	0,  // [0:8] is the sub-list for field type_name
 }
 
 func init() { file_gometheus_proto_init() }
@@ -389,7 +676,7 @@ func file_gometheus_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_gometheus_proto_rawDesc), len(file_gometheus_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   9,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
@@ -19,8 +19,10 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	MetricsService_SaveMetric_FullMethodName  = "/gometheus.MetricsService/SaveMetric"
-	MetricsService_SaveMetrics_FullMethodName = "/gometheus.MetricsService/SaveMetrics"
+	MetricsService_SaveMetric_FullMethodName   = "/gometheus.MetricsService/SaveMetric"
+	MetricsService_SaveMetrics_FullMethodName  = "/gometheus.MetricsService/SaveMetrics"
+	MetricsService_DeleteMetric_FullMethodName = "/gometheus.MetricsService/DeleteMetric"
+	MetricsService_Watch_FullMethodName        = "/gometheus.MetricsService/Watch"
 )
 
 // MetricsServiceClient is the client API for MetricsService service.
@@ -29,6 +31,14 @@ const (
 type MetricsServiceClient interface {
 	SaveMetric(ctx context.Context, in *SaveMetricRequest, opts ...grpc.CallOption) (*SaveMetricResponse, error)
 	SaveMetrics(ctx context.Context, in *SaveMetricsBatchRequest, opts ...grpc.CallOption) (*SaveMetricsBatchResponse, error)
+	// DeleteMetric requires admin token in "authorization" metadata
+	DeleteMetric(ctx context.Context, in *DeleteMetricRequest, opts ...grpc.CallOption) (*DeleteMetricResponse, error)
+	// Watch sends current values of selected metrics and then their changes.
+	// Stream resumed from revision of the last received metric gets changes made after it without snapshot,
+	// unless revision exceeds head revision of server storage.
+	// Storages without change feed (sqlite, bolt) send metrics saved by this server without revisions,
+	// such stream always starts from snapshot
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Metric], error)
 }
 
 type metricsServiceClient struct {
@@ -59,12 +69,49 @@ func (c *metricsServiceClient) SaveMetrics(ctx context.Context, in *SaveMetricsB
 	return out, nil
 }
 
+func (c *metricsServiceClient) DeleteMetric(ctx context.Context, in *DeleteMetricRequest, opts ...grpc.CallOption) (*DeleteMetricResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteMetricResponse)
+	err := c.cc.Invoke(ctx, MetricsService_DeleteMetric_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *metricsServiceClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Metric], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MetricsService_ServiceDesc.Streams[0], MetricsService_Watch_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchRequest, Metric]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_WatchClient = grpc.ServerStreamingClient[Metric]
+
 // MetricsServiceServer is the server API for MetricsService service.
 // All implementations must embed UnimplementedMetricsServiceServer
 // for forward compatibility.
 type MetricsServiceServer interface {
 	SaveMetric(context.Context, *SaveMetricRequest) (*SaveMetricResponse, error)
 	SaveMetrics(context.Context, *SaveMetricsBatchRequest) (*SaveMetricsBatchResponse, error)
+	// DeleteMetric requires admin token in "authorization" metadata
+	DeleteMetric(context.Context, *DeleteMetricRequest) (*DeleteMetricResponse, error)
+	// Watch sends current values of selected metrics and then their changes.
+	// Stream resumed from revision of the last received metric gets changes made after it without snapshot,
+	// unless revision exceeds head revision of server storage.
+	// Storages without change feed (sqlite, bolt) send metrics saved by this server without revisions,
+	// such stream always starts from snapshot
+	Watch(*WatchRequest, grpc.ServerStreamingServer[Metric]) error
 	mustEmbedUnimplementedMetricsServiceServer()
 }
 
@@ -81,6 +128,12 @@ func (UnimplementedMetricsServiceServer) SaveMetric(context.Context, *SaveMetric
 func (UnimplementedMetricsServiceServer) SaveMetrics(context.Context, *SaveMetricsBatchRequest) (*SaveMetricsBatchResponse, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method SaveMetrics not implemented")
 }
+func (UnimplementedMetricsServiceServer) DeleteMetric(context.Context, *DeleteMetricRequest) (*DeleteMetricResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteMetric not implemented")
+}
+func (UnimplementedMetricsServiceServer) Watch(*WatchRequest, grpc.ServerStreamingServer[Metric]) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
 func (UnimplementedMetricsServiceServer) mustEmbedUnimplementedMetricsServiceServer() {}
 func (UnimplementedMetricsServiceServer) testEmbeddedByValue()                        {}
 
@@ -138,6 +191,35 @@ func _MetricsService_SaveMetrics_Handler(srv interface{}, ctx context.Context, d
 	return interceptor(ctx, in, info, handler)
 }
 
+func _MetricsService_DeleteMetric_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteMetricRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MetricsServiceServer).DeleteMetric(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MetricsService_DeleteMetric_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MetricsServiceServer).DeleteMetric(ctx, req.(*DeleteMetricRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MetricsService_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MetricsServiceServer).Watch(m, &grpc.GenericServerStream[WatchRequest, Metric]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MetricsService_WatchServer = grpc.ServerStreamingServer[Metric]
+
 // MetricsService_ServiceDesc is the grpc.ServiceDesc for MetricsService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -153,7 +235,17 @@ var MetricsService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "SaveMetrics",
 			Handler:    _MetricsService_SaveMetrics_Handler,
 		},
+		{
+			MethodName: "DeleteMetric",
+			Handler:    _MetricsService_DeleteMetric_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _MetricsService_Watch_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "gometheus.proto",
 }
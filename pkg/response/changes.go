@@ -0,0 +1,8 @@
+package response
+
+// ChangesResponse contains metrics saved or deleted after requested revision, Revision is head revision
+// which should be requested next time to continue
+type ChangesResponse struct {
+	Revision uint64               `json:"revision"`
+	Metrics  []*GetMetricResponse `json:"metrics"`
+}
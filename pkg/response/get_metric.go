@@ -1,8 +1,14 @@
 package response
 
+import "time"
+
 type GetMetricResponse struct {
-	MetricName string   `json:"id"`
-	MetricType string   `json:"type"`
-	Delta      *int64   `json:"delta,omitempty"`
-	Value      *float64 `json:"value,omitempty"`
+	MetricName string     `json:"id"`
+	MetricType string     `json:"type"`
+	Delta      *int64     `json:"delta,omitempty"`
+	Value      *float64   `json:"value,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+	Revision   uint64     `json:"revision,omitempty"`
+	// Deleted is set in change feed for deleted metric, value is the last value of metric
+	Deleted bool `json:"deleted,omitempty"`
 }
@@ -0,0 +1,7 @@
+package response
+
+// ListMetricsResponse is page of metrics, NextCursor is empty on the last page
+type ListMetricsResponse struct {
+	Metrics    []*GetMetricResponse `json:"metrics"`
+	NextCursor string               `json:"next_cursor,omitempty"`
+}
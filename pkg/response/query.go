@@ -0,0 +1,13 @@
+package response
+
+// QueryResponse is result of query. Value is set for scalar result and Metrics for vector one
+type QueryResponse struct {
+	ResultType string                 `json:"type"`
+	Value      *float64               `json:"value,omitempty"`
+	Metrics    []*QueryMetricResponse `json:"metrics,omitempty"`
+}
+
+type QueryMetricResponse struct {
+	MetricName string  `json:"id"`
+	Value      float64 `json:"value"`
+}
@@ -3,14 +3,33 @@
 package retry
 
 import (
+	"context"
 	"time"
 )
 
+// Hook observes failed attempt which is going to be repeated, attempt is counted from 1
+type Hook func(attempt uint64, err error)
+
 type RetryOptions struct {
 	BaseDelay  time.Duration
 	MaxDelay   time.Duration
 	Attempts   uint64
 	Multiplier uint64
+	Hook       Hook // Hook is optional
+}
+
+type hookKey struct{}
+
+// ContextWithHook returns context carrying hook, so retries of nested calls could be observed by caller
+func ContextWithHook(ctx context.Context, hook Hook) context.Context {
+	return context.WithValue(ctx, hookKey{}, hook)
+}
+
+// HookFromContext returns hook set by ContextWithHook or nil
+func HookFromContext(ctx context.Context) Hook {
+	hook, _ := ctx.Value(hookKey{}).(Hook)
+
+	return hook
 }
 
 // Retry - repeats the function execution a specified number of attempts
@@ -23,6 +42,9 @@ func Retry(
 	var err error
 	for i := uint64(0); i < options.Attempts; i++ {
 		if err = function(); err != nil && (filter == nil || filter(err)) {
+			if options.Hook != nil && i+1 < options.Attempts {
+				options.Hook(i+1, err)
+			}
 			time.Sleep(calculateDelay(options, i))
 
 			continue
@@ -1,6 +1,7 @@
 package retry
 
 import (
+	"context"
 	"errors"
 	"testing"
 	"time"
@@ -211,6 +212,27 @@ func TestRetry(t *testing.T) {
 	}
 }
 
+func TestRetry_hook(t *testing.T) {
+	observed := []uint64{}
+	hook := func(attempt uint64, err error) {
+		assert.EqualError(t, err, "test error")
+		observed = append(observed, attempt)
+	}
+	ctx := ContextWithHook(context.Background(), hook)
+
+	err := Retry(RetryOptions{
+		Attempts: 3,
+		Hook:     HookFromContext(ctx),
+	}, func() error {
+		return errors.New("test error")
+	}, nil)
+
+	assert.Error(t, err)
+	// the last failed attempt is not repeated
+	assert.Equal(t, []uint64{1, 2}, observed)
+	assert.Nil(t, HookFromContext(context.Background()))
+}
+
 func Test_pow_EdgeCases(t *testing.T) {
 	tests := []struct {
 		name string
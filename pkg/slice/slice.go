@@ -2,6 +2,8 @@
 // contains helper functions for slices
 package slice
 
+import "iter"
+
 // Chunk returns a channel over consecutive sub-slices of up to n elements of slice.
 // All but the last sub-slice will have size n.
 // All sub-slices are clipped to have no capacity beyond the length.
@@ -39,3 +41,17 @@ func FromChannel[T any](channel <-chan T) []T {
 
 	return slice
 }
+
+// FromSeq2 collects values of iterator, first error is returned with values collected before it
+func FromSeq2[T any](seq iter.Seq2[T, error]) ([]T, error) {
+	slice := make([]T, 0)
+	for item, err := range seq {
+		if err != nil {
+			return slice, err
+		}
+
+		slice = append(slice, item)
+	}
+
+	return slice, nil
+}
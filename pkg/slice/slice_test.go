@@ -1,6 +1,7 @@
 package slice
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -90,3 +91,49 @@ func TestFromChannel(t *testing.T) {
 		})
 	}
 }
+
+func TestFromSeq2(t *testing.T) {
+	failed := errors.New("failed")
+	tests := []struct {
+		name    string
+		items   []int
+		err     error
+		want    []int
+		wantErr error
+	}{
+		{
+			name:  "without error",
+			items: []int{1, 2, 3},
+			want:  []int{1, 2, 3},
+		},
+		{
+			name:    "with error",
+			items:   []int{1, 2},
+			err:     failed,
+			want:    []int{1, 2},
+			wantErr: failed,
+		},
+		{
+			name: "empty",
+			want: []int{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seq := func(yield func(int, error) bool) {
+				for _, item := range tt.items {
+					if !yield(item, nil) {
+						return
+					}
+				}
+				if tt.err != nil {
+					yield(0, tt.err)
+				}
+			}
+
+			got, err := FromSeq2(seq)
+			assert.Equal(t, tt.want, got)
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}